@@ -0,0 +1,161 @@
+package apiplugin
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/freshwebio/k8s-kong-api/controllerclass"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Client provides typed access to ApiPlugin resources in Kubernetes.
+// It's built on the dynamic client so the type doesn't need to be registered with a scheme.
+type Client struct {
+	dynamic *k8sclient.DynamicClient
+}
+
+// NewClient creates a new instance of an ApiPlugin client.
+func NewClient(k8sClient *k8sclient.Client) *Client {
+	return &Client{dynamic: k8sClient.Resource(Resource)}
+}
+
+// Get retrieves the ApiPlugin resource with the provided namespace and name.
+func (c *Client) Get(ctx context.Context, namespace string, name string) (*ApiPlugin, error) {
+	obj, err := c.dynamic.Get(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(obj)
+}
+
+// List retrieves the ApiPlugin resources in the provided namespace that match the provided label selector.
+func (c *Client) List(ctx context.Context, namespace string, selector labels.Selector) (*ApiPluginList, error) {
+	list, err := c.dynamic.List(ctx, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	plugins := &ApiPluginList{Metadata: list.Metadata, Items: []ApiPlugin{}}
+	for i := range list.Items {
+		plugin, err := fromUnstructured(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		plugins.Items = append(plugins.Items, *plugin)
+	}
+	return plugins, nil
+}
+
+// Watch watches the ApiPlugin resources in the provided namespace that match the provided
+// label selector from the provided resource version.
+func (c *Client) Watch(ctx context.Context, namespace string, selector labels.Selector, resourceVersion string) (watch.Interface, error) {
+	w, err := c.dynamic.Watch(ctx, namespace, selector, resourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(in watch.Event) (watch.Event, bool) {
+		obj, ok := in.Object.(*k8sclient.Unstructured)
+		if !ok {
+			return in, true
+		}
+		plugin, err := fromUnstructured(obj)
+		if err != nil {
+			log.Printf("Skipping the %v ApiPlugin event that could not be decoded: %v", in.Type, err)
+			return in, false
+		}
+		in.Object = plugin
+		return in, true
+	}), nil
+}
+
+// Update replaces the provided ApiPlugin resource.
+func (c *Client) Update(ctx context.Context, p *ApiPlugin) (*ApiPlugin, error) {
+	if p.Kind == "" {
+		p.Kind = "ApiPlugin"
+	}
+	if p.APIVersion == "" {
+		p.APIVersion = Resource.Group + "/" + Resource.Version
+	}
+	obj, err := toUnstructured(p)
+	if err != nil {
+		return nil, err
+	}
+	if obj, err = c.dynamic.Update(ctx, obj); err != nil {
+		return nil, err
+	}
+	return fromUnstructured(obj)
+}
+
+// Patch applies the provided JSON merge patch to the ApiPlugin resource with the provided namespace and name.
+func (c *Client) Patch(ctx context.Context, namespace string, name string, patch []byte) (*ApiPlugin, error) {
+	obj, err := c.dynamic.Patch(ctx, namespace, name, patch)
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(obj)
+}
+
+// PatchStatus sets the status of the ApiPlugin resource with the provided namespace and name
+// to the provided status, ApiPlugin resources don't have a typed status yet so any JSON
+// encodable value can be provided.
+func (c *Client) PatchStatus(ctx context.Context, namespace string, name string, status interface{}) (*ApiPlugin, error) {
+	obj, err := c.dynamic.PatchStatus(ctx, namespace, name, status)
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(obj)
+}
+
+// ListWatch provides the list watch for the ApiPlugin resources in the provided namespace
+// that match the provided label selector and belong to the provided controller class,
+// lists are abandoned and watches stopped once the provided context is done.
+func (c *Client) ListWatch(ctx context.Context, namespace string, selector labels.Selector, class string) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options api.ListOptions) (runtime.Object, error) {
+			list, err := c.List(ctx, namespace, selector)
+			if err != nil {
+				return nil, err
+			}
+			items := list.Items[:0]
+			for _, item := range list.Items {
+				if controllerclass.Matches(item.Metadata.Annotations, class) {
+					items = append(items, item)
+				}
+			}
+			list.Items = items
+			return list, nil
+		},
+		WatchFunc: func(options api.ListOptions) (watch.Interface, error) {
+			w, err := c.Watch(ctx, namespace, selector, options.ResourceVersion)
+			if err != nil {
+				return nil, err
+			}
+			return controllerclass.Filter(w, class), nil
+		},
+	}
+}
+
+func fromUnstructured(obj *k8sclient.Unstructured) (*ApiPlugin, error) {
+	plugin := &ApiPlugin{}
+	if err := obj.Into(plugin); err != nil {
+		return nil, err
+	}
+	return plugin, nil
+}
+
+func toUnstructured(p *ApiPlugin) (*k8sclient.Unstructured, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	obj := &k8sclient.Unstructured{}
+	if err = json.Unmarshal(data, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
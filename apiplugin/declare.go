@@ -0,0 +1,40 @@
+package apiplugin
+
+import (
+	"errors"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+)
+
+// HasSynced lets us know whether the ApiPlugin resource cache has been loaded.
+func (s *Service) HasSynced() bool {
+	if len(s.synced) == 0 {
+		return false
+	}
+	for _, synced := range s.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Declare adds the plugins the cached ApiPlugin resources reconciled by this instance call for
+// to the provided declarative configuration, attached to the kong API objects they select.
+func (s *Service) Declare(cfg *kong.DeclarativeConfig) error {
+	if !s.HasSynced() {
+		return errors.New("The api plugin cache hasn't synced yet")
+	}
+	plugins, err := s.plugins.List()
+	if err != nil {
+		return err
+	}
+	for _, plugin := range plugins {
+		serviceName, exists := plugin.Spec.Selector[s.pluginServiceSelectorLabel]
+		if !exists || !s.reconciles(plugin.Metadata.Namespace) {
+			continue
+		}
+		cfg.AddPlugin(s.names.API(plugin.Metadata.Namespace, serviceName), &kong.Plugin{Name: plugin.Spec.Name, Config: plugin.Spec.Config})
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package apiplugin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/freshwebio/k8s-kong-api/drift"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+)
+
+// Drift compares the plugins the cached ApiPlugin resources reconciled by this instance call for
+// with the plugins attached to the kong API objects they select.
+// Plugins attached to those API objects by anything else aren't counted as the controller doesn't manage them.
+func (s *Service) Drift(ctx context.Context) (*drift.Report, error) {
+	if s.plugins == nil {
+		return nil, errors.New("The api plugin cache hasn't been started yet")
+	}
+	plugins, err := s.plugins.List()
+	if err != nil {
+		return nil, err
+	}
+	report := drift.NewReport("plugin")
+	desired := make(map[string]*kong.Plugin)
+	apiNames := make(map[string]bool)
+	for _, plugin := range plugins {
+		serviceName, exists := plugin.Spec.Selector[s.pluginServiceSelectorLabel]
+		if !exists || !s.reconciles(plugin.Metadata.Namespace) {
+			continue
+		}
+		apiName := s.names.API(plugin.Metadata.Namespace, serviceName)
+		kongPlugin := &kong.Plugin{Name: plugin.Spec.Name, Config: plugin.Spec.Config}
+		key := apiName + "/" + kongPlugin.Name
+		resource := syncerror.ResourceKey("apiplugins", plugin.Metadata.Namespace, plugin.Metadata.Name)
+		if err = report.AddDesired(key, resource, kongPlugin); err != nil {
+			return nil, err
+		}
+		desired[key] = kongPlugin
+		apiNames[apiName] = true
+	}
+	for apiName := range apiNames {
+		if _, err = s.kongClient.GetAPI(ctx, apiName); err != nil {
+			if err == kong.ErrNotFound {
+				// None of the plugins for the API object can be attached yet.
+				continue
+			}
+			return nil, err
+		}
+		attached, err := s.kongClient.ListApiPlugins(ctx, apiName)
+		if err != nil {
+			return nil, err
+		}
+		for _, plugin := range attached.Data {
+			key := apiName + "/" + plugin.Name
+			if want, exists := desired[key]; exists {
+				if err = report.AddActual(key, want, plugin); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return report, nil
+}
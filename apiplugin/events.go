@@ -0,0 +1,30 @@
+package apiplugin
+
+import (
+	"strings"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Records the outcome of a reconcile of the resource with the provided key as a Kubernetes Event
+// on the ApiPlugin resource it was for, reconciles for services are recorded by the GatewayApi controller.
+// Only the key of the resource is known once the reconcile has finished so it's looked up in the
+// informer cache, resources that have gone are forgotten.
+func (s *Service) recordOutcome(resource string, err error) {
+	if s.recorder == nil {
+		return
+	}
+	parts := strings.SplitN(resource, "/", 3)
+	if len(parts) != 3 || parts[0] != "apiplugins" {
+		return
+	}
+	ref := v1.ObjectReference{Kind: "ApiPlugin", APIVersion: Resource.Group + "/" + Resource.Version,
+		Namespace: parts[1], Name: parts[2]}
+	plugin, exists, lookupErr := s.plugins.Get(parts[1], parts[2])
+	if lookupErr != nil || !exists {
+		s.recorder.Forget(ref)
+		return
+	}
+	ref.UID = plugin.Metadata.UID
+	s.recorder.Outcome(ref, err)
+}
@@ -0,0 +1,37 @@
+package apiplugin
+
+import (
+	"context"
+	"github.com/freshwebio/k8s-kong-api/finalizer"
+)
+
+// Lets us know whether the provided ApiPlugin resource has been marked for deletion.
+func terminating(p *ApiPlugin) bool {
+	return p.Metadata.DeletionTimestamp != nil
+}
+
+// Adds our finalizer to the provided ApiPlugin resource so it can't disappear from Kubernetes
+// before its plugin has been removed from kong, even while the controller isn't running.
+// DB-less kong is configured from the resources that exist so it has nothing to clean up.
+func (s *Service) ensureFinalizer(ctx context.Context, p *ApiPlugin) error {
+	if s.dbless || terminating(p) {
+		return nil
+	}
+	return finalizer.Add(ctx, s.k8sClient.Resource(Resource), p.Metadata.Namespace, p.Metadata.Name,
+		p.Metadata.ResourceVersion, p.Metadata.Finalizers)
+}
+
+// Removes the plugin of the provided ApiPlugin resource that has been marked for deletion from kong
+// and then removes our finalizer so Kubernetes can go on to delete the resource.
+func (s *Service) finalizePlugin(ctx context.Context, p ApiPlugin) error {
+	if !finalizer.Has(p.Metadata.Finalizers) {
+		return nil
+	}
+	if !s.dbless {
+		if err := s.detachPluginFromService(ctx, p); err != nil {
+			return err
+		}
+	}
+	return finalizer.Remove(ctx, s.k8sClient.Resource(Resource), p.Metadata.Namespace, p.Metadata.Name,
+		p.Metadata.ResourceVersion, p.Metadata.Finalizers)
+}
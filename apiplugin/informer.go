@@ -0,0 +1,100 @@
+package apiplugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Provides the index of the ApiPlugin informer cache keyed by the namespace
+// and name of the service the plugins are attached to.
+const serviceIndex = "service"
+
+// NewInformer creates a shared informer caching the ApiPlugin resources in the provided namespaces
+// that match the provided label selector and belong to the provided controller class. The cache is indexed by namespace and by the service
+// each plugin selects with the provided service selector label.
+// Lists are abandoned and watches stopped once the provided context is done.
+func NewInformer(ctx context.Context, client *Client, namespaces []string, selector labels.Selector,
+	class string, serviceSelectorLabel string) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		k8sclient.NamespacesListWatch(namespaces, func(namespace string) *cache.ListWatch {
+			return client.ListWatch(ctx, namespace, selector, class)
+		}), &ApiPlugin{}, 0,
+		cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+			serviceIndex: func(obj interface{}) ([]string, error) {
+				plugin, ok := obj.(*ApiPlugin)
+				if !ok {
+					return nil, fmt.Errorf("could not convert %v (%T) into ApiPlugin", obj, obj)
+				}
+				service, selected := plugin.Spec.Selector[serviceSelectorLabel]
+				if !selected {
+					return []string{}, nil
+				}
+				return []string{plugin.Metadata.Namespace + "/" + service}, nil
+			},
+		})
+}
+
+// Lister provides typed reads of the ApiPlugin resources in an informer cache.
+type Lister struct {
+	indexer cache.Indexer
+}
+
+// NewLister creates a lister reading from the provided informer cache.
+func NewLister(indexer cache.Indexer) *Lister {
+	return &Lister{indexer: indexer}
+}
+
+// List provides every ApiPlugin resource in the cache.
+func (l *Lister) List() ([]*ApiPlugin, error) {
+	return plugins(l.indexer.List())
+}
+
+// ListNamespace provides the ApiPlugin resources in the cache for the provided namespace.
+func (l *Lister) ListNamespace(namespace string) ([]*ApiPlugin, error) {
+	objs, err := l.indexer.ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return plugins(objs)
+}
+
+// ListService provides the ApiPlugin resources in the cache attached to the service
+// with the provided namespace and name.
+func (l *Lister) ListService(namespace string, service string) ([]*ApiPlugin, error) {
+	objs, err := l.indexer.ByIndex(serviceIndex, namespace+"/"+service)
+	if err != nil {
+		return nil, err
+	}
+	return plugins(objs)
+}
+
+// Get provides the ApiPlugin resource in the cache with the provided namespace and name,
+// lets us know whether it exists.
+func (l *Lister) Get(namespace string, name string) (*ApiPlugin, bool, error) {
+	obj, exists, err := l.indexer.GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	plugin, ok := obj.(*ApiPlugin)
+	if !ok {
+		return nil, false, fmt.Errorf("could not convert %v (%T) into ApiPlugin", obj, obj)
+	}
+	return plugin, true, nil
+}
+
+func plugins(objs []interface{}) ([]*ApiPlugin, error) {
+	items := make([]*ApiPlugin, 0, len(objs))
+	for _, obj := range objs {
+		plugin, ok := obj.(*ApiPlugin)
+		if !ok {
+			return nil, fmt.Errorf("could not convert %v (%T) into ApiPlugin", obj, obj)
+		}
+		items = append(items, plugin)
+	}
+	return items, nil
+}
@@ -0,0 +1,119 @@
+package apiplugin
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/freshwebio/k8s-kong-api/checksum"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Queues the provided ApiPlugin resource to be reconciled, resources in namespaces
+// outside of our shard or that haven't been onboarded are left alone.
+func (s *Service) queuePlugin(p *ApiPlugin) {
+	namespace, apiName := p.Metadata.Namespace, p.Spec.Selector[s.pluginServiceSelectorLabel]
+	if !s.reconciles(namespace) {
+		return
+	}
+	if s.verbose {
+		log.Printf("Queueing a reconcile for the %v plugin of the %v kong API in the %v namespace", p.Spec.Name, apiName, namespace)
+	}
+	s.queue.Add(namespace, limiterKey(namespace, apiName), syncerror.ResourceKey("apiplugins", namespace, p.Metadata.Name))
+}
+
+// Queues the provided service to be reconciled so the plugins selecting it are attached to its kong API object.
+func (s *Service) queueService(service *v1.Service) {
+	namespace := service.GetNamespace()
+	if !s.reconciles(namespace) {
+		return
+	}
+	if s.verbose {
+		log.Printf("Queueing a reconcile of the plugins for the %v kong API in the %v namespace", service.GetName(), namespace)
+	}
+	s.queue.Add(namespace, limiterKey(namespace, service.GetName()), syncerror.ResourceKey("services", namespace, service.GetName()))
+}
+
+// Reconciles the resource with the provided key from its latest state, recording the outcome.
+func (s *Service) reconcile(key string) error {
+	ctx, cancel := workqueue.Context(s.ctx, s.reconcileTimeout)
+	defer cancel()
+	err := s.syncResource(ctx, key)
+	s.recordResult(key, "reconcile of "+key, err)
+	return err
+}
+
+// Brings kong in line with the latest state of the resource with the provided key,
+// cleaning up after resources that have been deleted.
+// A reconcile that has been forced by a resync stays forced until it succeeds.
+func (s *Service) syncResource(ctx context.Context, key string) (err error) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 {
+		return nil
+	}
+	forced := s.memory.TakeForced(key)
+	defer func() {
+		if err != nil && forced {
+			s.memory.Force(key)
+		}
+	}()
+	switch parts[0] {
+	case "apiplugins":
+		return s.syncApiPlugin(ctx, key, parts[1], parts[2], forced)
+	case "services":
+		return s.syncService(ctx, parts[1], parts[2])
+	}
+	return nil
+}
+
+// Brings the plugin in kong for the ApiPlugin resource with the provided key, namespace and name
+// in line with its latest state, removing it from kong when the resource has been deleted.
+// With the declarative strategy only forced reconciles write to kong.
+func (s *Service) syncApiPlugin(ctx context.Context, key string, namespace string, name string, forced bool) error {
+	cached, exists, err := s.plugins.Get(namespace, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		deleted, wasDeleted := s.memory.LastDeleted(key)
+		if !wasDeleted {
+			return nil
+		}
+		if !s.dbless {
+			if err = s.detachPluginFromService(ctx, *deleted.(*ApiPlugin)); err != nil {
+				return err
+			}
+		}
+		s.memory.Forget(key)
+		return nil
+	}
+	// The cached copy is never modified as it's shared with the informer.
+	p := *cached
+	if !terminating(&p) && (s.dbless || (s.declarative && !forced)) {
+		return nil
+	}
+	if forced {
+		p.Metadata.Annotations = checksum.Without(p.Metadata.Annotations)
+	}
+	if err = s.syncPlugin(ctx, p); err != nil {
+		return err
+	}
+	s.memory.Synced(key, &p)
+	return nil
+}
+
+// Attaches the plugins selecting the service with the provided namespace and name
+// to its kong API object, services that have been deleted took their plugins with them.
+func (s *Service) syncService(ctx context.Context, namespace string, name string) error {
+	obj, exists, err := s.serviceStore.GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return err
+	}
+	service, ok := obj.(*v1.Service)
+	if !ok {
+		return nil
+	}
+	return s.attachServicePlugins(ctx, *service)
+}
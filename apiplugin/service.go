@@ -1,18 +1,28 @@
 package apiplugin
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"sync"
+	"time"
 
+	"github.com/freshwebio/k8s-kong-api/checksum"
+	"github.com/freshwebio/k8s-kong-api/config"
+	"github.com/freshwebio/k8s-kong-api/dependency"
 	"github.com/freshwebio/k8s-kong-api/k8sclient"
-	"github.com/freshwebio/k8s-kong-api/k8stypes"
 	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/naming"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"github.com/freshwebio/k8s-kong-api/recorder"
+	"github.com/freshwebio/k8s-kong-api/shard"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
 	"k8s.io/client-go/pkg/api/v1"
 	"k8s.io/client-go/pkg/labels"
 	"k8s.io/client-go/pkg/selection"
 	"k8s.io/client-go/pkg/watch"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -20,23 +30,52 @@ import (
 // to events on api plugin resources in k8s
 // and updating the Kong representations accordingly.
 type Service struct {
-	k8sRestClient              *rest.RESTClient
 	k8sClient                  *k8sclient.Client
+	client                     *Client
 	apiLabel                   string
 	pluginServiceSelectorLabel string
-	namespace                  string
-	kongClient                 *kong.Client
+	namespaces                 []string
+	class                      string
+	kongClient                 kong.Interface
+	limiter                    *throttle.Limiter
+	shard                      shard.Shard
+	names                      naming.Scheme
+	verbose                    bool
+	resyncChan                 chan struct{}
+	errors                     *syncerror.Table
+	recorder                   *recorder.Recorder
+	resyncPeriod               time.Duration
+	dependencies               *dependency.Graph
+	onboarding                 *onboarding.Watcher
+	informers                  *k8sclient.InformerFactory
+	queue                      *workqueue.Queue
+	memory                     *workqueue.Memory
+	plugins                    *Lister
+	serviceStore               cache.Store
+	declarative                bool
+	dbless                     bool
+	ctx                        context.Context
+	reconcileTimeout           time.Duration
+	synced                     []func() bool
 }
 
 // NewService creates a new instance of the ApiPlugin service.
-func NewService(k8sRestClient *rest.RESTClient, k8sClient *k8sclient.Client, kong *kong.Client, namespace string,
-	apiLabel string, pluginServiceSelectorLabel string) *Service {
-	return &Service{k8sRestClient: k8sRestClient, k8sClient: k8sClient, kongClient: kong, namespace: namespace,
-		apiLabel: apiLabel, pluginServiceSelectorLabel: pluginServiceSelectorLabel}
+func NewService(k8sClient *k8sclient.Client, kong kong.Interface, cfg *config.Config) *Service {
+	s := &Service{k8sClient: k8sClient, client: NewClient(k8sClient), kongClient: kong, namespaces: cfg.Namespaces,
+		class: cfg.ControllerClass, apiLabel: cfg.APILabel, pluginServiceSelectorLabel: cfg.ServiceSelectorLabel, limiter: cfg.Limiter, shard: cfg.Shard,
+		verbose: cfg.Verbose, resyncChan: make(chan struct{}, 1), errors: cfg.Errors, recorder: cfg.Recorder,
+		resyncPeriod: cfg.ResyncPeriod, dependencies: cfg.Dependencies, names: cfg.Names,
+		onboarding: cfg.Onboarding, informers: cfg.Informers, memory: workqueue.NewMemory(),
+		declarative: cfg.SyncStrategy == config.DeclarativeSync, dbless: cfg.SyncStrategy == config.DBLessSync,
+		ctx: cfg.Context, reconcileTimeout: cfg.ReconcileTimeout}
+	s.queue = workqueue.New("apiplugin", cfg.Limiter, cfg.Retry, s.reconcile)
+	return s
 }
 
 // Start deals with beginning the monitoring process which deals with monitoring
 // events from k8s apiplugin resources as well as services to propogate changes to kong.
+// Events queue the resource they are for to be reconciled from its latest state, reconciles go through
+// the shared limiter so each namespace is bound to its own concurrency and kong write limits.
 // This method should be called asynchronously in it's own goroutine.
 func (s *Service) Start(doneChan <-chan struct{}, wg *sync.WaitGroup) {
 	log.Println("Starting the plugin watcher service")
@@ -47,67 +86,144 @@ func (s *Service) Start(doneChan <-chan struct{}, wg *sync.WaitGroup) {
 		log.Fatal(err)
 	}
 	selector = selector.Add(*req)
-	serviceEvents := s.monitorServiceEvents(s.namespace, selector, doneChan)
-	pluginEvents := s.monitorPluginEvents(s.namespace, labels.NewSelector(), doneChan)
+	s.monitorServiceEvents(selector)
+	s.monitorPluginEvents(s.namespaces, labels.NewSelector(), doneChan)
+	var resyncTicks <-chan time.Time
+	if s.resyncPeriod > 0 && !s.dbless {
+		ticker := time.NewTicker(s.resyncPeriod)
+		defer ticker.Stop()
+		resyncTicks = ticker.C
+	}
 	for {
 		select {
-		case event := <-pluginEvents:
-			err := s.processPluginEvent(event)
-			if err != nil {
-				log.Printf("Error while processing plugin event: %v", err)
+		case <-s.resyncChan:
+			if s.dbless {
+				continue
 			}
-		case event := <-serviceEvents:
-			err := s.processServiceEvent(event)
-			if err != nil {
-				log.Printf("Error while processing service event: %v", err)
+			s.resyncAll(0, true, doneChan)
+		case <-resyncTicks:
+			if s.declarative {
+				// The complete desired state is pushed to kong in one go.
+				s.resyncAll(0, true, doneChan)
+				continue
 			}
+			// Periodic resyncs are spread over the resync period so every object isn't reconciled on the same tick.
+			s.resyncAll(s.resyncPeriod, false, doneChan)
 		case <-doneChan:
+			s.queue.ShutDown()
 			wg.Done()
 			log.Println("Stopped api plugin event watcher.")
+			return
 		}
 	}
 }
 
-// Handles processing the service events we are interested in for the sake
-// of our plugins.
-func (s *Service) processServiceEvent(e k8stypes.ServiceEvent) error {
-	switch e.Type {
-	case "ADDED", "MODIFIED":
-		err := s.attachServicePlugins(e.Object)
-		if err != nil {
-			return err
+// Resync triggers a full reconciliation of every ApiPlugin resource so the plugins
+// in kong converge on the state in k8s straight away, e.g. after manual changes to kong.
+// Resyncs requested while one is already pending are folded into the pending one.
+func (s *Service) Resync() {
+	select {
+	case s.resyncChan <- struct{}{}:
+	default:
+	}
+}
+
+// Queues a reconcile for every ApiPlugin resource currently in the informer cache,
+// spreading them randomly over the provided window.
+// A forced resync ignores the hash of the last applied payload so kong is written to
+// even for unchanged resources, this is what undoes manual changes made to kong.
+func (s *Service) resyncAll(spread time.Duration, force bool, done <-chan struct{}) {
+	log.Println("Resyncing all api plugin resources")
+	plugins, err := s.plugins.List()
+	if err != nil {
+		log.Printf("Error listing the cached api plugin resources for the resync: %v", err)
+	}
+	for _, plugin := range plugins {
+		p := plugin
+		if force {
+			s.memory.Force(syncerror.ResourceKey("apiplugins", p.Metadata.Namespace, p.Metadata.Name))
 		}
+		throttle.Spread(spread, done, func() {
+			s.queuePlugin(p)
+		})
 	}
-	return nil
+}
+
+// Brings the plugin in kong fully in line with the provided ApiPlugin resource.
+// Attaching only adds missing plugins so it's followed up with an update
+// to bring the config of existing plugins back in line with the resource.
+// Resources that have been marked for deletion are finalized instead.
+func (s *Service) syncPlugin(ctx context.Context, p ApiPlugin) error {
+	if terminating(&p) {
+		return s.finalizePlugin(ctx, p)
+	}
+	if err := s.ensureFinalizer(ctx, &p); err != nil {
+		return err
+	}
+	err := s.attachPluginToService(ctx, p)
+	if err != nil {
+		return err
+	}
+	return s.updatePlugin(ctx, p)
+}
+
+// Defers the reconcile of the provided ApiPlugin resource until the kong API object with the
+// provided name has been created, at which point the resource is queued to be reconciled again.
+func (s *Service) awaitAPI(p ApiPlugin, apiName string) {
+	namespace := p.Metadata.Namespace
+	resource := syncerror.ResourceKey("apiplugins", namespace, p.Metadata.Name)
+	log.Printf("The %v kong API doesn't exist yet, the %v plugin will be attached once it's created", apiName, p.Spec.Name)
+	s.dependencies.AwaitAPI(namespace, apiName, resource, func() {
+		s.queuePlugin(&p)
+	})
+}
+
+// Lets us know whether resources in the provided namespace are reconciled by this instance of the controller.
+func (s *Service) reconciles(namespace string) bool {
+	return s.shard.Owns(namespace) && s.onboarding.Enabled(namespace)
+}
+
+// Logs the outcome of a reconcile of the provided resource and records it in the sync error rates,
+// the error table and the events of the resource.
+func (s *Service) recordResult(resource string, description string, err error) {
+	if err != nil {
+		log.Printf("Error while processing %v: %v", description, err)
+	}
+	metrics.RecordSync("apiplugin", syncerror.Classify(err))
+	s.errors.Record("apiplugin", resource, err)
+	s.recordOutcome(resource, err)
+}
+
+// Provides the key used to make sure reconciles touching the same kong API
+// are never run concurrently.
+func limiterKey(namespace string, apiName string) string {
+	return namespace + "/" + apiName
 }
 
 // Attaches plugins to a service if they aren't already attached.
-func (s *Service) attachServicePlugins(v1s v1.Service) error {
-	// First let's get a list of existing plugins with the provided service selector.
-	selector := labels.NewSelector()
-	req, err := labels.NewRequirement(s.pluginServiceSelectorLabel, selection.Equals, []string{v1s.GetName()})
+func (s *Service) attachServicePlugins(ctx context.Context, v1s v1.Service) error {
+	// First let's get the existing plugins with the provided service selector,
+	// these come from the plugin informer cache so the apiserver isn't hit with a list for every service event.
+	plugins, err := s.plugins.ListService(v1s.GetNamespace(), v1s.GetName())
 	if err != nil {
 		return err
 	}
-	selector = selector.Add(*req)
-	source := k8sclient.NewListWatchFromClient(s.k8sRestClient, "apiplugins", s.namespace, selector)
-	store, _ := cache.NewInformer(source, &ApiPlugin{}, 0, cache.ResourceEventHandlerFuncs{})
-	for _, obj := range store.List() {
-		plugin, ok := obj.(*ApiPlugin)
-		if !ok {
-			return fmt.Errorf("could not convert %v (%T) into ApiPlugin", obj, obj)
-		}
-		// The APIs are saved with the same name as the service.
+	// The APIs are saved with the name of the service, along with its namespace when names are namespaced.
+	apiName := s.names.API(v1s.GetNamespace(), v1s.GetName())
+	for _, plugin := range plugins {
 		kongPlugin := &kong.Plugin{
 			Name:   plugin.Spec.Name,
 			Config: plugin.Spec.Config,
 		}
-		hasPlugin, err := s.kongClient.APIHasPlugin(v1s.GetName(), kongPlugin.Name)
+		hasPlugin, err := s.kongClient.APIHasPlugin(ctx, apiName, kongPlugin.Name)
 		if err != nil {
 			return err
 		}
 		if !hasPlugin {
-			err := s.kongClient.AddPlugin(v1s.GetName(), kongPlugin)
+			if err := s.limiter.WaitWrite(ctx, v1s.GetNamespace()); err != nil {
+				return err
+			}
+			err := s.kongClient.AddPlugin(ctx, apiName, kongPlugin)
 			if err != nil {
 				return err
 			}
@@ -116,36 +232,20 @@ func (s *Service) attachServicePlugins(v1s v1.Service) error {
 	return nil
 }
 
-func (s *Service) processPluginEvent(e Event) error {
-	switch e.Type {
-	case "ADDED":
-		err := s.attachPluginToService(e.Object)
-		if err != nil {
-			return err
-		}
-	case "MODIFIED":
-		err := s.updatePlugin(e.Object)
-		if err != nil {
-			return err
-		}
-	case "DELETED":
-		err := s.detachPluginFromService(e.Object)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 // Simply deals with attaching a plugin to a service given the service
 // has a valid API object in kong and a plugin of the same type doesn't already
 // exist for the service.
-func (s *Service) attachPluginToService(p ApiPlugin) error {
+func (s *Service) attachPluginToService(ctx context.Context, p ApiPlugin) error {
 	// First of all attempt to retrieve the service provided
 	// by the plugin's selector to make sure it exists.
 	if serviceName, exists := p.Spec.Selector[s.pluginServiceSelectorLabel]; exists {
-		_, err := s.kongClient.GetAPI(serviceName)
+		apiName := s.names.API(p.Metadata.Namespace, serviceName)
+		_, err := s.kongClient.GetAPI(ctx, apiName)
 		if err != nil {
+			if err == kong.ErrNotFound {
+				s.awaitAPI(p, serviceName)
+				return nil
+			}
 			return err
 		}
 		// Now let's attach our plugin.
@@ -155,18 +255,27 @@ func (s *Service) attachPluginToService(p ApiPlugin) error {
 		}
 		// For the case where one might define duplicate plugins for a single service
 		// let's ensure the service doesn't already have the provided plugin.
-		hasPlugin, err := s.kongClient.APIHasPlugin(serviceName, kongPlugin.Name)
+		hasPlugin, err := s.kongClient.APIHasPlugin(ctx, apiName, kongPlugin.Name)
 		if err != nil {
 			return err
 		}
 		if !hasPlugin {
-			err := s.kongClient.AddPlugin(serviceName, kongPlugin)
+			hash, err := pluginHash(apiName, kongPlugin)
+			if err != nil {
+				return err
+			}
+			if err := s.limiter.WaitWrite(ctx, p.Metadata.Namespace); err != nil {
+				return err
+			}
+			err = s.kongClient.AddPlugin(ctx, apiName, kongPlugin)
 			if err != nil {
 				return err
 			}
+			s.recordAppliedPlugin(ctx, &p, hash)
+			return nil
 		}
 	} else {
-		return fmt.Errorf("The service selector (%v) was not provided in the plugin",
+		return syncerror.Validationf("The service selector (%v) was not provided in the plugin",
 			s.pluginServiceSelectorLabel)
 	}
 	return nil
@@ -174,115 +283,175 @@ func (s *Service) attachPluginToService(p ApiPlugin) error {
 
 // Deals with updating a plugin for the given service selector
 // if both the service exists and the plugin to be updated is already attached to the service.
-func (s *Service) updatePlugin(p ApiPlugin) error {
+func (s *Service) updatePlugin(ctx context.Context, p ApiPlugin) error {
 	if serviceName, exists := p.Spec.Selector[s.pluginServiceSelectorLabel]; exists {
-		_, err := s.kongClient.GetAPI(serviceName)
-		if err != nil {
-			return err
-		}
 		// Now let's update our plugin.
 		kongPlugin := &kong.Plugin{
 			Name:   p.Spec.Name,
 			Config: p.Spec.Config,
 		}
+		apiName := s.names.API(p.Metadata.Namespace, serviceName)
+		hash, err := pluginHash(apiName, kongPlugin)
+		if err != nil {
+			return err
+		}
+		if checksum.Matches(p.Metadata.Annotations, hash) {
+			// The plugin was last written with exactly this payload so there's nothing to do.
+			return nil
+		}
+		_, err = s.kongClient.GetAPI(ctx, apiName)
+		if err != nil {
+			if err == kong.ErrNotFound {
+				s.awaitAPI(p, serviceName)
+				return nil
+			}
+			return err
+		}
 		// Ensure the plugin exists for the provided service.
-		hasPlugin, err := s.kongClient.APIHasPlugin(serviceName, kongPlugin.Name)
+		current, err := s.attachedPlugin(ctx, apiName, kongPlugin.Name)
 		if err != nil {
 			return err
 		}
-		if hasPlugin {
-			err := s.kongClient.UpdatePlugin(serviceName, kongPlugin)
-			if err != nil {
-				return err
+		if current != nil {
+			if kong.PluginMatches(current, kongPlugin) {
+				// The plugin in kong already has the config of the resource so it's left alone.
+				metrics.KongWritesSkippedTotal.WithLabelValues("plugin").Inc()
+			} else {
+				if err := s.limiter.WaitWrite(ctx, p.Metadata.Namespace); err != nil {
+					return err
+				}
+				err := s.kongClient.UpdatePlugin(ctx, apiName, kongPlugin)
+				if err != nil {
+					return err
+				}
 			}
+			s.recordAppliedPlugin(ctx, &p, hash)
+			return nil
 		}
 	} else {
-		return fmt.Errorf("The service selector (%v) was not provided in the plugin",
+		return syncerror.Validationf("The service selector (%v) was not provided in the plugin",
 			s.pluginServiceSelectorLabel)
 	}
 	return nil
 }
 
+// Provides the plugin with the provided name attached to the kong API with the provided name,
+// nil when the API doesn't have the plugin.
+func (s *Service) attachedPlugin(ctx context.Context, apiName string, pluginName string) (*kong.Plugin, error) {
+	plugins, err := s.kongClient.ListApiPlugins(ctx, apiName)
+	if err != nil {
+		if err == kong.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, plugin := range plugins.Data {
+		if plugin.Name == pluginName {
+			return plugin, nil
+		}
+	}
+	return nil, nil
+}
+
+// Provides the hash of the plugin payload applied to the kong API with the provided name.
+func pluginHash(apiName string, plugin *kong.Plugin) (string, error) {
+	return checksum.Of(struct {
+		API    string       `json:"api"`
+		Plugin *kong.Plugin `json:"plugin"`
+	}{API: apiName, Plugin: plugin})
+}
+
+// Records the provided hash of the plugin payload that has just been applied
+// as an annotation on the provided ApiPlugin resource.
+func (s *Service) recordAppliedPlugin(ctx context.Context, p *ApiPlugin, hash string) {
+	if checksum.Matches(p.Metadata.Annotations, hash) {
+		return
+	}
+	checksum.Record(ctx, s.k8sClient.Resource(Resource), p.Metadata.Namespace, p.Metadata.Name, hash)
+}
+
 // Deals with removing a plugin from an API service in kong.
-func (s *Service) detachPluginFromService(p ApiPlugin) error {
+func (s *Service) detachPluginFromService(ctx context.Context, p ApiPlugin) error {
 	if serviceName, exists := p.Spec.Selector[s.pluginServiceSelectorLabel]; exists {
-		_, err := s.kongClient.GetAPI(serviceName)
+		s.dependencies.Forget(p.Metadata.Namespace, serviceName,
+			syncerror.ResourceKey("apiplugins", p.Metadata.Namespace, p.Metadata.Name))
+		apiName := s.names.API(p.Metadata.Namespace, serviceName)
+		_, err := s.kongClient.GetAPI(ctx, apiName)
 		if err != nil {
+			if err == kong.ErrNotFound {
+				// The plugin went along with the API object so there's nothing left to detach.
+				return nil
+			}
 			return err
 		}
 		// Ensure the plugin exists for the provided service.
-		hasPlugin, err := s.kongClient.APIHasPlugin(serviceName, p.Spec.Name)
+		hasPlugin, err := s.kongClient.APIHasPlugin(ctx, apiName, p.Spec.Name)
 		if err != nil {
 			return err
 		}
 		if hasPlugin {
-			err := s.kongClient.RemovePlugin(serviceName, p.Spec.Name)
+			if err := s.limiter.WaitWrite(ctx, p.Metadata.Namespace); err != nil {
+				return err
+			}
+			err := s.kongClient.RemovePlugin(ctx, apiName, p.Spec.Name)
 			if err != nil {
 				return err
 			}
 		}
 	} else {
-		return fmt.Errorf("The service selector (%v) was not provided in the plugin",
+		return syncerror.Validationf("The service selector (%v) was not provided in the plugin",
 			s.pluginServiceSelectorLabel)
 	}
 	return nil
 }
 
-// Writes service events from k8s to a new channel to be consumed.
-func (s *Service) monitorServiceEvents(namespace string, selector labels.Selector, done <-chan struct{}) <-chan k8stypes.ServiceEvent {
-	events := make(chan k8stypes.ServiceEvent)
+// Queues the services from k8s to be reconciled whenever they are added or change.
+func (s *Service) monitorServiceEvents(selector labels.Selector) {
 	eventCallback := func(evType watch.EventType, obj interface{}) {
 		service, ok := obj.(*v1.Service)
 		if !ok {
 			log.Printf("could not convert %v (%T) into Service", obj, obj)
 			return
 		}
-		events <- k8stypes.ServiceEvent{
-			Type:   string(evType),
-			Object: *service,
-		}
+		metrics.ObserveDelivery("apiplugin", "services", func() {
+			// Plugins go along with the kong API object of a service that's deleted so there's nothing to do for them.
+			if s.dbless || s.declarative || evType == watch.Deleted {
+				return
+			}
+			s.queueService(service)
+		})
 	}
-	source := k8sclient.NewListWatchFromClient(s.k8sClient.Clientset.CoreV1().RESTClient(), "services", namespace, selector)
-	store, ctrl := cache.NewInformer(source, &v1.Service{}, 0, cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			eventCallback(watch.Added, obj)
-		},
-		UpdateFunc: func(old, new interface{}) {
-			eventCallback(watch.Modified, new)
-		},
-		DeleteFunc: func(obj interface{}) {
-			eventCallback(watch.Deleted, obj)
-		},
-	})
-
-	go func() {
-		for _, initObj := range store.List() {
-			eventCallback(watch.Added, initObj)
-		}
-
-		go ctrl.Run(done)
-	}()
-
-	return events
+	// The services are watched along with the GatewayApi controller.
+	watcher := s.informers.Services(selector)
+	s.serviceStore = watcher.Store()
+	watcher.Subscribe(eventCallback)
 }
 
 // Handles watching events occuring for our custom plugin resource.
-// All ApiPlugin resources in the give namespace and selector combination are watched in this case.
-func (s *Service) monitorPluginEvents(namespace string, selector labels.Selector, done <-chan struct{}) <-chan Event {
-	events := make(chan Event)
+// All ApiPlugin resources in the given namespaces and selector combination are watched in this case
+// and queued to be reconciled.
+func (s *Service) monitorPluginEvents(namespaces []string, selector labels.Selector, done <-chan struct{}) {
 	eventCallback := func(evType watch.EventType, obj interface{}) {
 		plugin, ok := obj.(*ApiPlugin)
 		if !ok {
 			log.Printf("could not convert %v (%T) into ApiPlugin", obj, obj)
 			return
 		}
-		events <- Event{
-			Type:   string(evType),
-			Object: *plugin,
-		}
+		metrics.ObserveDelivery("apiplugin", "apiplugins", func() {
+			// Resources marked for deletion are always finalized so they aren't held up by our finalizer.
+			finalizing := evType != watch.Deleted && terminating(plugin)
+			if !finalizing && (s.dbless || (s.declarative && evType != watch.Deleted)) {
+				return
+			}
+			if evType == watch.Deleted {
+				s.memory.Deleted(syncerror.ResourceKey("apiplugins", plugin.Metadata.Namespace, plugin.Metadata.Name), plugin)
+			}
+			s.queuePlugin(plugin)
+		})
 	}
-	source := k8sclient.NewListWatchFromClient(s.k8sRestClient, "apiplugins", namespace, selector)
-	store, ctrl := cache.NewInformer(source, &ApiPlugin{}, 0, cache.ResourceEventHandlerFuncs{
+	informer := NewInformer(k8sclient.DoneContext(done), s.client, namespaces, selector, s.class,
+		s.pluginServiceSelectorLabel)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			eventCallback(watch.Added, obj)
 		},
@@ -293,14 +462,8 @@ func (s *Service) monitorPluginEvents(namespace string, selector labels.Selector
 			eventCallback(watch.Deleted, obj)
 		},
 	})
+	s.plugins = NewLister(informer.GetIndexer())
+	s.synced = append(s.synced, informer.HasSynced)
 
-	go func() {
-		for _, initObj := range store.List() {
-			eventCallback(watch.Added, initObj)
-		}
-
-		go ctrl.Run(done)
-	}()
-
-	return events
+	go informer.Run(done)
 }
@@ -1,13 +1,15 @@
 package apiplugin
 
 import (
-	"encoding/json"
-
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
 	"k8s.io/client-go/pkg/api"
 	"k8s.io/client-go/pkg/api/meta"
 	"k8s.io/client-go/pkg/api/unversioned"
 )
 
+// Resource identifies ApiPlugin resources for the dynamic client.
+var Resource = k8sclient.GroupVersionResource{Group: "k8s.freshweb.io", Version: "v1", Resource: "apiplugins"}
+
 // ApiPlugin provides the type for an
 // API plugin resource in Kubernetes.
 type ApiPlugin struct {
@@ -16,12 +18,6 @@ type ApiPlugin struct {
 	Spec                 Spec           `json:"spec"`
 }
 
-// Event provides the event recieved for plugin resource watchers.
-type Event struct {
-	Type   string    `json:"type"`
-	Object ApiPlugin `json:"object"`
-}
-
 // GetObjectKind provides the method to expose the kind
 // of our ApiPlugin object.
 func (p *ApiPlugin) GetObjectKind() unversioned.ObjectKind {
@@ -33,23 +29,6 @@ func (p *ApiPlugin) GetObjectMeta() meta.Object {
 	return &p.Metadata
 }
 
-// APCopy provides an alias of the ApiPlugin to be utilised
-// in unmarshalling of JSON data.
-type APCopy ApiPlugin
-
-// UnmarshalJSON provides the way in which JSON should be unmarshalled correctly for this type.
-// This is a temporary workaround for https://github.com/kubernetes/client-go/issues/8
-func (p *ApiPlugin) UnmarshalJSON(data []byte) error {
-	tmp := APCopy{}
-	err := json.Unmarshal(data, &tmp)
-	if err != nil {
-		return err
-	}
-	tmp2 := ApiPlugin(tmp)
-	*p = tmp2
-	return nil
-}
-
 // ApiPluginList provides the type encapsulating a list of ApiPlugin resources.
 type ApiPluginList struct {
 	unversioned.TypeMeta `json:",inline"`
@@ -68,22 +47,6 @@ func (l *ApiPluginList) GetListMeta() unversioned.List {
 	return &l.Metadata
 }
 
-// ListCopy provides the type alias for list to be used in unmarshalling from JSON.
-type ListCopy ApiPluginList
-
-// UnmarshalJSON provides the way in which JSON should be unmarshalled correctly for this list type.
-// Temporary workaround for https://github.com/kubernetes/client-go/issues/8
-func (l *ApiPluginList) UnmarshalJSON(data []byte) error {
-	tmp := ListCopy{}
-	err := json.Unmarshal(data, &tmp)
-	if err != nil {
-		return err
-	}
-	tmp2 := ApiPluginList(tmp)
-	*l = tmp2
-	return nil
-}
-
 // Spec provides the type for the specification
 // of the plugin resource specification.
 type Spec struct {
@@ -0,0 +1,376 @@
+package certificate
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/config"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/k8stypes"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/redact"
+	"github.com/freshwebio/k8s-kong-api/shard"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/selection"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// SNIsAnnotation provides the annotation of a TLS Secret listing the comma separated host names
+// its certificate is served for, the DNS names of the certificate are used when it isn't set.
+const SNIsAnnotation = "k8s.freshweb.io/snis"
+
+// Service deals with monitoring and responding
+// to events on labelled TLS secrets in k8s
+// and updating the Kong certificates and SNIs accordingly.
+type Service struct {
+	k8sClient        *k8sclient.Client
+	label            string
+	namespaces       []string
+	kongClient       kong.Interface
+	limiter          *throttle.Limiter
+	shard            shard.Shard
+	verbose          bool
+	registry         *ownership.Registry
+	resyncChan       chan struct{}
+	errors           *syncerror.Table
+	resyncPeriod     time.Duration
+	onboarding       *onboarding.Watcher
+	informers        *k8sclient.InformerFactory
+	secretStore      cache.Store
+	declarative      bool
+	dbless           bool
+	ctx              context.Context
+	reconcileTimeout time.Duration
+}
+
+// NewService creates a new instance of the certificate service managing the kong certificates
+// for the TLS Secrets carrying the certificate label of the provided configuration.
+func NewService(k8sClient *k8sclient.Client, kong kong.Interface, cfg *config.Config) *Service {
+	return &Service{k8sClient: k8sClient, label: cfg.CertificateLabel, kongClient: kong, namespaces: cfg.Namespaces,
+		limiter: cfg.Limiter, shard: cfg.Shard, verbose: cfg.Verbose, registry: cfg.Registry,
+		resyncChan: make(chan struct{}, 1), errors: cfg.Errors, resyncPeriod: cfg.ResyncPeriod, onboarding: cfg.Onboarding, informers: cfg.Informers,
+		declarative: cfg.SyncStrategy == config.DeclarativeSync, dbless: cfg.SyncStrategy == config.DBLessSync,
+		ctx: cfg.Context, reconcileTimeout: cfg.ReconcileTimeout}
+}
+
+// Start deals with beginning the monitoring process which deals with monitoring
+// events from labelled k8s TLS secrets to propogate changes to kong.
+// Events are reconciled through the shared limiter so each namespace is bound to its
+// own concurrency and kong write limits.
+// This method should be called asynchronously in it's own goroutine.
+func (s *Service) Start(doneChan <-chan struct{}, wg *sync.WaitGroup) {
+	log.Println("Starting the certificate watcher service")
+	secretEvents := s.monitorSecretEvents()
+	var resyncTicks <-chan time.Time
+	if s.resyncPeriod > 0 && !s.dbless {
+		ticker := time.NewTicker(s.resyncPeriod)
+		defer ticker.Stop()
+		resyncTicks = ticker.C
+	}
+	for {
+		select {
+		case event := <-secretEvents:
+			if s.dbless || (s.declarative && event.Type != "DELETED") {
+				continue
+			}
+			secret := event.Object
+			resource := syncerror.ResourceKey("secrets", secret.GetNamespace(), secret.GetName())
+			s.dispatch(secret.GetNamespace(), secret.GetName(), resource, "certificate event", func(ctx context.Context) error {
+				if event.Type == "DELETED" {
+					return s.deleteCertificate(ctx, secret.GetNamespace(), secret.GetName())
+				}
+				return s.syncCertificate(ctx, &secret)
+			})
+		case <-s.resyncChan:
+			if s.dbless {
+				continue
+			}
+			s.resyncAll(0, doneChan)
+		case <-resyncTicks:
+			if s.declarative {
+				// The complete desired state is pushed to kong in one go.
+				s.resyncAll(0, doneChan)
+				continue
+			}
+			// Periodic resyncs are spread over the resync period so every object isn't reconciled on the same tick.
+			s.resyncAll(s.resyncPeriod, doneChan)
+		case <-doneChan:
+			wg.Done()
+			log.Println("Stopped certificate event watcher.")
+			return
+		}
+	}
+}
+
+// Resync triggers a full reconciliation of every labelled TLS Secret so the certificates
+// in kong converge on the state in k8s straight away, e.g. after manual changes to kong.
+// Resyncs requested while one is already pending are folded into the pending one.
+func (s *Service) Resync() {
+	select {
+	case s.resyncChan <- struct{}{}:
+	default:
+	}
+}
+
+// Dispatches a reconcile for every TLS Secret currently in the informer cache,
+// spreading them randomly over the provided window.
+func (s *Service) resyncAll(spread time.Duration, done <-chan struct{}) {
+	log.Println("Resyncing all certificate secrets")
+	for _, obj := range s.secretStore.List() {
+		secret, ok := obj.(*v1.Secret)
+		if !ok {
+			continue
+		}
+		copied := *secret
+		resource := syncerror.ResourceKey("secrets", copied.GetNamespace(), copied.GetName())
+		throttle.Spread(spread, done, func() {
+			s.dispatch(copied.GetNamespace(), copied.GetName(), resource, "resync of certificate "+copied.GetName(), func(ctx context.Context) error {
+				return s.syncCertificate(ctx, &copied)
+			})
+		})
+	}
+}
+
+// Dispatches the provided reconcile through the limiter for the provided namespace and Secret name,
+// reconciles for namespaces outside of our shard are dropped as another instance deals with them
+// and reconciles for namespaces that haven't been onboarded are dropped altogether.
+// The outcome of the reconcile is logged and recorded against the provided resource
+// in the sync error rates and the error table.
+// The reconcile is carried out under its own reconcile context.
+func (s *Service) dispatch(namespace string, name string, resource string, description string, fn func(ctx context.Context) error) {
+	if !s.shard.Owns(namespace) || !s.onboarding.Enabled(namespace) {
+		return
+	}
+	if s.verbose {
+		log.Printf("Dispatching a reconcile for the %v certificate in the %v namespace", name, namespace)
+	}
+	s.limiter.Dispatch(namespace, "certificate/"+namespace+"/"+name, func() {
+		ctx, cancel := workqueue.Context(s.ctx, s.reconcileTimeout)
+		defer cancel()
+		err := fn(ctx)
+		if err != nil {
+			log.Printf("Error while processing %v: %v", description, err)
+		}
+		metrics.RecordSync("certificate", syncerror.Classify(err))
+		s.errors.Record("certificate", resource, err)
+	})
+}
+
+// Brings the kong certificate owned by the provided TLS Secret and the SNIs referencing it in line
+// with the Secret, creating the certificate when the Secret doesn't own one yet.
+// SNIs for the host names of the Secret that already serve another certificate are left alone
+// and reported as a validation error.
+func (s *Service) syncCertificate(ctx context.Context, secret *v1.Secret) error {
+	if secret.Type != v1.SecretTypeTLS {
+		return syncerror.Validationf("The %v/%v Secret must be of the %v type to be synced to kong",
+			secret.GetNamespace(), secret.GetName(), v1.SecretTypeTLS)
+	}
+	desired := &kong.Certificate{Cert: string(secret.Data[v1.TLSCertKey]), Key: string(secret.Data[v1.TLSPrivateKeyKey])}
+	if desired.Cert == "" || desired.Key == "" {
+		return syncerror.Validationf("The %v/%v Secret must set both %v and %v",
+			secret.GetNamespace(), secret.GetName(), v1.TLSCertKey, v1.TLSPrivateKeyKey)
+	}
+	redact.AddValue(desired.Key)
+	hosts, err := hostsFor(secret)
+	if err != nil {
+		return err
+	}
+	owner := secretOwner(secret.GetNamespace(), secret.GetName())
+	id := s.ownedCertificateID(owner)
+	if id != "" {
+		current, err := s.kongClient.GetCertificate(ctx, id)
+		if err != nil && err != kong.ErrNotFound {
+			return err
+		}
+		if err == kong.ErrNotFound {
+			// The certificate was removed from kong behind our back so it's created again.
+			if err = s.registry.Release(ownership.KindCertificate, id); err != nil {
+				return err
+			}
+			id = ""
+		} else if current.Cert != desired.Cert || current.Key != desired.Key {
+			log.Printf("Updating the kong certificate %v for %v", id, owner)
+			desired.ID = id
+			if err := s.limiter.WaitWrite(ctx, secret.GetNamespace()); err != nil {
+				return err
+			}
+			if _, err = s.kongClient.UpdateCertificate(ctx, desired); err != nil {
+				return err
+			}
+		}
+	}
+	if id == "" {
+		log.Printf("Creating a kong certificate for %v", owner)
+		if err := s.limiter.WaitWrite(ctx, secret.GetNamespace()); err != nil {
+			return err
+		}
+		created, err := s.kongClient.CreateCertificate(ctx, desired)
+		if err != nil {
+			return err
+		}
+		id = created.ID
+		if err = s.registry.Claim(ownership.KindCertificate, id, owner); err != nil {
+			return err
+		}
+	}
+	return s.syncSNIs(ctx, secret.GetNamespace(), id, hosts)
+}
+
+// Brings the SNIs referencing the kong certificate with the provided id in line with the provided host names.
+func (s *Service) syncSNIs(ctx context.Context, namespace string, certificateID string, hosts []string) error {
+	snis, err := s.kongClient.ListSNIs(ctx)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]*kong.SNI)
+	for _, sni := range snis {
+		existing[sni.Name] = sni
+	}
+	desired := make(map[string]bool)
+	conflicts := []string{}
+	for _, host := range hosts {
+		desired[host] = true
+		sni, exists := existing[host]
+		if exists && sni.CertificateRef() == certificateID {
+			continue
+		}
+		if exists {
+			conflicts = append(conflicts, host)
+			continue
+		}
+		log.Printf("Creating the %v kong SNI for the certificate %v", host, certificateID)
+		if err := s.limiter.WaitWrite(ctx, namespace); err != nil {
+			return err
+		}
+		if _, err = s.kongClient.CreateSNI(ctx, host, certificateID); err != nil {
+			return err
+		}
+	}
+	for _, sni := range snis {
+		if sni.CertificateRef() != certificateID || desired[sni.Name] {
+			continue
+		}
+		log.Printf("Deleting the %v kong SNI as it's no longer listed for the certificate %v", sni.Name, certificateID)
+		if err := s.limiter.WaitWrite(ctx, namespace); err != nil {
+			return err
+		}
+		if err = s.kongClient.DeleteSNI(ctx, sni.Name); err != nil && err != kong.ErrNotFound {
+			return err
+		}
+	}
+	if len(conflicts) > 0 {
+		return syncerror.Validationf("The %v kong SNIs already serve another certificate", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// Deletes the kong certificate owned by the TLS Secret with the provided namespace and name,
+// kong deletes the SNIs referencing it along with it.
+func (s *Service) deleteCertificate(ctx context.Context, namespace string, name string) error {
+	owner := secretOwner(namespace, name)
+	id := s.ownedCertificateID(owner)
+	if id == "" {
+		return nil
+	}
+	log.Printf("Deleting the kong certificate %v as %v has been deleted", id, owner)
+	if err := s.limiter.WaitWrite(ctx, namespace); err != nil {
+		return err
+	}
+	if err := s.kongClient.DeleteCertificate(ctx, id); err != nil && err != kong.ErrNotFound {
+		return err
+	}
+	return s.registry.Release(ownership.KindCertificate, id)
+}
+
+// Provides the id of the kong certificate owned by the provided owner, empty when it doesn't own one.
+func (s *Service) ownedCertificateID(owner string) string {
+	for id, current := range s.registry.Owned(ownership.KindCertificate) {
+		if current == owner {
+			return id
+		}
+	}
+	return ""
+}
+
+// Provides the owner recorded in the ownership registry for the certificate synced from a Secret.
+func secretOwner(namespace string, name string) string {
+	return fmt.Sprintf("secret/%v/%v", namespace, name)
+}
+
+// Provides the host names the certificate of the provided TLS Secret is served for,
+// either the ones listed in its SNIs annotation or the DNS names of the certificate itself.
+func hostsFor(secret *v1.Secret) ([]string, error) {
+	hosts := []string{}
+	if listed := secret.Annotations[SNIsAnnotation]; listed != "" {
+		for _, host := range strings.Split(listed, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+		return hosts, nil
+	}
+	block, _ := pem.Decode(secret.Data[v1.TLSCertKey])
+	if block == nil {
+		return nil, syncerror.Validationf("The %v of the %v/%v Secret isn't a PEM encoded certificate",
+			v1.TLSCertKey, secret.GetNamespace(), secret.GetName())
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, syncerror.Validationf("The %v of the %v/%v Secret can't be parsed: %v",
+			v1.TLSCertKey, secret.GetNamespace(), secret.GetName(), err)
+	}
+	hosts = append(hosts, cert.DNSNames...)
+	if len(hosts) == 0 && cert.Subject.CommonName != "" {
+		hosts = append(hosts, cert.Subject.CommonName)
+	}
+	if len(hosts) == 0 {
+		return nil, syncerror.Validationf("The certificate of the %v/%v Secret doesn't have any DNS names, "+
+			"list the host names to serve it for in the %v annotation", secret.GetNamespace(), secret.GetName(), SNIsAnnotation)
+	}
+	return hosts, nil
+}
+
+// Writes the events of the Secrets carrying the certificate label to a new channel to be consumed.
+func (s *Service) monitorSecretEvents() <-chan k8stypes.SecretEvent {
+	events := make(chan k8stypes.SecretEvent)
+	selector := labels.NewSelector()
+	req, err := labels.NewRequirement(s.label, selection.Exists, []string{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	selector = selector.Add(*req)
+	eventCallback := func(evType watch.EventType, obj interface{}) {
+		secret, ok := obj.(*v1.Secret)
+		if !ok {
+			log.Printf("could not convert %v (%T) into Secret", obj, obj)
+			return
+		}
+		metrics.ObserveDelivery("certificate", "secrets", func() {
+			events <- k8stypes.SecretEvent{
+				Type:   string(evType),
+				Object: *secret,
+			}
+		})
+	}
+	watcher := s.informers.Secrets(selector)
+	s.secretStore = watcher.Store()
+	// Subscribing replays the Secrets already in the cache, which can only be written to the channel
+	// once the events are being consumed.
+	go watcher.Subscribe(eventCallback)
+
+	return events
+}
@@ -0,0 +1,65 @@
+package checksum
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+)
+
+// Annotation provides the annotation holding the hash of the kong payload
+// last applied for a managed resource.
+const Annotation = "k8s.freshweb.io/last-applied-hash"
+
+// Of provides the hash of the provided kong payload.
+// Maps are marshalled with sorted keys so equal payloads always hash the same.
+func Of(payload interface{}) (string, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Matches lets us know whether the provided hash is the one recorded
+// in the provided annotations, in which case the payload doesn't need writing to kong again.
+func Matches(annotations map[string]string, hash string) bool {
+	recorded, exists := annotations[Annotation]
+	return exists && recorded == hash
+}
+
+// Without provides a copy of the provided annotations without the hash,
+// this is used to force a payload to be written to kong regardless of the hash.
+func Without(annotations map[string]string) map[string]string {
+	stripped := make(map[string]string)
+	for key, value := range annotations {
+		if key != Annotation {
+			stripped[key] = value
+		}
+	}
+	return stripped
+}
+
+// Record saves the provided hash as an annotation on the resource with the provided
+// namespace and name. A merge patch is used so the write can't conflict with other
+// changes made to the resource since it was read.
+// The payload has already been written to kong by the time the hash is recorded, so a failure
+// to record it is only logged rather than failing the reconcile, all it costs is writing the same payload
+// to kong again on the next reconcile.
+func Record(ctx context.Context, client *k8sclient.DynamicClient, namespace string, name string, hash string) {
+	body, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{Annotation: hash},
+		},
+	})
+	if err == nil {
+		_, err = client.Patch(ctx, namespace, name, body)
+	}
+	if err != nil {
+		log.Printf("Error recording the hash of the applied kong payload on %v/%v: %v", namespace, name, err)
+	}
+}
@@ -0,0 +1,110 @@
+package clustergatewayapi
+
+import (
+	"context"
+	"log"
+
+	"github.com/freshwebio/k8s-kong-api/controllerclass"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Client provides typed access to ClusterGatewayApi resources in Kubernetes.
+// It's built on the dynamic client so the type doesn't need to be registered with a scheme.
+type Client struct {
+	dynamic *k8sclient.DynamicClient
+}
+
+// NewClient creates a new instance of a ClusterGatewayApi client.
+func NewClient(k8sClient *k8sclient.Client) *Client {
+	return &Client{dynamic: k8sClient.Resource(Resource)}
+}
+
+// Get retrieves the ClusterGatewayApi resource with the provided name.
+func (c *Client) Get(ctx context.Context, name string) (*ClusterGatewayApi, error) {
+	obj, err := c.dynamic.Get(ctx, "", name)
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(obj)
+}
+
+// List retrieves the ClusterGatewayApi resources that match the provided label selector.
+func (c *Client) List(ctx context.Context, selector labels.Selector) (*ClusterGatewayApiList, error) {
+	list, err := c.dynamic.List(ctx, "", selector)
+	if err != nil {
+		return nil, err
+	}
+	clusterGatewayApis := &ClusterGatewayApiList{Metadata: list.Metadata, Items: []ClusterGatewayApi{}}
+	for i := range list.Items {
+		clusterGatewayApi, err := fromUnstructured(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		clusterGatewayApis.Items = append(clusterGatewayApis.Items, *clusterGatewayApi)
+	}
+	return clusterGatewayApis, nil
+}
+
+// Watch watches the ClusterGatewayApi resources that match the provided
+// label selector from the provided resource version.
+func (c *Client) Watch(ctx context.Context, selector labels.Selector, resourceVersion string) (watch.Interface, error) {
+	w, err := c.dynamic.Watch(ctx, "", selector, resourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(in watch.Event) (watch.Event, bool) {
+		obj, ok := in.Object.(*k8sclient.Unstructured)
+		if !ok {
+			return in, true
+		}
+		clusterGatewayApi, err := fromUnstructured(obj)
+		if err != nil {
+			log.Printf("Skipping the %v ClusterGatewayApi event that could not be decoded: %v", in.Type, err)
+			return in, false
+		}
+		in.Object = clusterGatewayApi
+		return in, true
+	}), nil
+}
+
+// ListWatch provides the list watch for the ClusterGatewayApi resources that match the provided
+// label selector and belong to the provided controller class,
+// lists are abandoned and watches stopped once the provided context is done.
+func (c *Client) ListWatch(ctx context.Context, selector labels.Selector, class string) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options api.ListOptions) (runtime.Object, error) {
+			list, err := c.List(ctx, selector)
+			if err != nil {
+				return nil, err
+			}
+			items := list.Items[:0]
+			for _, item := range list.Items {
+				if controllerclass.Matches(item.Metadata.Annotations, class) {
+					items = append(items, item)
+				}
+			}
+			list.Items = items
+			return list, nil
+		},
+		WatchFunc: func(options api.ListOptions) (watch.Interface, error) {
+			w, err := c.Watch(ctx, selector, options.ResourceVersion)
+			if err != nil {
+				return nil, err
+			}
+			return controllerclass.Filter(w, class), nil
+		},
+	}
+}
+
+func fromUnstructured(obj *k8sclient.Unstructured) (*ClusterGatewayApi, error) {
+	clusterGatewayApi := &ClusterGatewayApi{}
+	if err := obj.Into(clusterGatewayApi); err != nil {
+		return nil, err
+	}
+	return clusterGatewayApi, nil
+}
@@ -0,0 +1,52 @@
+package clustergatewayapi
+
+import (
+	"errors"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+)
+
+// HasSynced lets us know whether the service and ClusterGatewayApi resource caches have been loaded.
+func (s *Service) HasSynced() bool {
+	if len(s.synced) == 0 {
+		return false
+	}
+	for _, synced := range s.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Declare adds the kong API objects the cached ClusterGatewayApi resources call for to the provided
+// declarative configuration along with their upstreams and targets, when cluster-scoped resources are
+// reconciled by this instance. Resources that fail validation are left out.
+func (s *Service) Declare(cfg *kong.DeclarativeConfig) error {
+	if !s.HasSynced() {
+		return errors.New("The cluster gateway api caches haven't synced yet")
+	}
+	if !s.reconciles() {
+		return nil
+	}
+	clusterGatewayApis, err := s.clusterGatewayApis.List()
+	if err != nil {
+		return err
+	}
+	for _, a := range clusterGatewayApis {
+		if len(a.Spec.Selector) == 0 {
+			continue
+		}
+		desired, err := s.desiredTargets(a)
+		if err != nil {
+			continue
+		}
+		targets := make([]string, 0, len(desired))
+		for target := range desired {
+			targets = append(targets, target)
+		}
+		cfg.AddUpstream(UpstreamName(a.Metadata.Name), targets, s.defaults.TargetWeight)
+		cfg.AddAPI(s.kongAPIFor(a))
+	}
+	return nil
+}
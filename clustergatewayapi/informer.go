@@ -0,0 +1,54 @@
+package clustergatewayapi
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewInformer creates a shared informer caching the ClusterGatewayApi resources
+// that match the provided label selector and belong to the provided controller class.
+// Lists are abandoned and watches stopped once the provided context is done.
+func NewInformer(ctx context.Context, client *Client, selector labels.Selector, class string) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(client.ListWatch(ctx, selector, class), &ClusterGatewayApi{}, 0, cache.Indexers{})
+}
+
+// Lister provides typed reads of the ClusterGatewayApi resources in an informer cache.
+type Lister struct {
+	indexer cache.Indexer
+}
+
+// NewLister creates a lister reading from the provided informer cache.
+func NewLister(indexer cache.Indexer) *Lister {
+	return &Lister{indexer: indexer}
+}
+
+// List provides every ClusterGatewayApi resource in the cache.
+func (l *Lister) List() ([]*ClusterGatewayApi, error) {
+	objs := l.indexer.List()
+	items := make([]*ClusterGatewayApi, 0, len(objs))
+	for _, obj := range objs {
+		clusterGatewayApi, ok := obj.(*ClusterGatewayApi)
+		if !ok {
+			return nil, fmt.Errorf("could not convert %v (%T) into ClusterGatewayApi", obj, obj)
+		}
+		items = append(items, clusterGatewayApi)
+	}
+	return items, nil
+}
+
+// Get provides the ClusterGatewayApi resource in the cache with the provided name,
+// lets us know whether it exists.
+func (l *Lister) Get(name string) (*ClusterGatewayApi, bool, error) {
+	obj, exists, err := l.indexer.GetByKey(name)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	clusterGatewayApi, ok := obj.(*ClusterGatewayApi)
+	if !ok {
+		return nil, false, fmt.Errorf("could not convert %v (%T) into ClusterGatewayApi", obj, obj)
+	}
+	return clusterGatewayApi, true, nil
+}
@@ -0,0 +1,442 @@
+package clustergatewayapi
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/config"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/multicluster"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/shard"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Service deals with monitoring and responding
+// to events on cluster gateway api resources and the services they select in k8s
+// and updating the kong API objects and upstreams they are published through accordingly.
+// ClusterGatewayApi resources don't live in a namespace so they are all reconciled by the first shard
+// and their kong writes are bound by the limits of the empty namespace.
+type Service struct {
+	k8sClient          *k8sclient.Client
+	client             *Client
+	class              string
+	kongClient         kong.Interface
+	limiter            *throttle.Limiter
+	shard              shard.Shard
+	verbose            bool
+	registry           *ownership.Registry
+	adoptUnowned       bool
+	resyncChan         chan struct{}
+	errors             *syncerror.Table
+	resyncPeriod       time.Duration
+	onboarding         *onboarding.Watcher
+	informers          *k8sclient.InformerFactory
+	discovery          *multicluster.Discovery
+	endpoints          k8sclient.ServiceTargets
+	queue              *workqueue.Queue
+	memory             *workqueue.Memory
+	serviceStore       cache.Store
+	clusterGatewayApis *Lister
+	declarative        bool
+	dbless             bool
+	defaults           kong.Defaults
+	ctx                context.Context
+	reconcileTimeout   time.Duration
+	synced             []func() bool
+}
+
+// NewService creates a new instance of the ClusterGatewayApi service.
+// Pre-existing kong API objects that aren't in the ownership registry are only managed when the
+// ClusterGatewayApi resource has the adopt annotation unless adoptUnowned is set.
+func NewService(k8sClient *k8sclient.Client, kong kong.Interface, cfg *config.Config) *Service {
+	s := &Service{k8sClient: k8sClient, client: NewClient(k8sClient), kongClient: kong, class: cfg.ControllerClass,
+		limiter: cfg.Limiter, shard: cfg.Shard, verbose: cfg.Verbose, registry: cfg.Registry, adoptUnowned: cfg.AdoptUnowned,
+		resyncChan: make(chan struct{}, 1), errors: cfg.Errors, resyncPeriod: cfg.ResyncPeriod, onboarding: cfg.Onboarding,
+		informers: cfg.Informers, discovery: cfg.Discovery, endpoints: cfg.Endpoints, memory: workqueue.NewMemory(),
+		declarative: cfg.SyncStrategy == config.DeclarativeSync, dbless: cfg.SyncStrategy == config.DBLessSync,
+		defaults: cfg.Defaults, ctx: cfg.Context, reconcileTimeout: cfg.ReconcileTimeout}
+	s.queue = workqueue.New("clustergatewayapi", cfg.Limiter, cfg.Retry, s.reconcile)
+	return s
+}
+
+// Start deals with beginning the monitoring process which deals with monitoring
+// events from k8s cluster gateway api resources as well as services to propogate changes to kong.
+// Events queue the resources they affect to be reconciled from their latest state.
+// This method should be called asynchronously in it's own goroutine.
+func (s *Service) Start(doneChan <-chan struct{}, wg *sync.WaitGroup) {
+	log.Println("Starting the cluster gateway api watcher service")
+	s.monitorClusterGatewayApiEvents(labels.NewSelector(), doneChan)
+	s.monitorServiceEvents()
+	var resyncTicks <-chan time.Time
+	if s.resyncPeriod > 0 && !s.dbless {
+		ticker := time.NewTicker(s.resyncPeriod)
+		defer ticker.Stop()
+		resyncTicks = ticker.C
+	}
+	for {
+		select {
+		case <-s.resyncChan:
+			if s.dbless {
+				continue
+			}
+			s.resyncAll(0, true, doneChan)
+		case <-resyncTicks:
+			if s.declarative {
+				// The complete desired state is pushed to kong in one go.
+				s.resyncAll(0, true, doneChan)
+				continue
+			}
+			// Periodic resyncs are spread over the resync period so every object isn't reconciled on the same tick.
+			s.resyncAll(s.resyncPeriod, false, doneChan)
+		case <-doneChan:
+			s.queue.ShutDown()
+			wg.Done()
+			log.Println("Stopped cluster gateway api event watcher.")
+			return
+		}
+	}
+}
+
+// Resync triggers a full reconciliation of every ClusterGatewayApi resource
+// so kong converges on the state in k8s straight away, e.g. after manual changes to kong.
+// Resyncs requested while one is already pending are folded into the pending one.
+func (s *Service) Resync() {
+	select {
+	case s.resyncChan <- struct{}{}:
+	default:
+	}
+}
+
+// Queues a reconcile for every ClusterGatewayApi resource currently in the informer cache,
+// spreading them randomly over the provided window.
+// A forced resync writes to kong with the declarative strategy, where reconciles are otherwise skipped.
+func (s *Service) resyncAll(spread time.Duration, force bool, done <-chan struct{}) {
+	log.Println("Resyncing all cluster gateway api resources")
+	clusterGatewayApis, err := s.clusterGatewayApis.List()
+	if err != nil {
+		log.Printf("Error listing the cached cluster gateway api resources for the resync: %v", err)
+	}
+	for _, clusterGatewayApi := range clusterGatewayApis {
+		a := clusterGatewayApi
+		if force {
+			s.memory.Force(resourceKey(a.Metadata.Name))
+		}
+		throttle.Spread(spread, done, func() {
+			s.queueClusterGatewayApi(a.Metadata.Name)
+		})
+	}
+}
+
+// Lets us know whether cluster-scoped resources are reconciled by this instance of the controller.
+func (s *Service) reconciles() bool {
+	return s.shard.OwnsClusterScoped()
+}
+
+// Queues the ClusterGatewayApi resource with the provided name to be reconciled,
+// nothing is queued when cluster-scoped resources belong to another shard.
+func (s *Service) queueClusterGatewayApi(name string) {
+	if !s.reconciles() {
+		return
+	}
+	if s.verbose {
+		log.Printf("Queueing a reconcile for the %v cluster-wide kong API", name)
+	}
+	s.queue.Add("", limiterKey(name), resourceKey(name))
+}
+
+// Provides the key a ClusterGatewayApi resource is queued and recorded under.
+func resourceKey(name string) string {
+	return syncerror.ResourceKey("clustergatewayapis", "", name)
+}
+
+// Provides the key used to make sure reconciles touching the same kong API
+// are never run concurrently.
+func limiterKey(name string) string {
+	return "clustergatewayapi/" + name
+}
+
+// Provides the owner recorded in the ownership registry for a ClusterGatewayApi resource,
+// the namespace part of the owner is left empty as the resource doesn't live in a namespace.
+func ownerOf(a *ClusterGatewayApi) string {
+	return "clustergatewayapi//" + a.Metadata.Name
+}
+
+// Reconciles the resource with the provided key from its latest state, recording the outcome.
+func (s *Service) reconcile(key string) error {
+	ctx, cancel := workqueue.Context(s.ctx, s.reconcileTimeout)
+	defer cancel()
+	err := s.syncResource(ctx, key)
+	if err != nil {
+		log.Printf("Error while processing reconcile of %v: %v", key, err)
+	}
+	metrics.RecordSync("clustergatewayapi", syncerror.Classify(err))
+	s.errors.Record("clustergatewayapi", key, err)
+	return err
+}
+
+// Brings the kong API object and upstream for the ClusterGatewayApi resource with the provided key
+// in line with its latest state, cleaning up after resources that have been deleted.
+// With the declarative strategy only forced reconciles write to kong.
+// A reconcile that has been forced by a resync stays forced until it succeeds.
+func (s *Service) syncResource(ctx context.Context, key string) (err error) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 {
+		return nil
+	}
+	name := parts[2]
+	forced := s.memory.TakeForced(key)
+	defer func() {
+		if err != nil && forced {
+			s.memory.Force(key)
+		}
+	}()
+	a, exists, err := s.clusterGatewayApis.Get(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		deleted, wasDeleted := s.memory.LastDeleted(key)
+		if !wasDeleted {
+			return nil
+		}
+		if err = s.deleteKongClusterGatewayApi(ctx, deleted.(*ClusterGatewayApi)); err != nil {
+			return err
+		}
+		s.memory.Forget(key)
+		return nil
+	}
+	if s.dbless || (s.declarative && !forced) {
+		return nil
+	}
+	if err = s.syncKongClusterGatewayApi(ctx, a); err != nil {
+		return err
+	}
+	s.memory.Synced(key, a)
+	return nil
+}
+
+// Provides the kong API object the provided ClusterGatewayApi resource calls for,
+// it's named after the resource and points at the kong upstream for the resource.
+// The properties the resource leaves out are given the configured defaults.
+func (s *Service) kongAPIFor(a *ClusterGatewayApi) *kong.API {
+	return s.defaults.Apply(&kong.API{
+		Name:                   a.Metadata.Name,
+		Hosts:                  a.Spec.Hosts,
+		URIs:                   a.Spec.Uris,
+		UpstreamURL:            "http://" + UpstreamName(a.Metadata.Name),
+		StripURI:               a.Spec.StripURI,
+		Methods:                a.Spec.Methods,
+		PreserveHost:           a.Spec.PreserveHost,
+		Retries:                a.Spec.Retries,
+		UpstreamConnectTimeout: a.Spec.UpstreamConnectTimeout,
+		UpstreamSendTimeout:    a.Spec.UpstreamSendTimeout,
+		UpstreamReadTimeout:    a.Spec.UpstreamReadTimeout,
+		HTTPSOnly:              a.Spec.HTTPSOnly,
+		HTTPIfTerminated:       a.Spec.HTTPIfTerminated,
+	})
+}
+
+// Creates or updates the kong API object and upstream for the provided ClusterGatewayApi resource.
+// The targets are synced before the API object is written so a new API object never points at an empty upstream
+// when services are selected. Pre-existing API objects are only touched when the resource may manage them.
+func (s *Service) syncKongClusterGatewayApi(ctx context.Context, a *ClusterGatewayApi) error {
+	if len(a.Spec.Selector) == 0 {
+		return syncerror.Validationf("The cluster gateway api resource %v must have a service selector set", a.Metadata.Name)
+	}
+	api := s.kongAPIFor(a)
+	existing, err := s.kongClient.GetAPI(ctx, api.Name)
+	if err != nil && err != kong.ErrNotFound {
+		return err
+	}
+	apiExists := err == nil
+	if apiExists {
+		if err = s.canManageKongAPI(a, api.Name); err != nil {
+			return err
+		}
+	}
+	if err = s.syncTargets(ctx, a); err != nil {
+		return err
+	}
+	if apiExists {
+		// Writes that wouldn't change anything are skipped.
+		if kong.APIMatches(existing, api) {
+			metrics.KongWritesSkippedTotal.WithLabelValues("api").Inc()
+			return nil
+		}
+		if err := s.limiter.WaitWrite(ctx, ""); err != nil {
+			return err
+		}
+		_, err = s.kongClient.UpdateAPI(ctx, api)
+		return err
+	}
+	if err := s.limiter.WaitWrite(ctx, ""); err != nil {
+		return err
+	}
+	if _, err = s.kongClient.CreateAPI(ctx, api); err != nil {
+		return err
+	}
+	return s.registry.Claim(ownership.KindAPI, api.Name, ownerOf(a))
+}
+
+// Works out whether the provided ClusterGatewayApi resource may manage the pre-existing kong API object
+// with the provided name, adopting the API object when the resource is allowed to.
+// The refusal to manage an API object owned by something else is reported as a validation error
+// as it won't go away until the resource or the other owner changes.
+func (s *Service) canManageKongAPI(a *ClusterGatewayApi, apiName string) error {
+	owner := ownerOf(a)
+	current, owned := s.registry.Owner(ownership.KindAPI, apiName)
+	if owned && current == owner {
+		return nil
+	}
+	if a.Metadata.Annotations[AdoptAnnotation] != "true" && (owned || !s.adoptUnowned) {
+		if owned {
+			return syncerror.Validationf("The %v kong API is already managed by %v, "+
+				"set the %v annotation to \"true\" to take it over", apiName, current, AdoptAnnotation)
+		}
+		return syncerror.Validationf("The %v kong API already exists and isn't managed by this resource, "+
+			"set the %v annotation to \"true\" to adopt it", apiName, AdoptAnnotation)
+	}
+	log.Printf("The %v kong API has been adopted by %v", apiName, owner)
+	return s.registry.Claim(ownership.KindAPI, apiName, owner)
+}
+
+// Deletes the kong API object and upstream for the provided ClusterGatewayApi resource which has been deleted,
+// as long as they are owned by the resource.
+func (s *Service) deleteKongClusterGatewayApi(ctx context.Context, a *ClusterGatewayApi) error {
+	owner := ownerOf(a)
+	apiName := a.Metadata.Name
+	if current, owned := s.registry.Owner(ownership.KindAPI, apiName); owned && current == owner {
+		log.Printf("Deleting the %v kong API as its ClusterGatewayApi resource has been deleted", apiName)
+		if err := s.limiter.WaitWrite(ctx, ""); err != nil {
+			return err
+		}
+		if err := s.kongClient.DeleteAPI(ctx, apiName); err != nil && err != kong.ErrNotFound {
+			return err
+		}
+		if err := s.registry.Release(ownership.KindAPI, apiName); err != nil {
+			return err
+		}
+	}
+	upstreamName := UpstreamName(apiName)
+	if current, owned := s.registry.Owner(ownership.KindUpstream, upstreamName); !owned || current != owner {
+		return nil
+	}
+	if err := s.limiter.WaitWrite(ctx, ""); err != nil {
+		return err
+	}
+	if err := s.kongClient.DeleteUpstream(ctx, upstreamName); err != nil && err != kong.ErrNotFound {
+		return err
+	}
+	return s.registry.Release(ownership.KindUpstream, upstreamName)
+}
+
+// Queues the ClusterGatewayApi resources selecting a service to be reconciled whenever the service changes,
+// a service that has its labels changed is reconciled for the resources selecting it before and after the change.
+// Every service is watched as ClusterGatewayApi resources can select services by any label.
+func (s *Service) monitorServiceEvents() {
+	eventCallback := func(evType watch.EventType, old interface{}, obj interface{}) {
+		service, ok := obj.(*v1.Service)
+		if !ok {
+			log.Printf("could not convert %v (%T) into Service", obj, obj)
+			return
+		}
+		metrics.ObserveDelivery("clustergatewayapi", "services", func() {
+			if s.dbless || s.declarative {
+				return
+			}
+			oldService, _ := old.(*v1.Service)
+			s.queueSelecting(service, oldService)
+		})
+	}
+	watcher := s.informers.Services(labels.Everything())
+	s.serviceStore = watcher.Store()
+	s.synced = append(s.synced, watcher.HasSynced)
+	watcher.SubscribeChanges(eventCallback)
+}
+
+// Queues the ClusterGatewayApi resources selecting any of the provided services to be reconciled,
+// nil services are ignored.
+func (s *Service) queueSelecting(services ...*v1.Service) {
+	if s.clusterGatewayApis == nil {
+		return
+	}
+	clusterGatewayApis, err := s.clusterGatewayApis.List()
+	if err != nil {
+		log.Printf("Error listing the cached cluster gateway api resources: %v", err)
+		return
+	}
+	for _, a := range clusterGatewayApis {
+		for _, service := range services {
+			if service != nil && s.selects(a, service) {
+				s.queueClusterGatewayApi(a.Metadata.Name)
+				break
+			}
+		}
+	}
+}
+
+// SyncTargets queues the ClusterGatewayApi resources selecting the service with the provided namespace and name
+// to be reconciled, e.g. when the matching service in a remote cluster or the endpoints behind the service change.
+func (s *Service) SyncTargets(namespace string, name string) {
+	if s.serviceStore == nil || s.dbless {
+		return
+	}
+	obj, exists, err := s.serviceStore.GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return
+	}
+	if service, ok := obj.(*v1.Service); ok {
+		s.queueSelecting(service)
+	}
+}
+
+// Handles watching events occuring for our cluster gateway api resource.
+// All ClusterGatewayApi resources matching the given selector are watched
+// and queued to be reconciled.
+func (s *Service) monitorClusterGatewayApiEvents(selector labels.Selector, done <-chan struct{}) {
+	eventCallback := func(evType watch.EventType, obj interface{}) {
+		clusterGatewayApi, ok := obj.(*ClusterGatewayApi)
+		if !ok {
+			log.Printf("could not convert %v (%T) into ClusterGatewayApi", obj, obj)
+			return
+		}
+		metrics.ObserveDelivery("clustergatewayapi", "clustergatewayapis", func() {
+			if s.dbless || (s.declarative && evType != watch.Deleted) {
+				return
+			}
+			if evType == watch.Deleted {
+				s.memory.Deleted(resourceKey(clusterGatewayApi.Metadata.Name), clusterGatewayApi)
+			}
+			s.queueClusterGatewayApi(clusterGatewayApi.Metadata.Name)
+		})
+	}
+	informer := NewInformer(k8sclient.DoneContext(done), s.client, selector, s.class)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			eventCallback(watch.Added, obj)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			eventCallback(watch.Modified, new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			eventCallback(watch.Deleted, obj)
+		},
+	})
+	s.clusterGatewayApis = NewLister(informer.GetIndexer())
+	s.synced = append(s.synced, informer.HasSynced)
+
+	go informer.Run(done)
+}
@@ -0,0 +1,199 @@
+package clustergatewayapi
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+)
+
+// UpstreamName provides the name of the kong upstream the kong API object for the ClusterGatewayApi resource
+// with the provided name balances across, it can't clash with the upstreams of services in a namespace.
+func UpstreamName(name string) string {
+	return name + ".cluster"
+}
+
+// Lets us know whether the provided ClusterGatewayApi resource selects the provided service, services
+// have to carry every label of the selector and live in one of the listed namespaces when there are any.
+// Services in namespaces that haven't been onboarded or have opted out are never selected.
+func (s *Service) selects(a *ClusterGatewayApi, service *v1.Service) bool {
+	if len(a.Spec.Selector) == 0 || !labels.SelectorFromSet(labels.Set(a.Spec.Selector)).Matches(labels.Set(service.Labels)) {
+		return false
+	}
+	if len(a.Spec.Namespaces) > 0 {
+		listed := false
+		for _, namespace := range a.Spec.Namespaces {
+			listed = listed || namespace == service.GetNamespace()
+		}
+		if !listed {
+			return false
+		}
+	}
+	return s.onboarding.Enabled(service.GetNamespace())
+}
+
+// Provides the cached services the provided ClusterGatewayApi resource selects, sorted by namespace and name.
+func (s *Service) selectedServices(a *ClusterGatewayApi) []*v1.Service {
+	selected := []*v1.Service{}
+	if s.serviceStore == nil {
+		return selected
+	}
+	for _, obj := range s.serviceStore.List() {
+		if service, ok := obj.(*v1.Service); ok && s.selects(a, service) {
+			selected = append(selected, service)
+		}
+	}
+	sort.Sort(servicesByKey(selected))
+	return selected
+}
+
+type servicesByKey []*v1.Service
+
+func (l servicesByKey) Len() int { return len(l) }
+func (l servicesByKey) Less(i, j int) bool {
+	return l[i].GetNamespace()+"/"+l[i].GetName() < l[j].GetNamespace()+"/"+l[j].GetName()
+}
+func (l servicesByKey) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+// Provides the port of the provided service the provided ClusterGatewayApi resource sends traffic to,
+// selected by name or number with the first port of the service used when the resource doesn't select one.
+func servicePort(a *ClusterGatewayApi, service *v1.Service) (v1.ServicePort, error) {
+	if len(service.Spec.Ports) == 0 {
+		return v1.ServicePort{}, syncerror.Validationf("The service %v/%v should expose at least one port",
+			service.GetNamespace(), service.GetName())
+	}
+	if a.Spec.PortName == "" && a.Spec.Port == 0 {
+		return service.Spec.Ports[0], nil
+	}
+	for _, port := range service.Spec.Ports {
+		if a.Spec.PortName != "" && port.Name == a.Spec.PortName {
+			return port, nil
+		}
+		if a.Spec.PortName == "" && port.Port == a.Spec.Port {
+			return port, nil
+		}
+	}
+	if a.Spec.PortName != "" {
+		return v1.ServicePort{}, syncerror.Validationf("The service %v/%v doesn't expose a port named %v",
+			service.GetNamespace(), service.GetName(), a.Spec.PortName)
+	}
+	return v1.ServicePort{}, syncerror.Validationf("The service %v/%v doesn't expose port %v",
+		service.GetNamespace(), service.GetName(), a.Spec.Port)
+}
+
+// Provides the host:port targets the kong upstream for the provided ClusterGatewayApi resource should have
+// for the selected port of every service it selects. With endpoint targets configured the ready pods behind
+// the services are targeted instead of their cluster IPs, the matching services in remote clusters are targeted too.
+func (s *Service) desiredTargets(a *ClusterGatewayApi) (map[string]bool, error) {
+	desired := make(map[string]bool)
+	for _, selected := range s.selectedServices(a) {
+		port, err := servicePort(a, selected)
+		if err != nil {
+			return nil, err
+		}
+		if s.endpoints != nil {
+			for _, target := range s.endpoints.ReadyTargets(selected.GetNamespace(), selected.GetName(), port.Name) {
+				desired[target] = true
+			}
+		} else if selected.Spec.ClusterIP != "" && selected.Spec.ClusterIP != "None" {
+			desired[selected.Spec.ClusterIP+":"+strconv.Itoa(int(port.Port))] = true
+		}
+		if s.discovery != nil {
+			for _, target := range s.discovery.Targets(selected.GetNamespace(), selected.GetName(), port.Name) {
+				desired[target] = true
+			}
+		}
+	}
+	return desired, nil
+}
+
+// Brings the targets of the kong upstream for the provided ClusterGatewayApi resource in line with
+// the services it selects, the upstream is created when it doesn't exist yet.
+// Kong keeps the history of targets so targets are enabled and disabled rather than removed.
+func (s *Service) syncTargets(ctx context.Context, a *ClusterGatewayApi) error {
+	desired, err := s.desiredTargets(a)
+	if err != nil {
+		return err
+	}
+	upstreamName := UpstreamName(a.Metadata.Name)
+	_, err = s.kongClient.GetUpstream(ctx, upstreamName)
+	if err != nil {
+		if err != kong.ErrNotFound {
+			return err
+		}
+		if err := s.limiter.WaitWrite(ctx, ""); err != nil {
+			return err
+		}
+		if _, err = s.kongClient.CreateUpstream(ctx, &kong.Upstream{Name: upstreamName}); err != nil {
+			return err
+		}
+		if err = s.registry.Claim(ownership.KindUpstream, upstreamName, ownerOf(a)); err != nil {
+			return err
+		}
+	}
+	current, err := s.kongClient.ListTargets(ctx, upstreamName)
+	if err != nil {
+		return err
+	}
+	latest := latestTargets(current)
+	wait := s.rampWait()
+	for target := range desired {
+		entry, exists := latest[target]
+		if exists && entry.Weight >= s.kongClient.TargetWeight() {
+			continue
+		}
+		if exists && entry.Weight > 0 {
+			// The target was left part way through its slow start, e.g. by a restart or a change of leader.
+			if err = s.kongClient.ResumeTarget(ctx, upstreamName, target, entry.Weight, wait); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Printf("Enabling the %v target of the %v upstream", target, upstreamName)
+		if err := s.limiter.WaitWrite(ctx, ""); err != nil {
+			return err
+		}
+		if _, err = s.kongClient.EnableTarget(ctx, upstreamName, target, wait); err != nil {
+			return err
+		}
+	}
+	for target, entry := range latest {
+		if desired[target] || entry.Weight == 0 {
+			continue
+		}
+		log.Printf("Disabling the %v target of the %v upstream", target, upstreamName)
+		if err := s.limiter.WaitWrite(ctx, ""); err != nil {
+			return err
+		}
+		if _, err = s.kongClient.DisableTarget(ctx, upstreamName, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Provides the wait for every step of the slow start ramps of the targets of ClusterGatewayApi resources,
+// holding them to the write rate limit the cluster-scoped resources share.
+func (s *Service) rampWait() kong.RampWait {
+	return func(ctx context.Context) error {
+		return s.limiter.WaitWrite(ctx, "")
+	}
+}
+
+// Provides the latest entry for each target in the provided target history,
+// the latest entry for a target decides whether it's enabled.
+func latestTargets(targets *kong.TargetList) map[string]*kong.Target {
+	latest := make(map[string]*kong.Target)
+	for _, target := range targets.Data {
+		if existing, exists := latest[target.Target]; !exists || target.Created > existing.Created {
+			latest[target.Target] = target
+		}
+	}
+	return latest
+}
@@ -0,0 +1,81 @@
+package clustergatewayapi
+
+import (
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/api/meta"
+	"k8s.io/client-go/pkg/api/unversioned"
+)
+
+// Resource identifies ClusterGatewayApi resources for the dynamic client.
+var Resource = k8sclient.GroupVersionResource{Group: "k8s.freshweb.io", Version: "v1", Resource: "clustergatewayapis"}
+
+// AdoptAnnotation provides the annotation that allows a ClusterGatewayApi resource
+// to take over a pre-existing kong API object that isn't owned by it, the same one GatewayApi resources use.
+const AdoptAnnotation = "k8s.freshweb.io/adopt"
+
+// ClusterGatewayApi provides the type for a cluster-scoped
+// gateway API resource in Kubernetes, publishing a single kong API object
+// that balances across the services it selects in any namespace.
+type ClusterGatewayApi struct {
+	unversioned.TypeMeta `json:",inline"`
+	Metadata             api.ObjectMeta `json:"metadata"`
+	Spec                 Spec           `json:"spec"`
+}
+
+// GetObjectKind provides the method to expose the kind
+// of our ClusterGatewayApi object.
+func (a *ClusterGatewayApi) GetObjectKind() unversioned.ObjectKind {
+	return &a.TypeMeta
+}
+
+// GetObjectMeta Retrieves the metadata for the ClusterGatewayApi.
+func (a *ClusterGatewayApi) GetObjectMeta() meta.Object {
+	return &a.Metadata
+}
+
+// ClusterGatewayApiList provides the type encapsulating a list of ClusterGatewayApi resources.
+type ClusterGatewayApiList struct {
+	unversioned.TypeMeta `json:",inline"`
+	Metadata             unversioned.ListMeta `json:"metadata"`
+	Items                []ClusterGatewayApi  `json:"items"`
+}
+
+// GetObjectKind provides the method to expose the kind
+// of our ClusterGatewayApi List object.
+func (l *ClusterGatewayApiList) GetObjectKind() unversioned.ObjectKind {
+	return &l.TypeMeta
+}
+
+// GetListMeta Retrieves the metadata for the ClusterGatewayApi List.
+func (l *ClusterGatewayApiList) GetListMeta() unversioned.List {
+	return &l.Metadata
+}
+
+// Spec provides the type for the specification
+// of the cluster gateway api resource.
+// The kong API object is named after the resource and always points at a kong upstream
+// with the selected port of every selected service as a target.
+type Spec struct {
+	Hosts                  []string `json:"hosts,omitempty"`
+	Uris                   []string `json:"uris,omitempty"`
+	StripURI               *bool    `json:"strip_uri,omitempty"`
+	Methods                []string `json:"methods,omitempty"`
+	PreserveHost           *bool    `json:"preserve_host,omitempty"`
+	Retries                *int64   `json:"retries,omitempty"`
+	UpstreamConnectTimeout int64    `json:"upstream_connect_timeout,omitempty"`
+	UpstreamSendTimeout    int64    `json:"upstream_send_timeout,omitempty"`
+	UpstreamReadTimeout    int64    `json:"upstream_read_timeout,omitempty"`
+	HTTPSOnly              *bool    `json:"https_only,omitempty"`
+	HTTPIfTerminated       *bool    `json:"http_if_terminated,omitempty"`
+	// The number of the service port kong sends traffic to,
+	// the first port of each service is used when neither this nor PortName is set.
+	Port int32 `json:"port,omitempty"`
+	// The name of the service port kong sends traffic to, takes precedence over Port.
+	PortName string `json:"portName,omitempty"`
+	// Label selector for selecting the services the ClusterGatewayApi resource
+	// balances across, services in every watched namespace are selected.
+	Selector map[string]string `json:"selector"`
+	// The namespaces services are selected from, empty to select services from every watched namespace.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/dependency"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/multicluster"
+	"github.com/freshwebio/k8s-kong-api/naming"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/recorder"
+	"github.com/freshwebio/k8s-kong-api/shard"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+)
+
+// The strategies the controllers can use to bring kong in line with k8s.
+const (
+	// IncrementalSync applies every change to kong as the event for it comes in.
+	IncrementalSync = "incremental"
+	// DeclarativeSync pushes the complete desired state to kong every resync period,
+	// only deletions are applied as the events for them come in.
+	DeclarativeSync = "declarative"
+	// DBLessSync never writes to the kong admin api, the complete desired state is rendered
+	// as a declarative configuration for DB-less kong deployments instead.
+	DBLessSync = "dbless"
+)
+
+// Config provides the configuration shared by the controllers
+// that watch k8s resources and propogate them to kong.
+type Config struct {
+	// The namespaces to watch k8s resources in, empty to watch every namespace.
+	Namespaces []string
+	// The name of the label used to identify services that reference a GatewayApi resource.
+	APILabel string
+	// The name of the label used to select services in custom k8s resources.
+	ServiceSelectorLabel string
+	// The name of the label identifying the TLS Secrets synced to kong certificates.
+	CertificateLabel string
+	// The controller class of the resources reconciled, empty to reconcile the resources without a class.
+	ControllerClass string
+	// Limits the reconciles in flight and the kong writes made for each namespace.
+	Limiter *throttle.Limiter
+	// How failed reconciles are retried.
+	Retry workqueue.Backoff
+	// The context the work of the controllers is carried out under, it's cancelled on shutdown
+	// so reconciles waiting on kong are abandoned.
+	Context context.Context
+	// The longest a single reconcile can take before the requests it's making to kong are abandoned, 0 for no limit.
+	ReconcileTimeout time.Duration
+	// The shard of namespaces this instance of the controller reconciles.
+	Shard shard.Shard
+	// How the names of kong API objects are derived from the services they represent.
+	Names naming.Scheme
+	// How long a resource must be gone for before its kong API is deleted.
+	DeletionGracePeriod time.Duration
+	// Keeps track of the kong objects owned by the controller.
+	Registry *ownership.Registry
+	// Whether kong APIs that aren't owned by the controller can be adopted without the adopt annotation.
+	AdoptUnowned bool
+	// How often every resource is resynced, 0 disables periodic resyncs.
+	ResyncPeriod time.Duration
+	// Keeps the last error for every resource failing to sync.
+	Errors *syncerror.Table
+	// Records the outcome of syncs as Kubernetes Events on the resources synced.
+	Recorder *recorder.Recorder
+	// Orders plugin reconciles after the creation of the kong API objects they attach to.
+	Dependencies *dependency.Graph
+	// Keeps track of the namespaces that have been onboarded.
+	Onboarding *onboarding.Watcher
+	// Discovers the services in remote clusters, nil when no remote clusters are configured.
+	Discovery *multicluster.Discovery
+	// Hands out the services and secrets watchers shared between the controllers.
+	Informers *k8sclient.InformerFactory
+	// Watches the Endpoints or EndpointSlices behind services so their pods are registered as kong targets,
+	// nil when kong API objects point at the cluster IP of their service.
+	Endpoints k8sclient.ServiceTargets
+	// The values given to the properties of kong objects that resources leave out.
+	Defaults kong.Defaults
+	// Whether every reconcile should be logged.
+	Verbose bool
+	// How kong is brought in line with k8s, IncrementalSync, DeclarativeSync or DBLessSync.
+	SyncStrategy string
+}
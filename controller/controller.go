@@ -0,0 +1,32 @@
+package controller
+
+import "sync"
+
+// Controller provides the interface implemented by every controller that watches k8s resources
+// and propogates them to kong, so main can start and resync them all the same way
+// regardless of the resources they deal with.
+type Controller interface {
+	// Start watches and syncs the resources of the controller until the provided done channel
+	// is closed, the provided wait group is marked as done once the controller has stopped.
+	Start(doneChan <-chan struct{}, wg *sync.WaitGroup)
+	// Resync dispatches a full sync of every resource the controller deals with.
+	Resync()
+}
+
+// Set provides a group of controllers that are started and resynced together.
+type Set []Controller
+
+// Start starts every controller in the set, each one is added to the provided wait group.
+func (s Set) Start(doneChan <-chan struct{}, wg *sync.WaitGroup) {
+	for _, c := range s {
+		wg.Add(1)
+		go c.Start(doneChan, wg)
+	}
+}
+
+// Resync dispatches a full sync of every controller in the set.
+func (s Set) Resync() {
+	for _, c := range s {
+		c.Resync()
+	}
+}
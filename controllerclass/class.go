@@ -0,0 +1,64 @@
+package controllerclass
+
+import (
+	"log"
+
+	"k8s.io/client-go/pkg/api/meta"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+)
+
+const (
+	// Annotation provides the annotation naming the controller class a resource is reconciled by.
+	Annotation = "k8s.freshweb.io/controller-class"
+	// IngressAnnotation provides the ingress class annotation, it's honoured as well
+	// so the same class can be used for every gateway controller in a cluster.
+	IngressAnnotation = "kubernetes.io/ingress.class"
+)
+
+// Of provides the controller class of a resource with the provided annotations, the controller class
+// annotation takes precedence over the ingress class annotation. Resources without either of them
+// have an empty class.
+func Of(annotations map[string]string) string {
+	if class, exists := annotations[Annotation]; exists {
+		return class
+	}
+	return annotations[IngressAnnotation]
+}
+
+// Matches lets us know whether a resource with the provided annotations is reconciled by a controller
+// of the provided class. A controller without a class only reconciles resources without a class,
+// this lets several gateway controllers coexist in a cluster without fighting over resources.
+func Matches(annotations map[string]string, class string) bool {
+	return Of(annotations) == class
+}
+
+// Filter provides a watch only passing on events for objects of the provided class.
+// An object that's modified to move to another class is passed on as deleted, so the
+// informers fed by the watch drop it from their caches and it's treated as gone.
+func Filter(w watch.Interface, class string) watch.Interface {
+	return watch.Filter(w, func(in watch.Event) (watch.Event, bool) {
+		if in.Type != watch.Added && in.Type != watch.Modified {
+			return in, true
+		}
+		if ObjectMatches(in.Object, class) {
+			return in, true
+		}
+		if in.Type == watch.Modified {
+			in.Type = watch.Deleted
+			return in, true
+		}
+		return in, false
+	})
+}
+
+// ObjectMatches lets us know whether the provided object is reconciled by a controller of the provided class,
+// objects without metadata are never reconciled.
+func ObjectMatches(obj runtime.Object, class string) bool {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		log.Printf("could not read the metadata of %v (%T): %v", obj, obj, err)
+		return false
+	}
+	return Matches(accessor.GetAnnotations(), class)
+}
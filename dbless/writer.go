@@ -0,0 +1,141 @@
+package dbless
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// ConfigKey provides the key of the ConfigMap the kong.yml file is written to,
+	// mounting the ConfigMap into the kong pods makes it available as a file of the same name.
+	ConfigKey = "kong.yml"
+	// The number of times we'll retry writing the ConfigMap when
+	// someone else has updated it in the meantime.
+	maxConflictRetries = 5
+)
+
+// Source provides the part of the desired state of kong a controller is responsible for.
+type Source interface {
+	// HasSynced lets us know whether the caches the desired state is rendered from have been loaded.
+	HasSynced() bool
+	// Declare adds the kong objects the controller calls for to the provided declarative configuration.
+	Declare(cfg *kong.DeclarativeConfig) error
+}
+
+// Writer deals with rendering the complete desired state of kong as a declarative configuration
+// and writing it into a ConfigMap for DB-less kong deployments, which can't be written to through the admin api.
+// Nothing is written until every source has synced so kong is never handed an empty configuration on startup.
+type Writer struct {
+	k8sClient  *k8sclient.Client
+	namespace  string
+	name       string
+	interval   time.Duration
+	sources    []Source
+	resyncChan chan struct{}
+}
+
+// NewWriter creates a new writer rendering the desired state of the provided sources into the ConfigMap
+// with the provided namespace and name every interval.
+func NewWriter(k8sClient *k8sclient.Client, namespace string, name string, interval time.Duration, sources ...Source) *Writer {
+	return &Writer{k8sClient: k8sClient, namespace: namespace, name: name, interval: interval, sources: sources,
+		resyncChan: make(chan struct{}, 1)}
+}
+
+// Start renders and writes the declarative configuration every interval until the provided done channel is closed.
+// This method should be called asynchronously in it's own goroutine.
+func (w *Writer) Start(doneChan <-chan struct{}, wg *sync.WaitGroup) {
+	log.Printf("Starting the DB-less configuration writer for the %v/%v ConfigMap", w.namespace, w.name)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.sync()
+		case <-w.resyncChan:
+			w.sync()
+		case <-doneChan:
+			wg.Done()
+			log.Println("Stopped the DB-less configuration writer.")
+			return
+		}
+	}
+}
+
+// Resync renders and writes the declarative configuration straight away.
+// Resyncs requested while one is already pending are folded into the pending one.
+func (w *Writer) Resync() {
+	select {
+	case w.resyncChan <- struct{}{}:
+	default:
+	}
+}
+
+// Renders the declarative configuration and writes it to the ConfigMap, logging any failure
+// as the next interval will try again.
+func (w *Writer) sync() {
+	for _, source := range w.sources {
+		if !source.HasSynced() {
+			log.Println("Waiting for the caches to sync before writing the DB-less configuration")
+			return
+		}
+	}
+	cfg := kong.NewDeclarativeConfig()
+	for _, source := range w.sources {
+		if err := source.Declare(cfg); err != nil {
+			log.Printf("Error rendering the DB-less configuration: %v", err)
+			return
+		}
+	}
+	rendered, err := cfg.YAML()
+	if err != nil {
+		log.Printf("Error rendering the DB-less configuration: %v", err)
+		return
+	}
+	if err = w.write(string(rendered)); err != nil {
+		log.Printf("Error writing the DB-less configuration: %v", err)
+	}
+}
+
+// Writes the provided kong.yml contents to the ConfigMap, creating it when it doesn't exist yet.
+// The ConfigMap is left alone when it already holds the same contents so kong isn't reloaded for nothing.
+func (w *Writer) write(rendered string) error {
+	configMaps := w.k8sClient.Clientset.CoreV1().ConfigMaps(w.namespace)
+	for i := 0; i < maxConflictRetries; i++ {
+		configMap, err := configMaps.Get(w.name)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+			configMap = &v1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: w.name, Namespace: w.namespace}}
+			configMap.Data = map[string]string{ConfigKey: rendered}
+			log.Printf("Creating the %v/%v ConfigMap with the DB-less configuration", w.namespace, w.name)
+			_, err = configMaps.Create(configMap)
+			if err != nil && errors.IsAlreadyExists(err) {
+				continue
+			}
+			return err
+		}
+		if configMap.Data[ConfigKey] == rendered {
+			return nil
+		}
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		configMap.Data[ConfigKey] = rendered
+		log.Printf("Updating the DB-less configuration in the %v/%v ConfigMap", w.namespace, w.name)
+		_, err = configMaps.Update(configMap)
+		if err != nil && errors.IsConflict(err) {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("Failed to write the DB-less configuration to the %v/%v ConfigMap after %v attempts",
+		w.namespace, w.name, maxConflictRetries)
+}
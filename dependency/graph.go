@@ -0,0 +1,75 @@
+package dependency
+
+import "sync"
+
+// Graph keeps track of the plugin reconciles that depend on a kong API object
+// which doesn't exist yet, so they can be carried out as soon as the GatewayApi controller
+// creates the API object instead of failing and waiting for the next resync.
+// The GatewayApi and ApiPlugin controllers share the graph, along with the limiter keys
+// for each kong API, which gives us API creation before plugin attachment and plugin
+// detachment before API deletion.
+type Graph struct {
+	mu      sync.Mutex
+	waiting map[string]map[string]func()
+}
+
+// NewGraph creates a new instance of an empty dependency graph.
+func NewGraph() *Graph {
+	return &Graph{waiting: make(map[string]map[string]func())}
+}
+
+// AwaitAPI registers the provided function to be called once the kong API object
+// with the provided name is created in the provided namespace.
+// Only the latest function registered for a resource is kept as it supersedes any earlier ones.
+func (g *Graph) AwaitAPI(namespace string, apiName string, resource string, fn func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	k := key(namespace, apiName)
+	if _, exists := g.waiting[k]; !exists {
+		g.waiting[k] = make(map[string]func())
+	}
+	g.waiting[k][resource] = fn
+}
+
+// Forget removes anything the provided resource is waiting on for the kong API object
+// with the provided name, this should be used once the resource has been deleted.
+func (g *Graph) Forget(namespace string, apiName string, resource string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	k := key(namespace, apiName)
+	delete(g.waiting[k], resource)
+	if len(g.waiting[k]) == 0 {
+		delete(g.waiting, k)
+	}
+}
+
+// APIReady lets the graph know the kong API object with the provided name has been created
+// in the provided namespace, the functions waiting on it are called and then removed.
+// The functions are expected to dispatch their work rather than carry it out
+// as this will usually be called from within a reconcile.
+func (g *Graph) APIReady(namespace string, apiName string) {
+	g.mu.Lock()
+	k := key(namespace, apiName)
+	waiting := g.waiting[k]
+	delete(g.waiting, k)
+	g.mu.Unlock()
+	for _, fn := range waiting {
+		fn()
+	}
+}
+
+// Waiting provides the number of resources waiting on kong API objects to be created.
+func (g *Graph) Waiting() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	count := 0
+	for _, resources := range g.waiting {
+		count += len(resources)
+	}
+	return count
+}
+
+// Provides the key for a kong API object in a namespace.
+func key(namespace string, apiName string) string {
+	return namespace + "/" + apiName
+}
@@ -0,0 +1,198 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/checksum"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/metrics"
+)
+
+// Source provides a comparison of the kong objects derived from k8s
+// with the ones observed in kong for a single kind of kong object.
+// The comparison is abandoned once the provided context is done.
+type Source interface {
+	Drift(ctx context.Context) (*Report, error)
+}
+
+// Report provides the comparison of the desired and actual kong objects of a single kind.
+// Actual objects are hashed against the desired object of the same name so fields kong fills in
+// with defaults don't count as drift, objects that aren't desired at all are hashed as they are.
+type Report struct {
+	kind      string
+	desired   map[string]string
+	actual    map[string]string
+	resources map[string]string
+}
+
+// NewReport creates a new empty report for the kong objects of the provided kind, e.g. api.
+func NewReport(kind string) *Report {
+	return &Report{kind: kind, desired: make(map[string]string), actual: make(map[string]string),
+		resources: make(map[string]string)}
+}
+
+// AddDesired records the kong object with the provided name the k8s resource with the provided key calls for.
+func (r *Report) AddDesired(name string, resource string, object interface{}) error {
+	// Both sides are hashed in their decoded form so they are encoded the same way.
+	decoded, err := fields(object)
+	if err != nil {
+		return err
+	}
+	hash, err := checksum.Of(decoded)
+	if err != nil {
+		return err
+	}
+	r.desired[name] = hash
+	r.resources[name] = resource
+	return nil
+}
+
+// AddActual records the kong object with the provided name observed in kong,
+// it's compared with the fields of the provided desired object when there is one.
+func (r *Report) AddActual(name string, desired interface{}, object interface{}) error {
+	if desired == nil {
+		hash, err := checksum.Of(object)
+		if err != nil {
+			return err
+		}
+		r.actual[name] = hash
+		return nil
+	}
+	projected, err := project(desired, object)
+	if err != nil {
+		return err
+	}
+	hash, err := checksum.Of(projected)
+	if err != nil {
+		return err
+	}
+	r.actual[name] = hash
+	return nil
+}
+
+// OutOfSync provides whether each k8s resource in the report has a desired kong object
+// that's missing from kong or differs from it, keyed by resource.
+func (r *Report) OutOfSync() map[string]bool {
+	outOfSync := make(map[string]bool)
+	for name, hash := range r.desired {
+		resource := r.resources[name]
+		outOfSync[resource] = outOfSync[resource] || r.actual[name] != hash
+	}
+	return outOfSync
+}
+
+// Run compares the desired and actual kong objects of every provided source at the provided interval
+// until the provided done channel is closed, exporting the outcome as metrics.
+// A comparison that takes longer than the interval is abandoned so a slow kong can't pile them up.
+// This method should be called asynchronously in it's own goroutine.
+func Run(done <-chan struct{}, interval time.Duration, sources ...Source) {
+	ctx := k8sclient.DoneContext(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			check(ctx, interval, sources)
+		}
+	}
+}
+
+// Carries out a single comparison of every source, resources that are no longer in any report
+// are dropped from the out of sync metric. Each source gets the provided timeout to compare its objects.
+func check(ctx context.Context, timeout time.Duration, sources []Source) {
+	metrics.DriftOutOfSync.Reset()
+	for _, source := range sources {
+		sourceCtx, cancel := context.WithTimeout(ctx, timeout)
+		report, err := source.Drift(sourceCtx)
+		cancel()
+		if err != nil {
+			log.Printf("Error comparing the desired kong objects with the ones in kong: %v", err)
+			continue
+		}
+		metrics.DriftDesiredObjects.WithLabelValues(report.kind).Set(float64(len(report.desired)))
+		metrics.DriftActualObjects.WithLabelValues(report.kind).Set(float64(len(report.actual)))
+		metrics.DriftDesiredHash.WithLabelValues(report.kind).Set(fingerprint(report.desired))
+		metrics.DriftActualHash.WithLabelValues(report.kind).Set(fingerprint(report.actual))
+		for resource, outOfSync := range report.OutOfSync() {
+			value := 0.0
+			if outOfSync {
+				value = 1
+			}
+			metrics.DriftOutOfSync.WithLabelValues(report.kind, resource).Set(value)
+		}
+	}
+}
+
+// Provides a number identifying the provided set of hashed objects keyed by name, it's the same for
+// equal sets and fits in a float without losing precision so it can be exported as a gauge.
+func fingerprint(objects map[string]string) float64 {
+	names := make([]string, 0, len(objects))
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([][2]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, [2]string{name, objects[name]})
+	}
+	hash, err := checksum.Of(pairs)
+	if err != nil {
+		return 0
+	}
+	value, err := strconv.ParseUint(hash[:13], 16, 64)
+	if err != nil {
+		return 0
+	}
+	return float64(value)
+}
+
+// Provides the fields of the provided actual object that are set in the provided desired object,
+// nested objects are narrowed down the same way.
+func project(desired interface{}, actual interface{}) (interface{}, error) {
+	desiredFields, err := fields(desired)
+	if err != nil {
+		return nil, err
+	}
+	actualFields, err := fields(actual)
+	if err != nil {
+		return nil, err
+	}
+	return narrow(desiredFields, actualFields), nil
+}
+
+func fields(object interface{}) (interface{}, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+func narrow(desired interface{}, actual interface{}) interface{} {
+	desiredMap, ok := desired.(map[string]interface{})
+	if !ok {
+		return actual
+	}
+	actualMap, ok := actual.(map[string]interface{})
+	if !ok {
+		return actual
+	}
+	narrowed := make(map[string]interface{}, len(desiredMap))
+	for key, value := range desiredMap {
+		if actualValue, exists := actualMap[key]; exists {
+			narrowed[key] = narrow(value, actualValue)
+		}
+	}
+	return narrowed
+}
@@ -0,0 +1,65 @@
+package finalizer
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+)
+
+// Name provides the finalizer that keeps a resource around until the kong objects
+// it represents have been removed.
+const Name = "k8s.freshweb.io/kong-cleanup"
+
+// Has lets us know whether the provided finalizers include ours.
+func Has(finalizers []string) bool {
+	for _, finalizer := range finalizers {
+		if finalizer == Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds our finalizer to the resource with the provided namespace and name, which currently
+// has the provided finalizers at the provided resource version.
+// A merge patch replaces the finalizers as a whole so the resource version is included,
+// this makes the write fail with a conflict rather than drop finalizers added since the resource was read.
+// The write is abandoned once the provided context is done.
+func Add(ctx context.Context, client *k8sclient.DynamicClient, namespace string, name string, resourceVersion string, finalizers []string) error {
+	if Has(finalizers) {
+		return nil
+	}
+	return patch(ctx, client, namespace, name, resourceVersion, append(append([]string{}, finalizers...), Name))
+}
+
+// Remove removes our finalizer from the resource with the provided namespace and name, which currently
+// has the provided finalizers at the provided resource version. Once no finalizers are left
+// Kubernetes goes on to delete a resource that's been marked for deletion.
+// The write is abandoned once the provided context is done.
+func Remove(ctx context.Context, client *k8sclient.DynamicClient, namespace string, name string, resourceVersion string, finalizers []string) error {
+	if !Has(finalizers) {
+		return nil
+	}
+	remaining := []string{}
+	for _, finalizer := range finalizers {
+		if finalizer != Name {
+			remaining = append(remaining, finalizer)
+		}
+	}
+	return patch(ctx, client, namespace, name, resourceVersion, remaining)
+}
+
+func patch(ctx context.Context, client *k8sclient.DynamicClient, namespace string, name string, resourceVersion string, finalizers []string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": resourceVersion,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.Patch(ctx, namespace, name, body)
+	return err
+}
@@ -0,0 +1,69 @@
+package gatewayapi
+
+import (
+	"context"
+	"log"
+
+	"github.com/freshwebio/k8s-kong-api/checksum"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Builds the kong API object the provided GatewayApi resource and service should be represented by.
+// When a service is exposing multiple ports the port selected by the resource is used.
+// The properties the resource leaves out are given the configured defaults.
+// TODO: Implement a way to allow for TLS enabled services with https.
+func (s *Service) kongAPIFor(a *GatewayApi, service *v1.Service) (*kong.API, error) {
+	upstreamURL, err := s.upstreamURLFor(a, service)
+	if err != nil {
+		return nil, err
+	}
+	return s.defaults.Apply(&kong.API{
+		Name:                   s.names.API(service.GetNamespace(), service.GetName()),
+		Hosts:                  a.Spec.Hosts,
+		URIs:                   a.Spec.Uris,
+		UpstreamURL:            upstreamURL,
+		StripURI:               a.Spec.StripURI,
+		Methods:                a.Spec.Methods,
+		PreserveHost:           a.Spec.PreserveHost,
+		Retries:                a.Spec.Retries,
+		UpstreamConnectTimeout: a.Spec.UpstreamConnectTimeout,
+		UpstreamSendTimeout:    a.Spec.UpstreamSendTimeout,
+		UpstreamReadTimeout:    a.Spec.UpstreamReadTimeout,
+		HTTPSOnly:              a.Spec.HTTPSOnly,
+		HTTPIfTerminated:       a.Spec.HTTPIfTerminated,
+	}), nil
+}
+
+// Lets us know whether the provided kong API object is exactly what was last applied
+// for the provided GatewayApi resource so the write to kong can be skipped.
+func (s *Service) kongAPIUnchanged(a *GatewayApi, api *kong.API) bool {
+	hash, err := checksum.Of(appliedState(a, api))
+	if err != nil {
+		return false
+	}
+	return checksum.Matches(a.Metadata.Annotations, hash)
+}
+
+// Records the hash of the kong API object that has just been applied
+// as an annotation on the provided GatewayApi resource.
+func (s *Service) recordAppliedKongAPI(ctx context.Context, a *GatewayApi, api *kong.API) {
+	hash, err := checksum.Of(appliedState(a, api))
+	if err != nil {
+		log.Printf("Error hashing the applied kong API object %v: %v", api.Name, err)
+		return
+	}
+	if checksum.Matches(a.Metadata.Annotations, hash) {
+		return
+	}
+	checksum.Record(ctx, s.k8sClient.Resource(Resource), a.Metadata.Namespace, a.Metadata.Name, hash)
+}
+
+// Provides what's hashed to tell whether the kong API objects for the provided GatewayApi resource
+// are what was last applied, the ports list is included so changes to the port API objects are picked up too.
+func appliedState(a *GatewayApi, api *kong.API) interface{} {
+	if len(a.Spec.Ports) == 0 {
+		return api
+	}
+	return []interface{}{api, a.Spec.Ports}
+}
@@ -0,0 +1,192 @@
+package gatewayapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/freshwebio/k8s-kong-api/controllerclass"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Client provides typed access to GatewayApi resources in Kubernetes.
+// It's built on the dynamic client so the type doesn't need to be registered with a scheme.
+type Client struct {
+	dynamic *k8sclient.DynamicClient
+}
+
+// NewClient creates a new instance of a GatewayApi client.
+func NewClient(k8sClient *k8sclient.Client) *Client {
+	return &Client{dynamic: k8sClient.Resource(Resource)}
+}
+
+// Get retrieves the GatewayApi resource with the provided namespace and name.
+func (c *Client) Get(ctx context.Context, namespace string, name string) (*GatewayApi, error) {
+	obj, err := c.dynamic.Get(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(obj)
+}
+
+// List retrieves the GatewayApi resources in the provided namespace that match the provided label selector.
+func (c *Client) List(ctx context.Context, namespace string, selector labels.Selector) (*GatewayApiList, error) {
+	list, err := c.dynamic.List(ctx, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	gatewayApis := &GatewayApiList{Metadata: list.Metadata, Items: []GatewayApi{}}
+	for i := range list.Items {
+		gatewayApi, err := fromUnstructured(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		gatewayApis.Items = append(gatewayApis.Items, *gatewayApi)
+	}
+	return gatewayApis, nil
+}
+
+// Watch watches the GatewayApi resources in the provided namespace that match the provided
+// label selector from the provided resource version.
+func (c *Client) Watch(ctx context.Context, namespace string, selector labels.Selector, resourceVersion string) (watch.Interface, error) {
+	w, err := c.dynamic.Watch(ctx, namespace, selector, resourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(in watch.Event) (watch.Event, bool) {
+		obj, ok := in.Object.(*k8sclient.Unstructured)
+		if !ok {
+			return in, true
+		}
+		gatewayApi, err := fromUnstructured(obj)
+		if err != nil {
+			log.Printf("Skipping the %v GatewayApi event that could not be decoded: %v", in.Type, err)
+			return in, false
+		}
+		in.Object = gatewayApi
+		return in, true
+	}), nil
+}
+
+// Update replaces the provided GatewayApi resource.
+func (c *Client) Update(ctx context.Context, a *GatewayApi) (*GatewayApi, error) {
+	if a.Kind == "" {
+		a.Kind = "GatewayApi"
+	}
+	if a.APIVersion == "" {
+		a.APIVersion = Resource.Group + "/" + Resource.Version
+	}
+	obj, err := toUnstructured(a)
+	if err != nil {
+		return nil, err
+	}
+	if obj, err = c.dynamic.Update(ctx, obj); err != nil {
+		return nil, err
+	}
+	return fromUnstructured(obj)
+}
+
+// Patch applies the provided JSON merge patch to the GatewayApi resource with the provided namespace and name.
+func (c *Client) Patch(ctx context.Context, namespace string, name string, patch []byte) (*GatewayApi, error) {
+	obj, err := c.dynamic.Patch(ctx, namespace, name, patch)
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(obj)
+}
+
+// UpdateStatus replaces the status of the provided GatewayApi resource, the whole resource
+// is replaced when the apiserver doesn't serve the status subresource for it.
+func (c *Client) UpdateStatus(ctx context.Context, a *GatewayApi) (*GatewayApi, error) {
+	if a.Kind == "" {
+		a.Kind = "GatewayApi"
+	}
+	if a.APIVersion == "" {
+		a.APIVersion = Resource.Group + "/" + Resource.Version
+	}
+	obj, err := toUnstructured(a)
+	if err != nil {
+		return nil, err
+	}
+	if obj, err = c.dynamic.UpdateStatus(ctx, obj); err != nil {
+		return nil, err
+	}
+	return fromUnstructured(obj)
+}
+
+// PatchStatus sets the status of the GatewayApi resource with the provided namespace and name
+// to the provided status without needing the latest resource version.
+func (c *Client) PatchStatus(ctx context.Context, namespace string, name string, status Status) (*GatewayApi, error) {
+	obj, err := c.dynamic.PatchStatus(ctx, namespace, name, status)
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(obj)
+}
+
+// ListWatch provides the list watch for the GatewayApi resources in the provided namespace
+// that match the provided label selector and belong to the provided controller class,
+// lists are abandoned and watches stopped once the provided context is done.
+func (c *Client) ListWatch(ctx context.Context, namespace string, selector labels.Selector, class string) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options api.ListOptions) (runtime.Object, error) {
+			list, err := c.List(ctx, namespace, selector)
+			if err != nil {
+				return nil, err
+			}
+			items := list.Items[:0]
+			for _, item := range list.Items {
+				if controllerclass.Matches(item.Metadata.Annotations, class) {
+					items = append(items, item)
+				}
+			}
+			list.Items = items
+			return list, nil
+		},
+		WatchFunc: func(options api.ListOptions) (watch.Interface, error) {
+			w, err := c.Watch(ctx, namespace, selector, options.ResourceVersion)
+			if err != nil {
+				return nil, err
+			}
+			return controllerclass.Filter(w, class), nil
+		},
+	}
+}
+
+// Provides a copy of the provided GatewayApi resource sharing nothing with it.
+func deepCopy(a *GatewayApi) (*GatewayApi, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	copied := &GatewayApi{}
+	if err = json.Unmarshal(data, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+func fromUnstructured(obj *k8sclient.Unstructured) (*GatewayApi, error) {
+	gatewayApi := &GatewayApi{}
+	if err := obj.Into(gatewayApi); err != nil {
+		return nil, err
+	}
+	return gatewayApi, nil
+}
+
+func toUnstructured(a *GatewayApi) (*k8sclient.Unstructured, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	obj := &k8sclient.Unstructured{}
+	if err = json.Unmarshal(data, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
@@ -0,0 +1,161 @@
+package gatewayapi
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/multicluster"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// CompactTargets walks the kong upstreams of the services referencing a GatewayApi resource
+// at the provided interval until the provided done channel is closed, compacting the target history
+// of every upstream with at least the provided number of stale target entries.
+// Kong keeps every target entry ever created for an upstream, an upstream is compacted by deleting
+// the entries that no longer decide whether a target is enabled, leaving the upstream itself in place.
+// Kong before 1.0 can't delete target entries, deleting a target only adds another entry with a weight of 0,
+// so nothing is done unless the client has been set up for kong 1.0 or later.
+// Upstreams only exist with remote clusters or endpoint targets configured so nothing is done without them either.
+// This method should be called asynchronously in it's own goroutine.
+func (s *Service) CompactTargets(done <-chan struct{}, interval time.Duration, threshold int) {
+	if !s.usesUpstreams() {
+		return
+	}
+	if !s.kongClient.DeletesTargets() {
+		log.Println("Leaving the target history of upstreams as it is, target entries can't be deleted from kong before 1.0")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.compactionPass(threshold)
+		}
+	}
+}
+
+// Measures the stale target entries of every upstream managed by this instance of the controller,
+// dispatching a compaction for the upstreams with at least the provided number of them.
+// Each upstream is measured and compacted under its own reconcile context.
+func (s *Service) compactionPass(threshold int) {
+	if s.serviceStore == nil {
+		return
+	}
+	staleTotal := 0
+	for _, obj := range s.serviceStore.List() {
+		service, ok := obj.(*v1.Service)
+		if !ok {
+			continue
+		}
+		if _, exists := service.Labels[s.apiLabel]; !exists || !s.reconciles(service.GetNamespace()) {
+			continue
+		}
+		upstreamName := multicluster.UpstreamName(service.GetNamespace(), service.GetName())
+		ctx, cancel := workqueue.Context(s.ctx, s.reconcileTimeout)
+		targets, err := s.kongClient.ListTargets(ctx, upstreamName)
+		cancel()
+		if err != nil {
+			if err != kong.ErrNotFound {
+				log.Printf("Error listing the targets of the %v upstream for compaction: %v", upstreamName, err)
+			}
+			continue
+		}
+		stale := staleTargets(targets)
+		staleTotal += stale
+		if stale < threshold {
+			continue
+		}
+		v1s := *service
+		// Compactions run under the same key as the target syncs for the service
+		// so targets are never enabled or disabled while their entries are being deleted.
+		s.limiter.Dispatch(v1s.GetNamespace(), limiterKey(v1s.GetNamespace(), v1s.GetName()), func() {
+			ctx, cancel := workqueue.Context(s.ctx, s.reconcileTimeout)
+			defer cancel()
+			if err := s.compactUpstream(ctx, &v1s); err != nil {
+				log.Printf("Error compacting the %v upstream: %v", upstreamName, err)
+			}
+		})
+	}
+	metrics.UpstreamStaleTargets.WithLabelValues().Set(float64(staleTotal))
+}
+
+// Deletes the entries in the target history of the kong upstream for the provided service that don't decide
+// whether a target is enabled, the superseded entries of every target and then the latest entries of disabled targets.
+// Superseded entries go first so a disabled target is never brought back by an earlier entry enabling it.
+func (s *Service) compactUpstream(ctx context.Context, service *v1.Service) error {
+	upstreamName := multicluster.UpstreamName(service.GetNamespace(), service.GetName())
+	targets, err := s.kongClient.ListTargets(ctx, upstreamName)
+	if err != nil {
+		if err == kong.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	// Upstreams of services whose GatewayApi resource belongs to another controller class are left to it.
+	_, err = s.getGatewayApi(ctx, service.GetNamespace(), service.Labels[s.apiLabel])
+	if err == ErrOtherControllerClass {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stale := compactableTargets(targets)
+	if len(stale) == 0 {
+		return nil
+	}
+	log.Printf("Compacting the %v upstream with %v stale target entries", upstreamName, len(stale))
+	deleted := 0
+	defer func() {
+		if deleted > 0 {
+			metrics.TargetCompactionsTotal.WithLabelValues().Inc()
+			metrics.TargetEntriesCompactedTotal.WithLabelValues().Add(float64(deleted))
+		}
+	}()
+	for _, target := range stale {
+		if err := s.limiter.WaitWrite(ctx, service.GetNamespace()); err != nil {
+			return err
+		}
+		err = s.kongClient.DeleteTarget(ctx, upstreamName, target.ID)
+		if err != nil && err != kong.ErrNotFound {
+			return err
+		}
+		deleted++
+	}
+	return nil
+}
+
+// Provides the entries in the provided target history that can be deleted without changing which targets
+// are enabled, the entries superseded by a later entry for the same target followed by the latest entries
+// of disabled targets.
+func compactableTargets(targets *kong.TargetList) []*kong.Target {
+	latest := latestTargets(targets)
+	superseded := []*kong.Target{}
+	disabled := []*kong.Target{}
+	for _, target := range targets.Data {
+		if latest[target.Target] != target {
+			superseded = append(superseded, target)
+		} else if target.Weight == 0 {
+			disabled = append(disabled, target)
+		}
+	}
+	return append(superseded, disabled...)
+}
+
+// Provides the number of entries in the provided target history
+// that aren't the latest entry of an enabled target.
+func staleTargets(targets *kong.TargetList) int {
+	active := 0
+	for _, target := range latestTargets(targets) {
+		if target.Weight > 0 {
+			active++
+		}
+	}
+	return len(targets.Data) - active
+}
@@ -0,0 +1,105 @@
+package gatewayapi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/kong/fake"
+	"github.com/freshwebio/k8s-kong-api/multicluster"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Creates a service compacting upstreams in the provided fake kong for the orders service,
+// with the orders GatewayApi resource in its cache.
+func newCompactionService(t *testing.T, k *fake.Kong) *Service {
+	s := newTargetsService(k)
+	s.apiLabel = "kong.gateway.api"
+	s.onboarding = onboarding.NewWatcher(nil, "", "")
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	gatewayApi := &GatewayApi{Metadata: api.ObjectMeta{Namespace: "default", Name: "orders"}}
+	if err := indexer.Add(gatewayApi); err != nil {
+		t.Fatalf("caching the orders GatewayApi resource: %v", err)
+	}
+	s.gatewayApis = NewLister(indexer)
+	service := ordersService()
+	service.Labels = map[string]string{s.apiLabel: "orders"}
+	s.serviceStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	if err := s.serviceStore.Add(service); err != nil {
+		t.Fatalf("caching the orders service: %v", err)
+	}
+	return s
+}
+
+func TestCompactUpstreamKeepsOnlyTheEnabledTargets(t *testing.T) {
+	k := fake.New()
+	s := newCompactionService(t, k)
+	service := ordersService()
+	service.Labels = map[string]string{s.apiLabel: "orders"}
+	upstreamName := multicluster.UpstreamName(service.Namespace, service.Name)
+	seedUpstream(t, k, upstreamName)
+	before := enabledTargets(t, k, upstreamName)
+
+	if err := s.compactUpstream(context.Background(), service); err != nil {
+		t.Fatalf("compacting the upstream: %v", err)
+	}
+	if enabled := enabledTargets(t, k, upstreamName); !reflect.DeepEqual(enabled, before) {
+		t.Errorf("expected the enabled targets to stay %v but got %v", before, enabled)
+	}
+	targets, err := k.ListTargets(context.Background(), upstreamName)
+	if err != nil {
+		t.Fatalf("listing the compacted targets: %v", err)
+	}
+	if stale := staleTargets(targets); stale != 0 {
+		t.Errorf("expected no stale target entries to be left but got %v", stale)
+	}
+}
+
+func TestCompactionPassOnlyCompactsUpstreamsOverTheThreshold(t *testing.T) {
+	k := fake.New()
+	s := newCompactionService(t, k)
+	upstreamName := multicluster.UpstreamName("default", "orders")
+	seedUpstream(t, k, upstreamName)
+	targets, err := k.ListTargets(context.Background(), upstreamName)
+	if err != nil {
+		t.Fatalf("listing the targets: %v", err)
+	}
+	stale := staleTargets(targets)
+
+	s.compactionPass(stale + 1)
+	s.limiter.Wait()
+	if calls := k.Calls("DeleteTarget"); calls != 0 {
+		t.Fatalf("expected an upstream under the threshold to be left alone but got %v deletes", calls)
+	}
+	s.compactionPass(stale)
+	s.limiter.Wait()
+	if calls := k.Calls("DeleteTarget"); calls != stale {
+		t.Errorf("expected the %v stale entries to be deleted but got %v deletes", stale, calls)
+	}
+}
+
+func TestCompactTargetsLeavesKongBefore1Alone(t *testing.T) {
+	k := fake.New()
+	k.DisableTargetDeletes()
+	s := newCompactionService(t, k)
+	seedUpstream(t, k, multicluster.UpstreamName("default", "orders"))
+
+	done := make(chan struct{})
+	defer close(done)
+	returned := make(chan struct{})
+	go func() {
+		s.CompactTargets(done, time.Millisecond, 1)
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("expected compaction not to run against kong before 1.0")
+	}
+	if calls := k.Calls("ListTargets"); calls != 0 {
+		t.Errorf("expected the upstreams not to be measured but got %v target lists", calls)
+	}
+}
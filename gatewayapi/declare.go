@@ -0,0 +1,86 @@
+package gatewayapi
+
+import (
+	"errors"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/multicluster"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// HasSynced lets us know whether the service and GatewayApi resource caches have been loaded.
+func (s *Service) HasSynced() bool {
+	if len(s.synced) == 0 {
+		return false
+	}
+	for _, synced := range s.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Declare adds the kong API objects the cached services and GatewayApi resources reconciled by this
+// instance call for to the provided declarative configuration, along with their upstreams and targets
+// when upstreams are in use. Resources that fail validation are left out like they are by Drift.
+func (s *Service) Declare(cfg *kong.DeclarativeConfig) error {
+	if !s.HasSynced() {
+		return errors.New("The gateway api caches haven't synced yet")
+	}
+	for _, obj := range s.serviceStore.List() {
+		service, ok := obj.(*v1.Service)
+		if !ok {
+			continue
+		}
+		gatewayApiName, exists := service.Labels[s.apiLabel]
+		if !exists || !s.reconciles(service.GetNamespace()) {
+			continue
+		}
+		gatewayApi, exists, err := s.gatewayApis.Get(service.GetNamespace(), gatewayApiName)
+		if err != nil || !exists {
+			continue
+		}
+		if s.primaryService(gatewayApi, service) != service {
+			// The other services selected by the resource are targets of the upstream of the primary one.
+			continue
+		}
+		api, err := s.kongAPIFor(gatewayApi, service)
+		if err != nil {
+			continue
+		}
+		if err = s.declareUpstream(cfg, service.GetName(), gatewayApi, service); err != nil {
+			continue
+		}
+		cfg.AddAPI(api)
+		for _, port := range gatewayApi.Spec.Ports {
+			portAPI, err := s.portKongAPIFor(gatewayApi, port, service)
+			if err != nil {
+				continue
+			}
+			if err = s.declareUpstream(cfg, PortAPIName(service.GetName(), port.Name), portVariant(gatewayApi, port), service); err != nil {
+				continue
+			}
+			cfg.AddAPI(portAPI)
+		}
+	}
+	return nil
+}
+
+// Adds the upstream for the service or port with the provided name to the provided declarative configuration
+// with the targets for the port of the service selected by the provided GatewayApi resource.
+func (s *Service) declareUpstream(cfg *kong.DeclarativeConfig, name string, a *GatewayApi, service *v1.Service) error {
+	if !s.balances(a, service) {
+		return nil
+	}
+	desired, err := s.desiredTargets(a, service)
+	if err != nil {
+		return err
+	}
+	targets := make([]string, 0, len(desired))
+	for target := range desired {
+		targets = append(targets, target)
+	}
+	cfg.AddUpstream(multicluster.UpstreamName(service.GetNamespace(), name), targets, s.defaults.TargetWeight)
+	return nil
+}
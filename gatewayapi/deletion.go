@@ -0,0 +1,99 @@
+package gatewayapi
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+)
+
+// Keeps track of the kong APIs that have been marked for deletion
+// and are waiting for the deletion grace period to pass.
+type pendingDeletions struct {
+	mu      sync.Mutex
+	pending map[string]*pendingDeletion
+}
+
+// Provides a single deletion waiting on the grace period.
+type pendingDeletion struct {
+	timer *time.Timer
+}
+
+func newPendingDeletions() *pendingDeletions {
+	return &pendingDeletions{pending: make(map[string]*pendingDeletion)}
+}
+
+// Schedules the provided function to be called once the grace period has passed
+// for the provided key, replacing any deletion already pending for the key.
+// The provided function receives the pending deletion so it can be claimed before it's carried out.
+func (p *pendingDeletions) schedule(key string, gracePeriod time.Duration, fn func(d *pendingDeletion)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if existing, exists := p.pending[key]; exists {
+		existing.timer.Stop()
+	}
+	d := &pendingDeletion{}
+	d.timer = time.AfterFunc(gracePeriod, func() {
+		fn(d)
+	})
+	p.pending[key] = d
+}
+
+// Claims the provided pending deletion, this will return false when the deletion
+// has been cancelled or replaced in the meantime in which case it should not be carried out.
+func (p *pendingDeletions) claim(key string, d *pendingDeletion) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if current, exists := p.pending[key]; exists && current == d {
+		delete(p.pending, key)
+		return true
+	}
+	return false
+}
+
+// Cancels the deletion pending for the provided key,
+// lets us know whether there was a deletion to cancel.
+func (p *pendingDeletions) cancel(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if d, exists := p.pending[key]; exists {
+		d.timer.Stop()
+		delete(p.pending, key)
+		return true
+	}
+	return false
+}
+
+// Marks the kong API object the provided GatewayApi represents for deletion,
+// it only gets removed once the deletion grace period has passed without the resource reappearing.
+func (s *Service) scheduleKongGatewayApiDeletion(a GatewayApi) {
+	apiName, exists := a.Spec.Selector[s.serviceSelectorLabel]
+	if !exists {
+		return
+	}
+	namespace := a.Metadata.Namespace
+	key := limiterKey(namespace, apiName)
+	log.Printf("The %v kong API has been marked for deletion in %v", apiName, s.deletionGracePeriod)
+	s.pendingDeletions.schedule(key, s.deletionGracePeriod, func(d *pendingDeletion) {
+		// Go through the limiter so the deletion can't race with the resource reappearing.
+		resource := syncerror.ResourceKey("gatewayapis", namespace, a.Metadata.Name)
+		s.dispatch(namespace, apiName, resource, "deletion of the "+apiName+" kong API after the grace period", func(ctx context.Context) error {
+			if !s.pendingDeletions.claim(key, d) {
+				return nil
+			}
+			return s.deleteKongGatewayApi(ctx, a)
+		})
+	})
+}
+
+// Cancels the pending deletion of the kong API object for the provided namespace and API name,
+// lets us know whether a deletion was cancelled.
+func (s *Service) cancelKongGatewayApiDeletion(namespace string, apiName string) bool {
+	if s.pendingDeletions.cancel(limiterKey(namespace, apiName)) {
+		log.Printf("Cancelled the pending deletion of the %v kong API as its resource has reappeared", apiName)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package gatewayapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/freshwebio/k8s-kong-api/drift"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Drift compares the kong API objects the cached services and GatewayApi resources reconciled
+// by this instance call for with the API objects in kong owned by the resources it reconciles.
+// Services without their GatewayApi resource or with nothing to expose don't call for an API object.
+func (s *Service) Drift(ctx context.Context) (*drift.Report, error) {
+	if s.serviceStore == nil || s.gatewayApis == nil {
+		return nil, errors.New("The gateway api caches haven't been started yet")
+	}
+	report := drift.NewReport("api")
+	desired := make(map[string]*kong.API)
+	for _, obj := range s.serviceStore.List() {
+		service, ok := obj.(*v1.Service)
+		if !ok {
+			continue
+		}
+		gatewayApiName, exists := service.Labels[s.apiLabel]
+		if !exists || !s.reconciles(service.GetNamespace()) {
+			continue
+		}
+		gatewayApi, exists, err := s.gatewayApis.Get(service.GetNamespace(), gatewayApiName)
+		if err != nil || !exists {
+			continue
+		}
+		api, err := s.kongAPIFor(gatewayApi, service)
+		if err != nil {
+			continue
+		}
+		resource := syncerror.ResourceKey("gatewayapis", service.GetNamespace(), gatewayApiName)
+		if err = report.AddDesired(api.Name, resource, api); err != nil {
+			return nil, err
+		}
+		desired[api.Name] = api
+		for _, port := range gatewayApi.Spec.Ports {
+			portAPI, err := s.portKongAPIFor(gatewayApi, port, service)
+			if err != nil {
+				continue
+			}
+			if err = report.AddDesired(portAPI.Name, resource, portAPI); err != nil {
+				return nil, err
+			}
+			desired[portAPI.Name] = portAPI
+		}
+	}
+	apis, err := s.kongClient.ListAPIs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, api := range apis {
+		if want, exists := desired[api.Name]; exists {
+			err = report.AddActual(api.Name, want, api)
+		} else if s.reconcilesKongAPI(api.Name) {
+			err = report.AddActual(api.Name, nil, api)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,43 @@
+package gatewayapi
+
+import (
+	"strings"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Records the outcome of a reconcile of the resource with the provided key as a Kubernetes Event on
+// the GatewayApi resource or service it was for. Only the key of the resource is known once the reconcile
+// has finished so it's looked up in the informer caches, resources that have gone are forgotten.
+func (s *Service) recordOutcome(resource string, err error) {
+	if s.recorder == nil {
+		return
+	}
+	parts := strings.SplitN(resource, "/", 3)
+	if len(parts) != 3 {
+		return
+	}
+	namespace, name := parts[1], parts[2]
+	switch parts[0] {
+	case "gatewayapis":
+		ref := v1.ObjectReference{Kind: "GatewayApi", APIVersion: Resource.Group + "/" + Resource.Version,
+			Namespace: namespace, Name: name}
+		gatewayApi, exists, lookupErr := s.gatewayApis.Get(namespace, name)
+		if lookupErr != nil || !exists {
+			s.recorder.Forget(ref)
+			return
+		}
+		ref.UID = gatewayApi.Metadata.UID
+		s.recorder.Outcome(ref, err)
+	case "services":
+		ref := v1.ObjectReference{Kind: "Service", APIVersion: "v1", Namespace: namespace, Name: name}
+		obj, exists, lookupErr := s.serviceStore.GetByKey(namespace + "/" + name)
+		service, ok := obj.(*v1.Service)
+		if lookupErr != nil || !exists || !ok {
+			s.recorder.Forget(ref)
+			return
+		}
+		ref.UID = service.UID
+		s.recorder.Outcome(ref, err)
+	}
+}
@@ -0,0 +1,41 @@
+package gatewayapi
+
+import (
+	"context"
+	"github.com/freshwebio/k8s-kong-api/finalizer"
+)
+
+// Lets us know whether the provided GatewayApi resource has been marked for deletion.
+func terminating(a *GatewayApi) bool {
+	return a.Metadata.DeletionTimestamp != nil
+}
+
+// Adds our finalizer to the provided GatewayApi resource so it can't disappear from Kubernetes
+// before its kong API objects have been deleted, even while the controller isn't running.
+// DB-less kong is configured from the resources that exist so it has nothing to clean up.
+func (s *Service) ensureFinalizer(ctx context.Context, a *GatewayApi) error {
+	if s.dbless || terminating(a) {
+		return nil
+	}
+	return finalizer.Add(ctx, s.k8sClient.Resource(Resource), a.Metadata.Namespace, a.Metadata.Name,
+		a.Metadata.ResourceVersion, a.Metadata.Finalizers)
+}
+
+// Deletes the kong API objects of the provided GatewayApi resource that has been marked for deletion
+// and then removes our finalizer so Kubernetes can go on to delete the resource.
+// With a deletion grace period the deletion is scheduled and the finalizer removed straight away,
+// a resource can't be recreated while it's waiting on finalizers which is what the grace period is there for.
+func (s *Service) finalizeKongGatewayApi(ctx context.Context, a GatewayApi) error {
+	if !finalizer.Has(a.Metadata.Finalizers) {
+		return nil
+	}
+	if s.deletionGracePeriod > 0 && !s.dbless {
+		s.scheduleKongGatewayApiDeletion(a)
+	} else if !s.dbless {
+		if err := s.deleteKongGatewayApi(ctx, a); err != nil {
+			return err
+		}
+	}
+	return finalizer.Remove(ctx, s.k8sClient.Resource(Resource), a.Metadata.Namespace, a.Metadata.Name,
+		a.Metadata.ResourceVersion, a.Metadata.Finalizers)
+}
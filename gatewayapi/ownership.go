@@ -0,0 +1,81 @@
+package gatewayapi
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/freshwebio/k8s-kong-api/ownership"
+)
+
+// Provides the owner recorded in the ownership registry for a GatewayApi resource.
+func ownerOf(a *GatewayApi) string {
+	return "gatewayapi/" + a.Metadata.Namespace + "/" + a.Metadata.Name
+}
+
+// Works out whether the provided GatewayApi resource may manage the pre-existing kong API object
+// with the provided name, adopting the API object when the resource is allowed to.
+// When the API object can't be managed the refusal is recorded as a condition on the resource
+// instead of overwriting someone else's configuration.
+// Also lets us know whether the API object has just been adopted so the caller can bring it in line with the resource.
+func (s *Service) canManageKongAPI(a *GatewayApi, apiName string) (bool, bool, error) {
+	owner := ownerOf(a)
+	current, owned := s.registry.Owner(ownership.KindAPI, apiName)
+	if owned && current == owner {
+		return true, false, nil
+	}
+	if a.Metadata.Annotations[AdoptAnnotation] != "true" && (owned || !s.adoptUnowned) {
+		message := fmt.Sprintf("The %v kong API already exists and isn't managed by this resource, "+
+			"set the %v annotation to \"true\" to adopt it", apiName, AdoptAnnotation)
+		if owned {
+			message = fmt.Sprintf("The %v kong API is already managed by %v, "+
+				"set the %v annotation to \"true\" to take it over", apiName, current, AdoptAnnotation)
+		}
+		log.Println(message)
+		return false, false, s.setCondition(a, ConditionKongAPIOwned, false, "AdoptionRequired", message)
+	}
+	err := s.registry.Claim(ownership.KindAPI, apiName, owner)
+	if err != nil {
+		return false, false, err
+	}
+	log.Printf("The %v kong API has been adopted by %v", apiName, owner)
+	return true, true, s.setCondition(a, ConditionKongAPIOwned, true, "Adopted",
+		fmt.Sprintf("The pre-existing %v kong API was adopted by this resource", apiName))
+}
+
+// Records the provided GatewayApi resource as the owner of a kong API object it has just created.
+func (s *Service) claimKongAPI(a *GatewayApi, apiName string) error {
+	err := s.registry.Claim(ownership.KindAPI, apiName, ownerOf(a))
+	if err != nil {
+		return err
+	}
+	return s.setCondition(a, ConditionKongAPIOwned, true, "Created",
+		fmt.Sprintf("The %v kong API was created for this resource", apiName))
+}
+
+// Lets us know whether the provided GatewayApi resource owns the kong API object with the provided name.
+// Unowned API objects are treated as owned when the controller is set up to adopt them.
+func (s *Service) ownsKongAPI(a *GatewayApi, apiName string) bool {
+	current, owned := s.registry.Owner(ownership.KindAPI, apiName)
+	if !owned {
+		return s.adoptUnowned
+	}
+	return current == ownerOf(a)
+}
+
+// Lets us know whether the kong API object with the provided name is managed by the controller at all.
+func (s *Service) managesKongAPI(apiName string) bool {
+	_, owned := s.registry.Owner(ownership.KindAPI, apiName)
+	return owned || s.adoptUnowned
+}
+
+// Lets us know whether the kong API object with the provided name is owned by a GatewayApi resource
+// in a namespace reconciled by this instance, unowned API objects count when they can be adopted.
+func (s *Service) reconcilesKongAPI(apiName string) bool {
+	owner, owned := s.registry.Owner(ownership.KindAPI, apiName)
+	if !owned {
+		return s.adoptUnowned
+	}
+	parts := strings.Split(owner, "/")
+	return len(parts) == 3 && parts[0] == "gatewayapi" && s.reconciles(parts[1])
+}
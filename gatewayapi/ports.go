@@ -0,0 +1,144 @@
+package gatewayapi
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/multicluster"
+	"github.com/freshwebio/k8s-kong-api/naming"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// PortAPIName provides the name of the kong API object for the port with the provided name
+// of the service with the provided name.
+func PortAPIName(serviceName string, portName string) string {
+	return serviceName + "-" + portName
+}
+
+// KongAPINames provides the names of every kong API object the provided GatewayApi resource represents
+// for the service with the provided name, the API object for the service itself followed by one for each listed port.
+// The names are derived following the provided naming scheme.
+func KongAPINames(a *GatewayApi, serviceName string, scheme naming.Scheme) []string {
+	names := []string{scheme.API(a.Metadata.Namespace, serviceName)}
+	for _, port := range a.Spec.Ports {
+		names = append(names, scheme.API(a.Metadata.Namespace, PortAPIName(serviceName, port.Name)))
+	}
+	return names
+}
+
+// Provides a copy of the provided GatewayApi resource selecting the provided port
+// with the hosts, uris and methods of the port in place of its own.
+func portVariant(a *GatewayApi, port PortAPI) *GatewayApi {
+	variant := *a
+	variant.Spec.Hosts, variant.Spec.Uris, variant.Spec.Methods = port.Hosts, port.Uris, port.Methods
+	variant.Spec.PortName, variant.Spec.Port, variant.Spec.Ports = port.Name, 0, nil
+	return &variant
+}
+
+// Builds the kong API object for the provided port listed by the provided GatewayApi resource,
+// with upstreams in use it's pointed at its own upstream so it only balances across the targets for the port.
+func (s *Service) portKongAPIFor(a *GatewayApi, port PortAPI, service *v1.Service) (*kong.API, error) {
+	if len(port.Hosts) == 0 && len(port.Uris) == 0 && len(port.Methods) == 0 {
+		return nil, syncerror.Validationf("The %v port of the gateway api resource %v must set hosts, uris or methods",
+			port.Name, a.Metadata.Name)
+	}
+	api, err := s.kongAPIFor(portVariant(a, port), service)
+	if err != nil {
+		return nil, err
+	}
+	api.Name = s.names.API(service.GetNamespace(), PortAPIName(service.GetName(), port.Name))
+	if s.balances(a, service) {
+		api.UpstreamURL = "http://" + multicluster.UpstreamName(service.GetNamespace(), PortAPIName(service.GetName(), port.Name))
+	}
+	return api, nil
+}
+
+// Brings the kong API objects for the ports listed by the provided GatewayApi resource in line with
+// the resource and the provided service, deleting the ones it owns for ports that are no longer listed.
+// Pre-existing API objects are only taken over when they can be adopted by the resource.
+func (s *Service) syncPortAPIs(ctx context.Context, a *GatewayApi, service *v1.Service) error {
+	desired := make(map[string]bool)
+	for _, port := range a.Spec.Ports {
+		api, err := s.portKongAPIFor(a, port, service)
+		if err != nil {
+			return err
+		}
+		desired[api.Name] = true
+		upstreamName := multicluster.UpstreamName(service.GetNamespace(), PortAPIName(service.GetName(), port.Name))
+		err = s.syncUpstream(ctx, upstreamName, portVariant(a, port), service)
+		if err != nil {
+			return err
+		}
+		current, err := s.kongClient.GetAPI(ctx, api.Name)
+		if err != nil {
+			if err != kong.ErrNotFound {
+				return err
+			}
+			log.Printf("Creating the %v kong API for the %v port of the %v service", api.Name, port.Name, service.GetName())
+			if err := s.limiter.WaitWrite(ctx, a.Metadata.Namespace); err != nil {
+				return err
+			}
+			if _, err = s.kongClient.CreateAPI(ctx, api); err != nil {
+				return err
+			}
+			if err = s.claimKongAPI(a, api.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		manage, _, err := s.canManageKongAPI(a, api.Name)
+		if err != nil {
+			return err
+		}
+		if !manage {
+			continue
+		}
+		if err = s.writeKongAPI(ctx, a.Metadata.Namespace, current, api); err != nil {
+			return err
+		}
+	}
+	return s.deletePortAPIs(ctx, a, service.GetName(), desired)
+}
+
+// Brings the targets of the kong upstreams for the ports listed by the provided GatewayApi resource
+// in line with the provided service.
+func (s *Service) syncPortTargets(ctx context.Context, a *GatewayApi, service *v1.Service) error {
+	for _, port := range a.Spec.Ports {
+		upstreamName := multicluster.UpstreamName(service.GetNamespace(), PortAPIName(service.GetName(), port.Name))
+		if err := s.syncUpstream(ctx, upstreamName, portVariant(a, port), service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes the kong API objects for ports of the service with the provided name owned by the provided
+// GatewayApi resource, apart from the ones with the kong API names in keep.
+func (s *Service) deletePortAPIs(ctx context.Context, a *GatewayApi, serviceName string, keep map[string]bool) error {
+	owner := ownerOf(a)
+	for apiName, current := range s.registry.Owned(ownership.KindAPI) {
+		// The prefix is matched on the name the API object was derived from as kong API names can carry the namespace.
+		localName := s.names.Local(a.Metadata.Namespace, apiName)
+		if current != owner || keep[apiName] || !strings.HasPrefix(localName, serviceName+"-") {
+			continue
+		}
+		log.Printf("Deleting the %v kong API as its port is no longer listed by %v", apiName, owner)
+		if err := s.limiter.WaitWrite(ctx, a.Metadata.Namespace); err != nil {
+			return err
+		}
+		if err := s.kongClient.DeleteAPI(ctx, apiName); err != nil && err != kong.ErrNotFound {
+			return err
+		}
+		if err := s.deleteUpstream(ctx, a.Metadata.Namespace, localName); err != nil {
+			return err
+		}
+		if err := s.registry.Release(ownership.KindAPI, apiName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
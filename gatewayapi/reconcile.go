@@ -0,0 +1,203 @@
+package gatewayapi
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/freshwebio/k8s-kong-api/checksum"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Queues the provided GatewayApi resource to be reconciled, resources in namespaces
+// outside of our shard or that haven't been onboarded are left alone.
+func (s *Service) queueGatewayApi(a *GatewayApi) {
+	namespace, apiName := a.Metadata.Namespace, a.Spec.Selector[s.serviceSelectorLabel]
+	if !s.reconciles(namespace) {
+		return
+	}
+	if s.verbose {
+		log.Printf("Queueing a reconcile for the %v kong API in the %v namespace", apiName, namespace)
+	}
+	s.queue.Add(namespace, limiterKey(namespace, apiName), syncerror.ResourceKey("gatewayapis", namespace, a.Metadata.Name))
+}
+
+// Queues the provided service to be reconciled like queueGatewayApi.
+func (s *Service) queueService(service *v1.Service) {
+	namespace := service.GetNamespace()
+	if !s.reconciles(namespace) {
+		return
+	}
+	if s.verbose {
+		log.Printf("Queueing a reconcile for the %v kong API in the %v namespace", service.GetName(), namespace)
+	}
+	s.queue.Add(namespace, limiterKey(namespace, service.GetName()), syncerror.ResourceKey("services", namespace, service.GetName()))
+}
+
+// Reconciles the resource with the provided key from its latest state, recording the outcome.
+func (s *Service) reconcile(key string) error {
+	ctx, cancel := workqueue.Context(s.ctx, s.reconcileTimeout)
+	defer cancel()
+	err := s.syncResource(ctx, key)
+	s.recordResult(key, "reconcile of "+key, err)
+	return err
+}
+
+// Brings kong in line with the latest state of the resource with the provided key,
+// cleaning up after resources that have been deleted.
+// A reconcile that has been forced by a resync stays forced until it succeeds.
+func (s *Service) syncResource(ctx context.Context, key string) (err error) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 {
+		return nil
+	}
+	forced := s.memory.TakeForced(key)
+	defer func() {
+		if err != nil && forced {
+			s.memory.Force(key)
+		}
+	}()
+	switch parts[0] {
+	case "gatewayapis":
+		return s.syncGatewayApi(ctx, key, parts[1], parts[2], forced)
+	case "services":
+		return s.syncService(ctx, key, parts[1], parts[2], forced)
+	}
+	return nil
+}
+
+// Brings the kong API objects for the GatewayApi resource with the provided key, namespace and name
+// in line with its latest state, the state it was last synced with tells us whether it has been pointed at
+// another service. With the declarative strategy only forced reconciles write to kong.
+func (s *Service) syncGatewayApi(ctx context.Context, key string, namespace string, name string, forced bool) error {
+	cached, exists, err := s.gatewayApis.Get(namespace, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		deleted, wasDeleted := s.memory.LastDeleted(key)
+		if !wasDeleted {
+			return nil
+		}
+		if err = s.removeKongGatewayApi(ctx, *deleted.(*GatewayApi)); err != nil {
+			return err
+		}
+		s.memory.Forget(key)
+		return nil
+	}
+	// The cached copy is never modified as it's shared with the informer.
+	a, err := deepCopy(cached)
+	if err != nil {
+		return err
+	}
+	if terminating(a) {
+		return s.finalizeKongGatewayApi(ctx, *a)
+	}
+	if s.dbless || (s.declarative && !forced) {
+		return nil
+	}
+	if forced {
+		a.Metadata.Annotations = checksum.Without(a.Metadata.Annotations)
+	}
+	if err = s.ensureFinalizer(ctx, a); err != nil {
+		return err
+	}
+	old := *a
+	if last, synced := s.memory.LastSynced(key); synced {
+		old = *last.(*GatewayApi)
+	} else {
+		// The API object was never removed when the resource reappears within the deletion grace period.
+		s.cancelKongGatewayApiDeletion(namespace, a.Spec.Selector[s.serviceSelectorLabel])
+	}
+	// Updating a resource against itself creates the API object when it's missing
+	// and brings it back in line with the resource otherwise.
+	if err = s.updateKongGatewayApi(ctx, old, *a); err != nil {
+		return err
+	}
+	s.memory.Synced(key, a)
+	return nil
+}
+
+// Removes the kong API object for the provided GatewayApi resource which has been deleted,
+// with a deletion grace period it's only marked for deletion.
+func (s *Service) removeKongGatewayApi(ctx context.Context, a GatewayApi) error {
+	if s.deletionGracePeriod > 0 {
+		s.scheduleKongGatewayApiDeletion(a)
+		return nil
+	}
+	return s.deleteKongGatewayApi(ctx, a)
+}
+
+// Brings the kong API object for the service with the provided key, namespace and name in line with its
+// latest state. Services that haven't been synced since the controller started and forced reconciles
+// go through everything, otherwise only what depends on the changes since the last sync is updated.
+func (s *Service) syncService(ctx context.Context, key string, namespace string, name string, forced bool) error {
+	obj, exists, err := s.serviceStore.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		deleted, wasDeleted := s.memory.LastDeleted(key)
+		if !wasDeleted {
+			return nil
+		}
+		gone := deleted.(*v1.Service)
+		if last, synced := s.memory.LastSynced(key); synced {
+			// A service that has its gateway label removed drops out of the services we watch
+			// without the label, the state it was last synced with still tells us what it was represented by.
+			gone = last.(*v1.Service)
+		}
+		if err = s.deleteKongGatewayApiForService(ctx, *gone); err != nil {
+			return err
+		}
+		s.memory.Forget(key)
+		return nil
+	}
+	service, ok := obj.(*v1.Service)
+	if !ok {
+		return nil
+	}
+	if s.dbless || (s.declarative && !forced) {
+		return nil
+	}
+	v1s := *service
+	last, synced := s.memory.LastSynced(key)
+	relabelled := synced && s.relabelled(last.(*v1.Service), &v1s)
+	if relabelled {
+		// The kong API the service used to be represented by is torn down rather than left serving traffic,
+		// the service is then synced from scratch for whatever its labels select now.
+		log.Printf("The labels selecting the %v service for a GatewayApi have changed, removing the kong API it was represented by",
+			name)
+		if err = s.deleteKongGatewayApiForService(ctx, *last.(*v1.Service)); err != nil {
+			return err
+		}
+	}
+	if synced && !relabelled && !forced {
+		err = s.updateKongGatewayApiForService(ctx, *last.(*v1.Service), v1s)
+	} else {
+		if !synced || (relabelled && s.labelled(&v1s)) {
+			// A service that comes back or gets its labels back within the deletion grace period keeps its API object.
+			s.cancelKongGatewayApiDeletion(namespace, name)
+		}
+		err = s.createKongGatewayApiForService(ctx, v1s)
+	}
+	if err != nil {
+		return err
+	}
+	s.memory.Synced(key, &v1s)
+	return nil
+}
+
+// Lets us know whether the gateway or service selector labels of the provided service have been removed
+// or changed since the provided state it was last synced with.
+func (s *Service) relabelled(last *v1.Service, current *v1.Service) bool {
+	return last.Labels[s.apiLabel] != current.Labels[s.apiLabel] ||
+		last.Labels[s.serviceSelectorLabel] != current.Labels[s.serviceSelectorLabel]
+}
+
+// Lets us know whether the provided service carries both the gateway and service selector labels.
+func (s *Service) labelled(service *v1.Service) bool {
+	return service.Labels[s.apiLabel] != "" && service.Labels[s.serviceSelectorLabel] != ""
+}
@@ -1,51 +1,113 @@
 package gatewayapi
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
-	"strconv"
+	"reflect"
 	"sync"
+	"time"
 
+	"github.com/freshwebio/k8s-kong-api/checksum"
+	"github.com/freshwebio/k8s-kong-api/config"
+	"github.com/freshwebio/k8s-kong-api/controllerclass"
+	"github.com/freshwebio/k8s-kong-api/dependency"
 	"github.com/freshwebio/k8s-kong-api/k8sclient"
-	"github.com/freshwebio/k8s-kong-api/k8stypes"
 	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/multicluster"
+	"github.com/freshwebio/k8s-kong-api/naming"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/recorder"
+	"github.com/freshwebio/k8s-kong-api/shard"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+	k8serrors "k8s.io/client-go/pkg/api/errors"
 	"k8s.io/client-go/pkg/api/v1"
 	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/runtime"
 	"k8s.io/client-go/pkg/selection"
 	"k8s.io/client-go/pkg/watch"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 )
 
 var (
 	// ErrGatewayNotFound should be used when a gateway can't be found in the Kubernetes cluster.
-	ErrGatewayNotFound = errors.New("Could not find the specifed GatewayApi resource in Kubernetes")
+	ErrGatewayNotFound = syncerror.NewValidation("Could not find the specifed GatewayApi resource in Kubernetes")
 	// ErrServiceNotFound should be used when a service resource cannot be found in the Kubernetes cluster.
-	ErrServiceNotFound = errors.New("Could not find the specified v1.Service resources in Kubernetes")
+	ErrServiceNotFound = syncerror.NewValidation("Could not find the specified v1.Service resources in Kubernetes")
+	// ErrOtherControllerClass should be used when a GatewayApi resource belongs to another controller class,
+	// the services referencing it are reconciled by the controller of that class.
+	ErrOtherControllerClass = errors.New("The GatewayApi resource belongs to another controller class")
 )
 
 // Service deals with monitoring and responding
 // to events on gateway api resources in k8s
 // and updating the Kong representations accordingly.
 type Service struct {
-	k8sRestClient        *rest.RESTClient
 	k8sClient            *k8sclient.Client
+	client               *Client
 	apiLabel             string
 	serviceSelectorLabel string
-	namespace            string
-	kongClient           *kong.Client
+	namespaces           []string
+	class                string
+	kongClient           kong.Interface
+	limiter              *throttle.Limiter
+	shard                shard.Shard
+	names                naming.Scheme
+	verbose              bool
+	deletionGracePeriod  time.Duration
+	pendingDeletions     *pendingDeletions
+	registry             *ownership.Registry
+	adoptUnowned         bool
+	resyncChan           chan struct{}
+	errors               *syncerror.Table
+	recorder             *recorder.Recorder
+	resyncPeriod         time.Duration
+	dependencies         *dependency.Graph
+	onboarding           *onboarding.Watcher
+	informers            *k8sclient.InformerFactory
+	discovery            *multicluster.Discovery
+	endpoints            k8sclient.ServiceTargets
+	queue                *workqueue.Queue
+	memory               *workqueue.Memory
+	serviceStore         cache.Store
+	gatewayApis          *Lister
+	declarative          bool
+	dbless               bool
+	defaults             kong.Defaults
+	ctx                  context.Context
+	reconcileTimeout     time.Duration
+	synced               []func() bool
 }
 
 // NewService creates a new instance of the GatewayApi service.
-func NewService(k8sRestClient *rest.RESTClient, k8sClient *k8sclient.Client, kong *kong.Client, namespace string,
-	apiLabel string, serviceSelectorLabel string) *Service {
-	return &Service{k8sRestClient: k8sRestClient, k8sClient: k8sClient, kongClient: kong, namespace: namespace,
-		apiLabel: apiLabel, serviceSelectorLabel: serviceSelectorLabel}
+// When a deletion grace period is provided kong API objects are only removed once their
+// GatewayApi resource has been gone for the grace period.
+// Pre-existing kong API objects that aren't in the ownership registry are only managed when the
+// GatewayApi resource has the adopt annotation unless adoptUnowned is set.
+// Only namespaces that belong to the configured shard are reconciled.
+func NewService(k8sClient *k8sclient.Client, kong kong.Interface, cfg *config.Config) *Service {
+	s := &Service{k8sClient: k8sClient, client: NewClient(k8sClient), kongClient: kong, namespaces: cfg.Namespaces,
+		class: cfg.ControllerClass, apiLabel: cfg.APILabel, serviceSelectorLabel: cfg.ServiceSelectorLabel,
+		limiter: cfg.Limiter, shard: cfg.Shard, names: cfg.Names, verbose: cfg.Verbose, deletionGracePeriod: cfg.DeletionGracePeriod,
+		pendingDeletions: newPendingDeletions(), registry: cfg.Registry, adoptUnowned: cfg.AdoptUnowned,
+		resyncChan: make(chan struct{}, 1), errors: cfg.Errors, recorder: cfg.Recorder, resyncPeriod: cfg.ResyncPeriod,
+		dependencies: cfg.Dependencies, onboarding: cfg.Onboarding, informers: cfg.Informers, discovery: cfg.Discovery,
+		endpoints: cfg.Endpoints, memory: workqueue.NewMemory(), declarative: cfg.SyncStrategy == config.DeclarativeSync,
+		dbless: cfg.SyncStrategy == config.DBLessSync, defaults: cfg.Defaults, ctx: cfg.Context,
+		reconcileTimeout: cfg.ReconcileTimeout}
+	s.queue = workqueue.New("gatewayapi", cfg.Limiter, cfg.Retry, s.reconcile)
+	return s
 }
 
 // Start deals with beginning the monitoring process which deals with monitoring
 // events from k8s gatewayapi resources as well as services to propogate changes to kong.
+// Events queue the resource they are for to be reconciled from its latest state, reconciles go through
+// the shared limiter so each namespace is bound to its own concurrency and kong write limits.
 // This method should be called asynchronously in it's own goroutine.
 func (s *Service) Start(doneChan <-chan struct{}, wg *sync.WaitGroup) {
 	log.Println("Starting the gatewayapi watcher service")
@@ -56,136 +118,268 @@ func (s *Service) Start(doneChan <-chan struct{}, wg *sync.WaitGroup) {
 		log.Fatal(err)
 	}
 	selector = selector.Add(*req)
-	serviceEvents, serviceUpdateEvents := s.monitorServiceEvents(s.namespace, selector, doneChan)
-	gatewayApiEvents, gatewayApiUpdateEvents := s.monitorGatewayApiEvents(s.namespace, labels.NewSelector(), doneChan)
+	s.monitorServiceEvents(selector)
+	s.monitorGatewayApiEvents(s.namespaces, labels.NewSelector(), doneChan)
+	var resyncTicks <-chan time.Time
+	if s.resyncPeriod > 0 && !s.dbless {
+		ticker := time.NewTicker(s.resyncPeriod)
+		defer ticker.Stop()
+		resyncTicks = ticker.C
+	}
 	for {
 		select {
-		case event := <-gatewayApiEvents:
-			err := s.processGatewayApiEvent(event)
-			if err != nil {
-				log.Printf("Error while processing gateway api event: %v", err)
-			}
-		case event := <-gatewayApiUpdateEvents:
-			err := s.processGatewayApiUpdateEvent(event)
-			if err != nil {
-				log.Printf("Error while processing gateway api update event: %v", err)
+		case <-s.resyncChan:
+			if s.dbless {
+				continue
 			}
-		case event := <-serviceUpdateEvents:
-			err := s.processServiceUpdateEvent(event)
-			if err != nil {
-				log.Printf("Error while processing service update event: %v", err)
-			}
-		case event := <-serviceEvents:
-			err := s.processServiceEvent(event)
-			if err != nil {
-				log.Printf("Error while processing service event: %v", err)
+			s.resyncAll(0, true, doneChan)
+		case <-resyncTicks:
+			if s.declarative {
+				// The complete desired state is pushed to kong in one go.
+				s.resyncAll(0, true, doneChan)
+				continue
 			}
+			// Periodic resyncs are spread over the resync period so every object isn't reconciled on the same tick.
+			s.resyncAll(s.resyncPeriod, false, doneChan)
 		case <-doneChan:
+			s.queue.ShutDown()
 			wg.Done()
 			log.Println("Stopped gateway api event watcher.")
+			return
 		}
 	}
 }
 
-// Handles processing the service events we are interested in for the sake
-// of our gateway api resources.
-func (s *Service) processServiceEvent(e k8stypes.ServiceEvent) error {
-	if e.Type == "ADDED" {
-		err := s.createKongGatewayApiForService(e.Object)
-		if err != nil {
-			return err
+// Resync triggers a full reconciliation of every GatewayApi resource and service
+// so kong converges on the state in k8s straight away, e.g. after manual changes to kong.
+// Resyncs requested while one is already pending are folded into the pending one.
+func (s *Service) Resync() {
+	select {
+	case s.resyncChan <- struct{}{}:
+	default:
+	}
+}
+
+// Queues a reconcile for every GatewayApi resource and service currently
+// in the informer caches, spreading them randomly over the provided window.
+// A forced resync ignores the hash of the last applied payload so kong is written to
+// even for unchanged resources, this is what undoes manual changes made to kong.
+func (s *Service) resyncAll(spread time.Duration, force bool, done <-chan struct{}) {
+	log.Println("Resyncing all gateway api resources and services")
+	gatewayApis, err := s.gatewayApis.List()
+	if err != nil {
+		log.Printf("Error listing the cached gateway api resources for the resync: %v", err)
+	}
+	for _, gatewayApi := range gatewayApis {
+		a := gatewayApi
+		if force {
+			s.memory.Force(syncerror.ResourceKey("gatewayapis", a.Metadata.Namespace, a.Metadata.Name))
 		}
+		throttle.Spread(spread, done, func() {
+			s.queueGatewayApi(a)
+		})
 	}
-	return nil
+	for _, obj := range s.serviceStore.List() {
+		service, ok := obj.(*v1.Service)
+		if !ok {
+			continue
+		}
+		if force {
+			s.memory.Force(syncerror.ResourceKey("services", service.GetNamespace(), service.GetName()))
+		}
+		throttle.Spread(spread, done, func() {
+			s.queueService(service)
+		})
+	}
+}
+
+// Dispatches the provided reconcile through the limiter for the provided namespace and API name,
+// reconciles for namespaces outside of our shard are dropped as another instance deals with them
+// and reconciles for namespaces that haven't been onboarded are dropped altogether.
+// The outcome of the reconcile is logged and recorded against the provided resource
+// in the sync error rates and the error table.
+func (s *Service) dispatch(namespace string, apiName string, resource string, description string, fn func(ctx context.Context) error) {
+	if !s.reconciles(namespace) {
+		return
+	}
+	s.enqueue(namespace, apiName, resource, description, fn)
+}
+
+// Lets us know whether resources in the provided namespace are reconciled by this instance of the controller.
+func (s *Service) reconciles(namespace string) bool {
+	return s.shard.Owns(namespace) && s.onboarding.Enabled(namespace)
 }
 
-// Handles processing the service update events we are interested in for the sake
-// of our gateway api resources.
-func (s *Service) processServiceUpdateEvent(e k8stypes.ServiceUpdateEvent) error {
-	err := s.updateKongGatewayApiForService(e.Old, e.New)
+// Hands the provided reconcile over to the limiter, logging and recording its outcome.
+// The reconcile is carried out under its own reconcile context.
+func (s *Service) enqueue(namespace string, apiName string, resource string, description string, fn func(ctx context.Context) error) {
+	if s.verbose {
+		log.Printf("Dispatching a reconcile for the %v kong API in the %v namespace", apiName, namespace)
+	}
+	s.limiter.Dispatch(namespace, limiterKey(namespace, apiName), func() {
+		ctx, cancel := workqueue.Context(s.ctx, s.reconcileTimeout)
+		defer cancel()
+		s.recordResult(resource, description, fn(ctx))
+	})
+}
+
+// Logs the outcome of a reconcile of the provided resource and records it in the sync error rates,
+// the error table, the events and the status of the resource.
+// The status is recorded under a context of its own so it's still recorded when the reconcile timed out.
+func (s *Service) recordResult(resource string, description string, err error) {
 	if err != nil {
-		return err
+		log.Printf("Error while processing %v: %v", description, err)
+	}
+	metrics.RecordSync("gatewayapi", syncerror.Classify(err))
+	s.errors.Record("gatewayapi", resource, err)
+	s.recordOutcome(resource, err)
+	ctx, cancel := workqueue.Context(s.ctx, s.reconcileTimeout)
+	defer cancel()
+	if statusErr := s.recordSyncStatus(ctx, resource, err); statusErr != nil {
+		log.Printf("Error recording the sync status of %v: %v", resource, statusErr)
 	}
-	return nil
+}
+
+// Provides the key used to make sure reconciles touching the same kong API
+// are never run concurrently.
+func limiterKey(namespace string, apiName string) string {
+	return namespace + "/" + apiName
 }
 
 // Creates a new kong API object if a gateway exists for the provided service.
-func (s *Service) createKongGatewayApiForService(v1s v1.Service) error {
+// When the GatewayApi resource selects several services the API object is named after the primary one
+// and balances across all of them, so a service joining the others brings the API object over to the upstream.
+func (s *Service) createKongGatewayApiForService(ctx context.Context, v1s v1.Service) error {
 	// First of all we want to make sure that the provided service has the gateway API reference label
 	// set and extract the name of the gateway api object from that.
 	if gatewayApiName, exists := v1s.Labels[s.apiLabel]; exists {
-		gatewayApi, err := s.getGatewayApi(gatewayApiName)
+		gatewayApi, err := s.getGatewayApi(ctx, v1s.GetNamespace(), gatewayApiName)
+		if err == ErrOtherControllerClass {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
+		if apiName, selected := gatewayApi.Spec.Selector[s.serviceSelectorLabel]; !selected ||
+			v1s.Labels[s.serviceSelectorLabel] != apiName {
+			// The service isn't the one selected by the GatewayApi resource it references.
+			return nil
+		}
+		v1s = *s.primaryService(gatewayApi, &v1s)
 
-		// Now let's attempt to create our upstream URL for the service, if no ports
+		// Now let's create our new API object for the retrieved GatewayApi resource, if no ports
 		// are provided then we won't create the API object as something is wrong with the service.
-		// Also when a service is exposing multiple ports the first one will always be used.
-		// TODO: Implement functionality that allows selection of port to be used for a Kong
-		// upstream when a service is exposing multiple ports.
-		// TODO: Implement a way to allow for TLS enabled services with https.
-		upstreamURL := "http://" + v1s.Spec.ClusterIP
-		if len(v1s.Spec.Ports) > 0 {
-			upstreamURL += ":" + strconv.Itoa(int(v1s.Spec.Ports[0].Port))
-		} else {
-			return fmt.Errorf("The service %v should expose at least one port", v1s.GetName())
+		api, err := s.kongAPIFor(gatewayApi, &v1s)
+		if err != nil {
+			return err
 		}
 
 		// Only proceed if an API object with the provided name doesn't already exist, in what would be assumed
 		// to be a rare case a GatewayApi resource
 		// might still be around after a previous deletion of the same or similar service.
-		_, err = s.kongClient.GetAPI(v1s.GetName())
-		if err != nil && err == kong.ErrNotFound {
-			// Now let's create our new API object for the retrieved GatewayApi resource.
-			api := &kong.API{
-				Name:                   v1s.GetName(),
-				Hosts:                  gatewayApi.Spec.Hosts,
-				URIs:                   gatewayApi.Spec.Uris,
-				UpstreamURL:            upstreamURL,
-				StripURI:               gatewayApi.Spec.StripURI,
-				Methods:                gatewayApi.Spec.Methods,
-				PreserveHost:           gatewayApi.Spec.PreserveHost,
-				Retries:                gatewayApi.Spec.Retries,
-				UpstreamConnectTimeout: gatewayApi.Spec.UpstreamConnectTimeout,
-				UpstreamSendTimeout:    gatewayApi.Spec.UpstreamSendTimeout,
-				UpstreamReadTimeout:    gatewayApi.Spec.UpstreamReadTimeout,
-				HTTPSOnly:              gatewayApi.Spec.HTTPSOnly,
-				HTTPIfTerminated:       gatewayApi.Spec.HTTPIfTerminated,
+		// When it does exist it's only touched when it can be adopted by the GatewayApi resource.
+		existing, err := s.kongClient.GetAPI(ctx, api.Name)
+		if err != nil && err != kong.ErrNotFound {
+			return err
+		}
+		apiExists := err == nil
+		if apiExists {
+			manage, _, err := s.canManageKongAPI(gatewayApi, api.Name)
+			if !manage || err != nil {
+				return err
 			}
-			_, err = s.kongClient.CreateAPI(api)
+		}
+		err = s.syncTargets(ctx, gatewayApi, &v1s)
+		if err != nil {
+			return err
+		}
+		err = s.syncPortAPIs(ctx, gatewayApi, &v1s)
+		if err != nil {
+			return err
+		}
+		if apiExists {
+			// Bring the managed or adopted API object in line with the GatewayApi resource,
+			// writes that wouldn't change anything are skipped.
+			err = s.writeKongAPI(ctx, v1s.GetNamespace(), existing, api)
 			if err != nil {
 				return err
 			}
+			s.recordAppliedKongAPI(ctx, gatewayApi, api)
+			return nil
+		}
+		if err := s.limiter.WaitWrite(ctx, v1s.GetNamespace()); err != nil {
+			return err
+		}
+		_, err = s.kongClient.CreateAPI(ctx, api)
+		if err != nil {
+			return err
 		}
+		s.dependencies.APIReady(v1s.GetNamespace(), v1s.GetName())
+		err = s.claimKongAPI(gatewayApi, api.Name)
+		if err != nil {
+			return err
+		}
+		s.recordAppliedKongAPI(ctx, gatewayApi, api)
+		return nil
 	}
 	return nil
 }
 
 // Updates the upstream URL of a Kong API object if the service upstream has changed.
-// We assume if the API object exist ins in kong then a GatewayApi resource exists in k8s.
-// The above may not always be the case but it saves an extra call to the k8s apiserver.
-// TODO: Make it work for selecting either a named port or the port number from a range on a single service.
-func (s *Service) updateKongGatewayApiForService(old v1.Service, new v1.Service) error {
+// The port of the service used is the one selected by the GatewayApi resource the service references,
+// which is normally served from the informer cache.
+func (s *Service) updateKongGatewayApiForService(ctx context.Context, old v1.Service, new v1.Service) error {
+	gatewayApiName, exists := new.Labels[s.apiLabel]
+	if !exists {
+		return nil
+	}
+	gatewayApi, err := s.getGatewayApi(ctx, new.GetNamespace(), gatewayApiName)
+	if err == ErrOtherControllerClass {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.balances(gatewayApi, &new) {
+		// The API object always points at the upstream of the primary service so only the targets can change.
+		primary := s.primaryService(gatewayApi, &new)
+		err = s.syncPortAPIs(ctx, gatewayApi, primary)
+		if err != nil {
+			return err
+		}
+		if !s.managesKongAPI(s.names.API(primary.GetNamespace(), primary.GetName())) {
+			return nil
+		}
+		return s.syncTargets(ctx, gatewayApi, primary)
+	}
+	err = s.syncPortAPIs(ctx, gatewayApi, &new)
+	if err != nil {
+		return err
+	}
 	// Only proceed if there is a change in the upstream URL.
 	// TODO: Add support for https.
-	oldUpstreamURL := "http://" + old.Spec.ClusterIP
-	newUpstreamURL := "http://" + new.Spec.ClusterIP
-	if len(old.Spec.Ports) > 0 && len(new.Spec.Ports) > 0 {
-		oldUpstreamURL += ":" + strconv.Itoa(int(old.Spec.Ports[0].Port))
-		newUpstreamURL += ":" + strconv.Itoa(int(new.Spec.Ports[0].Port))
-	} else {
-		return fmt.Errorf("The service %v should expose at least one port", new.GetName())
+	newUpstreamURL, err := s.upstreamURLFor(gatewayApi, &new)
+	if err != nil {
+		return err
 	}
+	// The old service is compared on the same port so only changes to the service are picked up.
+	oldUpstreamURL, _ := s.upstreamURLFor(gatewayApi, &old)
 	if oldUpstreamURL != newUpstreamURL {
+		// Leave API objects the controller doesn't manage alone.
+		apiName := s.names.API(new.GetNamespace(), new.GetName())
+		if !s.managesKongAPI(apiName) {
+			log.Printf("Not updating the upstream of the %v kong API as it isn't managed by the controller", apiName)
+			return nil
+		}
 		// Now make sure an API object exists for the provided service.
-		api, err := s.kongClient.GetAPI(new.GetName())
+		current, err := s.kongClient.GetAPI(ctx, apiName)
 		if err != nil {
 			return err
 		}
-		// Let's update the retrieved API object.
+		// Let's update a copy of the retrieved API object as it may be shared with the kong read cache.
+		api := *current
 		api.UpstreamURL = newUpstreamURL
-		_, err = s.kongClient.UpdateAPI(api)
+		err = s.writeKongAPI(ctx, new.GetNamespace(), current, &api)
 		if err != nil {
 			return err
 		}
@@ -193,147 +387,177 @@ func (s *Service) updateKongGatewayApiForService(old v1.Service, new v1.Service)
 	return nil
 }
 
-func (s *Service) processGatewayApiEvent(e Event) error {
-	switch e.Type {
-	case "ADDED":
-		err := s.createKongGatewayApi(e.Object)
-		if err != nil {
-			return err
-		}
-	case "DELETED":
-		err := s.deleteKongGatewayApi(e.Object)
-		if err != nil {
-			return err
-		}
+// Deletes the kong API object, port API objects and upstreams for the provided service that has been deleted
+// as long as they are owned by the GatewayApi resource the service references.
+// They are left alone while another service with the same selector label remains, the targets of the deleted service
+// are dropped from the upstream when the remaining service references the resource too.
+// With a deletion grace period they are only deleted once the service has been gone for the grace period.
+func (s *Service) deleteKongGatewayApiForService(ctx context.Context, v1s v1.Service) error {
+	gatewayApiName, exists := v1s.Labels[s.apiLabel]
+	if !exists {
+		return nil
+	}
+	gatewayApi, err := s.getGatewayApi(ctx, v1s.GetNamespace(), gatewayApiName)
+	if err == ErrOtherControllerClass || err == ErrGatewayNotFound {
+		// Without the GatewayApi resource there's nothing the service is represented by.
+		return nil
 	}
-	return nil
-}
-
-func (s *Service) processGatewayApiUpdateEvent(e UpdateEvent) error {
-	err := s.updateKongGatewayApi(e.Old, e.New)
 	if err != nil {
 		return err
 	}
-	return nil
-}
-
-// Creates a new API object in kong if one for the provided service selector
-// doesn't already exist and the service referenced does.
-func (s *Service) createKongGatewayApi(a GatewayApi) error {
-	if serviceName, exists := a.Spec.Selector[s.serviceSelectorLabel]; exists {
-		_, err := s.kongClient.GetAPI(serviceName)
-		if err != nil {
-			if err == kong.ErrNotFound {
-				service, err := s.getServiceByServiceLabelSelector(serviceName)
-				if err != nil {
-					return err
-				}
-				// Let's get the upstream URL from the service.
-				upstreamURL := "http://" + service.Spec.ClusterIP
-				if len(service.Spec.Ports) > 0 {
-					upstreamURL += ":" + strconv.Itoa(int(service.Spec.Ports[0].Port))
-				} else {
-					return fmt.Errorf("The service %v should expose at least one port", service.GetName())
-				}
-				api := &kong.API{
-					Name:                   service.GetName(),
-					Hosts:                  a.Spec.Hosts,
-					URIs:                   a.Spec.Uris,
-					UpstreamURL:            upstreamURL,
-					StripURI:               a.Spec.StripURI,
-					Methods:                a.Spec.Methods,
-					PreserveHost:           a.Spec.PreserveHost,
-					Retries:                a.Spec.Retries,
-					UpstreamConnectTimeout: a.Spec.UpstreamConnectTimeout,
-					UpstreamSendTimeout:    a.Spec.UpstreamSendTimeout,
-					UpstreamReadTimeout:    a.Spec.UpstreamReadTimeout,
-					HTTPSOnly:              a.Spec.HTTPSOnly,
-					HTTPIfTerminated:       a.Spec.HTTPIfTerminated,
-				}
-				_, err = s.kongClient.CreateAPI(api)
-				if err != nil {
-					return err
-				}
-			} else {
-				return err
+	apiName, exists := gatewayApi.Spec.Selector[s.serviceSelectorLabel]
+	if !exists || v1s.Labels[s.serviceSelectorLabel] != apiName {
+		return nil
+	}
+	for _, obj := range s.serviceStore.List() {
+		service, ok := obj.(*v1.Service)
+		if ok && service.GetNamespace() == v1s.GetNamespace() && service.GetName() != v1s.GetName() &&
+			service.Labels[s.serviceSelectorLabel] == apiName {
+			log.Printf("Not deleting the %v kong API as the %v service still selects it", apiName, service.GetName())
+			if service.Labels[s.apiLabel] == gatewayApiName {
+				return s.createKongGatewayApiForService(ctx, *service)
 			}
+			return nil
 		}
 	}
-	return nil
+	log.Printf("Deleting the %v kong API as the %v service has been deleted", apiName, v1s.GetName())
+	if s.deletionGracePeriod > 0 {
+		s.scheduleKongGatewayApiDeletion(*gatewayApi)
+		return nil
+	}
+	return s.deleteKongGatewayApi(ctx, *gatewayApi)
 }
 
 // Updates the kong API object if the same service is referenced
 // otherwise destroys the API object for the old service and creates
 // a new API object for the newly referenced service.
-func (s *Service) updateKongGatewayApi(old GatewayApi, new GatewayApi) error {
+// API objects that aren't owned by the resource are left alone unless they can be adopted.
+func (s *Service) updateKongGatewayApi(ctx context.Context, old GatewayApi, new GatewayApi) error {
 	oldService, oldExists := old.Spec.Selector[s.serviceSelectorLabel]
 	newService, newExists := new.Spec.Selector[s.serviceSelectorLabel]
 	if !oldExists || !newExists {
-		return fmt.Errorf("The gateway api resource %v must have a service selector set", new.Metadata.GetName())
+		return syncerror.Validationf("The gateway api resource %v must have a service selector set", new.Metadata.GetName())
 	}
 	// Load the new service from k8s. We don't need to load the old service
 	// As we only need to delete an API object if one exists for it.
-	srvObj, err := s.getServiceByServiceLabelSelector(newService)
+	srvObj, err := s.getServiceByServiceLabelSelector(ctx, new.Metadata.Namespace, newService)
 	if err != nil {
 		return err
 	}
-	upstreamURL := "http://" + srvObj.Spec.ClusterIP
-	if len(srvObj.Spec.Ports) > 0 {
-		upstreamURL += ":" + strconv.Itoa(int(srvObj.Spec.Ports[0].Port))
-	} else {
-		return fmt.Errorf("The service %v should expose at least one port", srvObj.GetName())
-	}
+	srvObj = s.primaryService(&new, srvObj)
 	// Create our new API object either to be saved anew or updated.
-	api := &kong.API{
-		Name:                   srvObj.GetName(),
-		Hosts:                  new.Spec.Hosts,
-		URIs:                   new.Spec.Uris,
-		UpstreamURL:            upstreamURL,
-		StripURI:               new.Spec.StripURI,
-		Methods:                new.Spec.Methods,
-		PreserveHost:           new.Spec.PreserveHost,
-		Retries:                new.Spec.Retries,
-		UpstreamConnectTimeout: new.Spec.UpstreamConnectTimeout,
-		UpstreamSendTimeout:    new.Spec.UpstreamSendTimeout,
-		UpstreamReadTimeout:    new.Spec.UpstreamReadTimeout,
-		HTTPSOnly:              new.Spec.HTTPSOnly,
-		HTTPIfTerminated:       new.Spec.HTTPIfTerminated,
-	}
-	if oldService == newService {
-		// Simply update the Kong API object.
-		_, err = s.kongClient.UpdateAPI(api)
+	api, err := s.kongAPIFor(&new, srvObj)
+	if err != nil {
+		return err
+	}
+	err = s.syncTargets(ctx, &new, srvObj)
+	if err != nil {
+		return err
+	}
+	if oldService == newService && s.kongAPIUnchanged(&new, api) {
+		// The API object was last written with exactly this payload so there's nothing to do.
+		return nil
+	}
+	err = s.syncPortAPIs(ctx, &new, srvObj)
+	if err != nil {
+		return err
+	}
+	if oldService != newService {
+		// The port API objects for the old service go along with its API object.
+		err = s.deletePortAPIs(ctx, &old, oldService, map[string]bool{api.Name: true})
 		if err != nil {
 			return err
 		}
-	} else {
-		// Delete the API object for the old service and add a new one for our new service.
-		_, err := s.kongClient.GetAPI(oldService)
+		// Delete the API object for the old service as long as it's owned by the resource.
+		oldAPIName := s.names.API(old.Metadata.Namespace, oldService)
+		_, err := s.kongClient.GetAPI(ctx, oldAPIName)
 		if err != nil {
 			// Only quit when the error is not error not found.
 			if err != kong.ErrNotFound {
 				return err
 			}
-		} else {
+		} else if s.ownsKongAPI(&old, oldAPIName) {
 			// Delete the API object from the old service reference.
-			err = s.kongClient.DeleteAPI(oldService)
+			err = s.detachKongPlugins(ctx, new.Metadata.Namespace, oldAPIName)
 			if err != nil {
 				return err
 			}
+			if err := s.limiter.WaitWrite(ctx, new.Metadata.Namespace); err != nil {
+				return err
+			}
+			err = s.kongClient.DeleteAPI(ctx, oldAPIName)
+			if err != nil {
+				return err
+			}
+			err = s.deleteUpstream(ctx, new.Metadata.Namespace, oldService)
+			if err != nil {
+				return err
+			}
+			err = s.registry.Release(ownership.KindAPI, oldAPIName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	current, err := s.kongClient.GetAPI(ctx, api.Name)
+	if err != nil {
+		if err != kong.ErrNotFound {
+			return err
 		}
 		// Now we'll create the new API object.
-		_, err = s.kongClient.CreateAPI(api)
+		if err := s.limiter.WaitWrite(ctx, new.Metadata.Namespace); err != nil {
+			return err
+		}
+		_, err = s.kongClient.CreateAPI(ctx, api)
+		if err != nil {
+			return err
+		}
+		s.dependencies.APIReady(new.Metadata.Namespace, srvObj.GetName())
+		err = s.claimKongAPI(&new, api.Name)
 		if err != nil {
 			return err
 		}
+		s.recordAppliedKongAPI(ctx, &new, api)
+		return nil
 	}
+	manage, _, err := s.canManageKongAPI(&new, api.Name)
+	if !manage {
+		return err
+	}
+	// Simply update the Kong API object.
+	err = s.writeKongAPI(ctx, new.Metadata.Namespace, current, api)
+	if err != nil {
+		return err
+	}
+	s.recordAppliedKongAPI(ctx, &new, api)
 	return nil
 }
 
-// Deletes the API object in kong the provided GatewayApi represents.
-func (s *Service) deleteKongGatewayApi(a GatewayApi) error {
+// Replaces the provided API object currently in kong with the provided desired API object,
+// the write is skipped when nothing that matters has changed so noisy service updates don't hit the kong admin api.
+func (s *Service) writeKongAPI(ctx context.Context, namespace string, current *kong.API, desired *kong.API) error {
+	if kong.APIMatches(current, desired) {
+		metrics.KongWritesSkippedTotal.WithLabelValues("api").Inc()
+		return nil
+	}
+	if err := s.limiter.WaitWrite(ctx, namespace); err != nil {
+		return err
+	}
+	_, err := s.kongClient.UpdateAPI(ctx, desired)
+	return err
+}
+
+// Deletes the API object in kong the provided GatewayApi represents
+// as long as it's owned by the resource.
+func (s *Service) deleteKongGatewayApi(ctx context.Context, a GatewayApi) error {
 	if apiName, exists := a.Spec.Selector[s.serviceSelectorLabel]; exists {
+		err := s.deletePortAPIs(ctx, &a, apiName, nil)
+		if err != nil {
+			return err
+		}
 		// Only delete the API object if it already exists.
-		_, err := s.kongClient.GetAPI(apiName)
+		kongAPIName := s.names.API(a.Metadata.Namespace, apiName)
+		_, err = s.kongClient.GetAPI(ctx, kongAPIName)
 		if err != nil {
 			if err == kong.ErrNotFound {
 				// Don't do anything as the API object doesn't exist.
@@ -342,7 +566,43 @@ func (s *Service) deleteKongGatewayApi(a GatewayApi) error {
 			}
 			return err
 		}
-		err = s.kongClient.DeleteAPI(apiName)
+		if !s.ownsKongAPI(&a, kongAPIName) {
+			log.Printf("Not deleting the %v kong API as it isn't owned by %v", kongAPIName, ownerOf(&a))
+			return nil
+		}
+		err = s.detachKongPlugins(ctx, a.Metadata.Namespace, kongAPIName)
+		if err != nil {
+			return err
+		}
+		if err := s.limiter.WaitWrite(ctx, a.Metadata.Namespace); err != nil {
+			return err
+		}
+		err = s.kongClient.DeleteAPI(ctx, kongAPIName)
+		if err != nil {
+			return err
+		}
+		err = s.deleteUpstream(ctx, a.Metadata.Namespace, apiName)
+		if err != nil {
+			return err
+		}
+		return s.registry.Release(ownership.KindAPI, kongAPIName)
+	}
+	return nil
+}
+
+// Detaches the plugins from the kong API object with the provided name before it gets deleted,
+// this runs under the same limiter key as the plugin reconciles for the API object so plugin
+// detachment always precedes the deletion of the API object.
+func (s *Service) detachKongPlugins(ctx context.Context, namespace string, apiName string) error {
+	plugins, err := s.kongClient.ListApiPlugins(ctx, apiName)
+	if err != nil {
+		return err
+	}
+	for _, plugin := range plugins.Data {
+		if err := s.limiter.WaitWrite(ctx, namespace); err != nil {
+			return err
+		}
+		err = s.kongClient.RemovePlugin(ctx, apiName, plugin.Name)
 		if err != nil {
 			return err
 		}
@@ -350,132 +610,130 @@ func (s *Service) deleteKongGatewayApi(a GatewayApi) error {
 	return nil
 }
 
-// Writes service events from k8s to a new channel to be consumed.
-func (s *Service) monitorServiceEvents(
-	namespace string,
-	selector labels.Selector,
-	done <-chan struct{}) (<-chan k8stypes.ServiceEvent, <-chan k8stypes.ServiceUpdateEvent) {
-	events := make(chan k8stypes.ServiceEvent)
-	updateEvents := make(chan k8stypes.ServiceUpdateEvent)
+// Queues the services from k8s to be reconciled whenever they change.
+func (s *Service) monitorServiceEvents(selector labels.Selector) {
 	eventCallback := func(evType watch.EventType, obj interface{}) {
 		service, ok := obj.(*v1.Service)
 		if !ok {
 			log.Printf("could not convert %v (%T) into Service", obj, obj)
 			return
 		}
-		events <- k8stypes.ServiceEvent{
-			Type:   string(evType),
-			Object: *service,
-		}
-	}
-	updateEventCallback := func(evType watch.EventType, old, new interface{}) {
-		oldSrv, ook := old.(*v1.Service)
-		newSrv, nok := new.(*v1.Service)
-		if !(ook && nok) {
-			log.Printf("could not convert %v (%T) and %v (%T) into Services", old, old, new, new)
-			return
-		}
-		updateEvents <- k8stypes.ServiceUpdateEvent{
-			Old: *oldSrv,
-			New: *newSrv,
-		}
+		metrics.ObserveDelivery("gatewayapi", "services", func() {
+			if s.dbless || s.declarative {
+				return
+			}
+			if evType == watch.Deleted {
+				s.memory.Deleted(syncerror.ResourceKey("services", service.GetNamespace(), service.GetName()), service)
+			}
+			s.queueService(service)
+		})
 	}
-	source := k8sclient.NewListWatchFromClient(s.k8sClient.Clientset.CoreV1().RESTClient(), "services", namespace, selector)
-	store, ctrl := cache.NewInformer(source, &v1.Service{}, 0, cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			eventCallback(watch.Added, obj)
-		},
-		UpdateFunc: func(old, new interface{}) {
-			updateEventCallback(watch.Modified, old, new)
-		},
-		DeleteFunc: func(obj interface{}) {
-			eventCallback(watch.Deleted, obj)
-		},
-	})
-
-	go func() {
-		for _, initObj := range store.List() {
-			eventCallback(watch.Added, initObj)
-		}
-
-		go ctrl.Run(done)
-	}()
-
-	return events, updateEvents
+	// The services are watched along with the ApiPlugin controller.
+	watcher := s.informers.Services(selector)
+	s.serviceStore = watcher.Store()
+	s.synced = append(s.synced, watcher.HasSynced)
+	watcher.Subscribe(eventCallback)
 }
 
 // Handles watching events occuring for our custom plugin resource.
-// All GatewayApi resources in the given namespace and selector combination are watched in this case.
-func (s *Service) monitorGatewayApiEvents(
-	namespace string,
-	selector labels.Selector,
-	done <-chan struct{}) (<-chan Event, <-chan UpdateEvent) {
-	events := make(chan Event)
-	updateEvents := make(chan UpdateEvent)
+// All GatewayApi resources in the given namespaces and selector combination are watched in this case
+// and queued to be reconciled.
+func (s *Service) monitorGatewayApiEvents(namespaces []string, selector labels.Selector, done <-chan struct{}) {
 	eventCallback := func(evType watch.EventType, obj interface{}) {
 		gatewayApi, ok := obj.(*GatewayApi)
 		if !ok {
-			log.Printf("could not convert %v (%T) into ApiPlugin", obj, obj)
+			log.Printf("could not convert %v (%T) into GatewayApi", obj, obj)
 			return
 		}
-		events <- Event{
-			Type:   string(evType),
-			Object: *gatewayApi,
-		}
+		metrics.ObserveDelivery("gatewayapi", "gatewayapis", func() {
+			// Resources marked for deletion are always finalized so they aren't held up by our finalizer.
+			finalizing := evType != watch.Deleted && terminating(gatewayApi)
+			if !finalizing && (s.dbless || (s.declarative && evType != watch.Deleted)) {
+				return
+			}
+			if evType == watch.Deleted {
+				s.memory.Deleted(syncerror.ResourceKey("gatewayapis", gatewayApi.Metadata.Namespace, gatewayApi.Metadata.Name), gatewayApi)
+			}
+			s.queueGatewayApi(gatewayApi)
+		})
 	}
 	updateEventCallback := func(evType watch.EventType, old, new interface{}) {
-
+		oldGatewayApi, oldOk := old.(*GatewayApi)
+		newGatewayApi, newOk := new.(*GatewayApi)
+		if oldOk && newOk && !changed(oldGatewayApi, newGatewayApi) {
+			// Our own status and checksum writes come back as updates that don't need reconciling.
+			return
+		}
+		eventCallback(evType, new)
 	}
-	source := k8sclient.NewListWatchFromClient(s.k8sRestClient, "gatewayapis", namespace, selector)
-	store, ctrl := cache.NewInformer(source, &GatewayApi{}, 0, cache.ResourceEventHandlerFuncs{
+	informer := NewInformer(k8sclient.DoneContext(done), s.client, namespaces, selector, s.class)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			eventCallback(watch.Added, obj)
 		},
 		UpdateFunc: func(old, new interface{}) {
+			if gatewayApi, ok := new.(*GatewayApi); ok && terminating(gatewayApi) {
+				// Marking a resource for deletion is an update, our finalizer is what keeps it around.
+				eventCallback(watch.Modified, new)
+				return
+			}
 			updateEventCallback(watch.Modified, old, new)
 		},
 		DeleteFunc: func(obj interface{}) {
 			eventCallback(watch.Deleted, obj)
 		},
 	})
+	s.gatewayApis = NewLister(informer.GetIndexer())
+	s.synced = append(s.synced, informer.HasSynced)
 
-	go func() {
-		for _, initObj := range store.List() {
-			eventCallback(watch.Added, initObj)
-		}
-
-		go ctrl.Run(done)
-	}()
+	go informer.Run(done)
+}
 
-	return events, updateEvents
+// Lets us know whether the provided GatewayApi resource has changed in a way that affects kong
+// since the provided old copy of it, i.e. its spec, labels or annotations other than the last applied hash.
+func changed(old *GatewayApi, new *GatewayApi) bool {
+	return !reflect.DeepEqual(old.Spec, new.Spec) || !reflect.DeepEqual(old.Metadata.Labels, new.Metadata.Labels) ||
+		!reflect.DeepEqual(checksum.Without(old.Metadata.Annotations), checksum.Without(new.Metadata.Annotations))
 }
 
-// Attempts to retrieve a GatewayApi resource with the provided name.
+// Attempts to retrieve a GatewayApi resource with the provided namespace and name.
+// The informer cache is read first, falling back to the apiserver for resources
+// created since the cache was last updated. Resources belonging to another controller class
+// are reported with ErrOtherControllerClass and resources that don't exist with ErrGatewayNotFound.
 // The assumption that should be made is if there is in error then the resource
 // isn't reachable or doesn't exist so carry on doing other stuff instead of functionality
 // dependant on getting the gateway API object.
-func (s *Service) getGatewayApi(name string) (*GatewayApi, error) {
-	obj, err := s.k8sRestClient.Get().
-		Namespace(s.namespace).
-		Resource("gatewayapis").
-		Name(name).
-		Do().
-		Get()
+// The apiserver is only queried until the provided context is done.
+func (s *Service) getGatewayApi(ctx context.Context, namespace string, name string) (*GatewayApi, error) {
+	gatewayApi, exists, err := s.gatewayApis.Get(namespace, name)
 	if err != nil {
 		return nil, err
 	}
-	gatewayApi, ok := obj.(*GatewayApi)
-	if !ok {
-		err := fmt.Errorf("could not convert %v (%T) into GatewayApi", obj, obj)
-		log.Println(err)
+	if exists {
+		// Callers are free to modify the resource so the cached copy is never handed out.
+		return deepCopy(gatewayApi)
+	}
+	gatewayApi, err = s.client.Get(ctx, namespace, name)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, ErrGatewayNotFound
+		}
 		return nil, err
 	}
+	if !controllerclass.Matches(gatewayApi.Metadata.Annotations, s.class) {
+		return nil, ErrOtherControllerClass
+	}
 	return gatewayApi, nil
 }
 
-// Attempts to retrieve a service by it's service label selector.
+// Attempts to retrieve a service in the provided namespace by it's service label selector.
 // This will only query services with the api label set. e.g. kong.gateway.api
-func (s *Service) getServiceByServiceLabelSelector(value string) (*v1.Service, error) {
+// The service is looked up in the informer cache of the services we watch, the apiserver is only queried
+// when it isn't in the cache, e.g. while the cache is still being loaded, until the provided context is done.
+func (s *Service) getServiceByServiceLabelSelector(ctx context.Context, namespace string, value string) (*v1.Service, error) {
+	if service := s.cachedServiceByServiceLabelSelector(namespace, value); service != nil {
+		return service, nil
+	}
 	selector := labels.NewSelector()
 	req, err := labels.NewRequirement(s.serviceSelectorLabel, selection.Equals, []string{value})
 	if err != nil {
@@ -488,12 +746,17 @@ func (s *Service) getServiceByServiceLabelSelector(value string) (*v1.Service, e
 		return nil, err
 	}
 	selector = selector.Add(*req2)
-	obj, err := s.k8sClient.Clientset.CoreV1().RESTClient().Get().
-		Namespace(s.namespace).
-		Resource("services").
-		LabelsSelectorParam(selector).
-		Do().
-		Get()
+	var obj runtime.Object
+	err = k8sclient.Retry(ctx, func() error {
+		var err error
+		obj, err = s.k8sClient.Clientset.CoreV1().RESTClient().Get().
+			Namespace(namespace).
+			Resource("services").
+			LabelsSelectorParam(selector).
+			Do().
+			Get()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -509,3 +772,31 @@ func (s *Service) getServiceByServiceLabelSelector(value string) (*v1.Service, e
 	}
 	return nil, ErrServiceNotFound
 }
+
+// Provides a copy of the service in the informer cache in the provided namespace with the provided
+// service label selector value, nil when there isn't one. When there are several the service named
+// like the value is picked, otherwise the one that comes first by name like the apiserver would.
+func (s *Service) cachedServiceByServiceLabelSelector(namespace string, value string) *v1.Service {
+	if s.serviceStore == nil {
+		return nil
+	}
+	var found *v1.Service
+	for _, obj := range s.serviceStore.List() {
+		service, ok := obj.(*v1.Service)
+		if !ok || service.GetNamespace() != namespace {
+			continue
+		}
+		if selected, exists := service.Labels[s.serviceSelectorLabel]; !exists || selected != value {
+			continue
+		}
+		if found == nil || (found.GetName() != value && (service.GetName() == value || service.GetName() < found.GetName())) {
+			found = service
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	// A copy is handed out so callers setting fields of the service don't change the cached one.
+	service := *found
+	return &service
+}
@@ -0,0 +1,200 @@
+package gatewayapi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/freshwebio/k8s-kong-api/checksum"
+	"github.com/freshwebio/k8s-kong-api/dependency"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/kong/fake"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	ownershipfake "github.com/freshwebio/k8s-kong-api/ownership/fake"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Creates a service reconciling GatewayApi resources against the provided fake kong
+// with the provided services in its cache.
+func newReconcileService(t *testing.T, k *fake.Kong, services ...*v1.Service) *Service {
+	s := &Service{
+		kongClient:           k,
+		apiLabel:             "kong.gateway.api",
+		serviceSelectorLabel: "service",
+		limiter:              throttle.NewLimiter(1, 0, 1),
+		registry:             ownership.NewRegistryFor(ownershipfake.NewConfigMaps(), "kong", "owners"),
+		dependencies:         dependency.NewGraph(),
+		onboarding:           onboarding.NewWatcher(nil, "", ""),
+		serviceStore:         cache.NewStore(cache.MetaNamespaceKeyFunc),
+	}
+	for _, service := range services {
+		if err := s.serviceStore.Add(service); err != nil {
+			t.Fatalf("caching the %v service: %v", service.Name, err)
+		}
+	}
+	return s
+}
+
+// Provides a service selected by the orders GatewayApi resource under the provided name.
+func selectedService(name string) *v1.Service {
+	service := &v1.Service{Spec: v1.ServiceSpec{ClusterIP: "10.96.0.10", Ports: []v1.ServicePort{{Name: "http", Port: 80}}}}
+	service.Name = name
+	service.Namespace = "default"
+	service.Labels = map[string]string{"kong.gateway.api": "orders", "service": name}
+	return service
+}
+
+// Provides the orders GatewayApi resource selecting the service with the provided name.
+func ordersGatewayApi(serviceName string) GatewayApi {
+	return GatewayApi{
+		Metadata: api.ObjectMeta{Namespace: "default", Name: "orders"},
+		Spec:     Spec{Uris: []string{"/orders"}, Selector: map[string]string{"service": serviceName}},
+	}
+}
+
+// Creates the kong API object for the provided service with a plugin attached,
+// claimed by the orders GatewayApi resource when owned is set.
+func seedKongAPI(t *testing.T, s *Service, k *fake.Kong, serviceName string, owned bool) {
+	ctx := context.Background()
+	if _, err := k.CreateAPI(ctx, &kong.API{Name: serviceName, URIs: []string{"/orders"}}); err != nil {
+		t.Fatalf("creating the %v kong API: %v", serviceName, err)
+	}
+	if err := k.AddPlugin(ctx, serviceName, &kong.Plugin{Name: "rate-limiting"}); err != nil {
+		t.Fatalf("adding a plugin to the %v kong API: %v", serviceName, err)
+	}
+	if owned {
+		if err := s.registry.Claim(ownership.KindAPI, serviceName, "gatewayapi/default/orders"); err != nil {
+			t.Fatalf("claiming the %v kong API: %v", serviceName, err)
+		}
+	}
+}
+
+// Sets the owned condition and applied hash the provided resource ends up with once its kong API object
+// has been created for the provided service, so the reconcile finds nothing to write back to Kubernetes.
+func markApplied(t *testing.T, s *Service, a *GatewayApi, service *v1.Service) {
+	desired, err := s.kongAPIFor(a, service)
+	if err != nil {
+		t.Fatalf("building the kong API object: %v", err)
+	}
+	hash, err := checksum.Of(appliedState(a, desired))
+	if err != nil {
+		t.Fatalf("hashing the kong API object: %v", err)
+	}
+	a.Metadata.Annotations = map[string]string{checksum.Annotation: hash}
+	applyCondition(a, ConditionKongAPIOwned, true, "Created",
+		fmt.Sprintf("The %v kong API was created for this resource", desired.Name))
+}
+
+func TestRepointingRemovesTheOwnedKongAPIOfTheOldService(t *testing.T) {
+	k := fake.New()
+	oldService, newService := selectedService("orders-v1"), selectedService("orders-v2")
+	s := newReconcileService(t, k, oldService, newService)
+	seedKongAPI(t, s, k, "orders-v1", true)
+	old, repointed := ordersGatewayApi("orders-v1"), ordersGatewayApi("orders-v2")
+	markApplied(t, s, &repointed, newService)
+
+	if err := s.updateKongGatewayApi(context.Background(), old, repointed); err != nil {
+		t.Fatalf("repointing the resource: %v", err)
+	}
+	if _, err := k.GetAPI(context.Background(), "orders-v1"); err != kong.ErrNotFound {
+		t.Errorf("expected the kong API of the old service to be deleted but got %v", err)
+	}
+	if _, owned := s.registry.Owner(ownership.KindAPI, "orders-v1"); owned {
+		t.Error("expected the claim on the kong API of the old service to be released")
+	}
+	if calls := k.Calls("RemovePlugin"); calls != 1 {
+		t.Errorf("expected the plugin to be detached before the deletion but got %v removals", calls)
+	}
+	if _, err := k.GetAPI(context.Background(), "orders-v2"); err != nil {
+		t.Errorf("expected the kong API of the new service to be created but got %v", err)
+	}
+	if owner, _ := s.registry.Owner(ownership.KindAPI, "orders-v2"); owner != "gatewayapi/default/orders" {
+		t.Errorf("expected the kong API of the new service to be claimed but got the owner %q", owner)
+	}
+}
+
+func TestRepointingLeavesUnownedKongAPIsAlone(t *testing.T) {
+	k := fake.New()
+	oldService, newService := selectedService("orders-v1"), selectedService("orders-v2")
+	s := newReconcileService(t, k, oldService, newService)
+	seedKongAPI(t, s, k, "orders-v1", false)
+	old, repointed := ordersGatewayApi("orders-v1"), ordersGatewayApi("orders-v2")
+	markApplied(t, s, &repointed, newService)
+
+	if err := s.updateKongGatewayApi(context.Background(), old, repointed); err != nil {
+		t.Fatalf("repointing the resource: %v", err)
+	}
+	if _, err := k.GetAPI(context.Background(), "orders-v1"); err != nil {
+		t.Errorf("expected the unowned kong API of the old service to be left alone but got %v", err)
+	}
+	if calls := k.Calls("RemovePlugin"); calls != 0 {
+		t.Errorf("expected the plugins of the unowned kong API to be left alone but got %v removals", calls)
+	}
+}
+
+func TestDeletionRemovesTheOwnedKongAPI(t *testing.T) {
+	k := fake.New()
+	s := newReconcileService(t, k)
+	seedKongAPI(t, s, k, "orders", true)
+
+	if err := s.deleteKongGatewayApi(context.Background(), ordersGatewayApi("orders")); err != nil {
+		t.Fatalf("deleting the kong API: %v", err)
+	}
+	if _, err := k.GetAPI(context.Background(), "orders"); err != kong.ErrNotFound {
+		t.Errorf("expected the kong API to be deleted but got %v", err)
+	}
+	if calls := k.Calls("RemovePlugin"); calls != 1 {
+		t.Errorf("expected the plugin to be detached before the deletion but got %v removals", calls)
+	}
+	if _, owned := s.registry.Owner(ownership.KindAPI, "orders"); owned {
+		t.Error("expected the claim on the deleted kong API to be released")
+	}
+}
+
+func TestDeletionLeavesUnownedKongAPIsAlone(t *testing.T) {
+	k := fake.New()
+	s := newReconcileService(t, k)
+	seedKongAPI(t, s, k, "orders", false)
+
+	if err := s.deleteKongGatewayApi(context.Background(), ordersGatewayApi("orders")); err != nil {
+		t.Fatalf("deleting the kong API: %v", err)
+	}
+	if _, err := k.GetAPI(context.Background(), "orders"); err != nil {
+		t.Errorf("expected the unowned kong API to be left alone but got %v", err)
+	}
+	if calls := k.Calls("RemovePlugin"); calls != 0 {
+		t.Errorf("expected the plugins of the unowned kong API to be left alone but got %v removals", calls)
+	}
+}
+
+func TestDeletionKeepsTheClaimWhenKongFails(t *testing.T) {
+	k := fake.New()
+	s := newReconcileService(t, k)
+	seedKongAPI(t, s, k, "orders", true)
+	k.FailOn("DeleteAPI", 1, kong.ErrNotFound)
+
+	if err := s.deleteKongGatewayApi(context.Background(), ordersGatewayApi("orders")); err != kong.ErrNotFound {
+		t.Fatalf("expected the deletion to fail with the error from kong but got %v", err)
+	}
+	if _, owned := s.registry.Owner(ownership.KindAPI, "orders"); !owned {
+		t.Error("expected the claim to be kept until the kong API has been deleted")
+	}
+	if err := s.deleteKongGatewayApi(context.Background(), ordersGatewayApi("orders")); err != nil {
+		t.Fatalf("retrying the deletion: %v", err)
+	}
+	if _, err := k.GetAPI(context.Background(), "orders"); err != kong.ErrNotFound {
+		t.Errorf("expected the kong API to be deleted on the retry but got %v", err)
+	}
+}
+
+func TestDeletionOfAMissingKongAPISucceeds(t *testing.T) {
+	k := fake.New()
+	s := newReconcileService(t, k)
+	if err := s.deleteKongGatewayApi(context.Background(), ordersGatewayApi("orders")); err != nil {
+		t.Errorf("expected deleting a kong API that doesn't exist to succeed but got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package gatewayapi
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/controllerclass"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/redact"
+	"k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/unversioned"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// How often the last sync time of a GatewayApi resource is refreshed when nothing else in its status changes,
+// this keeps resyncs of unchanged resources from writing to the apiserver every time.
+const lastSyncRefreshInterval = time.Minute
+
+// Sets the condition of the provided type on the GatewayApi resource and writes the status
+// back to Kubernetes, nothing is written when the condition hasn't changed.
+func (s *Service) setCondition(a *GatewayApi, conditionType string, status bool, reason string, message string) error {
+	if !applyCondition(a, conditionType, status, reason, message) {
+		return nil
+	}
+	return s.updateGatewayApiStatus(a)
+}
+
+// Sets the condition of the provided type on the GatewayApi resource without writing it back to Kubernetes,
+// lets us know whether the condition has changed.
+func applyCondition(a *GatewayApi, conditionType string, status bool, reason string, message string) bool {
+	message = redact.String(message)
+	conditionStatus := "False"
+	if status {
+		conditionStatus = "True"
+	}
+	for i, condition := range a.Status.Conditions {
+		if condition.Type == conditionType {
+			if condition.Status == conditionStatus && condition.Reason == reason && condition.Message == message {
+				return false
+			}
+			if condition.Status != conditionStatus {
+				a.Status.Conditions[i].LastTransitionTime = unversioned.Now()
+			}
+			a.Status.Conditions[i].Status = conditionStatus
+			a.Status.Conditions[i].Reason = reason
+			a.Status.Conditions[i].Message = message
+			return true
+		}
+	}
+	a.Status.Conditions = append(a.Status.Conditions, Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: unversioned.Now(),
+	})
+	return true
+}
+
+// Records the outcome of a reconcile of the resource with the provided key in the status of the GatewayApi
+// resource it was for, reconciles for services are recorded on the GatewayApi resource the service references.
+// The Synced and Degraded conditions, the last sync time and the id of the kong API object are written
+// to the latest copy of the resource, resources that have gone are skipped.
+func (s *Service) recordSyncStatus(ctx context.Context, resource string, syncErr error) error {
+	parts := strings.SplitN(resource, "/", 3)
+	if len(parts) != 3 {
+		return nil
+	}
+	namespace, name := parts[1], parts[2]
+	switch parts[0] {
+	case "gatewayapis":
+	case "services":
+		obj, exists, err := s.serviceStore.GetByKey(namespace + "/" + name)
+		service, ok := obj.(*v1.Service)
+		if err != nil || !exists || !ok || service.Labels[s.apiLabel] == "" {
+			return err
+		}
+		name = service.Labels[s.apiLabel]
+	default:
+		return nil
+	}
+	a, err := s.client.Get(context.Background(), namespace, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !controllerclass.Matches(a.Metadata.Annotations, s.class) {
+		return nil
+	}
+	previousID := a.Status.KongAPIID
+	api, err := s.kongClient.GetAPI(ctx, s.names.API(a.Metadata.Namespace, a.Spec.Selector[s.serviceSelectorLabel]))
+	apiExists := err == nil
+	if err != nil && err != kong.ErrNotFound {
+		// Kong can't tell us about the API object so the id from the last sync is kept.
+		apiExists = a.Status.KongAPIID != ""
+	} else if apiExists {
+		a.Status.KongAPIID = api.ID
+	} else {
+		a.Status.KongAPIID = ""
+	}
+	changed := a.Status.KongAPIID != previousID
+	if syncErr != nil {
+		changed = applyCondition(a, ConditionSynced, false, "SyncFailed", syncErr.Error()) || changed
+		changed = applyCondition(a, ConditionDegraded, apiExists, "SyncFailed", syncErr.Error()) || changed
+	} else {
+		changed = applyCondition(a, ConditionSynced, true, "Synced", "") || changed
+		changed = applyCondition(a, ConditionDegraded, false, "Synced", "") || changed
+		if a.Status.LastSyncTime == nil || time.Since(a.Status.LastSyncTime.Time) >= lastSyncRefreshInterval {
+			now := unversioned.Now()
+			a.Status.LastSyncTime = &now
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.updateGatewayApiStatus(a)
+}
+
+// Writes the status of the provided GatewayApi resource back to Kubernetes.
+func (s *Service) updateGatewayApiStatus(a *GatewayApi) error {
+	_, err := s.client.UpdateStatus(context.Background(), a)
+	return err
+}
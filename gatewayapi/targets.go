@@ -0,0 +1,286 @@
+package gatewayapi
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/multicluster"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Lets us know whether kong API objects are pointed at a kong upstream for their service
+// rather than straight at its cluster IP, which is the case with remote clusters or endpoint targets configured.
+func (s *Service) usesUpstreams() bool {
+	return s.discovery != nil || s.endpoints != nil
+}
+
+// Lets us know whether the kong API object for the provided GatewayApi resource and service balances across
+// a kong upstream, which is the case when upstreams are in use or the resource selects several services.
+func (s *Service) balances(a *GatewayApi, service *v1.Service) bool {
+	return s.usesUpstreams() || len(s.selectedServices(a, service)) > 1
+}
+
+// Provides the services in the namespace of the provided service that reference the provided GatewayApi resource
+// and carry the service selector label it selects, including the provided service, sorted by name.
+// Every selected service is a target of the kong upstream for the resource.
+func (s *Service) selectedServices(a *GatewayApi, service *v1.Service) []*v1.Service {
+	selected := []*v1.Service{service}
+	apiName := a.Spec.Selector[s.serviceSelectorLabel]
+	if s.serviceStore == nil || apiName == "" {
+		return selected
+	}
+	for _, obj := range s.serviceStore.List() {
+		other, ok := obj.(*v1.Service)
+		if !ok || other.GetNamespace() != service.GetNamespace() || other.GetName() == service.GetName() {
+			continue
+		}
+		if other.Labels[s.apiLabel] == a.Metadata.Name && other.Labels[s.serviceSelectorLabel] == apiName {
+			selected = append(selected, other)
+		}
+	}
+	sort.Sort(servicesByName(selected))
+	return selected
+}
+
+// Provides the service the kong API object for the provided GatewayApi resource is named after out of
+// the services it selects along with the provided one, the service named like the value of the service selector
+// when there is one, otherwise the first by name. This keeps the name of the API object stable as services come and go.
+func (s *Service) primaryService(a *GatewayApi, service *v1.Service) *v1.Service {
+	selected := s.selectedServices(a, service)
+	for _, candidate := range selected {
+		if candidate.GetName() == a.Spec.Selector[s.serviceSelectorLabel] {
+			return candidate
+		}
+	}
+	return selected[0]
+}
+
+type servicesByName []*v1.Service
+
+func (l servicesByName) Len() int           { return len(l) }
+func (l servicesByName) Less(i, j int) bool { return l[i].GetName() < l[j].GetName() }
+func (l servicesByName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// Provides the port of the provided service the provided GatewayApi resource sends traffic to,
+// selected by name or number with the first port of the service used when the resource doesn't select one.
+func servicePort(a *GatewayApi, service *v1.Service) (v1.ServicePort, error) {
+	if len(service.Spec.Ports) == 0 {
+		return v1.ServicePort{}, syncerror.Validationf("The service %v should expose at least one port", service.GetName())
+	}
+	if a.Spec.PortName == "" && a.Spec.Port == 0 {
+		return service.Spec.Ports[0], nil
+	}
+	for _, port := range service.Spec.Ports {
+		if a.Spec.PortName != "" && port.Name == a.Spec.PortName {
+			return port, nil
+		}
+		if a.Spec.PortName == "" && port.Port == a.Spec.Port {
+			return port, nil
+		}
+	}
+	if a.Spec.PortName != "" {
+		return v1.ServicePort{}, syncerror.Validationf("The service %v doesn't expose a port named %v", service.GetName(), a.Spec.PortName)
+	}
+	return v1.ServicePort{}, syncerror.Validationf("The service %v doesn't expose port %v", service.GetName(), a.Spec.Port)
+}
+
+// Provides the upstream URL of the kong API object for the provided GatewayApi resource and service.
+// With remote clusters or endpoint targets configured, or several services selected by the resource,
+// the API object is pointed at the kong upstream balancing across the targets of the services,
+// otherwise it's pointed straight at the cluster IP.
+func (s *Service) upstreamURLFor(a *GatewayApi, service *v1.Service) (string, error) {
+	port, err := servicePort(a, service)
+	if err != nil {
+		return "", err
+	}
+	if s.balances(a, service) {
+		return "http://" + multicluster.UpstreamName(service.GetNamespace(), service.GetName()), nil
+	}
+	return "http://" + service.Spec.ClusterIP + ":" + strconv.Itoa(int(port.Port)), nil
+}
+
+// SyncTargets dispatches a sync of the targets of the kong upstream for the local service
+// with the provided namespace and name, e.g. when the matching service in a remote cluster
+// or the endpoints behind the service change.
+// Services that aren't cached or don't reference a GatewayApi resource are ignored, as are changes
+// in DB-less mode where the targets are picked up the next time the declarative configuration is rendered.
+func (s *Service) SyncTargets(namespace string, name string) {
+	if s.serviceStore == nil || s.dbless {
+		return
+	}
+	obj, exists, err := s.serviceStore.GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return
+	}
+	service, ok := obj.(*v1.Service)
+	if !ok {
+		return
+	}
+	gatewayApiName, exists := service.Labels[s.apiLabel]
+	if !exists {
+		return
+	}
+	v1s := *service
+	resource := syncerror.ResourceKey("services", namespace, name)
+	s.dispatch(namespace, name, resource, "target sync of service "+name, func(ctx context.Context) error {
+		gatewayApi, err := s.getGatewayApi(ctx, namespace, gatewayApiName)
+		if err == ErrOtherControllerClass {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// The targets of every selected service live in the upstream named after the primary one.
+		primary := s.primaryService(gatewayApi, &v1s)
+		if err = s.syncTargets(ctx, gatewayApi, primary); err != nil {
+			return err
+		}
+		return s.syncPortTargets(ctx, gatewayApi, primary)
+	})
+}
+
+// Brings the targets of the kong upstream for the provided service in line with the port of the services
+// selected by the provided GatewayApi resource and the services with the same namespace and names
+// in the remote clusters, the upstream is created when it doesn't exist yet.
+// With endpoint targets configured the ready pods behind the services are targeted instead of their cluster IPs.
+// Nothing is done when neither is configured and the resource selects a single service.
+// Kong keeps the history of targets so targets are enabled and disabled rather than removed.
+func (s *Service) syncTargets(ctx context.Context, a *GatewayApi, service *v1.Service) error {
+	return s.syncUpstream(ctx, multicluster.UpstreamName(service.GetNamespace(), service.GetName()), a, service)
+}
+
+// Brings the targets of the kong upstream with the provided name in line with the provided
+// GatewayApi resource and service like syncTargets.
+func (s *Service) syncUpstream(ctx context.Context, upstreamName string, a *GatewayApi, service *v1.Service) error {
+	if !s.balances(a, service) {
+		return nil
+	}
+	desired, err := s.desiredTargets(a, service)
+	if err != nil {
+		return err
+	}
+	_, err = s.kongClient.GetUpstream(ctx, upstreamName)
+	if err != nil {
+		if err != kong.ErrNotFound {
+			return err
+		}
+		if err := s.limiter.WaitWrite(ctx, service.GetNamespace()); err != nil {
+			return err
+		}
+		if _, err = s.kongClient.CreateUpstream(ctx, &kong.Upstream{Name: upstreamName}); err != nil {
+			return err
+		}
+		// The upstream is registered so the garbage collector can find it should it ever be left behind.
+		if err = s.registry.Claim(ownership.KindUpstream, upstreamName, ownerOf(a)); err != nil {
+			return err
+		}
+	}
+	current, err := s.kongClient.ListTargets(ctx, upstreamName)
+	if err != nil {
+		return err
+	}
+	latest := latestTargets(current)
+	wait := s.rampWait(service.GetNamespace())
+	for target := range desired {
+		entry, exists := latest[target]
+		if exists && entry.Weight >= s.kongClient.TargetWeight() {
+			continue
+		}
+		if exists && entry.Weight > 0 {
+			// The target was left part way through its slow start, e.g. by a restart or a change of leader.
+			if err = s.kongClient.ResumeTarget(ctx, upstreamName, target, entry.Weight, wait); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Printf("Enabling the %v target of the %v upstream", target, upstreamName)
+		if err := s.limiter.WaitWrite(ctx, service.GetNamespace()); err != nil {
+			return err
+		}
+		if _, err = s.kongClient.EnableTarget(ctx, upstreamName, target, wait); err != nil {
+			return err
+		}
+	}
+	for target, entry := range latest {
+		if desired[target] || entry.Weight == 0 {
+			continue
+		}
+		log.Printf("Disabling the %v target of the %v upstream", target, upstreamName)
+		if err := s.limiter.WaitWrite(ctx, service.GetNamespace()); err != nil {
+			return err
+		}
+		if _, err = s.kongClient.DisableTarget(ctx, upstreamName, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Provides the wait for every step of the slow start ramps of targets in the provided namespace,
+// holding them to the write rate limit of the namespace.
+func (s *Service) rampWait(namespace string) kong.RampWait {
+	return func(ctx context.Context) error {
+		return s.limiter.WaitWrite(ctx, namespace)
+	}
+}
+
+// Provides the host:port targets the kong upstream for the provided service should have for the port
+// selected by the provided GatewayApi resource of every service it selects.
+func (s *Service) desiredTargets(a *GatewayApi, service *v1.Service) (map[string]bool, error) {
+	desired := make(map[string]bool)
+	for _, selected := range s.selectedServices(a, service) {
+		port, err := servicePort(a, selected)
+		if err != nil {
+			return nil, err
+		}
+		if s.endpoints != nil {
+			// Pods are targeted on the container port behind the selected port of the service.
+			for _, target := range s.endpoints.ReadyTargets(selected.GetNamespace(), selected.GetName(), port.Name) {
+				desired[target] = true
+			}
+		} else if selected.Spec.ClusterIP != "" && selected.Spec.ClusterIP != "None" {
+			desired[selected.Spec.ClusterIP+":"+strconv.Itoa(int(port.Port))] = true
+		}
+		if s.discovery != nil {
+			for _, target := range s.discovery.Targets(selected.GetNamespace(), selected.GetName(), port.Name) {
+				desired[target] = true
+			}
+		}
+	}
+	return desired, nil
+}
+
+// Provides the latest entry for each target in the provided target history,
+// the latest entry for a target decides whether it's enabled.
+func latestTargets(targets *kong.TargetList) map[string]*kong.Target {
+	latest := make(map[string]*kong.Target)
+	for _, target := range targets.Data {
+		if existing, exists := latest[target.Target]; !exists || target.Created > existing.Created {
+			latest[target.Target] = target
+		}
+	}
+	return latest
+}
+
+// Deletes the kong upstream for the service with the provided namespace and name
+// once its kong API object has gone, its targets go along with it.
+// Nothing is done when kong API objects don't use upstreams and we don't own one for the service.
+func (s *Service) deleteUpstream(ctx context.Context, namespace string, name string) error {
+	upstreamName := multicluster.UpstreamName(namespace, name)
+	if _, owned := s.registry.Owner(ownership.KindUpstream, upstreamName); !owned && !s.usesUpstreams() {
+		return nil
+	}
+	if err := s.limiter.WaitWrite(ctx, namespace); err != nil {
+		return err
+	}
+	err := s.kongClient.DeleteUpstream(ctx, upstreamName)
+	if err != nil && err != kong.ErrNotFound {
+		return err
+	}
+	return s.registry.Release(ownership.KindUpstream, upstreamName)
+}
@@ -0,0 +1,222 @@
+package gatewayapi
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/kong/fake"
+	"github.com/freshwebio/k8s-kong-api/multicluster"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	ownershipfake "github.com/freshwebio/k8s-kong-api/ownership/fake"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Creates a service reconciling upstreams in the provided fake kong without any remote clusters,
+// so the only target of a service is its cluster IP.
+func newTargetsService(k *fake.Kong) *Service {
+	return &Service{
+		kongClient: k,
+		limiter:    throttle.NewLimiter(1, 0, 1),
+		discovery:  &multicluster.Discovery{},
+		registry:   ownership.NewRegistryFor(ownershipfake.NewConfigMaps(), "kong", "owners"),
+	}
+}
+
+func ordersService() *v1.Service {
+	service := &v1.Service{Spec: v1.ServiceSpec{ClusterIP: "10.0.0.1", Ports: []v1.ServicePort{{Name: "http", Port: 8080}}}}
+	service.Name = "orders"
+	service.Namespace = "default"
+	return service
+}
+
+// Provides the sorted targets the latest entries of the upstream with the provided name enable.
+func enabledTargets(t *testing.T, k *fake.Kong, upstreamName string) []string {
+	targets, err := k.ListTargets(context.Background(), upstreamName)
+	if err != nil {
+		t.Fatalf("listing the targets of the %v upstream: %v", upstreamName, err)
+	}
+	enabled := []string{}
+	for target, entry := range latestTargets(targets) {
+		if entry.Weight > 0 {
+			enabled = append(enabled, target)
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
+
+// Seeds the provided upstream with a history of enabled and disabled targets.
+func seedUpstream(t *testing.T, k *fake.Kong, upstreamName string) {
+	ctx := context.Background()
+	if _, err := k.CreateUpstream(ctx, &kong.Upstream{Name: upstreamName}); err != nil {
+		t.Fatalf("creating the %v upstream: %v", upstreamName, err)
+	}
+	for _, step := range []struct {
+		target  string
+		enabled bool
+	}{
+		{"10.0.0.1:8080", true},
+		{"10.0.0.9:8080", true},
+		{"10.0.0.2:8080", true},
+		{"10.0.0.2:8080", false},
+		{"10.0.0.1:8080", false},
+		{"10.0.0.1:8080", true},
+	} {
+		var err error
+		if step.enabled {
+			_, err = k.EnableTarget(ctx, upstreamName, step.target, nil)
+		} else {
+			_, err = k.DisableTarget(ctx, upstreamName, step.target)
+		}
+		if err != nil {
+			t.Fatalf("seeding the %v target: %v", step.target, err)
+		}
+	}
+}
+
+func TestSyncTargetsConvergesOnTheTargetsOfTheService(t *testing.T) {
+	k := fake.New()
+	service := ordersService()
+	upstreamName := multicluster.UpstreamName(service.Namespace, service.Name)
+	seedUpstream(t, k, upstreamName)
+	s := newTargetsService(k)
+
+	if err := s.syncTargets(context.Background(), &GatewayApi{}, service); err != nil {
+		t.Fatalf("syncing the targets: %v", err)
+	}
+	expected := []string{"10.0.0.1:8080"}
+	if enabled := enabledTargets(t, k, upstreamName); !reflect.DeepEqual(enabled, expected) {
+		t.Errorf("expected the enabled targets to be %v but got %v", expected, enabled)
+	}
+
+	// A second sync finds everything in place and leaves kong alone.
+	writes := k.Calls("EnableTarget") + k.Calls("DisableTarget")
+	if err := s.syncTargets(context.Background(), &GatewayApi{}, service); err != nil {
+		t.Fatalf("syncing the targets again: %v", err)
+	}
+	if after := k.Calls("EnableTarget") + k.Calls("DisableTarget"); after != writes {
+		t.Errorf("expected no target writes for an upstream in sync but got %v", after-writes)
+	}
+}
+
+func TestSyncTargetsCreatesAMissingUpstream(t *testing.T) {
+	k := fake.New()
+	service := ordersService()
+	upstreamName := multicluster.UpstreamName(service.Namespace, service.Name)
+	s := newTargetsService(k)
+
+	if err := s.syncTargets(context.Background(), &GatewayApi{}, service); err != nil {
+		t.Fatalf("syncing the targets: %v", err)
+	}
+	if _, err := k.GetUpstream(context.Background(), upstreamName); err != nil {
+		t.Fatalf("expected the %v upstream to be created but got %v", upstreamName, err)
+	}
+	expected := []string{"10.0.0.1:8080"}
+	if enabled := enabledTargets(t, k, upstreamName); !reflect.DeepEqual(enabled, expected) {
+		t.Errorf("expected the enabled targets to be %v but got %v", expected, enabled)
+	}
+}
+
+func TestSyncTargetsResumesTargetsLeftPartWayThroughTheirSlowStart(t *testing.T) {
+	k := fake.New()
+	service := ordersService()
+	upstreamName := multicluster.UpstreamName(service.Namespace, service.Name)
+	if _, err := k.CreateUpstream(context.Background(), &kong.Upstream{Name: upstreamName}); err != nil {
+		t.Fatalf("creating the %v upstream: %v", upstreamName, err)
+	}
+	if _, err := k.CreateTarget(context.Background(), upstreamName, &kong.Target{Target: "10.0.0.1:8080", Weight: 2}); err != nil {
+		t.Fatalf("creating a partly ramped target: %v", err)
+	}
+	s := newTargetsService(k)
+
+	if err := s.syncTargets(context.Background(), &GatewayApi{}, service); err != nil {
+		t.Fatalf("syncing the targets: %v", err)
+	}
+	if calls := k.Calls("ResumeTarget"); calls != 1 {
+		t.Fatalf("expected the partly ramped target to be resumed but got %v resumes", calls)
+	}
+	targets, err := k.ListTargets(context.Background(), upstreamName)
+	if err != nil {
+		t.Fatalf("listing the targets: %v", err)
+	}
+	if weight := latestTargets(targets)["10.0.0.1:8080"].Weight; weight != k.TargetWeight() {
+		t.Errorf("expected the target to end up with the full weight of %v but got %v", k.TargetWeight(), weight)
+	}
+}
+
+func TestSyncTargetsFailsWhenKongDoes(t *testing.T) {
+	k := fake.New()
+	service := ordersService()
+	upstreamName := multicluster.UpstreamName(service.Namespace, service.Name)
+	seedUpstream(t, k, upstreamName)
+	s := newTargetsService(k)
+	k.FailOn("DisableTarget", 0, kong.ErrNotFound)
+
+	if err := s.syncTargets(context.Background(), &GatewayApi{}, service); err != kong.ErrNotFound {
+		t.Fatalf("expected the sync to fail with the error from kong but got %v", err)
+	}
+	k.Heal("DisableTarget")
+	if err := s.syncTargets(context.Background(), &GatewayApi{}, service); err != nil {
+		t.Fatalf("expected the sync to go through once kong is healthy but got %v", err)
+	}
+	expected := []string{"10.0.0.1:8080"}
+	if enabled := enabledTargets(t, k, upstreamName); !reflect.DeepEqual(enabled, expected) {
+		t.Errorf("expected the enabled targets to be %v but got %v", expected, enabled)
+	}
+}
+
+func TestSyncTargetsStopsOnceTheContextIsDone(t *testing.T) {
+	k := fake.New()
+	service := ordersService()
+	upstreamName := multicluster.UpstreamName(service.Namespace, service.Name)
+	seedUpstream(t, k, upstreamName)
+	s := newTargetsService(k)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.syncTargets(ctx, &GatewayApi{}, service); err != context.Canceled {
+		t.Fatalf("expected the sync to fail with %v but got %v", context.Canceled, err)
+	}
+	expected := []string{"10.0.0.1:8080", "10.0.0.9:8080"}
+	if enabled := enabledTargets(t, k, upstreamName); !reflect.DeepEqual(enabled, expected) {
+		t.Errorf("expected the enabled targets to be left as %v but got %v", expected, enabled)
+	}
+}
+
+func TestCompactableTargetsKeepTheEnabledTargets(t *testing.T) {
+	k := fake.New()
+	service := ordersService()
+	upstreamName := multicluster.UpstreamName(service.Namespace, service.Name)
+	seedUpstream(t, k, upstreamName)
+	ctx := context.Background()
+	before := enabledTargets(t, k, upstreamName)
+
+	targets, err := k.ListTargets(ctx, upstreamName)
+	if err != nil {
+		t.Fatalf("listing the targets: %v", err)
+	}
+	stale := compactableTargets(targets)
+	if len(stale) != staleTargets(targets) {
+		t.Errorf("expected %v compactable entries but got %v", staleTargets(targets), len(stale))
+	}
+	// Every entry is deleted in turn so no target may be enabled or disabled along the way.
+	for _, target := range stale {
+		if err = k.DeleteTarget(ctx, upstreamName, target.ID); err != nil {
+			t.Fatalf("deleting the %v target entry: %v", target.ID, err)
+		}
+		if enabled := enabledTargets(t, k, upstreamName); !reflect.DeepEqual(enabled, before) {
+			t.Fatalf("expected the enabled targets to stay %v but got %v", before, enabled)
+		}
+	}
+	compacted, err := k.ListTargets(ctx, upstreamName)
+	if err != nil {
+		t.Fatalf("listing the compacted targets: %v", err)
+	}
+	if len(compacted.Data) != len(before) {
+		t.Errorf("expected only the %v enabled target entries to be left but got %v", len(before), len(compacted.Data))
+	}
+}
@@ -1,33 +1,38 @@
 package gatewayapi
 
 import (
-	"encoding/json"
-
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
 	"k8s.io/client-go/pkg/api"
 	"k8s.io/client-go/pkg/api/meta"
 	"k8s.io/client-go/pkg/api/unversioned"
 )
 
+// Resource identifies GatewayApi resources for the dynamic client.
+var Resource = k8sclient.GroupVersionResource{Group: "k8s.freshweb.io", Version: "v1", Resource: "gatewayapis"}
+
 // GatewayApi provides the type for an
 // API plugin resource in Kubernetes.
 type GatewayApi struct {
 	unversioned.TypeMeta `json:",inline"`
 	Metadata             api.ObjectMeta `json:"metadata"`
 	Spec                 Spec           `json:"spec"`
+	Status               Status         `json:"status,omitempty"`
 }
 
-// Event provides the event recieved for gateway api resource watchers.
-type Event struct {
-	Type   string     `json:"type"`
-	Object GatewayApi `json:"object"`
-}
-
-// UpdateEvent provides the event recieved for gateway api resource watchers
-// for update events specifically.
-type UpdateEvent struct {
-	Old GatewayApi `json:"old"`
-	New GatewayApi `json:"new"`
-}
+const (
+	// AdoptAnnotation provides the annotation that allows a GatewayApi resource
+	// to take over a pre-existing kong API object that isn't owned by the controller.
+	AdoptAnnotation = "k8s.freshweb.io/adopt"
+	// ConditionKongAPIOwned provides the condition type letting users know
+	// whether the kong API object for the resource is owned by the controller.
+	ConditionKongAPIOwned = "KongAPIOwned"
+	// ConditionSynced provides the condition type letting users know
+	// whether the last sync of the resource to kong succeeded.
+	ConditionSynced = "Synced"
+	// ConditionDegraded provides the condition type letting users know that the last sync
+	// failed while the kong API object for the resource exists, kong keeps serving it as it was last synced.
+	ConditionDegraded = "Degraded"
+)
 
 // GetObjectKind provides the method to expose the kind
 // of our GatewayApi object.
@@ -40,23 +45,6 @@ func (p *GatewayApi) GetObjectMeta() meta.Object {
 	return &p.Metadata
 }
 
-// GACopy provides an alias of the GatewayApi to be utilised
-// in unmarshalling of JSON data.
-type GACopy GatewayApi
-
-// UnmarshalJSON provides the way in which JSON should be unmarshalled correctly for this type.
-// This is a temporary workaround for https://github.com/kubernetes/client-go/issues/8
-func (p *GatewayApi) UnmarshalJSON(data []byte) error {
-	tmp := GACopy{}
-	err := json.Unmarshal(data, &tmp)
-	if err != nil {
-		return err
-	}
-	tmp2 := GatewayApi(tmp)
-	*p = tmp2
-	return nil
-}
-
 // GatewayApiList provides the type encapsulating a list of GatewayApi resources.
 type GatewayApiList struct {
 	unversioned.TypeMeta `json:",inline"`
@@ -75,22 +63,6 @@ func (l *GatewayApiList) GetListMeta() unversioned.List {
 	return &l.Metadata
 }
 
-// ListCopy provides the type alias for list to be used in unmarshalling from JSON.
-type ListCopy GatewayApiList
-
-// UnmarshalJSON provides the way in which JSON should be unmarshalled correctly for this list type.
-// Temporary workaround for https://github.com/kubernetes/client-go/issues/8
-func (l *GatewayApiList) UnmarshalJSON(data []byte) error {
-	tmp := ListCopy{}
-	err := json.Unmarshal(data, &tmp)
-	if err != nil {
-		return err
-	}
-	tmp2 := GatewayApiList(tmp)
-	*l = tmp2
-	return nil
-}
-
 // Spec provides the type for the specification
 // of the plugin resource specification.
 // The name and upstream url of the API to be created in kong are
@@ -101,14 +73,51 @@ type Spec struct {
 	StripURI               *bool    `json:"strip_uri,omitempty"`
 	Methods                []string `json:"methods,omitempty"`
 	PreserveHost           *bool    `json:"preserve_host,omitempty"`
-	Retries                int64    `json:"retries,omitempty"`
+	Retries                *int64   `json:"retries,omitempty"`
 	UpstreamConnectTimeout int64    `json:"upstream_connect_timeout,omitempty"`
 	UpstreamSendTimeout    int64    `json:"upstream_send_timeout,omitempty"`
 	UpstreamReadTimeout    int64    `json:"upstream_read_timeout,omitempty"`
 	HTTPSOnly              *bool    `json:"https_only,omitempty"`
 	HTTPIfTerminated       *bool    `json:"http_if_terminated,omitempty"`
+	// The number of the service port kong sends traffic to,
+	// the first port of the service is used when neither this nor PortName is set.
+	Port int32 `json:"port,omitempty"`
+	// The name of the service port kong sends traffic to, takes precedence over Port.
+	PortName string `json:"portName,omitempty"`
+	// Additional kong API objects for named ports of the service, each with their own hosts, uris and methods.
+	Ports []PortAPI `json:"ports,omitempty"`
 	// Label selector for selecting the services the GatewayApi resource
 	// represents. This will then create a new API object
 	// in Kong for the configuration and service upstream host.
 	Selector map[string]string `json:"selector"`
 }
+
+// PortAPI provides the type for an additional kong API object sending traffic
+// to a single named port of the selected service, the API object is named <service>-<port name>.
+// Everything but the hosts, uris and methods is taken from the spec of the GatewayApi resource.
+type PortAPI struct {
+	Name    string   `json:"name"`
+	Hosts   []string `json:"hosts,omitempty"`
+	Uris    []string `json:"uris,omitempty"`
+	Methods []string `json:"methods,omitempty"`
+}
+
+// Status provides the type for the observed state
+// of a GatewayApi resource.
+type Status struct {
+	Conditions []Condition `json:"conditions,omitempty"`
+	// When the resource was last synced to kong successfully.
+	LastSyncTime *unversioned.Time `json:"lastSyncTime,omitempty"`
+	// The id of the kong API object for the resource as of the last sync.
+	KongAPIID string `json:"kongApiId,omitempty"`
+}
+
+// Condition provides a single observation of the state
+// of a GatewayApi resource.
+type Condition struct {
+	Type               string           `json:"type"`
+	Status             string           `json:"status"`
+	Reason             string           `json:"reason,omitempty"`
+	Message            string           `json:"message,omitempty"`
+	LastTransitionTime unversioned.Time `json:"lastTransitionTime,omitempty"`
+}
@@ -0,0 +1,166 @@
+package gatewayapi
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// VersionV2 provides the version GatewayApi resources with the v2 spec are served under.
+// Resources are stored as v1, the only version the controller works from, and the apiserver
+// has the conversion webhook of the controller convert them to and from v2, see Convert.
+const VersionV2 = "v2"
+
+// SpecV2 provides the type for the v2 specification of GatewayApi resources, which groups the
+// routes kong matches requests against, the port of the service traffic is sent to and how it's sent upstream.
+type SpecV2 struct {
+	// The routes kong matches requests against. The route without a port is represented by the kong API object
+	// for the service itself and every route for a named port by an additional kong API object for the port.
+	Routes []RouteV2 `json:"routes"`
+	// The port of the service the route without a port sends traffic to.
+	ServicePort ServicePortV2 `json:"servicePort,omitempty"`
+	// How kong treats the requests matched by every route.
+	Routing RoutingPolicyV2 `json:"routing,omitempty"`
+	// How kong sends the requests matched by every route to the service.
+	Upstream UpstreamPolicyV2 `json:"upstream,omitempty"`
+	// Label selector for selecting the service the GatewayApi resource represents.
+	Selector map[string]string `json:"selector"`
+}
+
+// RouteV2 provides the type for a single route of a v2 GatewayApi resource.
+type RouteV2 struct {
+	// The name of the service port the route sends traffic to, empty for the port selected by the spec.
+	Port    string   `json:"port,omitempty"`
+	Hosts   []string `json:"hosts,omitempty"`
+	Paths   []string `json:"paths,omitempty"`
+	Methods []string `json:"methods,omitempty"`
+}
+
+// ServicePortV2 provides the type selecting a port of the service by number or by name,
+// the name takes precedence and the first port of the service is used when neither is set.
+type ServicePortV2 struct {
+	Number int32  `json:"number,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// RoutingPolicyV2 provides the type for how kong treats the requests matched by the routes.
+type RoutingPolicyV2 struct {
+	StripPath        *bool `json:"stripPath,omitempty"`
+	PreserveHost     *bool `json:"preserveHost,omitempty"`
+	HTTPSOnly        *bool `json:"httpsOnly,omitempty"`
+	HTTPIfTerminated *bool `json:"httpIfTerminated,omitempty"`
+}
+
+// UpstreamPolicyV2 provides the type for how kong sends requests to the service, the timeouts are in milliseconds.
+// Retries is a pointer so retries of 0 can be told apart from retries that haven't been set.
+type UpstreamPolicyV2 struct {
+	Retries        *int64 `json:"retries,omitempty"`
+	ConnectTimeout int64  `json:"connectTimeout,omitempty"`
+	SendTimeout    int64  `json:"sendTimeout,omitempty"`
+	ReadTimeout    int64  `json:"readTimeout,omitempty"`
+}
+
+// ToV1 converts the v2 spec to the v1 spec the controller works from. The route without a port becomes the hosts,
+// uris and methods of the spec and every other route a port API object. Specs with more than one route without a port
+// or several routes for the same port can't be represented in v1 and fail to convert.
+func (s SpecV2) ToV1() (Spec, error) {
+	spec := Spec{
+		StripURI:               s.Routing.StripPath,
+		PreserveHost:           s.Routing.PreserveHost,
+		HTTPSOnly:              s.Routing.HTTPSOnly,
+		HTTPIfTerminated:       s.Routing.HTTPIfTerminated,
+		Retries:                s.Upstream.Retries,
+		UpstreamConnectTimeout: s.Upstream.ConnectTimeout,
+		UpstreamSendTimeout:    s.Upstream.SendTimeout,
+		UpstreamReadTimeout:    s.Upstream.ReadTimeout,
+		Port:                   s.ServicePort.Number,
+		PortName:               s.ServicePort.Name,
+		Selector:               s.Selector,
+	}
+	defaultRoute := false
+	ports := make(map[string]bool)
+	for _, route := range s.Routes {
+		switch {
+		case route.Port == "" && defaultRoute:
+			return Spec{}, fmt.Errorf("Only one route can leave out the port")
+		case route.Port == "":
+			defaultRoute = true
+			spec.Hosts, spec.Uris, spec.Methods = route.Hosts, route.Paths, route.Methods
+		case ports[route.Port]:
+			return Spec{}, fmt.Errorf("Only one route can send traffic to the %v port", route.Port)
+		default:
+			ports[route.Port] = true
+			spec.Ports = append(spec.Ports, PortAPI{Name: route.Port, Hosts: route.Hosts, Uris: route.Paths,
+				Methods: route.Methods})
+		}
+	}
+	return spec, nil
+}
+
+// ToV2 converts the v1 spec to the v2 layout, every v1 spec can be represented in v2
+// and converts back to the same v1 spec.
+func (s Spec) ToV2() SpecV2 {
+	spec := SpecV2{
+		Routes:      []RouteV2{},
+		ServicePort: ServicePortV2{Number: s.Port, Name: s.PortName},
+		Routing: RoutingPolicyV2{StripPath: s.StripURI, PreserveHost: s.PreserveHost, HTTPSOnly: s.HTTPSOnly,
+			HTTPIfTerminated: s.HTTPIfTerminated},
+		Upstream: UpstreamPolicyV2{Retries: s.Retries, ConnectTimeout: s.UpstreamConnectTimeout,
+			SendTimeout: s.UpstreamSendTimeout, ReadTimeout: s.UpstreamReadTimeout},
+		Selector: s.Selector,
+	}
+	if len(s.Hosts) > 0 || len(s.Uris) > 0 || len(s.Methods) > 0 {
+		spec.Routes = append(spec.Routes, RouteV2{Hosts: s.Hosts, Paths: s.Uris, Methods: s.Methods})
+	}
+	for _, port := range s.Ports {
+		spec.Routes = append(spec.Routes, RouteV2{Port: port.Name, Hosts: port.Hosts, Paths: port.Uris, Methods: port.Methods})
+	}
+	return spec
+}
+
+// Convert converts the provided GatewayApi object to the provided API version, e.g. k8s.freshweb.io/v2,
+// leaving everything but its spec and API version as it is so nothing the apiserver keeps is lost.
+// Objects already at the provided version are provided as they are.
+func Convert(object []byte, apiVersion string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(object, &fields); err != nil {
+		return nil, err
+	}
+	var current string
+	if err := json.Unmarshal(fields["apiVersion"], &current); err != nil {
+		return nil, fmt.Errorf("The object doesn't have an API version: %v", err)
+	}
+	if current == apiVersion {
+		return object, nil
+	}
+	v1Version, v2Version := Resource.Group+"/"+Resource.Version, Resource.Group+"/"+VersionV2
+	if (current != v1Version || apiVersion != v2Version) && (current != v2Version || apiVersion != v1Version) {
+		return nil, fmt.Errorf("Can't convert a GatewayApi from %v to %v", current, apiVersion)
+	}
+	var err error
+	// Only the API version changes for objects without a spec.
+	if len(fields["spec"]) > 0 {
+		var spec interface{}
+		if apiVersion == v2Version {
+			v1 := Spec{}
+			if err = json.Unmarshal(fields["spec"], &v1); err != nil {
+				return nil, err
+			}
+			spec = v1.ToV2()
+		} else {
+			v2 := SpecV2{}
+			if err = json.Unmarshal(fields["spec"], &v2); err != nil {
+				return nil, err
+			}
+			if spec, err = v2.ToV1(); err != nil {
+				return nil, err
+			}
+		}
+		if fields["spec"], err = json.Marshal(spec); err != nil {
+			return nil, err
+		}
+	}
+	if fields["apiVersion"], err = json.Marshal(apiVersion); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
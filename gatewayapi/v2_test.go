@@ -0,0 +1,118 @@
+package gatewayapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func boolPtr(value bool) *bool {
+	return &value
+}
+
+func int64Ptr(value int64) *int64 {
+	return &value
+}
+
+func TestV1SpecsSurviveConversionToV2(t *testing.T) {
+	specs := []Spec{
+		{Selector: map[string]string{"service": "orders"}},
+		{
+			Hosts:                  []string{"orders.example.com"},
+			Uris:                   []string{"/orders"},
+			Methods:                []string{"GET", "POST"},
+			StripURI:               boolPtr(false),
+			PreserveHost:           boolPtr(true),
+			HTTPSOnly:              boolPtr(true),
+			HTTPIfTerminated:       boolPtr(false),
+			Retries:                int64Ptr(0),
+			UpstreamConnectTimeout: 1000,
+			UpstreamSendTimeout:    2000,
+			UpstreamReadTimeout:    3000,
+			PortName:               "http",
+			Ports:                  []PortAPI{{Name: "admin", Uris: []string{"/orders-admin"}}},
+			Selector:               map[string]string{"service": "orders"},
+		},
+		{Port: 8080, Ports: []PortAPI{{Name: "metrics", Hosts: []string{"metrics.example.com"}}}},
+	}
+	for _, spec := range specs {
+		converted, err := spec.ToV2().ToV1()
+		if err != nil {
+			t.Errorf("converting %+v back to v1: %v", spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(converted, spec) {
+			t.Errorf("expected %+v to convert back to itself but got %+v", spec, converted)
+		}
+	}
+}
+
+func TestV2SpecsThatCantBeRepresentedInV1(t *testing.T) {
+	specs := map[string]SpecV2{
+		"two routes without a port": {Routes: []RouteV2{{Paths: []string{"/a"}}, {Paths: []string{"/b"}}}},
+		"two routes for the same port": {Routes: []RouteV2{{Port: "admin", Paths: []string{"/a"}},
+			{Port: "admin", Paths: []string{"/b"}}}},
+	}
+	for name, spec := range specs {
+		if _, err := spec.ToV1(); err == nil {
+			t.Errorf("%v: expected the conversion to v1 to fail", name)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	v1Object := []byte(`{"apiVersion":"k8s.freshweb.io/v1","kind":"GatewayApi",` +
+		`"metadata":{"name":"orders","namespace":"default","resourceVersion":"12"},` +
+		`"spec":{"uris":["/orders"],"retries":0,"selector":{"service":"orders"}},` +
+		`"status":{"conditions":[{"type":"Synced","status":"True"}]}}`)
+	v2Object, err := Convert(v1Object, "k8s.freshweb.io/v2")
+	if err != nil {
+		t.Fatalf("converting to v2: %v", err)
+	}
+	converted := struct {
+		APIVersion string          `json:"apiVersion"`
+		Metadata   json.RawMessage `json:"metadata"`
+		Spec       SpecV2          `json:"spec"`
+		Status     json.RawMessage `json:"status"`
+	}{}
+	if err = json.Unmarshal(v2Object, &converted); err != nil {
+		t.Fatalf("decoding the v2 object: %v", err)
+	}
+	if converted.APIVersion != "k8s.freshweb.io/v2" {
+		t.Errorf("expected the v2 API version but got %v", converted.APIVersion)
+	}
+	if string(converted.Metadata) != `{"name":"orders","namespace":"default","resourceVersion":"12"}` {
+		t.Errorf("expected the metadata to be left as it is but got %s", converted.Metadata)
+	}
+	if string(converted.Status) != `{"conditions":[{"type":"Synced","status":"True"}]}` {
+		t.Errorf("expected the status to be left as it is but got %s", converted.Status)
+	}
+	expected := []RouteV2{{Paths: []string{"/orders"}}}
+	if !reflect.DeepEqual(converted.Spec.Routes, expected) {
+		t.Errorf("expected the routes %+v but got %+v", expected, converted.Spec.Routes)
+	}
+	if retries := converted.Spec.Upstream.Retries; retries == nil || *retries != 0 {
+		t.Errorf("expected retries of 0 to be kept but got %v", retries)
+	}
+
+	roundTripped, err := Convert(v2Object, "k8s.freshweb.io/v1")
+	if err != nil {
+		t.Fatalf("converting back to v1: %v", err)
+	}
+	a := &GatewayApi{}
+	if err = json.Unmarshal(roundTripped, a); err != nil {
+		t.Fatalf("decoding the v1 object: %v", err)
+	}
+	if !reflect.DeepEqual(a.Spec.Uris, []string{"/orders"}) || a.Spec.Retries == nil || *a.Spec.Retries != 0 {
+		t.Errorf("expected the v1 spec to survive the round trip but got %+v", a.Spec)
+	}
+
+	if _, err = Convert(v1Object, "k8s.freshweb.io/v3"); err == nil {
+		t.Error("expected the conversion to an unknown version to fail")
+	}
+	invalid := []byte(`{"apiVersion":"k8s.freshweb.io/v2","kind":"GatewayApi",` +
+		`"spec":{"routes":[{"paths":["/a"]},{"paths":["/b"]}]}}`)
+	if _, err = Convert(invalid, "k8s.freshweb.io/v1"); err == nil {
+		t.Error("expected the conversion of a v2 spec with two routes without a port to fail")
+	}
+}
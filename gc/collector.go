@@ -0,0 +1,341 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/clustergatewayapi"
+	"github.com/freshwebio/k8s-kong-api/config"
+	"github.com/freshwebio/k8s-kong-api/controllerclass"
+	"github.com/freshwebio/k8s-kong-api/gatewayapi"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/multicluster"
+	"github.com/freshwebio/k8s-kong-api/naming"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/shard"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+	"k8s.io/client-go/pkg/api/errors"
+)
+
+// Collector deals with periodically reaping the kong objects owned by the controller
+// that no longer have a Kubernetes resource they are generated from.
+// Events can be missed while the controller is down so the watches alone can't guarantee
+// owned objects are removed, the collector catches anything they leave behind.
+// Plugins and targets are removed by kong along with the API object or upstream they belong to
+// so only API objects and upstreams need to be collected.
+type Collector struct {
+	kongClient           kong.Interface
+	gatewayApis          gatewayApiGetter
+	clusterGatewayApis   clusterGatewayApiGetter
+	registry             *ownership.Registry
+	limiter              *throttle.Limiter
+	shard                shard.Shard
+	names                naming.Scheme
+	onboarding           *onboarding.Watcher
+	serviceSelectorLabel string
+	class                string
+	interval             time.Duration
+	minOrphanAge         time.Duration
+	reportOnly           bool
+	ctx                  context.Context
+	reconcileTimeout     time.Duration
+	mu                   sync.Mutex
+	orphanedSince        map[string]time.Time
+}
+
+// Retrieves the GatewayApi resources owned kong objects are generated from,
+// implemented by the GatewayApi client.
+type gatewayApiGetter interface {
+	Get(ctx context.Context, namespace string, name string) (*gatewayapi.GatewayApi, error)
+}
+
+// Retrieves the ClusterGatewayApi resources owned kong objects are generated from,
+// implemented by the ClusterGatewayApi client.
+type clusterGatewayApiGetter interface {
+	Get(ctx context.Context, name string) (*clustergatewayapi.ClusterGatewayApi, error)
+}
+
+// NewCollector creates a new instance of the garbage collector running a pass at the provided interval.
+// In report only mode orphaned objects are logged and counted but never deleted.
+// An object has to be orphaned for at least the interval and the deletion grace period
+// before it's reaped so objects that are only briefly without a resource are left alone.
+func NewCollector(k8sClient *k8sclient.Client, kongClient kong.Interface, cfg *config.Config,
+	interval time.Duration, reportOnly bool) *Collector {
+	minOrphanAge := interval
+	if cfg.DeletionGracePeriod > minOrphanAge {
+		minOrphanAge = cfg.DeletionGracePeriod
+	}
+	return &Collector{
+		kongClient:           kongClient,
+		gatewayApis:          gatewayapi.NewClient(k8sClient),
+		clusterGatewayApis:   clustergatewayapi.NewClient(k8sClient),
+		registry:             cfg.Registry,
+		limiter:              cfg.Limiter,
+		shard:                cfg.Shard,
+		names:                cfg.Names,
+		onboarding:           cfg.Onboarding,
+		serviceSelectorLabel: cfg.ServiceSelectorLabel,
+		class:                cfg.ControllerClass,
+		interval:             interval,
+		minOrphanAge:         minOrphanAge,
+		reportOnly:           reportOnly,
+		ctx:                  cfg.Context,
+		reconcileTimeout:     cfg.ReconcileTimeout,
+		orphanedSince:        make(map[string]time.Time),
+	}
+}
+
+// Run carries out a garbage collection pass at the configured interval
+// until the provided done channel is closed.
+// This method should be called asynchronously in it's own goroutine.
+func (c *Collector) Run(done <-chan struct{}) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ctx, cancel := workqueue.Context(c.ctx, c.reconcileTimeout)
+			if err := c.collect(ctx); err != nil {
+				log.Printf("Error while collecting orphaned kong objects: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Carries out a single garbage collection pass over the kong API objects and upstreams owned by the controller,
+// the deletions of orphans are dispatched with a reconcile context of their own.
+func (c *Collector) collect(ctx context.Context) error {
+	apis, err := c.kongClient.ListAPIs(ctx)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for _, api := range apis {
+		existing[api.Name] = true
+	}
+	c.collectKind(ctx, ownership.KindAPI, func(apiName string) (bool, error) {
+		return existing[apiName], nil
+	})
+	// Kong can't list upstreams in every version we target so they are looked up one at a time.
+	c.collectKind(ctx, ownership.KindUpstream, func(upstreamName string) (bool, error) {
+		_, err := c.kongClient.GetUpstream(ctx, upstreamName)
+		if err == kong.ErrNotFound {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	return nil
+}
+
+// Carries out a garbage collection pass over the owned kong objects of the provided kind,
+// the provided function lets us know whether an object still exists in kong.
+// The resources the objects are generated from are looked up until the provided context is done.
+// Plugins and targets are removed by kong along with the API object or upstream they belong to.
+func (c *Collector) collectKind(ctx context.Context, kind string, exists func(name string) (bool, error)) {
+	orphans := 0
+	seen := make(map[string]bool)
+	for objectName, owner := range c.registry.Owned(kind) {
+		resource, namespace, name, err := parseOwner(owner)
+		if err != nil {
+			log.Printf("Skipping the %v kong %v during garbage collection: %v", objectName, kind, err)
+			continue
+		}
+		if resource == clusterResource && !c.shard.OwnsClusterScoped() {
+			continue
+		}
+		if resource != clusterResource && (!c.shard.Owns(namespace) || !c.onboarding.Enabled(namespace)) {
+			continue
+		}
+		found, err := exists(objectName)
+		if err != nil {
+			log.Printf("Error checking whether the %v kong %v still exists: %v", objectName, kind, err)
+			continue
+		}
+		orphaned, err := c.orphaned(ctx, kind, resource, namespace, name, objectName)
+		if err != nil {
+			log.Printf("Error checking whether the %v kong %v is orphaned: %v", objectName, kind, err)
+			continue
+		}
+		if !orphaned {
+			// An object missing from kong while its resource is still around keeps its claim,
+			// the next reconcile of the resource recreates it.
+			continue
+		}
+		seen[orphanKey(kind, objectName)] = true
+		if !found {
+			// The object has already gone so there's nothing left to reap, its claim is released once its resource
+			// has been gone for as long as an orphan has to be before it's reaped.
+			if !c.reportOnly && c.orphanedLongEnough(orphanKey(kind, objectName)) {
+				if err := c.registry.Release(kind, objectName); err != nil {
+					log.Printf("Error releasing the %v kong %v which no longer exists: %v", objectName, kind, err)
+				}
+			}
+			continue
+		}
+		orphans++
+		if !c.orphanedLongEnough(orphanKey(kind, objectName)) {
+			continue
+		}
+		if c.reportOnly {
+			log.Printf("The %v kong %v owned by %v no longer has its resource and would be deleted", objectName, kind, owner)
+			continue
+		}
+		c.reap(kind, resource, namespace, name, objectName, owner)
+	}
+	c.forget(kind, seen)
+	metrics.GCOrphans.WithLabelValues(kind).Set(float64(orphans))
+}
+
+// Lets us know whether the kong object of the provided kind and name no longer has the resource
+// of the provided resource kind, namespace and name it's generated from, either because the resource has gone,
+// has moved to another controller class or has been pointed at another service or no longer lists the port the object is for.
+func (c *Collector) orphaned(ctx context.Context, kind string, resource string, namespace string, name string, objectName string) (bool, error) {
+	if resource == clusterResource {
+		return c.orphanedCluster(ctx, kind, name, objectName)
+	}
+	gatewayApi, err := c.gatewayApis.Get(ctx, namespace, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if !controllerclass.Matches(gatewayApi.Metadata.Annotations, c.class) {
+		return true, nil
+	}
+	names := c.names
+	if kind == ownership.KindUpstream {
+		// Upstream names carry the namespace already so they're derived from the plain service and port names.
+		names = naming.Scheme{}
+	}
+	for _, apiName := range gatewayapi.KongAPINames(gatewayApi, gatewayApi.Spec.Selector[c.serviceSelectorLabel], names) {
+		if kind == ownership.KindUpstream {
+			// Upstreams are named after the API object they balance traffic for.
+			apiName = multicluster.UpstreamName(namespace, apiName)
+		}
+		if objectName == apiName {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Lets us know whether the kong object of the provided kind and name no longer has the ClusterGatewayApi resource
+// with the provided name it's generated from, either because the resource has gone or has moved to another controller class.
+func (c *Collector) orphanedCluster(ctx context.Context, kind string, name string, objectName string) (bool, error) {
+	clusterGatewayApi, err := c.clusterGatewayApis.Get(ctx, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if !controllerclass.Matches(clusterGatewayApi.Metadata.Annotations, c.class) {
+		return true, nil
+	}
+	if kind == ownership.KindUpstream {
+		return objectName != clustergatewayapi.UpstreamName(name), nil
+	}
+	return objectName != name, nil
+}
+
+// Deletes the orphaned kong object of the provided kind and name, going through the limiter
+// so the deletion can't race with a reconcile for a resource that has just reappeared.
+func (c *Collector) reap(kind string, resource string, namespace string, name string, objectName string, owner string) {
+	// Reconciles are keyed by the name the API object, or the API object an upstream is for, was derived from.
+	apiName := c.names.Local(namespace, objectName)
+	if kind == ownership.KindUpstream {
+		apiName = strings.TrimSuffix(objectName, multicluster.UpstreamName(namespace, ""))
+	}
+	limiterKey := namespace + "/" + apiName
+	if resource == clusterResource {
+		// ClusterGatewayApi reconciles are keyed by the name of the resource.
+		limiterKey = "clustergatewayapi/" + name
+	}
+	c.limiter.Dispatch(namespace, limiterKey, func() {
+		ctx, cancel := workqueue.Context(c.ctx, c.reconcileTimeout)
+		defer cancel()
+		// The resource may have reappeared while we were waiting on the limiter.
+		orphaned, err := c.orphaned(ctx, kind, resource, namespace, name, objectName)
+		if err != nil || !orphaned {
+			return
+		}
+		if current, owned := c.registry.Owner(kind, objectName); !owned || current != owner {
+			return
+		}
+		log.Printf("Deleting the %v kong %v owned by %v as it no longer has its resource", objectName, kind, owner)
+		if kind == ownership.KindUpstream {
+			err = c.kongClient.DeleteUpstream(ctx, objectName)
+		} else {
+			err = c.kongClient.DeleteAPI(ctx, objectName)
+		}
+		if err != nil && err != kong.ErrNotFound {
+			log.Printf("Error deleting the orphaned %v kong %v: %v", objectName, kind, err)
+			return
+		}
+		if err = c.registry.Release(kind, objectName); err != nil {
+			log.Printf("Error releasing the orphaned %v kong %v: %v", objectName, kind, err)
+		}
+		metrics.GCReapedTotal.WithLabelValues(kind).Inc()
+		c.mu.Lock()
+		delete(c.orphanedSince, orphanKey(kind, objectName))
+		c.mu.Unlock()
+	})
+}
+
+// Records when the kong object with the provided orphan key was first seen to be orphaned,
+// lets us know whether it has been orphaned for long enough to be reaped.
+func (c *Collector) orphanedLongEnough(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	since, exists := c.orphanedSince[key]
+	if !exists {
+		c.orphanedSince[key] = time.Now()
+		return false
+	}
+	return time.Since(since) >= c.minOrphanAge
+}
+
+// Stops tracking the kong objects of the provided kind that are no longer orphaned.
+func (c *Collector) forget(kind string, orphans map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := kind + "/"
+	for key := range c.orphanedSince {
+		if strings.HasPrefix(key, prefix) && !orphans[key] {
+			delete(c.orphanedSince, key)
+		}
+	}
+}
+
+// Provides the key orphaned kong objects are tracked by, names are only unique within a kind.
+func orphanKey(kind string, name string) string {
+	return kind + "/" + name
+}
+
+// The kinds of resource the kong objects collected are generated from, as recorded in their owners.
+const (
+	namespacedResource = "gatewayapi"
+	clusterResource    = "clustergatewayapi"
+)
+
+// Parses the kind of resource, namespace and name of the GatewayApi or ClusterGatewayApi resource
+// out of an owner recorded in the ownership registry, the namespace of a ClusterGatewayApi resource is empty.
+func parseOwner(owner string) (string, string, string, error) {
+	parts := strings.Split(owner, "/")
+	if len(parts) != 3 || (parts[0] != namespacedResource && parts[0] != clusterResource) {
+		return "", "", "", fmt.Errorf("Unrecognised owner %v", owner)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
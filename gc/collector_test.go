@@ -0,0 +1,133 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/clustergatewayapi"
+	"github.com/freshwebio/k8s-kong-api/gatewayapi"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	kongfake "github.com/freshwebio/k8s-kong-api/kong/fake"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	ownershipfake "github.com/freshwebio/k8s-kong-api/ownership/fake"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/unversioned"
+)
+
+// Provides GatewayApi resources from memory keyed by namespace/name.
+type memoryGatewayApis map[string]*gatewayapi.GatewayApi
+
+func (m memoryGatewayApis) Get(ctx context.Context, namespace string, name string) (*gatewayapi.GatewayApi, error) {
+	gatewayApi, exists := m[namespace+"/"+name]
+	if !exists {
+		return nil, errors.NewNotFound(unversioned.GroupResource{Resource: "gatewayapis"}, name)
+	}
+	return gatewayApi, nil
+}
+
+// Provides no ClusterGatewayApi resources.
+type noClusterGatewayApis struct{}
+
+func (noClusterGatewayApis) Get(ctx context.Context, name string) (*clustergatewayapi.ClusterGatewayApi, error) {
+	return nil, errors.NewNotFound(unversioned.GroupResource{Resource: "clustergatewayapis"}, name)
+}
+
+func newTestCollector(t *testing.T, kongClient kong.Interface, gatewayApis memoryGatewayApis) *Collector {
+	registry := ownership.NewRegistryFor(ownershipfake.NewConfigMaps(), "kong", "owners")
+	if err := registry.Claim(ownership.KindAPI, "orders", "gatewayapi/default/orders"); err != nil {
+		t.Fatalf("claiming the orders API: %v", err)
+	}
+	return &Collector{
+		kongClient:           kongClient,
+		gatewayApis:          gatewayApis,
+		clusterGatewayApis:   noClusterGatewayApis{},
+		registry:             registry,
+		limiter:              throttle.NewLimiter(1, 0, 0),
+		onboarding:           onboarding.NewWatcher(nil, "", ""),
+		serviceSelectorLabel: "service",
+		ctx:                  context.Background(),
+		reconcileTimeout:     time.Minute,
+		orphanedSince:        make(map[string]time.Time),
+	}
+}
+
+func ordersGatewayApi() *gatewayapi.GatewayApi {
+	return &gatewayapi.GatewayApi{
+		Metadata: api.ObjectMeta{Namespace: "default", Name: "orders"},
+		Spec:     gatewayapi.Spec{Selector: map[string]string{"service": "orders"}},
+	}
+}
+
+func TestClaimsOfMissingObjectsAreReleasedAfterTheGracePeriod(t *testing.T) {
+	c := newTestCollector(t, kongfake.New(), memoryGatewayApis{})
+	c.minOrphanAge = 50 * time.Millisecond
+	if err := c.collect(context.Background()); err != nil {
+		t.Fatalf("collecting: %v", err)
+	}
+	if _, owned := c.registry.Owner(ownership.KindAPI, "orders"); !owned {
+		t.Fatal("expected the claim to be kept until the resource has been gone for the grace period")
+	}
+	time.Sleep(c.minOrphanAge)
+	if err := c.collect(context.Background()); err != nil {
+		t.Fatalf("collecting: %v", err)
+	}
+	if _, owned := c.registry.Owner(ownership.KindAPI, "orders"); owned {
+		t.Error("expected the claim to be released once the resource has been gone for the grace period")
+	}
+}
+
+func TestClaimsOfMissingObjectsWithTheirResourceAreKept(t *testing.T) {
+	c := newTestCollector(t, kongfake.New(), memoryGatewayApis{"default/orders": ordersGatewayApi()})
+	for i := 0; i < 3; i++ {
+		if err := c.collect(context.Background()); err != nil {
+			t.Fatalf("collecting: %v", err)
+		}
+	}
+	if _, owned := c.registry.Owner(ownership.KindAPI, "orders"); !owned {
+		t.Error("expected the claim to be kept while the resource is still around so the object can be recreated")
+	}
+}
+
+func TestReportOnlyKeepsClaims(t *testing.T) {
+	c := newTestCollector(t, kongfake.New(), memoryGatewayApis{})
+	c.reportOnly = true
+	for i := 0; i < 3; i++ {
+		if err := c.collect(context.Background()); err != nil {
+			t.Fatalf("collecting: %v", err)
+		}
+	}
+	if _, owned := c.registry.Owner(ownership.KindAPI, "orders"); !owned {
+		t.Error("expected the claim to be kept in report only mode")
+	}
+}
+
+func TestOrphansAreReapedAfterTheGracePeriod(t *testing.T) {
+	kongClient := kongfake.New()
+	if _, err := kongClient.CreateAPI(context.Background(), &kong.API{Name: "orders"}); err != nil {
+		t.Fatalf("creating the orders API: %v", err)
+	}
+	c := newTestCollector(t, kongClient, memoryGatewayApis{})
+	c.minOrphanAge = 50 * time.Millisecond
+	if err := c.collect(context.Background()); err != nil {
+		t.Fatalf("collecting: %v", err)
+	}
+	c.limiter.Wait()
+	if _, err := kongClient.GetAPI(context.Background(), "orders"); err != nil {
+		t.Fatalf("expected the orders API to be left alone during the grace period but got %v", err)
+	}
+	time.Sleep(c.minOrphanAge)
+	if err := c.collect(context.Background()); err != nil {
+		t.Fatalf("collecting: %v", err)
+	}
+	c.limiter.Wait()
+	if _, err := kongClient.GetAPI(context.Background(), "orders"); err != kong.ErrNotFound {
+		t.Errorf("expected the orders API to be reaped but got %v", err)
+	}
+	if _, owned := c.registry.Owner(ownership.KindAPI, "orders"); owned {
+		t.Error("expected the claim on the reaped API to be released")
+	}
+}
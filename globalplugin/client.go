@@ -0,0 +1,110 @@
+package globalplugin
+
+import (
+	"context"
+	"log"
+
+	"github.com/freshwebio/k8s-kong-api/controllerclass"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Client provides typed access to GlobalPlugin resources in Kubernetes.
+// It's built on the dynamic client so the type doesn't need to be registered with a scheme.
+type Client struct {
+	dynamic *k8sclient.DynamicClient
+}
+
+// NewClient creates a new instance of a GlobalPlugin client.
+func NewClient(k8sClient *k8sclient.Client) *Client {
+	return &Client{dynamic: k8sClient.Resource(Resource)}
+}
+
+// Get retrieves the GlobalPlugin resource with the provided namespace and name.
+func (c *Client) Get(ctx context.Context, namespace string, name string) (*GlobalPlugin, error) {
+	obj, err := c.dynamic.Get(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(obj)
+}
+
+// List retrieves the GlobalPlugin resources in the provided namespace that match the provided label selector.
+func (c *Client) List(ctx context.Context, namespace string, selector labels.Selector) (*GlobalPluginList, error) {
+	list, err := c.dynamic.List(ctx, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	plugins := &GlobalPluginList{Metadata: list.Metadata, Items: []GlobalPlugin{}}
+	for i := range list.Items {
+		plugin, err := fromUnstructured(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		plugins.Items = append(plugins.Items, *plugin)
+	}
+	return plugins, nil
+}
+
+// Watch watches the GlobalPlugin resources in the provided namespace that match the provided
+// label selector from the provided resource version.
+func (c *Client) Watch(ctx context.Context, namespace string, selector labels.Selector, resourceVersion string) (watch.Interface, error) {
+	w, err := c.dynamic.Watch(ctx, namespace, selector, resourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(in watch.Event) (watch.Event, bool) {
+		obj, ok := in.Object.(*k8sclient.Unstructured)
+		if !ok {
+			return in, true
+		}
+		plugin, err := fromUnstructured(obj)
+		if err != nil {
+			log.Printf("Skipping the %v GlobalPlugin event that could not be decoded: %v", in.Type, err)
+			return in, false
+		}
+		in.Object = plugin
+		return in, true
+	}), nil
+}
+
+// ListWatch provides the list watch for the GlobalPlugin resources in the provided namespace
+// that match the provided label selector and belong to the provided controller class,
+// lists are abandoned and watches stopped once the provided context is done.
+func (c *Client) ListWatch(ctx context.Context, namespace string, selector labels.Selector, class string) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options api.ListOptions) (runtime.Object, error) {
+			list, err := c.List(ctx, namespace, selector)
+			if err != nil {
+				return nil, err
+			}
+			items := list.Items[:0]
+			for _, item := range list.Items {
+				if controllerclass.Matches(item.Metadata.Annotations, class) {
+					items = append(items, item)
+				}
+			}
+			list.Items = items
+			return list, nil
+		},
+		WatchFunc: func(options api.ListOptions) (watch.Interface, error) {
+			w, err := c.Watch(ctx, namespace, selector, options.ResourceVersion)
+			if err != nil {
+				return nil, err
+			}
+			return controllerclass.Filter(w, class), nil
+		},
+	}
+}
+
+func fromUnstructured(obj *k8sclient.Unstructured) (*GlobalPlugin, error) {
+	plugin := &GlobalPlugin{}
+	if err := obj.Into(plugin); err != nil {
+		return nil, err
+	}
+	return plugin, nil
+}
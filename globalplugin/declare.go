@@ -0,0 +1,56 @@
+package globalplugin
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+)
+
+// HasSynced lets us know whether the GlobalPlugin resource cache has been loaded.
+func (s *Service) HasSynced() bool {
+	if len(s.synced) == 0 {
+		return false
+	}
+	for _, synced := range s.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Declare adds the global plugins the cached GlobalPlugin resources reconciled by this instance call for
+// to the provided declarative configuration. Only the oldest resource for each plugin name is included
+// as kong only allows a single global plugin with each name.
+func (s *Service) Declare(cfg *kong.DeclarativeConfig) error {
+	if !s.HasSynced() {
+		return errors.New("The global plugin cache hasn't synced yet")
+	}
+	plugins, err := s.plugins.List()
+	if err != nil {
+		return err
+	}
+	sort.Sort(byCreation(plugins))
+	declared := make(map[string]bool)
+	for _, plugin := range plugins {
+		if !s.reconciles(plugin.Metadata.Namespace) || plugin.Spec.Name == "" || declared[plugin.Spec.Name] {
+			continue
+		}
+		declared[plugin.Spec.Name] = true
+		cfg.AddGlobalPlugin(&kong.Plugin{Name: plugin.Spec.Name, Config: plugin.Spec.Config})
+	}
+	return nil
+}
+
+type byCreation []*GlobalPlugin
+
+func (p byCreation) Len() int { return len(p) }
+func (p byCreation) Less(i, j int) bool {
+	created, otherCreated := p[i].Metadata.CreationTimestamp.Time, p[j].Metadata.CreationTimestamp.Time
+	if !created.Equal(otherCreated) {
+		return created.Before(otherCreated)
+	}
+	return p[i].Metadata.Namespace+"/"+p[i].Metadata.Name < p[j].Metadata.Namespace+"/"+p[j].Metadata.Name
+}
+func (p byCreation) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
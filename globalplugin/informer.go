@@ -0,0 +1,47 @@
+package globalplugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewInformer creates a shared informer caching the GlobalPlugin resources in the provided namespaces
+// that match the provided label selector and belong to the provided controller class,
+// the cache is indexed by namespace.
+// Lists are abandoned and watches stopped once the provided context is done.
+func NewInformer(ctx context.Context, client *Client, namespaces []string, selector labels.Selector,
+	class string) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		k8sclient.NamespacesListWatch(namespaces, func(namespace string) *cache.ListWatch {
+			return client.ListWatch(ctx, namespace, selector, class)
+		}), &GlobalPlugin{}, 0,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// Lister provides typed reads of the GlobalPlugin resources in an informer cache.
+type Lister struct {
+	indexer cache.Indexer
+}
+
+// NewLister creates a lister reading from the provided informer cache.
+func NewLister(indexer cache.Indexer) *Lister {
+	return &Lister{indexer: indexer}
+}
+
+// List provides every GlobalPlugin resource in the cache.
+func (l *Lister) List() ([]*GlobalPlugin, error) {
+	objs := l.indexer.List()
+	items := make([]*GlobalPlugin, 0, len(objs))
+	for _, obj := range objs {
+		plugin, ok := obj.(*GlobalPlugin)
+		if !ok {
+			return nil, fmt.Errorf("could not convert %v (%T) into GlobalPlugin", obj, obj)
+		}
+		items = append(items, plugin)
+	}
+	return items, nil
+}
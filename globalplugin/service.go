@@ -0,0 +1,377 @@
+package globalplugin
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/checksum"
+	"github.com/freshwebio/k8s-kong-api/config"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/shard"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Service deals with monitoring and responding
+// to events on global plugin resources in k8s
+// and updating the plugins applied globally in Kong accordingly.
+type Service struct {
+	k8sClient        *k8sclient.Client
+	client           *Client
+	namespaces       []string
+	class            string
+	kongClient       kong.Interface
+	limiter          *throttle.Limiter
+	shard            shard.Shard
+	verbose          bool
+	registry         *ownership.Registry
+	adoptUnowned     bool
+	resyncChan       chan struct{}
+	errors           *syncerror.Table
+	resyncPeriod     time.Duration
+	onboarding       *onboarding.Watcher
+	plugins          *Lister
+	declarative      bool
+	dbless           bool
+	ctx              context.Context
+	reconcileTimeout time.Duration
+	synced           []func() bool
+}
+
+// NewService creates a new instance of the GlobalPlugin service.
+// Pre-existing global plugins that aren't in the ownership registry are only managed when the
+// GlobalPlugin resource has the adopt annotation unless adoptUnowned is set.
+func NewService(k8sClient *k8sclient.Client, kong kong.Interface, cfg *config.Config) *Service {
+	return &Service{k8sClient: k8sClient, client: NewClient(k8sClient), kongClient: kong, namespaces: cfg.Namespaces, limiter: cfg.Limiter,
+		class: cfg.ControllerClass, shard: cfg.Shard, verbose: cfg.Verbose, registry: cfg.Registry, adoptUnowned: cfg.AdoptUnowned,
+		resyncChan: make(chan struct{}, 1), errors: cfg.Errors, resyncPeriod: cfg.ResyncPeriod, onboarding: cfg.Onboarding,
+		declarative: cfg.SyncStrategy == config.DeclarativeSync, dbless: cfg.SyncStrategy == config.DBLessSync,
+		ctx: cfg.Context, reconcileTimeout: cfg.ReconcileTimeout}
+}
+
+// Start deals with beginning the monitoring process which deals with monitoring
+// events from k8s global plugin resources to propogate changes to kong.
+// Events are reconciled through the shared limiter so each namespace is bound to its
+// own concurrency and kong write limits.
+// This method should be called asynchronously in it's own goroutine.
+func (s *Service) Start(doneChan <-chan struct{}, wg *sync.WaitGroup) {
+	log.Println("Starting the global plugin watcher service")
+	pluginEvents := s.monitorPluginEvents(s.namespaces, labels.NewSelector(), doneChan)
+	var resyncTicks <-chan time.Time
+	if s.resyncPeriod > 0 && !s.dbless {
+		ticker := time.NewTicker(s.resyncPeriod)
+		defer ticker.Stop()
+		resyncTicks = ticker.C
+	}
+	for {
+		select {
+		case event := <-pluginEvents:
+			if s.dbless || (s.declarative && event.Type != "DELETED") {
+				continue
+			}
+			namespace := event.Object.Metadata.Namespace
+			resource := syncerror.ResourceKey("globalplugins", namespace, event.Object.Metadata.Name)
+			s.dispatch(namespace, event.Object.Spec.Name, resource, "global plugin event", func(ctx context.Context) error {
+				return s.processPluginEvent(ctx, event)
+			})
+		case <-s.resyncChan:
+			if s.dbless {
+				continue
+			}
+			s.resyncAll(0, true, doneChan)
+		case <-resyncTicks:
+			if s.declarative {
+				// The complete desired state is pushed to kong in one go.
+				s.resyncAll(0, true, doneChan)
+				continue
+			}
+			// Periodic resyncs are spread over the resync period so every object isn't reconciled on the same tick.
+			s.resyncAll(s.resyncPeriod, false, doneChan)
+		case <-doneChan:
+			wg.Done()
+			log.Println("Stopped global plugin event watcher.")
+			return
+		}
+	}
+}
+
+// Resync triggers a full reconciliation of every GlobalPlugin resource so the global plugins
+// in kong converge on the state in k8s straight away, e.g. after manual changes to kong.
+// Resyncs requested while one is already pending are folded into the pending one.
+func (s *Service) Resync() {
+	select {
+	case s.resyncChan <- struct{}{}:
+	default:
+	}
+}
+
+// Dispatches a reconcile for every GlobalPlugin resource currently in the informer cache,
+// spreading them randomly over the provided window.
+// A forced resync ignores the hash of the last applied payload so kong is written to
+// even for unchanged resources, this is what undoes manual changes made to kong.
+func (s *Service) resyncAll(spread time.Duration, force bool, done <-chan struct{}) {
+	log.Println("Resyncing all global plugin resources")
+	plugins, err := s.plugins.List()
+	if err != nil {
+		log.Printf("Error listing the cached global plugin resources for the resync: %v", err)
+	}
+	for _, plugin := range plugins {
+		p := *plugin
+		if force {
+			p.Metadata.Annotations = checksum.Without(p.Metadata.Annotations)
+		}
+		resource := syncerror.ResourceKey("globalplugins", p.Metadata.Namespace, p.Metadata.Name)
+		throttle.Spread(spread, done, func() {
+			s.dispatch(p.Metadata.Namespace, p.Spec.Name, resource, "resync of global plugin "+p.Metadata.Name, func(ctx context.Context) error {
+				return s.syncPlugin(ctx, p)
+			})
+		})
+	}
+}
+
+// Dispatches the provided reconcile through the limiter for the provided namespace and plugin name,
+// reconciles for namespaces outside of our shard are dropped as another instance deals with them
+// and reconciles for namespaces that haven't been onboarded are dropped altogether.
+// The outcome of the reconcile is logged and recorded against the provided resource
+// in the sync error rates and the error table.
+// The reconcile is carried out under its own reconcile context.
+func (s *Service) dispatch(namespace string, pluginName string, resource string, description string, fn func(ctx context.Context) error) {
+	if !s.reconciles(namespace) {
+		return
+	}
+	if s.verbose {
+		log.Printf("Dispatching a reconcile for the global %v plugin in the %v namespace", pluginName, namespace)
+	}
+	s.limiter.Dispatch(namespace, "globalplugin/"+pluginName, func() {
+		ctx, cancel := workqueue.Context(s.ctx, s.reconcileTimeout)
+		defer cancel()
+		err := fn(ctx)
+		if err != nil {
+			log.Printf("Error while processing %v: %v", description, err)
+		}
+		metrics.RecordSync("globalplugin", syncerror.Classify(err))
+		s.errors.Record("globalplugin", resource, err)
+	})
+}
+
+// Lets us know whether resources in the provided namespace are reconciled by this instance of the controller.
+func (s *Service) reconciles(namespace string) bool {
+	return s.shard.Owns(namespace) && s.onboarding.Enabled(namespace)
+}
+
+func (s *Service) processPluginEvent(ctx context.Context, e Event) error {
+	switch e.Type {
+	case "ADDED":
+		return s.attachPlugin(ctx, e.Object)
+	case "MODIFIED":
+		return s.updatePlugin(ctx, e.Object)
+	case "DELETED":
+		return s.removePlugin(ctx, e.Object, "")
+	}
+	return nil
+}
+
+// Brings the global plugin in kong fully in line with the provided GlobalPlugin resource.
+// Attaching only adds a missing plugin so it's followed up with an update
+// to bring the config of an existing plugin back in line with the resource.
+func (s *Service) syncPlugin(ctx context.Context, p GlobalPlugin) error {
+	if err := s.attachPlugin(ctx, p); err != nil {
+		return err
+	}
+	return s.updatePlugin(ctx, p)
+}
+
+// Applies the plugin of the provided GlobalPlugin resource globally when kong
+// doesn't have a global plugin with the same name yet.
+func (s *Service) attachPlugin(ctx context.Context, p GlobalPlugin) error {
+	if p.Spec.Name == "" {
+		return syncerror.Validationf("The global plugin resource %v must set the name of a plugin", p.Metadata.Name)
+	}
+	existing, err := s.findGlobalPlugin(ctx, p.Spec.Name)
+	if err != nil || existing != nil {
+		return err
+	}
+	kongPlugin := &kong.Plugin{Name: p.Spec.Name, Config: p.Spec.Config}
+	hash, err := checksum.Of(kongPlugin)
+	if err != nil {
+		return err
+	}
+	log.Printf("Applying the %v plugin globally for %v", p.Spec.Name, ownerOf(&p))
+	if err := s.limiter.WaitWrite(ctx, p.Metadata.Namespace); err != nil {
+		return err
+	}
+	if _, err = s.kongClient.AddGlobalPlugin(ctx, kongPlugin); err != nil {
+		return err
+	}
+	if err = s.registry.Claim(ownership.KindGlobalPlugin, p.Spec.Name, ownerOf(&p)); err != nil {
+		return err
+	}
+	s.recordAppliedPlugin(ctx, &p, hash)
+	return nil
+}
+
+// Brings the config of the global plugin in kong in line with the provided GlobalPlugin resource
+// when the resource manages it, any global plugin the resource owned under a previous name is removed.
+func (s *Service) updatePlugin(ctx context.Context, p GlobalPlugin) error {
+	if p.Spec.Name == "" {
+		return syncerror.Validationf("The global plugin resource %v must set the name of a plugin", p.Metadata.Name)
+	}
+	if err := s.removePlugin(ctx, p, p.Spec.Name); err != nil {
+		return err
+	}
+	kongPlugin := &kong.Plugin{Name: p.Spec.Name, Config: p.Spec.Config}
+	hash, err := checksum.Of(kongPlugin)
+	if err != nil {
+		return err
+	}
+	if checksum.Matches(p.Metadata.Annotations, hash) {
+		// The plugin was last written with exactly this payload so there's nothing to do.
+		return nil
+	}
+	existing, err := s.findGlobalPlugin(ctx, p.Spec.Name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return s.attachPlugin(ctx, p)
+	}
+	if err = s.claimPlugin(&p); err != nil {
+		return err
+	}
+	kongPlugin.ID = existing.ID
+	log.Printf("Updating the global %v plugin for %v", p.Spec.Name, ownerOf(&p))
+	if err := s.limiter.WaitWrite(ctx, p.Metadata.Namespace); err != nil {
+		return err
+	}
+	if _, err = s.kongClient.UpdateGlobalPlugin(ctx, kongPlugin); err != nil {
+		return err
+	}
+	s.recordAppliedPlugin(ctx, &p, hash)
+	return nil
+}
+
+// Makes sure the provided GlobalPlugin resource owns the global plugin with its name, pre-existing
+// plugins are only taken over when they can be adopted by the resource.
+func (s *Service) claimPlugin(p *GlobalPlugin) error {
+	current, owned := s.registry.Owner(ownership.KindGlobalPlugin, p.Spec.Name)
+	if owned && current == ownerOf(p) {
+		return nil
+	}
+	if p.Metadata.Annotations[AdoptAnnotation] != "true" && (owned || !s.adoptUnowned) {
+		if owned {
+			return syncerror.Validationf("The global %v plugin is already managed by %v, "+
+				"set the %v annotation to \"true\" to take it over", p.Spec.Name, current, AdoptAnnotation)
+		}
+		return syncerror.Validationf("The global %v plugin already exists and isn't managed by this resource, "+
+			"set the %v annotation to \"true\" to adopt it", p.Spec.Name, AdoptAnnotation)
+	}
+	if err := s.registry.Claim(ownership.KindGlobalPlugin, p.Spec.Name, ownerOf(p)); err != nil {
+		return err
+	}
+	log.Printf("The global %v plugin has been adopted by %v", p.Spec.Name, ownerOf(p))
+	return nil
+}
+
+// Removes the global plugins owned by the provided GlobalPlugin resource apart from the one
+// with the provided name, global plugins the resource doesn't own are left alone.
+func (s *Service) removePlugin(ctx context.Context, p GlobalPlugin, keep string) error {
+	owner := ownerOf(&p)
+	for name, current := range s.registry.Owned(ownership.KindGlobalPlugin) {
+		if current != owner || name == keep {
+			continue
+		}
+		existing, err := s.findGlobalPlugin(ctx, name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			log.Printf("Removing the global %v plugin as it's no longer applied by %v", name, owner)
+			if err := s.limiter.WaitWrite(ctx, p.Metadata.Namespace); err != nil {
+				return err
+			}
+			if err = s.kongClient.RemoveGlobalPlugin(ctx, existing.ID); err != nil && err != kong.ErrNotFound {
+				return err
+			}
+		}
+		if err = s.registry.Release(ownership.KindGlobalPlugin, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Retrieves the global plugin in kong with the provided name, nil when there isn't one.
+func (s *Service) findGlobalPlugin(ctx context.Context, name string) (*kong.Plugin, error) {
+	plugins, err := s.kongClient.ListGlobalPlugins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, plugin := range plugins {
+		if plugin.Name == name {
+			return plugin, nil
+		}
+	}
+	return nil, nil
+}
+
+// Records the provided hash of the plugin payload that has just been applied
+// as an annotation on the provided GlobalPlugin resource.
+func (s *Service) recordAppliedPlugin(ctx context.Context, p *GlobalPlugin, hash string) {
+	if checksum.Matches(p.Metadata.Annotations, hash) {
+		return
+	}
+	checksum.Record(ctx, s.k8sClient.Resource(Resource), p.Metadata.Namespace, p.Metadata.Name, hash)
+}
+
+// Provides the owner recorded in the ownership registry for a GlobalPlugin resource.
+func ownerOf(p *GlobalPlugin) string {
+	return fmt.Sprintf("globalplugin/%v/%v", p.Metadata.Namespace, p.Metadata.Name)
+}
+
+// Handles watching events occuring for our custom global plugin resource.
+// All GlobalPlugin resources in the given namespaces and selector combination are watched in this case.
+func (s *Service) monitorPluginEvents(namespaces []string, selector labels.Selector, done <-chan struct{}) <-chan Event {
+	events := make(chan Event)
+	eventCallback := func(evType watch.EventType, obj interface{}) {
+		plugin, ok := obj.(*GlobalPlugin)
+		if !ok {
+			log.Printf("could not convert %v (%T) into GlobalPlugin", obj, obj)
+			return
+		}
+		metrics.ObserveDelivery("globalplugin", "globalplugins", func() {
+			events <- Event{
+				Type:   string(evType),
+				Object: *plugin,
+			}
+		})
+	}
+	informer := NewInformer(k8sclient.DoneContext(done), s.client, namespaces, selector, s.class)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			eventCallback(watch.Added, obj)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			eventCallback(watch.Modified, new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			eventCallback(watch.Deleted, obj)
+		},
+	})
+	s.plugins = NewLister(informer.GetIndexer())
+	s.synced = append(s.synced, informer.HasSynced)
+
+	go informer.Run(done)
+
+	return events
+}
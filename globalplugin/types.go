@@ -0,0 +1,70 @@
+package globalplugin
+
+import (
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/api/meta"
+	"k8s.io/client-go/pkg/api/unversioned"
+)
+
+// Resource identifies GlobalPlugin resources for the dynamic client.
+var Resource = k8sclient.GroupVersionResource{Group: "k8s.freshweb.io", Version: "v1", Resource: "globalplugins"}
+
+// AdoptAnnotation provides the annotation that allows a GlobalPlugin resource to take over
+// a pre-existing global plugin that isn't owned by the controller, the same one GatewayApi resources use.
+const AdoptAnnotation = "k8s.freshweb.io/adopt"
+
+// GlobalPlugin provides the type for a plugin resource in Kubernetes
+// that's applied to every request through kong rather than to a single API.
+type GlobalPlugin struct {
+	unversioned.TypeMeta `json:",inline"`
+	Metadata             api.ObjectMeta `json:"metadata"`
+	Spec                 Spec           `json:"spec"`
+}
+
+// Event provides the event recieved for global plugin resource watchers.
+type Event struct {
+	Type   string       `json:"type"`
+	Object GlobalPlugin `json:"object"`
+}
+
+// GetObjectKind provides the method to expose the kind
+// of our GlobalPlugin object.
+func (p *GlobalPlugin) GetObjectKind() unversioned.ObjectKind {
+	return &p.TypeMeta
+}
+
+// GetObjectMeta Retrieves the metadata for the GlobalPlugin.
+func (p *GlobalPlugin) GetObjectMeta() meta.Object {
+	return &p.Metadata
+}
+
+// GlobalPluginList provides the type encapsulating a list of GlobalPlugin resources.
+type GlobalPluginList struct {
+	unversioned.TypeMeta `json:",inline"`
+	Metadata             unversioned.ListMeta `json:"metadata"`
+	Items                []GlobalPlugin       `json:"items"`
+}
+
+// GetObjectKind provides the method to expose the kind
+// of our GlobalPlugin List object.
+func (l *GlobalPluginList) GetObjectKind() unversioned.ObjectKind {
+	return &l.TypeMeta
+}
+
+// GetListMeta Retrieves the metadata for the GlobalPlugin List.
+func (l *GlobalPluginList) GetListMeta() unversioned.List {
+	return &l.Metadata
+}
+
+// Spec provides the type for the specification
+// of the global plugin resource specification.
+type Spec struct {
+	// The name of the plugin to be applied globally,
+	// kong only allows a single global plugin with each name.
+	Name string `json:"name"`
+	// Configuration for the plugin as expected by Kong.
+	// Keys in this map should avoid the config. prefix
+	// as will be automatically prepended when requests are made to Kong.
+	Config map[string]interface{} `json:"config"`
+}
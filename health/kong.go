@@ -0,0 +1,82 @@
+package health
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+)
+
+// KongProbe deals with regularly polling the status of the kong admin api
+// so the controller only reports itself as ready while it can actually apply changes to kong.
+// The probe only becomes unready once the number of consecutive failed polls reaches the
+// failure threshold so a single blip doesn't take the instance out of service.
+type KongProbe struct {
+	kongClient       kong.Interface
+	interval         time.Duration
+	failureThreshold int
+	mu               sync.RWMutex
+	failures         int
+	polled           bool
+	lastErr          error
+}
+
+// NewKongProbe creates a new instance of the kong probe polling at the provided interval,
+// a failure threshold of less than 1 is treated as 1.
+func NewKongProbe(kongClient kong.Interface, interval time.Duration, failureThreshold int) *KongProbe {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &KongProbe{kongClient: kongClient, interval: interval, failureThreshold: failureThreshold}
+}
+
+// Run polls the kong admin api until the provided done channel is closed.
+// This method should be called asynchronously in it's own goroutine.
+func (p *KongProbe) Run(done <-chan struct{}) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.poll()
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ready lets us know whether kong is reachable, along with the last error
+// seen when it's not. The probe isn't ready until kong has been polled successfully.
+func (p *KongProbe) Ready() (bool, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if !p.polled {
+		return false, p.lastErr
+	}
+	return p.failures < p.failureThreshold, p.lastErr
+}
+
+// Polls the status of the kong admin api, a poll that takes longer than the interval counts as a failure.
+func (p *KongProbe) poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+	defer cancel()
+	err := p.kongClient.Status(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		if p.failures >= p.failureThreshold {
+			log.Println("The kong admin api is reachable again")
+		}
+		p.failures = 0
+		p.polled = true
+		p.lastErr = nil
+		return
+	}
+	p.failures++
+	p.lastErr = err
+	if p.failures == p.failureThreshold {
+		log.Printf("The kong admin api has been unreachable for %v consecutive polls: %v", p.failures, err)
+	}
+}
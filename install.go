@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/freshwebio/k8s-kong-api/install"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/namsral/flag"
+)
+
+// The flags that only make sense for the instance of the controller running the install,
+// these aren't passed on to the installed controller.
+var installOnlyFlags = map[string]bool{
+	"config":           true,
+	"kubeconfig":       true,
+	"kubecontext":      true,
+	"image":            true,
+	"replicas":         true,
+	"installnamespace": true,
+	"backupdir":        true,
+}
+
+// Provides the environment variables configuring the installed controller
+// with every flag that has been set explicitly, named the way the flag package reads them.
+func installEnv() map[string]string {
+	env := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if installOnlyFlags[f.Name] {
+			return
+		}
+		env[strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))] = f.Value.String()
+	})
+	return env
+}
+
+// Applies the CustomResourceDefinitions, RBAC rules and Deployment for the controller
+// to the cluster, with the Deployment configured from the provided environment variables.
+// Types still registered as ThirdPartyResources by an earlier install are migrated first.
+func runInstall(cli *k8sclient.Client, env map[string]string) error {
+	if err := install.Migrate(cli, *backupDir); err != nil {
+		return err
+	}
+	opts := install.Options{
+		Namespace:  *installNamespace,
+		Image:      *image,
+		Replicas:   *replicas,
+		Env:        env,
+		StatusPort: install.StatusPort(*statusAddr),
+		Webhook:    conversionWebhook(),
+	}
+	return install.Apply(cli, install.Manifests(opts))
+}
+
+// Provides the service of the webhook server converting objects between the versions their types
+// are served under, zero when the webhook server isn't enabled so the types are only served under v1.
+func conversionWebhook() install.Webhook {
+	if *webhookAddr == "" {
+		return install.Webhook{}
+	}
+	return install.Webhook{Namespace: *webhookNamespace, Service: *webhookService}
+}
@@ -0,0 +1,56 @@
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api/errors"
+)
+
+// Apply deals with creating each of the provided manifests in the cluster,
+// objects that already exist are replaced so running the install again upgrades the controller.
+func Apply(k8sClient *k8sclient.Client, manifests []Manifest) error {
+	restClient := k8sClient.JSONClientset.CoreV1().RESTClient()
+	for _, manifest := range manifests {
+		kind, _ := manifest.Object["kind"].(string)
+		raw, err := restClient.Get().AbsPath(manifest.Path + "/" + manifest.Name).DoRaw()
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("Failed to retrieve the %v %v: %v", manifest.Name, kind, err)
+		}
+		exists := err == nil
+		if exists {
+			// Carry over the resourceVersion so the update fails rather than overwriting concurrent changes.
+			var current struct {
+				Metadata struct {
+					ResourceVersion string `json:"resourceVersion"`
+				} `json:"metadata"`
+			}
+			if err = json.Unmarshal(raw, &current); err != nil {
+				return err
+			}
+			if metadata, ok := manifest.Object["metadata"].(map[string]interface{}); ok {
+				metadata["resourceVersion"] = current.Metadata.ResourceVersion
+			}
+		}
+		body, err := json.Marshal(manifest.Object)
+		if err != nil {
+			return err
+		}
+		if exists {
+			_, err = restClient.Put().AbsPath(manifest.Path + "/" + manifest.Name).Body(body).DoRaw()
+		} else {
+			_, err = restClient.Post().AbsPath(manifest.Path).Body(body).DoRaw()
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to apply the %v %v: %v", manifest.Name, kind, err)
+		}
+		if exists {
+			log.Printf("Updated the %v %v", manifest.Name, kind)
+		} else {
+			log.Printf("Created the %v %v", manifest.Name, kind)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package install
+
+// The label of the service selector the columns show, the default of the sslabel option.
+const serviceSelectorLabel = "service"
+
+func column(name string, columnType string, path string, description string) map[string]interface{} {
+	return map[string]interface{}{"name": name, "type": columnType, "JSONPath": path, "description": description}
+}
+
+func ageColumn() map[string]interface{} {
+	return column("Age", "date", ".metadata.creationTimestamp", "When the object was created")
+}
+
+// The columns apply to every version GatewayApi resources are served under,
+// so they only use paths the v1 and v2 specs have in common.
+func gatewayApiColumns() []map[string]interface{} {
+	return []map[string]interface{}{
+		column("Service", "string", ".spec.selector."+serviceSelectorLabel, "The service the kong API object represents"),
+		column("Synced", "string", `.status.conditions[?(@.type=="Synced")].status`,
+			"Whether the last sync of the resource to kong succeeded"),
+		ageColumn(),
+	}
+}
+
+func apiPluginColumns() []map[string]interface{} {
+	return []map[string]interface{}{
+		column("Plugin", "string", ".spec.name", "The kong plugin attached"),
+		column("Service", "string", ".spec.selector."+serviceSelectorLabel, "The kong API object the plugin is attached to"),
+		ageColumn(),
+	}
+}
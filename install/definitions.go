@@ -0,0 +1,42 @@
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api/errors"
+)
+
+// EnsureDefinitions deals with creating the CustomResourceDefinitions of the controller that don't exist yet
+// so the controller works without the definitions being applied beforehand, it then waits for their objects to be served.
+// Definitions that already exist are left as they are so changes made to them by operators aren't undone.
+// Types with more versions are served under them when the provided webhook is set, see Definition.Manifest.
+func EnsureDefinitions(k8sClient *k8sclient.Client, webhook Webhook) error {
+	restClient := k8sClient.JSONClientset.CoreV1().RESTClient()
+	for _, definition := range Definitions {
+		manifest := definition.Manifest(webhook)
+		_, err := restClient.Get().AbsPath(manifest.Path + "/" + manifest.Name).DoRaw()
+		if err == nil {
+			continue
+		}
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("Failed to retrieve the %v CustomResourceDefinition: %v", manifest.Name, err)
+		}
+		body, err := json.Marshal(manifest.Object)
+		if err != nil {
+			return err
+		}
+		// Another replica may have created it in the meantime.
+		_, err = restClient.Post().AbsPath(manifest.Path).Body(body).DoRaw()
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("Failed to create the %v CustomResourceDefinition: %v", manifest.Name, err)
+		}
+		log.Printf("Created the %v CustomResourceDefinition", manifest.Name)
+		if err = awaitServed(restClient, definition.Plural); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package install
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Name provides the name given to the service account, RBAC rules and Deployment of the controller.
+const Name = "k8s-kong-api"
+
+// Options provides the settings the installation manifests are rendered from.
+type Options struct {
+	// The namespace the controller is installed in.
+	Namespace string
+	// The container image the controller is run from.
+	Image string
+	// The number of replicas of the controller to run.
+	Replicas int
+	// The environment variables the controller is configured with, keyed by name.
+	Env map[string]string
+	// The port the status server listens on, 0 when it isn't enabled.
+	StatusPort int
+	// The service of the webhook server, zero when the webhook server isn't enabled.
+	Webhook Webhook
+}
+
+// Webhook provides the service the apiserver reaches the webhook server of the controller through,
+// types served under versions besides v1 have their objects converted by it.
+type Webhook struct {
+	Namespace string
+	Service   string
+}
+
+// The path the apiserver posts conversion reviews to, served by the webhook server.
+const convertPath = "/convert"
+
+// Manifest provides a single object to be applied to the cluster
+// along with the API path of the collection it belongs to.
+type Manifest struct {
+	Path   string
+	Name   string
+	Object map[string]interface{}
+}
+
+// Group provides the API group the custom resources of the controller are served under.
+const Group = "k8s.freshweb.io"
+
+// Definition provides a custom resource type served by the apiserver for the controller.
+type Definition struct {
+	// The plural name of the resource the objects are served under, e.g. gatewayapis.
+	Plural string
+	// The kind of the objects.
+	Kind string
+	// Whether the objects are cluster-scoped rather than living in a namespace.
+	ClusterScoped bool
+	// The name of the ThirdPartyResource the type was registered with before CustomResourceDefinitions.
+	ThirdPartyResource string
+	// The OpenAPI schema objects of the type are validated against when they're applied.
+	Schema map[string]interface{}
+	// The versions the type is served under besides v1, which objects are stored as.
+	Versions []Version
+	// The extra columns kubectl get lists objects of the type with.
+	Columns []map[string]interface{}
+}
+
+// Version provides a version a type is served under besides v1 along with the OpenAPI schema of its objects.
+type Version struct {
+	Name   string
+	Schema map[string]interface{}
+}
+
+// Definitions lists every custom resource type the controller deals with.
+var Definitions = []Definition{
+	{Plural: "gatewayapis", Kind: "GatewayApi", ThirdPartyResource: "gateway-api.k8s.freshweb.io", Schema: gatewayApiSchema(),
+		Versions: []Version{{Name: "v2", Schema: gatewayApiV2Schema()}}, Columns: gatewayApiColumns()},
+	{Plural: "apiplugins", Kind: "ApiPlugin", ThirdPartyResource: "api-plugin.k8s.freshweb.io", Schema: apiPluginSchema(),
+		Columns: apiPluginColumns()},
+	{Plural: "kongconsumers", Kind: "KongConsumer", ThirdPartyResource: "kong-consumer.k8s.freshweb.io",
+		Schema: kongConsumerSchema()},
+	{Plural: "globalplugins", Kind: "GlobalPlugin", ThirdPartyResource: "global-plugin.k8s.freshweb.io",
+		Schema: globalPluginSchema()},
+	{Plural: "clustergatewayapis", Kind: "ClusterGatewayApi", ClusterScoped: true,
+		ThirdPartyResource: "cluster-gateway-api.k8s.freshweb.io", Schema: clusterGatewayApiSchema()},
+}
+
+// Name provides the name of the CustomResourceDefinition for the type.
+func (d Definition) Name() string {
+	return d.Plural + "." + Group
+}
+
+// Manifest renders the CustomResourceDefinition registering the type, with the same group,
+// version and kind the type had as a ThirdPartyResource so existing objects keep their paths.
+// The schema of the type is published with the definition so malformed objects are rejected when they're applied.
+// With the provided webhook set types served under more versions list them all with v1 as the version objects are stored as,
+// the apiserver has the webhook convert objects between them. Without it the types are only served under v1.
+// Printer columns replace the default columns of kubectl get, so the age of the object is always listed last.
+func (d Definition) Manifest(webhook Webhook) Manifest {
+	scope := "Namespaced"
+	if d.ClusterScoped {
+		scope = "Cluster"
+	}
+	spec := map[string]interface{}{
+		"group":   Group,
+		"version": "v1",
+		"scope":   scope,
+		"names": map[string]interface{}{
+			"plural":   d.Plural,
+			"singular": strings.ToLower(d.Kind),
+			"kind":     d.Kind,
+			"listKind": d.Kind + "List",
+		},
+	}
+	if len(d.Columns) > 0 {
+		spec["additionalPrinterColumns"] = d.Columns
+	}
+	if len(d.Versions) == 0 || webhook.Service == "" {
+		if d.Schema != nil {
+			spec["validation"] = map[string]interface{}{"openAPIV3Schema": d.Schema}
+		}
+	} else {
+		// Every version has its own schema, which rules out the schema of the definition as a whole.
+		versions := []interface{}{map[string]interface{}{"name": "v1", "served": true, "storage": true,
+			"schema": map[string]interface{}{"openAPIV3Schema": d.Schema}}}
+		for _, version := range d.Versions {
+			versions = append(versions, map[string]interface{}{"name": version.Name, "served": true, "storage": false,
+				"schema": map[string]interface{}{"openAPIV3Schema": version.Schema}})
+		}
+		spec["versions"] = versions
+		// The webhook server patches in the CA bundle of its certificates once it has them.
+		spec["preserveUnknownFields"] = false
+		spec["conversion"] = map[string]interface{}{
+			"strategy": "Webhook",
+			"webhookClientConfig": map[string]interface{}{
+				"service": map[string]interface{}{"namespace": webhook.Namespace, "name": webhook.Service, "path": convertPath},
+			},
+		}
+	}
+	return Manifest{
+		Path: "/apis/apiextensions.k8s.io/v1beta1/customresourcedefinitions",
+		Name: d.Name(),
+		Object: map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1beta1",
+			"kind":       "CustomResourceDefinition",
+			"metadata":   map[string]interface{}{"name": d.Name()},
+			"spec":       spec,
+		},
+	}
+}
+
+// Manifests renders every object needed to run the controller from the provided options,
+// in the order they should be applied.
+func Manifests(opts Options) []Manifest {
+	manifests := []Manifest{}
+	for _, definition := range Definitions {
+		manifests = append(manifests, definition.Manifest(opts.Webhook))
+	}
+	return append(manifests,
+		serviceAccount(opts),
+		clusterRole(),
+		clusterRoleBinding(opts),
+		deployment(opts),
+	)
+}
+
+func serviceAccount(opts Options) Manifest {
+	return Manifest{
+		Path: "/api/v1/namespaces/" + opts.Namespace + "/serviceaccounts",
+		Name: Name,
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ServiceAccount",
+			"metadata":   map[string]interface{}{"name": Name, "namespace": opts.Namespace},
+		},
+	}
+}
+
+// Provides the rules covering everything the controller reads and writes,
+// namespaces are needed for onboarding, ConfigMaps for ownership and leader election,
+// Secrets along with the webhook configurations for the webhook certificates and consumer credentials
+// and CustomResourceDefinitions for creating the definitions that are missing on startup and patching
+// the CA bundle of the webhook certificates into the definitions converted by the webhook server.
+func clusterRole() Manifest {
+	rule := func(group string, resources []string, verbs ...string) map[string]interface{} {
+		return map[string]interface{}{"apiGroups": []string{group}, "resources": resources, "verbs": verbs}
+	}
+	return Manifest{
+		Path: "/apis/rbac.authorization.k8s.io/v1beta1/clusterroles",
+		Name: Name,
+		Object: map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1beta1",
+			"kind":       "ClusterRole",
+			"metadata":   map[string]interface{}{"name": Name},
+			"rules": []interface{}{
+				rule("", []string{"services", "endpoints", "namespaces"}, "get", "list", "watch"),
+				rule("", []string{"configmaps"}, "get", "list", "watch", "create", "update"),
+				rule("", []string{"secrets"}, "get", "list", "watch", "create", "update"),
+				rule("", []string{"events"}, "create", "update"),
+				rule("discovery.k8s.io", []string{"endpointslices"}, "list", "watch"),
+				rule("apiextensions.k8s.io", []string{"customresourcedefinitions"}, "get", "create", "update"),
+				rule("k8s.freshweb.io", []string{"gatewayapis", "apiplugins", "kongconsumers", "globalplugins",
+					"clustergatewayapis"}, "get", "list", "watch", "update", "patch"),
+				rule("admissionregistration.k8s.io",
+					[]string{"validatingwebhookconfigurations", "mutatingwebhookconfigurations"}, "get", "update"),
+			},
+		},
+	}
+}
+
+func clusterRoleBinding(opts Options) Manifest {
+	return Manifest{
+		Path: "/apis/rbac.authorization.k8s.io/v1beta1/clusterrolebindings",
+		Name: Name,
+		Object: map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1beta1",
+			"kind":       "ClusterRoleBinding",
+			"metadata":   map[string]interface{}{"name": Name},
+			"roleRef": map[string]interface{}{
+				"apiGroup": "rbac.authorization.k8s.io",
+				"kind":     "ClusterRole",
+				"name":     Name,
+			},
+			"subjects": []interface{}{
+				map[string]interface{}{"kind": "ServiceAccount", "name": Name, "namespace": opts.Namespace},
+			},
+		},
+	}
+}
+
+// Renders the Deployment running the controller, the controller is configured
+// entirely through environment variables which are sorted so the manifest is stable.
+func deployment(opts Options) Manifest {
+	labels := map[string]string{"app": Name}
+	names := make([]string, 0, len(opts.Env))
+	for name := range opts.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	env := []interface{}{}
+	for _, name := range names {
+		env = append(env, map[string]interface{}{"name": name, "value": opts.Env[name]})
+	}
+	container := map[string]interface{}{
+		"name":  Name,
+		"image": opts.Image,
+		"env":   env,
+	}
+	if opts.StatusPort > 0 {
+		container["ports"] = []interface{}{map[string]interface{}{"name": "status", "containerPort": opts.StatusPort}}
+		container["livenessProbe"] = httpProbe("/healthz")
+		container["readinessProbe"] = httpProbe("/readyz")
+	}
+	return Manifest{
+		Path: "/apis/extensions/v1beta1/namespaces/" + opts.Namespace + "/deployments",
+		Name: Name,
+		Object: map[string]interface{}{
+			"apiVersion": "extensions/v1beta1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": Name, "namespace": opts.Namespace, "labels": labels},
+			"spec": map[string]interface{}{
+				"replicas": opts.Replicas,
+				"selector": map[string]interface{}{"matchLabels": labels},
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{"labels": labels},
+					"spec": map[string]interface{}{
+						"serviceAccountName": Name,
+						"containers":         []interface{}{container},
+					},
+				},
+			},
+		},
+	}
+}
+
+func httpProbe(path string) map[string]interface{} {
+	return map[string]interface{}{
+		"httpGet": map[string]interface{}{"path": path, "port": "status"},
+	}
+}
+
+// StatusPort provides the port of the provided status server address,
+// 0 when the address is empty or doesn't contain a valid port.
+func StatusPort(addr string) int {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return 0
+	}
+	port, err := strconv.Atoi(addr[i+1:])
+	if err != nil {
+		return 0
+	}
+	return port
+}
@@ -0,0 +1,142 @@
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/rest"
+)
+
+// How long the CustomResourceDefinition of a migrated type has to start serving its objects.
+const migrationTimeout = time.Minute
+
+// Migrate deals with moving every custom resource type of the controller that's still registered as
+// a ThirdPartyResource over to a CustomResourceDefinition with the same group, version and kind.
+// The CustomResourceDefinition is created before the ThirdPartyResource is deleted, at which point the apiserver
+// copies the existing objects over itself. The objects are backed up beforehand, both to a <plural>-tpr-backup.json file
+// in the provided backup directory and in memory, and any the apiserver didn't copy over are created from the backup.
+// Nothing is touched for a type whose backup can't be written.
+// Types that aren't registered as ThirdPartyResources are left alone so the migration can be run any number of times.
+func Migrate(k8sClient *k8sclient.Client, backupDir string) error {
+	for _, definition := range Definitions {
+		if err := migrate(k8sClient, definition, backupDir); err != nil {
+			return fmt.Errorf("Failed to migrate the %v ThirdPartyResource: %v", definition.ThirdPartyResource, err)
+		}
+	}
+	return nil
+}
+
+func migrate(k8sClient *k8sclient.Client, d Definition, backupDir string) error {
+	restClient := k8sClient.JSONClientset.CoreV1().RESTClient()
+	tprPath := "/apis/extensions/v1beta1/thirdpartyresources/" + d.ThirdPartyResource
+	_, err := restClient.Get().AbsPath(tprPath).DoRaw()
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// ThirdPartyResource objects always live in a namespace so they're listed across every namespace.
+	raw, err := restClient.Get().AbsPath(objectsPath(d.Plural, "")).DoRaw()
+	if err != nil {
+		return err
+	}
+	var backup struct {
+		Items []map[string]interface{} `json:"items"`
+	}
+	if err = json.Unmarshal(raw, &backup); err != nil {
+		return err
+	}
+	backupPath, err := filepath.Abs(filepath.Join(backupDir, d.Plural+"-tpr-backup.json"))
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(backupPath, raw, 0600); err != nil {
+		return fmt.Errorf("Failed to back up the %v objects, the ThirdPartyResource has been left in place: %v", d.Kind, err)
+	}
+	log.Printf("Backed up %v %v objects to %v", len(backup.Items), d.Kind, backupPath)
+	log.Printf("Migrating %v %v objects from the %v ThirdPartyResource", len(backup.Items), d.Kind, d.ThirdPartyResource)
+	// Clusters with ThirdPartyResources predate conversion webhooks so the type is only served under v1.
+	if err = Apply(k8sClient, []Manifest{d.Manifest(Webhook{})}); err != nil {
+		return err
+	}
+	if _, err = restClient.Delete().AbsPath(tprPath).DoRaw(); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err = awaitServed(restClient, d.Plural); err != nil {
+		return err
+	}
+	restored := 0
+	for _, item := range backup.Items {
+		copied, err := restore(restClient, d, item)
+		if err != nil {
+			return err
+		}
+		if copied {
+			restored++
+		}
+	}
+	log.Printf("Migrated the %v ThirdPartyResource to the %v CustomResourceDefinition, %v objects were restored from the backup",
+		d.ThirdPartyResource, d.Name(), restored)
+	return nil
+}
+
+// Waits for the objects of the resource with the provided plural name to be served,
+// the CustomResourceDefinition only takes over once the ThirdPartyResource has gone.
+func awaitServed(restClient rest.Interface, plural string) error {
+	deadline := time.Now().Add(migrationTimeout)
+	for {
+		_, err := restClient.Get().AbsPath(objectsPath(plural, "")).DoRaw()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("The %v objects weren't served within %v: %v", plural, migrationTimeout, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Creates the provided backed up object of the provided type when the apiserver didn't copy it over,
+// lets us know whether it had to be created. Objects of cluster-scoped types lose their namespace.
+func restore(restClient rest.Interface, d Definition, item map[string]interface{}) (bool, error) {
+	metadata, _ := item["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	name, _ := metadata["name"].(string)
+	if d.ClusterScoped {
+		namespace = ""
+		delete(metadata, "namespace")
+	}
+	path := objectsPath(d.Plural, namespace)
+	_, err := restClient.Get().AbsPath(path + "/" + name).DoRaw()
+	if err == nil || !errors.IsNotFound(err) {
+		return false, err
+	}
+	// The object is created anew so nothing the apiserver sets can be carried over.
+	for _, field := range []string{"resourceVersion", "uid", "selfLink", "creationTimestamp"} {
+		delete(metadata, field)
+	}
+	body, err := json.Marshal(item)
+	if err != nil {
+		return false, err
+	}
+	if _, err = restClient.Post().AbsPath(path).Body(body).DoRaw(); err != nil {
+		return false, fmt.Errorf("Failed to restore the %v %v: %v", name, d.Kind, err)
+	}
+	return true, nil
+}
+
+// Provides the path of the objects of the resource with the provided plural name in the provided namespace,
+// an empty namespace provides the objects across every namespace or of a cluster-scoped resource.
+func objectsPath(plural string, namespace string) string {
+	if namespace == "" {
+		return "/apis/" + Group + "/v1/" + plural
+	}
+	return "/apis/" + Group + "/v1/namespaces/" + namespace + "/" + plural
+}
@@ -0,0 +1,133 @@
+package install
+
+// The HTTP methods kong API objects can be restricted to.
+var httpMethods = []interface{}{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT"}
+
+// Provides the OpenAPI schema of a custom resource validating its spec with the provided schema,
+// the apiserver rejects objects that don't match it when they're applied.
+func resourceSchema(spec map[string]interface{}) map[string]interface{} {
+	return object([]string{"spec"}, map[string]interface{}{"spec": spec})
+}
+
+func object(required []string, properties map[string]interface{}) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func array(items map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+func str() map[string]interface{} {
+	return map[string]interface{}{"type": "string"}
+}
+
+func boolean() map[string]interface{} {
+	return map[string]interface{}{"type": "boolean"}
+}
+
+func integer(minimum int64, maximum int64) map[string]interface{} {
+	return map[string]interface{}{"type": "integer", "minimum": minimum, "maximum": maximum}
+}
+
+// Provides the schema of a label selector, which has to select on at least one label.
+func selector() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "minProperties": 1, "additionalProperties": str()}
+}
+
+// Provides the properties of the spec shared by the resources that map to a kong API object.
+// Kong stores retries as a smallint and the timeouts in milliseconds as an integer.
+func apiProperties() map[string]interface{} {
+	return map[string]interface{}{
+		"hosts":                    array(str()),
+		"uris":                     array(str()),
+		"strip_uri":                boolean(),
+		"methods":                  array(map[string]interface{}{"type": "string", "enum": httpMethods}),
+		"preserve_host":            boolean(),
+		"retries":                  integer(0, 32767),
+		"upstream_connect_timeout": integer(0, 2147483647),
+		"upstream_send_timeout":    integer(0, 2147483647),
+		"upstream_read_timeout":    integer(0, 2147483647),
+		"https_only":               boolean(),
+		"http_if_terminated":       boolean(),
+		"port":                     integer(0, 65535),
+		"portName":                 str(),
+		"selector":                 selector(),
+	}
+}
+
+func gatewayApiSchema() map[string]interface{} {
+	properties := apiProperties()
+	properties["ports"] = array(object([]string{"name"}, map[string]interface{}{
+		"name":    str(),
+		"hosts":   array(str()),
+		"uris":    array(str()),
+		"methods": array(map[string]interface{}{"type": "string", "enum": httpMethods}),
+	}))
+	return resourceSchema(object([]string{"selector"}, properties))
+}
+
+// Kong stores retries as a smallint and the timeouts in milliseconds as an integer, like the v1 spec.
+func gatewayApiV2Schema() map[string]interface{} {
+	return resourceSchema(object([]string{"selector"}, map[string]interface{}{
+		"routes": array(object(nil, map[string]interface{}{
+			"port":    str(),
+			"hosts":   array(str()),
+			"paths":   array(str()),
+			"methods": array(map[string]interface{}{"type": "string", "enum": httpMethods}),
+		})),
+		"servicePort": object(nil, map[string]interface{}{
+			"number": integer(0, 65535),
+			"name":   str(),
+		}),
+		"routing": object(nil, map[string]interface{}{
+			"stripPath":        boolean(),
+			"preserveHost":     boolean(),
+			"httpsOnly":        boolean(),
+			"httpIfTerminated": boolean(),
+		}),
+		"upstream": object(nil, map[string]interface{}{
+			"retries":        integer(0, 32767),
+			"connectTimeout": integer(0, 2147483647),
+			"sendTimeout":    integer(0, 2147483647),
+			"readTimeout":    integer(0, 2147483647),
+		}),
+		"selector": selector(),
+	}))
+}
+
+func clusterGatewayApiSchema() map[string]interface{} {
+	properties := apiProperties()
+	properties["namespaces"] = array(str())
+	return resourceSchema(object([]string{"selector"}, properties))
+}
+
+func apiPluginSchema() map[string]interface{} {
+	// The configuration of the plugin is left to kong to validate.
+	return resourceSchema(object([]string{"name", "selector"}, map[string]interface{}{
+		"name":     str(),
+		"selector": selector(),
+	}))
+}
+
+func globalPluginSchema() map[string]interface{} {
+	return resourceSchema(object([]string{"name"}, map[string]interface{}{
+		"name": str(),
+	}))
+}
+
+// Consumers need at least one of a username and a custom id.
+func kongConsumerSchema() map[string]interface{} {
+	spec := object(nil, map[string]interface{}{
+		"username": str(),
+		"customId": str(),
+	})
+	spec["anyOf"] = []interface{}{
+		map[string]interface{}{"required": []string{"username"}},
+		map[string]interface{}{"required": []string{"customId"}},
+	}
+	return resourceSchema(spec)
+}
@@ -0,0 +1,176 @@
+package k8sclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/rest"
+)
+
+// The number of objects retrieved with each request when listing in chunks.
+const listChunkSize = 500
+
+// Provides the prefix the apiserver starts every protobuf encoded response with.
+var protobufPrefix = []byte{0x6b, 0x38, 0x73, 0x00}
+
+// Lets us know a protobuf encoded list page ended part way through a field.
+var errTruncatedProtobuf = errors.New("The protobuf encoded list page is truncated")
+
+// Provides the path of the collection of a core resource in the provided namespace,
+// an empty namespace provides the collection across every namespace.
+func corePath(resource string, namespace string) string {
+	if namespace == "" {
+		return "/api/v1/" + resource
+	}
+	return "/api/v1/namespaces/" + namespace + "/" + resource
+}
+
+// Lists the collection at the provided path in chunks of listChunkSize objects using limit and continue,
+// so large collections don't need one giant response from the apiserver. The provided function is called
+// with the raw JSON of each page in turn. Apiservers that don't support chunking return everything in the first page.
+// Chunked lists are always read from etcd as the apiserver watch cache doesn't support them.
+// This is meant for custom resources and the ingresses we translate ourselves, built-in types are listed
+// as protobuf with listObjectsInChunks.
+func listInChunks(ctx context.Context, restClient rest.Interface, path string, labelSelector string, fieldSelector string,
+	each func(page []byte) error) error {
+	return listPages(ctx, restClient, path, labelSelector, fieldSelector, func(result rest.Result, page []byte) error {
+		return each(page)
+	})
+}
+
+// Lists the collection of a built-in resource at the provided path in chunks like listInChunks, with every page
+// decoded by the codec of the provided REST client into a list created with the provided function.
+// Passing the REST client of the protobuf Clientset has each page exchanged as protobuf.
+func listObjectsInChunks(ctx context.Context, restClient rest.Interface, path string, labelSelector string, fieldSelector string,
+	newList func() runtime.Object, each func(list runtime.Object) error) error {
+	return listPages(ctx, restClient, path, labelSelector, fieldSelector, func(result rest.Result, page []byte) error {
+		list := newList()
+		if err := result.Into(list); err != nil {
+			return err
+		}
+		return each(list)
+	})
+}
+
+// Requests the pages of the collection at the provided path in turn, following the continue token
+// of each page until the last one. The provided function is called with the result of each request
+// along with its raw body.
+func listPages(ctx context.Context, restClient rest.Interface, path string, labelSelector string, fieldSelector string,
+	each func(result rest.Result, page []byte) error) error {
+	continueToken := ""
+	for {
+		req := restClient.Get().AbsPath(path).Param("limit", strconv.Itoa(listChunkSize))
+		if labelSelector != "" {
+			req = req.Param("labelSelector", labelSelector)
+		}
+		if fieldSelector != "" {
+			req = req.Param("fieldSelector", fieldSelector)
+		}
+		if continueToken != "" {
+			req = req.Param("continue", continueToken)
+		}
+		if timeout := timeoutSeconds(ctx); timeout != nil {
+			req = req.Param("timeoutSeconds", strconv.FormatInt(*timeout, 10))
+		}
+		var result rest.Result
+		var page []byte
+		err := Retry(ctx, func() error {
+			result = req.Do()
+			var err error
+			page, err = result.Raw()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err = each(result, page); err != nil {
+			return err
+		}
+		continueToken, err = pageContinue(page)
+		if err != nil {
+			return err
+		}
+		if continueToken == "" {
+			return nil
+		}
+	}
+}
+
+// Provides the continue token of the provided page of a list, empty for the last page.
+// The token is read straight from the body of the page as the list types of the client
+// we build against predate chunking and drop it when decoding.
+func pageContinue(page []byte) (string, error) {
+	if bytes.HasPrefix(page, protobufPrefix) {
+		// The list is wrapped in a runtime.Unknown with the list as its raw field (2),
+		// the continue token is field 3 of the list metadata which is field 1 of every list.
+		raw, err := protobufField(page[len(protobufPrefix):], 2)
+		if err != nil {
+			return "", err
+		}
+		listMeta, err := protobufField(raw, 1)
+		if err != nil {
+			return "", err
+		}
+		continueToken, err := protobufField(listMeta, 3)
+		return string(continueToken), err
+	}
+	listMeta := struct {
+		Metadata struct {
+			Continue string `json:"continue"`
+		} `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(page, &listMeta); err != nil {
+		return "", err
+	}
+	return listMeta.Metadata.Continue, nil
+}
+
+// Provides the value of the length delimited field with the provided number in the provided
+// protobuf encoded message, nil when the message doesn't have the field.
+// A message that ends part way through a field fails rather than pass for one without the field,
+// as that would pass a cut off page for the last one.
+func protobufField(message []byte, number uint64) ([]byte, error) {
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return nil, errTruncatedProtobuf
+		}
+		message = message[n:]
+		switch key & 7 {
+		case 0:
+			if _, n = binary.Uvarint(message); n <= 0 {
+				return nil, errTruncatedProtobuf
+			}
+			message = message[n:]
+		case 1:
+			if len(message) < 8 {
+				return nil, errTruncatedProtobuf
+			}
+			message = message[8:]
+		case 5:
+			if len(message) < 4 {
+				return nil, errTruncatedProtobuf
+			}
+			message = message[4:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || length > uint64(len(message)-n) {
+				return nil, errTruncatedProtobuf
+			}
+			value := message[n : n+int(length)]
+			if key>>3 == number {
+				return value, nil
+			}
+			message = message[n+int(length):]
+		default:
+			return nil, fmt.Errorf("Unsupported protobuf wire type %v in a list page", key&7)
+		}
+	}
+	return nil, nil
+}
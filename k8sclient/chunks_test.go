@@ -0,0 +1,119 @@
+package k8sclient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// Encodes a length delimited protobuf field with the provided number and value.
+func lengthDelimited(number uint64, value []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	field := append([]byte{}, buf[:binary.PutUvarint(buf, number<<3|2)]...)
+	field = append(field, buf[:binary.PutUvarint(buf, uint64(len(value)))]...)
+	return append(field, value...)
+}
+
+// Encodes a varint protobuf field with the provided number and value.
+func varintField(number uint64, value uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	field := append([]byte{}, buf[:binary.PutUvarint(buf, number<<3)]...)
+	return append(field, buf[:binary.PutUvarint(buf, value)]...)
+}
+
+// Encodes a protobuf list page the way the apiserver does, a runtime.Unknown holding the type meta
+// as field 1 and the list as field 2, with the provided list metadata as field 1 of the list.
+func protobufPage(listMeta []byte, items ...[]byte) []byte {
+	list := lengthDelimited(1, listMeta)
+	for _, item := range items {
+		list = append(list, lengthDelimited(2, item)...)
+	}
+	unknown := lengthDelimited(1, append(lengthDelimited(1, []byte("v1")), lengthDelimited(2, []byte("ServiceList"))...))
+	unknown = append(unknown, lengthDelimited(2, list)...)
+	return append(append([]byte{}, protobufPrefix...), unknown...)
+}
+
+func TestPageContinue(t *testing.T) {
+	longToken := strings.Repeat("c", 300)
+	complete := protobufPage(append(lengthDelimited(2, []byte("1234")), lengthDelimited(3, []byte("next"))...))
+	tests := []struct {
+		name     string
+		page     []byte
+		expected string
+		fails    bool
+	}{
+		{
+			name:     "json page with a continue token",
+			page:     []byte(`{"kind":"ServiceList","metadata":{"resourceVersion":"1234","continue":"next"},"items":[]}`),
+			expected: "next",
+		},
+		{
+			name: "json last page",
+			page: []byte(`{"kind":"ServiceList","metadata":{"resourceVersion":"1234"},"items":[]}`),
+		},
+		{
+			name:  "invalid json",
+			page:  []byte(`{"kind":"ServiceList","metadata":`),
+			fails: true,
+		},
+		{
+			name:     "protobuf page with a continue token",
+			page:     complete,
+			expected: "next",
+		},
+		{
+			name:     "protobuf page with a continue token longer than a single byte varint",
+			page:     protobufPage(lengthDelimited(3, []byte(longToken)), bytes.Repeat([]byte("i"), 200)),
+			expected: longToken,
+		},
+		{
+			name:     "protobuf page with varint fields ahead of the continue token",
+			page:     protobufPage(append(varintField(7, 1<<40), lengthDelimited(3, []byte("next"))...)),
+			expected: "next",
+		},
+		{
+			name: "protobuf last page without a continue token",
+			page: protobufPage(lengthDelimited(2, []byte("1234"))),
+		},
+		{
+			name: "protobuf page without list metadata",
+			page: append(append([]byte{}, protobufPrefix...), lengthDelimited(2, lengthDelimited(2, []byte("item")))...),
+		},
+		{
+			name: "protobuf page without a list",
+			page: append(append([]byte{}, protobufPrefix...), lengthDelimited(1, []byte("v1"))...),
+		},
+		{
+			name:  "protobuf page cut off part way through the list",
+			page:  complete[:len(complete)-3],
+			fails: true,
+		},
+		{
+			name:  "protobuf page cut off part way through a field key",
+			page:  append(append([]byte{}, protobufPrefix...), 0x80),
+			fails: true,
+		},
+		{
+			name:  "protobuf page cut off part way through a varint value",
+			page:  protobufPage(append(lengthDelimited(2, []byte("1234")), 0x38, 0xff)),
+			fails: true,
+		},
+	}
+	for _, test := range tests {
+		continueToken, err := pageContinue(test.page)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%v: expected an error but got the continue token %q", test.name, continueToken)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if continueToken != test.expected {
+			t.Errorf("%v: expected the continue token %q but got %q", test.name, test.expected, continueToken)
+		}
+	}
+}
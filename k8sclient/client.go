@@ -1,9 +1,14 @@
 package k8sclient
 
 import (
+	"context"
+	"reflect"
+	goruntime "runtime"
+
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/pkg/api"
 	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/fields"
 	"k8s.io/client-go/pkg/labels"
 	"k8s.io/client-go/pkg/runtime"
 	"k8s.io/client-go/pkg/watch"
@@ -12,83 +17,194 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// Provides the content type used to talk protobuf to the apiserver.
+const protobufContentType = "application/vnd.kubernetes.protobuf"
+
 // Client provides the type to interact
 // with Kubernetes.
+// Built-in types are exchanged with the apiserver as protobuf through Clientset which
+// cuts bandwidth and decoding time for large lists of services, JSONClientset talks JSON
+// and should be used for raw requests that read or write JSON bodies.
 type Client struct {
-	Clientset *kubernetes.Clientset
+	Clientset     *kubernetes.Clientset
+	JSONClientset *kubernetes.Clientset
+}
+
+// Options provides the settings applied to every request made by a client.
+type Options struct {
+	// The context of the kubeconfig file to use, empty for the current context.
+	// This is ignored by in cluster clients.
+	Context string
+	// The User-Agent the client identifies itself to the apiserver with.
+	UserAgent string
+	// The maximum number of requests per second made to the apiserver and the number
+	// of requests that can be made in a burst above it, 0 for the client defaults.
+	QPS   float32
+	Burst int
+}
+
+// UserAgent provides the User-Agent identifying the provided version of the controller.
+func UserAgent(version string) string {
+	return "k8s-kong-api/" + version + " (" + goruntime.GOOS + "/" + goruntime.GOARCH + ")"
 }
 
 // NewInClusterClient deals with creating a new
 // instance of a Kubernetes client.
-func NewInClusterClient() (*Client, error) {
+func NewInClusterClient(opts Options) (*Client, error) {
 	// Let's create an in cluster config.
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		return nil, err
 	}
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, err
-	}
-	return &Client{Clientset: clientset}, nil
+	return newClient(config, opts)
 }
 
 // NewClient deals with creating
 // a new kubernetes client instance from provided configuration.
-func NewClient(configFile string) (*Client, error) {
+// The context set in the provided options is used in place of the current context of the file.
+func NewClient(configFile string, opts Options) (*Client, error) {
 	// Create our configuration from the provided file.
-	config, err := clientcmd.BuildConfigFromFlags("", configFile)
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: configFile},
+		&clientcmd.ConfigOverrides{CurrentContext: opts.Context}).ClientConfig()
 	if err != nil {
 		return nil, err
 	}
-	// creates the clientset
-	clientset, err := kubernetes.NewForConfig(config)
+	return newClient(config, opts)
+}
+
+// Creates the protobuf and JSON clientsets for the provided configuration.
+// Types the apiserver can't encode as protobuf still come back as JSON
+// as the protobuf clientset accepts any content type in responses.
+// Each of the clientsets is rate limited with the QPS and burst of the provided options.
+func newClient(config *rest.Config, opts Options) (*Client, error) {
+	if opts.UserAgent != "" {
+		config.UserAgent = opts.UserAgent
+	}
+	if opts.QPS > 0 {
+		config.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		config.Burst = opts.Burst
+	}
+	jsonClientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	protobufConfig := *config
+	protobufConfig.ContentType = protobufContentType
+	clientset, err := kubernetes.NewForConfig(&protobufConfig)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{Clientset: clientset}, nil
+	return &Client{Clientset: clientset, JSONClientset: jsonClientset}, nil
 }
 
 // WatchServices deals with watching services for the provided namespace.
 // To note: Only services with the defined label are watched in this stream.
-func (cli *Client) WatchServices(namespace string, routesLabel string) (watch.Interface, error) {
+// The watch resumes from the provided resource version so when a watch expires it can be
+// restarted from the last event seen instead of re-listing every service, an empty resource
+// version starts the watch from the current state of the cluster.
+// The field selector narrows the watch down further, e.g. to a single service with NameSelector.
+// The watch is stopped once the provided context is done.
+func (cli *Client) WatchServices(ctx context.Context, namespace string, routesLabel string, fieldSelector fields.Selector,
+	resourceVersion string) (watch.Interface, error) {
 	// We only care about services which are created to be upstream
 	// API services so filter to only those with the defined
 	// label.
 	options := v1.ListOptions{
-		LabelSelector: routesLabel,
+		LabelSelector:   routesLabel,
+		FieldSelector:   fieldSelector.String(),
+		ResourceVersion: resourceVersion,
 	}
-	return cli.Clientset.Services(namespace).Watch(options)
+	return watchWithContext(ctx, func() (watch.Interface, error) {
+		return cli.Clientset.Services(namespace).Watch(options)
+	})
 }
 
 // NewListWatchFromClient is a helper method taken from the kube-cert-manager newListWatchFromClient and retrieves a list watch object
 // for the provided client.
-func NewListWatchFromClient(c cache.Getter, resource string, namespace string, selector labels.Selector) *cache.ListWatch {
+// Objects are selected with both the provided label and field selectors, the field selector
+// lets single object watches avoid streaming the whole namespace.
+// Lists are abandoned and watches stopped once the provided context is done.
+func NewListWatchFromClient(ctx context.Context, c cache.Getter, resource string, namespace string,
+	selector labels.Selector, fieldSelector fields.Selector) *cache.ListWatch {
 	listFunc := func(options api.ListOptions) (runtime.Object, error) {
-		return c.Get().
-			Namespace(namespace).
-			Resource(resource).
-			VersionedParams(&options, api.ParameterCodec).
-			LabelsSelectorParam(selector).
-			Do().
-			Get()
+		// Any resource version lets the apiserver serve the list from its watch cache
+		// rather than reading every object from etcd, the watch that follows picks up
+		// from the resource version of the list so nothing is missed.
+		if options.ResourceVersion == "" {
+			options.ResourceVersion = "0"
+		}
+		var obj runtime.Object
+		err := Retry(ctx, func() error {
+			var err error
+			obj, err = c.Get().
+				Namespace(namespace).
+				Resource(resource).
+				VersionedParams(&options, api.ParameterCodec).
+				LabelsSelectorParam(selector).
+				FieldsSelectorParam(fieldSelector).
+				Do().
+				Get()
+			return err
+		})
+		return obj, err
 	}
 	watchFunc := func(options api.ListOptions) (watch.Interface, error) {
-		return c.Get().
-			Prefix("watch").
-			Namespace(namespace).
-			Resource(resource).
-			VersionedParams(&options, api.ParameterCodec).
-			LabelsSelectorParam(selector).
-			Watch()
+		return watchWithContext(ctx, func() (watch.Interface, error) {
+			return c.Get().
+				Prefix("watch").
+				Namespace(namespace).
+				Resource(resource).
+				VersionedParams(&options, api.ParameterCodec).
+				LabelsSelectorParam(selector).
+				FieldsSelectorParam(fieldSelector).
+				Watch()
+		})
 	}
 	return &cache.ListWatch{ListFunc: listFunc, WatchFunc: watchFunc}
 }
 
 // ListServices retrieves a list of services with the defined label.
-func (cli *Client) ListServices(namespace string, routesLabel string) (*v1.ServiceList, error) {
-	options := v1.ListOptions{
-		LabelSelector: routesLabel,
+// The resource version of the list should be passed on to WatchServices
+// so the watch carries on from the state the list was taken at.
+// The list is retrieved in chunks so large namespaces don't need one giant response from the apiserver.
+// The field selector narrows the list down further, e.g. to a single service with NameSelector.
+// The deadline of the provided context is passed on to the apiserver.
+func (cli *Client) ListServices(ctx context.Context, namespace string, routesLabel string, fieldSelector fields.Selector) (*v1.ServiceList, error) {
+	services := &v1.ServiceList{}
+	err := listObjectsInChunks(ctx, cli.Clientset.CoreV1().RESTClient(), corePath("services", namespace), routesLabel, fieldSelector.String(),
+		func() runtime.Object { return &v1.ServiceList{} },
+		func(list runtime.Object) error {
+			chunk := list.(*v1.ServiceList)
+			services.ListMeta = chunk.ListMeta
+			services.Items = append(services.Items, chunk.Items...)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// NewServiceWatcher creates a watcher sharing changes to the services in the provided namespace
+// that match the provided label selector with every controller that subscribes to it.
+// Subscribers are only notified of updates that change the spec or status of a service.
+// An empty namespace watches every namespace.
+func (cli *Client) NewServiceWatcher(ctx context.Context, namespace string, selector labels.Selector) *ResourceWatcher {
+	w := newResourceWatcher(ctx, cli.Clientset.CoreV1().RESTClient(), "services", namespace, selector, &v1.Service{})
+	w.changed = func(old interface{}, new interface{}) bool {
+		oldService, oldOk := old.(*v1.Service)
+		newService, newOk := new.(*v1.Service)
+		return !oldOk || !newOk || !reflect.DeepEqual(oldService.Spec, newService.Spec) ||
+			!reflect.DeepEqual(oldService.Status, newService.Status)
 	}
-	return cli.Clientset.Services(namespace).List(options)
+	return w
+}
+
+// NameSelector provides the field selector matching the object with the provided name,
+// for watching a single object without streaming every object in the namespace.
+func NameSelector(name string) fields.Selector {
+	return fields.OneTermEqualSelector("metadata.name", name)
 }
@@ -0,0 +1,55 @@
+package k8sclient
+
+import (
+	"context"
+	"reflect"
+
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+)
+
+// WatchConfigMaps deals with watching the ConfigMaps in the provided namespace
+// that match the provided label selector, resuming from the provided resource version.
+// The watch is stopped once the provided context is done.
+func (cli *Client) WatchConfigMaps(ctx context.Context, namespace string, selector labels.Selector, resourceVersion string) (watch.Interface, error) {
+	options := v1.ListOptions{
+		LabelSelector:   selector.String(),
+		ResourceVersion: resourceVersion,
+	}
+	return watchWithContext(ctx, func() (watch.Interface, error) {
+		return cli.Clientset.CoreV1().ConfigMaps(namespace).Watch(options)
+	})
+}
+
+// ListConfigMaps retrieves the ConfigMaps in the provided namespace that match the provided label selector.
+func (cli *Client) ListConfigMaps(ctx context.Context, namespace string, selector labels.Selector) (*v1.ConfigMapList, error) {
+	configMaps := &v1.ConfigMapList{}
+	err := listObjectsInChunks(ctx, cli.Clientset.CoreV1().RESTClient(), corePath("configmaps", namespace), selector.String(), "",
+		func() runtime.Object { return &v1.ConfigMapList{} },
+		func(list runtime.Object) error {
+			chunk := list.(*v1.ConfigMapList)
+			configMaps.ListMeta = chunk.ListMeta
+			configMaps.Items = append(configMaps.Items, chunk.Items...)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return configMaps, nil
+}
+
+// NewConfigMapWatcher creates a watcher sharing changes to the ConfigMaps in the provided namespace
+// that match the provided label selector with every controller that subscribes to it.
+// Subscribers are only told about updates that change the data of a ConfigMap,
+// an empty namespace watches every namespace.
+func (cli *Client) NewConfigMapWatcher(ctx context.Context, namespace string, selector labels.Selector) *ResourceWatcher {
+	w := newResourceWatcher(ctx, cli.Clientset.CoreV1().RESTClient(), "configmaps", namespace, selector, &v1.ConfigMap{})
+	w.changed = func(old interface{}, new interface{}) bool {
+		oldConfigMap, oldOk := old.(*v1.ConfigMap)
+		newConfigMap, newOk := new.(*v1.ConfigMap)
+		return !oldOk || !newOk || !reflect.DeepEqual(oldConfigMap.Data, newConfigMap.Data)
+	}
+	return w
+}
@@ -0,0 +1,111 @@
+package k8sclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/pkg/watch"
+)
+
+// DoneContext provides a context that is cancelled once the provided done channel is closed,
+// this lets the shutdown of the controllers cancel the apiserver calls they have pending.
+func DoneContext(done <-chan struct{}) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	return ctx
+}
+
+// Runs the provided apiserver call, returning the error of the provided context
+// as soon as the context is done instead of waiting on the call.
+// The client doesn't support cancelling requests so a call that is given up on
+// is left to finish in the background.
+func doWithContext(ctx context.Context, call func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- call()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Starts the provided watch and stops it once the provided context is done.
+func watchWithContext(ctx context.Context, start func() (watch.Interface, error)) (watch.Interface, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type started struct {
+		w   watch.Interface
+		err error
+	}
+	result := make(chan started, 1)
+	go func() {
+		w, err := start()
+		result <- started{w: w, err: err}
+	}()
+	select {
+	case r := <-result:
+		if r.err != nil {
+			return nil, r.err
+		}
+		w := &contextWatch{Interface: r.w, stopped: make(chan struct{})}
+		go func() {
+			select {
+			case <-ctx.Done():
+				w.Stop()
+			case <-w.stopped:
+			}
+		}()
+		return w, nil
+	case <-ctx.Done():
+		// Make sure a watch that gets started after we've given up on it doesn't leak.
+		go func() {
+			if r := <-result; r.err == nil {
+				r.w.Stop()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// Wraps a watch so we know when it has been stopped by whoever is consuming it.
+type contextWatch struct {
+	watch.Interface
+	once    sync.Once
+	stopped chan struct{}
+}
+
+// Stop stops the underlying watch, it's safe to call more than once.
+func (w *contextWatch) Stop() {
+	w.once.Do(func() {
+		close(w.stopped)
+		w.Interface.Stop()
+	})
+}
+
+// Provides the time left before the deadline of the provided context in whole seconds
+// so the deadline can be enforced by the apiserver, nil when the context has no deadline.
+func timeoutSeconds(ctx context.Context) *int64 {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	seconds := int64(deadline.Sub(time.Now()) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &seconds
+}
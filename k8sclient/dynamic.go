@@ -0,0 +1,331 @@
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/api/meta"
+	"k8s.io/client-go/pkg/api/unversioned"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// GroupVersionResource identifies a collection of namespaced custom resources served by the apiserver,
+// e.g. the gatewayapis resource of the k8s.freshweb.io/v1 API group version.
+type GroupVersionResource struct {
+	Group    string
+	Version  string
+	Resource string
+}
+
+// Provides the path of the collection of the resource in the provided namespace,
+// an empty namespace provides the collection across every namespace.
+func (r GroupVersionResource) path(namespace string) string {
+	if namespace == "" {
+		return "/apis/" + r.Group + "/" + r.Version + "/" + r.Resource
+	}
+	return "/apis/" + r.Group + "/" + r.Version + "/namespaces/" + namespace + "/" + r.Resource
+}
+
+// Unstructured provides a custom resource of any type, the metadata is decoded so unstructured
+// objects can be kept in caches like any other object while everything else is left as is.
+// Into decodes the whole object into the type of the resource when it's needed.
+type Unstructured struct {
+	unversioned.TypeMeta
+	Metadata api.ObjectMeta
+	Object   map[string]interface{}
+}
+
+// GetObjectKind provides the method to expose the kind
+// of our Unstructured object.
+func (u *Unstructured) GetObjectKind() unversioned.ObjectKind {
+	return &u.TypeMeta
+}
+
+// GetObjectMeta Retrieves the metadata for the Unstructured object.
+func (u *Unstructured) GetObjectMeta() meta.Object {
+	return &u.Metadata
+}
+
+// UnmarshalJSON decodes the type and metadata of the object while keeping hold of everything else.
+func (u *Unstructured) UnmarshalJSON(data []byte) error {
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	header := struct {
+		unversioned.TypeMeta `json:",inline"`
+		Metadata             api.ObjectMeta `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	*u = Unstructured{TypeMeta: header.TypeMeta, Metadata: header.Metadata, Object: object}
+	return nil
+}
+
+// MarshalJSON encodes the object with any changes made to its type or metadata.
+func (u *Unstructured) MarshalJSON() ([]byte, error) {
+	metadata, err := json.Marshal(u.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	object := make(map[string]interface{}, len(u.Object)+3)
+	for key, value := range u.Object {
+		object[key] = value
+	}
+	object["metadata"] = json.RawMessage(metadata)
+	if u.Kind != "" {
+		object["kind"] = u.Kind
+	}
+	if u.APIVersion != "" {
+		object["apiVersion"] = u.APIVersion
+	}
+	return json.Marshal(object)
+}
+
+// Into decodes the provided unstructured object into the provided typed object,
+// e.g. a GatewayApi.
+func (u *Unstructured) Into(obj interface{}) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, obj)
+}
+
+// UnstructuredList provides the type encapsulating a list of unstructured objects.
+type UnstructuredList struct {
+	unversioned.TypeMeta `json:",inline"`
+	Metadata             unversioned.ListMeta `json:"metadata"`
+	Items                []Unstructured       `json:"items"`
+}
+
+// GetObjectKind provides the method to expose the kind
+// of our Unstructured List object.
+func (l *UnstructuredList) GetObjectKind() unversioned.ObjectKind {
+	return &l.TypeMeta
+}
+
+// GetListMeta Retrieves the metadata for the Unstructured List.
+func (l *UnstructuredList) GetListMeta() unversioned.List {
+	return &l.Metadata
+}
+
+// DynamicClient provides the type to read and write custom resources of a single resource type
+// without the type having to be registered with a scheme, objects are exchanged as Unstructured objects.
+type DynamicClient struct {
+	restClient rest.Interface
+	resource   GroupVersionResource
+}
+
+// Resource provides a dynamic client for the provided custom resource.
+func (cli *Client) Resource(resource GroupVersionResource) *DynamicClient {
+	return &DynamicClient{restClient: cli.JSONClientset.CoreV1().RESTClient(), resource: resource}
+}
+
+// Get retrieves the object with the provided namespace and name.
+func (c *DynamicClient) Get(ctx context.Context, namespace string, name string) (*Unstructured, error) {
+	return c.do(ctx, func() *rest.Request {
+		return c.restClient.Get().AbsPath(c.resource.path(namespace), name)
+	})
+}
+
+// List retrieves the objects in the provided namespace that match the provided label selector,
+// an empty namespace lists the objects across every namespace.
+func (c *DynamicClient) List(ctx context.Context, namespace string, selector labels.Selector) (*UnstructuredList, error) {
+	list := &UnstructuredList{Items: []Unstructured{}}
+	err := listInChunks(ctx, c.restClient, c.resource.path(namespace), selector.String(), "", func(page []byte) error {
+		chunk := &UnstructuredList{}
+		if err := json.Unmarshal(page, chunk); err != nil {
+			return err
+		}
+		list.Metadata = chunk.Metadata
+		list.Items = append(list.Items, chunk.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Watch watches the objects in the provided namespace that match the provided label selector
+// from the provided resource version, an empty resource version starts the watch from the current
+// state of the cluster. The watch is stopped once the provided context is done.
+func (c *DynamicClient) Watch(ctx context.Context, namespace string, selector labels.Selector, resourceVersion string) (watch.Interface, error) {
+	return watchWithContext(ctx, func() (watch.Interface, error) {
+		return c.watch(namespace, api.ListOptions{LabelSelector: selector, ResourceVersion: resourceVersion})
+	})
+}
+
+// Create creates the provided object, unlike the other calls it isn't retried
+// as a retry after the connection drops could fail on the object it had already created.
+func (c *DynamicClient) Create(ctx context.Context, obj *Unstructured) (*Unstructured, error) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var raw []byte
+	err = doWithContext(ctx, func() error {
+		var err error
+		raw, err = c.restClient.Post().AbsPath(c.resource.path(obj.Metadata.Namespace)).Body(body).DoRaw()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	created := &Unstructured{}
+	if err = json.Unmarshal(raw, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// Update replaces the provided object, the update fails with a conflict
+// when the object has changed since the resource version it carries.
+func (c *DynamicClient) Update(ctx context.Context, obj *Unstructured) (*Unstructured, error) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, func() *rest.Request {
+		return c.restClient.Put().AbsPath(c.resource.path(obj.Metadata.Namespace), obj.Metadata.Name).Body(body)
+	})
+}
+
+// Patch applies the provided JSON merge patch to the object with the provided namespace and name.
+func (c *DynamicClient) Patch(ctx context.Context, namespace string, name string, patch []byte) (*Unstructured, error) {
+	return c.do(ctx, func() *rest.Request {
+		return c.restClient.Patch(api.MergePatchType).AbsPath(c.resource.path(namespace), name).Body(patch)
+	})
+}
+
+// Delete deletes the object with the provided namespace and name.
+func (c *DynamicClient) Delete(ctx context.Context, namespace string, name string) error {
+	return Retry(ctx, func() error {
+		_, err := c.restClient.Delete().AbsPath(c.resource.path(namespace), name).DoRaw()
+		return err
+	})
+}
+
+// NewWatcher creates a watcher sharing changes to the objects in the provided namespaces
+// that match the provided label selector with every controller that subscribes to it.
+// An empty list of namespaces watches every namespace.
+func (c *DynamicClient) NewWatcher(ctx context.Context, namespaces []string, selector labels.Selector) *ResourceWatcher {
+	source := NamespacesListWatch(namespaces, func(namespace string) *cache.ListWatch {
+		return &cache.ListWatch{
+			ListFunc: func(options api.ListOptions) (runtime.Object, error) {
+				return c.List(ctx, namespace, selector)
+			},
+			WatchFunc: func(options api.ListOptions) (watch.Interface, error) {
+				options.LabelSelector = selector
+				return watchWithContext(ctx, func() (watch.Interface, error) {
+					return c.watch(namespace, options)
+				})
+			},
+		}
+	})
+	return newResourceWatcherFromSource(source, &Unstructured{})
+}
+
+// Carries out the request built by the provided function, retrying transient errors,
+// and decodes the object in the response.
+func (c *DynamicClient) do(ctx context.Context, request func() *rest.Request) (*Unstructured, error) {
+	var raw []byte
+	err := Retry(ctx, func() error {
+		var err error
+		raw, err = request().DoRaw()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	obj := &Unstructured{}
+	if err = json.Unmarshal(raw, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (c *DynamicClient) watch(namespace string, options api.ListOptions) (watch.Interface, error) {
+	req := withListOptions(c.restClient.Get().AbsPath(c.resource.path(namespace)), options).Param("watch", "true")
+	stream, err := req.Stream()
+	if err != nil {
+		return nil, err
+	}
+	return newRawWatch(stream, func(raw json.RawMessage) (runtime.Object, error) {
+		obj := &Unstructured{}
+		if err := json.Unmarshal(raw, obj); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	}), nil
+}
+
+// Decodes the events of a raw JSON watch stream, the objects in them
+// are decoded with the provided function.
+type rawWatch struct {
+	stream io.ReadCloser
+	decode func(raw json.RawMessage) (runtime.Object, error)
+	result chan watch.Event
+	once   sync.Once
+	done   chan struct{}
+}
+
+// Starts decoding the events of the provided watch stream.
+func newRawWatch(stream io.ReadCloser, decode func(raw json.RawMessage) (runtime.Object, error)) *rawWatch {
+	w := &rawWatch{stream: stream, decode: decode, result: make(chan watch.Event), done: make(chan struct{})}
+	go w.receive()
+	return w
+}
+
+func (w *rawWatch) Stop() {
+	w.once.Do(func() {
+		close(w.done)
+		w.stream.Close()
+	})
+}
+
+func (w *rawWatch) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *rawWatch) receive() {
+	defer close(w.result)
+	defer w.Stop()
+	decoder := json.NewDecoder(w.stream)
+	for {
+		rawEvent := struct {
+			Type   watch.EventType `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}{}
+		if err := decoder.Decode(&rawEvent); err != nil {
+			return
+		}
+		var obj runtime.Object
+		if rawEvent.Type == watch.Error {
+			status := &unversioned.Status{}
+			if err := json.Unmarshal(rawEvent.Object, status); err != nil {
+				return
+			}
+			obj = status
+		} else {
+			var err error
+			if obj, err = w.decode(rawEvent.Object); err != nil {
+				return
+			}
+		}
+		select {
+		case w.result <- watch.Event{Type: rawEvent.Type, Object: obj}:
+		case <-w.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package k8sclient
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+)
+
+// EndpointsWatcher provides a shared source of the endpoints behind each service,
+// endpoints objects share the name of their service so they are looked up by service name.
+type EndpointsWatcher struct {
+	*ResourceWatcher
+}
+
+// WatchEndpoints deals with watching the endpoints in the provided namespace
+// that match the provided label selector, resuming from the provided resource version.
+// The watch is stopped once the provided context is done.
+func (cli *Client) WatchEndpoints(ctx context.Context, namespace string, selector labels.Selector, resourceVersion string) (watch.Interface, error) {
+	options := v1.ListOptions{
+		LabelSelector:   selector.String(),
+		ResourceVersion: resourceVersion,
+	}
+	return watchWithContext(ctx, func() (watch.Interface, error) {
+		return cli.Clientset.CoreV1().Endpoints(namespace).Watch(options)
+	})
+}
+
+// ListEndpoints retrieves the endpoints in the provided namespace that match the provided label selector.
+func (cli *Client) ListEndpoints(ctx context.Context, namespace string, selector labels.Selector) (*v1.EndpointsList, error) {
+	endpoints := &v1.EndpointsList{}
+	err := listObjectsInChunks(ctx, cli.Clientset.CoreV1().RESTClient(), corePath("endpoints", namespace), selector.String(), "",
+		func() runtime.Object { return &v1.EndpointsList{} },
+		func(list runtime.Object) error {
+			chunk := list.(*v1.EndpointsList)
+			endpoints.ListMeta = chunk.ListMeta
+			endpoints.Items = append(endpoints.Items, chunk.Items...)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// NewEndpointsWatcher creates a watcher sharing changes to the endpoints in the provided namespaces
+// with every controller that subscribes to it.
+// Subscribers are only told about updates that change the addresses or ports of the endpoints,
+// an empty list of namespaces watches every namespace.
+func (cli *Client) NewEndpointsWatcher(ctx context.Context, namespaces []string, selector labels.Selector) *EndpointsWatcher {
+	w := newNamespacesWatcher(ctx, cli.Clientset.CoreV1().RESTClient(), "endpoints", namespaces, selector, &v1.Endpoints{})
+	w.changed = func(old interface{}, new interface{}) bool {
+		oldEndpoints, oldOk := old.(*v1.Endpoints)
+		newEndpoints, newOk := new.(*v1.Endpoints)
+		return !oldOk || !newOk || !reflect.DeepEqual(oldEndpoints.Subsets, newEndpoints.Subsets)
+	}
+	return &EndpointsWatcher{ResourceWatcher: w}
+}
+
+// Endpoints retrieves the endpoints for the service with the provided namespace and name.
+func (w *EndpointsWatcher) Endpoints(namespace string, serviceName string) (*v1.Endpoints, bool) {
+	obj, exists := w.Get(namespace, serviceName)
+	if !exists {
+		return nil, false
+	}
+	endpoints, ok := obj.(*v1.Endpoints)
+	return endpoints, ok
+}
+
+// ReadyTargets provides the sorted host:port targets of the ready addresses behind the service
+// with the provided namespace and name for the service port with the provided name,
+// an empty port name matches the only port of services exposing a single port.
+func (w *EndpointsWatcher) ReadyTargets(namespace string, serviceName string, portName string) []string {
+	endpoints, exists := w.Endpoints(namespace, serviceName)
+	if !exists {
+		return nil
+	}
+	targets := []string{}
+	for _, subset := range endpoints.Subsets {
+		for _, port := range subset.Ports {
+			if port.Name != portName {
+				continue
+			}
+			for _, address := range subset.Addresses {
+				targets = append(targets, address.IP+":"+strconv.Itoa(int(port.Port)))
+			}
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// OnServiceChange registers the provided function to be called with the namespace and name
+// of the service of every endpoints object that's added, changed or removed.
+func (w *EndpointsWatcher) OnServiceChange(fn func(namespace string, serviceName string)) {
+	w.Subscribe(func(evType watch.EventType, obj interface{}) {
+		endpoints, ok := obj.(*v1.Endpoints)
+		if !ok {
+			log.Printf("could not convert %v (%T) into Endpoints", obj, obj)
+			return
+		}
+		fn(endpoints.GetNamespace(), endpoints.GetName())
+	})
+}
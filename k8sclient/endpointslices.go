@@ -0,0 +1,149 @@
+package k8sclient
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/selection"
+	"k8s.io/client-go/pkg/watch"
+)
+
+// EndpointSliceResource provides the resource of the EndpointSlices the endpoints of large services are split into,
+// they aren't part of the client-go API types we build against so they are read through the dynamic client.
+var EndpointSliceResource = GroupVersionResource{Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"}
+
+// ServiceNameLabel provides the label EndpointSlices carry the name of their service in.
+const ServiceNameLabel = "kubernetes.io/service-name"
+
+// ServiceTargets provides the ready host:port targets behind each service, from either
+// the Endpoints or the EndpointSlices of the service.
+type ServiceTargets interface {
+	// ReadyTargets provides the sorted host:port targets of the ready addresses behind the service
+	// with the provided namespace and name for the service port with the provided name.
+	ReadyTargets(namespace string, serviceName string, portName string) []string
+	// OnServiceChange registers the provided function to be called with the namespace and name
+	// of every service whose targets change, it must be registered before the source is run.
+	OnServiceChange(fn func(namespace string, serviceName string))
+	// Run starts watching the targets until the provided done channel is closed
+	// and blocks until the initial targets have been loaded.
+	Run(done <-chan struct{})
+}
+
+// EndpointSlice provides the parts of a discovery.k8s.io/v1 EndpointSlice needed to target its endpoints.
+type EndpointSlice struct {
+	Metadata    v1.ObjectMeta       `json:"metadata"`
+	AddressType string              `json:"addressType"`
+	Endpoints   []SliceEndpoint     `json:"endpoints"`
+	Ports       []EndpointSlicePort `json:"ports"`
+}
+
+// SliceEndpoint provides a single endpoint of an EndpointSlice.
+type SliceEndpoint struct {
+	Addresses  []string `json:"addresses"`
+	Conditions struct {
+		// Ready is only ever unset when the readiness of the endpoint is unknown, which is treated as ready.
+		Ready *bool `json:"ready"`
+	} `json:"conditions"`
+}
+
+// EndpointSlicePort provides a port every endpoint of an EndpointSlice is reachable on.
+type EndpointSlicePort struct {
+	Name *string `json:"name"`
+	Port *int32  `json:"port"`
+}
+
+// EndpointSliceWatcher provides a shared source of the EndpointSlices behind each service,
+// a service can be split across any number of slices so they are gathered by the service name label.
+type EndpointSliceWatcher struct {
+	*ResourceWatcher
+}
+
+// NewEndpointSliceWatcher creates a watcher sharing changes to the EndpointSlices of the services
+// in the provided namespaces with every controller that subscribes to it.
+// Subscribers are only told about updates that change the endpoints or ports of a slice,
+// an empty list of namespaces watches every namespace.
+func (cli *Client) NewEndpointSliceWatcher(ctx context.Context, namespaces []string) *EndpointSliceWatcher {
+	selector := labels.NewSelector()
+	req, err := labels.NewRequirement(ServiceNameLabel, selection.Exists, []string{})
+	if err == nil {
+		selector = selector.Add(*req)
+	}
+	w := cli.Resource(EndpointSliceResource).NewWatcher(ctx, namespaces, selector)
+	w.changed = func(old interface{}, new interface{}) bool {
+		oldSlice, oldOk := old.(*Unstructured)
+		newSlice, newOk := new.(*Unstructured)
+		return !oldOk || !newOk || !reflect.DeepEqual(oldSlice.Object["endpoints"], newSlice.Object["endpoints"]) ||
+			!reflect.DeepEqual(oldSlice.Object["ports"], newSlice.Object["ports"])
+	}
+	return &EndpointSliceWatcher{ResourceWatcher: w}
+}
+
+// Slices retrieves the EndpointSlices of the service with the provided namespace and name.
+// The cache is walked for every call as slices are keyed by their own generated names.
+func (w *EndpointSliceWatcher) Slices(namespace string, serviceName string) []*EndpointSlice {
+	slices := []*EndpointSlice{}
+	for _, obj := range w.store.List() {
+		u, ok := obj.(*Unstructured)
+		if !ok || u.Metadata.Namespace != namespace || u.Metadata.Labels[ServiceNameLabel] != serviceName {
+			continue
+		}
+		slice := &EndpointSlice{}
+		if err := u.Into(slice); err != nil {
+			log.Printf("Error decoding the %v/%v EndpointSlice: %v", namespace, u.Metadata.Name, err)
+			continue
+		}
+		slices = append(slices, slice)
+	}
+	return slices
+}
+
+// ReadyTargets provides the sorted host:port targets of the ready endpoints in every slice of the service
+// with the provided namespace and name for the service port with the provided name,
+// an empty port name matches the only port of services exposing a single port.
+// Endpoints that turn up in more than one slice while they are moved between slices are only targeted once.
+func (w *EndpointSliceWatcher) ReadyTargets(namespace string, serviceName string, portName string) []string {
+	unique := make(map[string]bool)
+	for _, slice := range w.Slices(namespace, serviceName) {
+		for _, port := range slice.Ports {
+			name := ""
+			if port.Name != nil {
+				name = *port.Name
+			}
+			if name != portName || port.Port == nil {
+				continue
+			}
+			for _, endpoint := range slice.Endpoints {
+				if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+					continue
+				}
+				for _, address := range endpoint.Addresses {
+					unique[address+":"+strconv.Itoa(int(*port.Port))] = true
+				}
+			}
+		}
+	}
+	targets := make([]string, 0, len(unique))
+	for target := range unique {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// OnServiceChange registers the provided function to be called with the namespace and name
+// of the service of every EndpointSlice that's added, changed or removed.
+func (w *EndpointSliceWatcher) OnServiceChange(fn func(namespace string, serviceName string)) {
+	w.Subscribe(func(evType watch.EventType, obj interface{}) {
+		u, ok := obj.(*Unstructured)
+		if !ok {
+			log.Printf("could not convert %v (%T) into EndpointSlice", obj, obj)
+			return
+		}
+		fn(u.Metadata.Namespace, u.Metadata.Labels[ServiceNameLabel])
+	})
+}
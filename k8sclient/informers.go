@@ -0,0 +1,59 @@
+package k8sclient
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+)
+
+// InformerFactory hands out watchers shared between the controllers, so every controller asking for
+// the same kind of object with the same label selector reuses a single list, watch and informer cache
+// instead of each putting its own load on the apiserver.
+// Watchers are started as soon as they are first asked for and run until the factory is done.
+type InformerFactory struct {
+	client     *Client
+	ctx        context.Context
+	done       <-chan struct{}
+	namespaces []string
+	mu         sync.Mutex
+	watchers   map[string]*ResourceWatcher
+}
+
+// NewInformerFactory creates a new instance of a factory of watchers for the objects in the provided namespaces,
+// the watchers are stopped once the provided done channel is closed. An empty list of namespaces watches every namespace.
+func (cli *Client) NewInformerFactory(namespaces []string, done <-chan struct{}) *InformerFactory {
+	return &InformerFactory{client: cli, ctx: DoneContext(done), done: done, namespaces: namespaces,
+		watchers: make(map[string]*ResourceWatcher)}
+}
+
+// Services provides the shared watcher for the services that match the provided label selector,
+// subscribers are notified of every change to the services.
+func (f *InformerFactory) Services(selector labels.Selector) *ResourceWatcher {
+	return f.watcher("services", selector, func() *ResourceWatcher {
+		return newNamespacesWatcher(f.ctx, f.client.Clientset.CoreV1().RESTClient(), "services", f.namespaces, selector, &v1.Service{})
+	})
+}
+
+// Secrets provides the shared watcher for the secrets that match the provided label selector.
+func (f *InformerFactory) Secrets(selector labels.Selector) *ResourceWatcher {
+	return f.watcher("secrets", selector, func() *ResourceWatcher {
+		return f.client.NewSecretWatcher(f.ctx, f.namespaces, selector)
+	})
+}
+
+// Provides the watcher for the provided resource and label selector, the watcher is created
+// with the provided function and started the first time it's asked for.
+func (f *InformerFactory) watcher(resource string, selector labels.Selector, create func() *ResourceWatcher) *ResourceWatcher {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := resource + "?" + selector.String()
+	if w, exists := f.watchers[key]; exists {
+		return w
+	}
+	w := create()
+	f.watchers[key] = w
+	go w.Run(f.done)
+	return w
+}
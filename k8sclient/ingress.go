@@ -0,0 +1,369 @@
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/meta"
+	"k8s.io/client-go/pkg/api/unversioned"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// IngressClassAnnotation provides the annotation used to set the class of an ingress
+// on clusters that predate the ingressClassName field.
+const IngressClassAnnotation = "kubernetes.io/ingress.class"
+
+// The API group versions serving ingresses, newest first.
+var ingressGroupVersions = []string{"networking.k8s.io/v1", "networking.k8s.io/v1beta1", "extensions/v1beta1"}
+
+// Ingress provides a version independent representation of an ingress,
+// ingresses from every API group version the cluster might serve are translated into it
+// so the rest of the controller doesn't need to care which one is in use.
+type Ingress struct {
+	unversioned.TypeMeta `json:",inline"`
+	Metadata             api.ObjectMeta `json:"metadata"`
+	Spec                 IngressSpec    `json:"spec"`
+}
+
+// IngressSpec provides the specification of an ingress.
+// ClassName is taken from the ingressClassName field, falling back to the class annotation.
+type IngressSpec struct {
+	ClassName      string          `json:"className,omitempty"`
+	DefaultBackend *IngressBackend `json:"defaultBackend,omitempty"`
+	TLS            []IngressTLS    `json:"tls,omitempty"`
+	Rules          []IngressRule   `json:"rules,omitempty"`
+}
+
+// IngressTLS provides the hosts covered by a TLS certificate and the secret holding it.
+type IngressTLS struct {
+	Hosts      []string `json:"hosts,omitempty"`
+	SecretName string   `json:"secretName,omitempty"`
+}
+
+// IngressRule provides the paths routed for a host, an empty host matches every host.
+type IngressRule struct {
+	Host  string        `json:"host,omitempty"`
+	Paths []IngressPath `json:"paths,omitempty"`
+}
+
+// IngressPath provides a path routed to a backend.
+type IngressPath struct {
+	Path     string         `json:"path,omitempty"`
+	PathType string         `json:"pathType,omitempty"`
+	Backend  IngressBackend `json:"backend"`
+}
+
+// IngressBackend provides the service and port traffic is routed to,
+// the port is either the name or the number of the service port.
+type IngressBackend struct {
+	ServiceName string `json:"serviceName"`
+	ServicePort string `json:"servicePort"`
+}
+
+// GetObjectKind provides the method to expose the kind
+// of our Ingress object.
+func (i *Ingress) GetObjectKind() unversioned.ObjectKind {
+	return &i.TypeMeta
+}
+
+// GetObjectMeta Retrieves the metadata for the Ingress.
+func (i *Ingress) GetObjectMeta() meta.Object {
+	return &i.Metadata
+}
+
+// IngressList provides the type encapsulating a list of ingresses.
+type IngressList struct {
+	unversioned.TypeMeta `json:",inline"`
+	Metadata             unversioned.ListMeta `json:"metadata"`
+	Items                []Ingress            `json:"items"`
+}
+
+// GetObjectKind provides the method to expose the kind
+// of our Ingress List object.
+func (l *IngressList) GetObjectKind() unversioned.ObjectKind {
+	return &l.TypeMeta
+}
+
+// GetListMeta Retrieves the metadata for the Ingress List.
+func (l *IngressList) GetListMeta() unversioned.List {
+	return &l.Metadata
+}
+
+// IngressGroupVersion works out the newest API group version the cluster serves ingresses from.
+func (cli *Client) IngressGroupVersion(ctx context.Context) (string, error) {
+	restClient := cli.JSONClientset.CoreV1().RESTClient()
+	for _, groupVersion := range ingressGroupVersions {
+		var raw []byte
+		err := Retry(ctx, func() error {
+			var err error
+			raw, err = restClient.Get().AbsPath("/apis/" + groupVersion).DoRaw()
+			return err
+		})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return "", err
+		}
+		resources := unversioned.APIResourceList{}
+		if err = json.Unmarshal(raw, &resources); err != nil {
+			return "", err
+		}
+		for _, resource := range resources.APIResources {
+			if resource.Name == "ingresses" {
+				return groupVersion, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("The cluster doesn't serve ingresses from any of %v", ingressGroupVersions)
+}
+
+// ListIngresses retrieves the ingresses of the provided class in the provided namespace that match
+// the provided label selector from the provided API group version, an empty class matches every ingress.
+func (cli *Client) ListIngresses(ctx context.Context, groupVersion string, namespace string, selector labels.Selector, class string) (*IngressList, error) {
+	list := &IngressList{Items: []Ingress{}}
+	err := listInChunks(ctx, cli.JSONClientset.CoreV1().RESTClient(), ingressesPath(groupVersion, namespace), selector.String(), "",
+		func(page []byte) error {
+			chunk, err := decodeIngresses(groupVersion, page)
+			if err != nil {
+				return err
+			}
+			list.Metadata = chunk.Metadata
+			for _, ingress := range chunk.Items {
+				if ingressHasClass(&ingress, class) {
+					list.Items = append(list.Items, ingress)
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// NewIngressWatcher creates a watcher sharing changes to the ingresses of the provided class in the provided
+// namespace with every controller that subscribes to it, an empty class matches every ingress.
+// Ingresses are read from the provided API group version and translated into our own Ingress type.
+// An ingress that moves to another class is delivered to subscribers as deleted,
+// the cache of the watcher still holds the ingresses of every class.
+func (cli *Client) NewIngressWatcher(ctx context.Context, groupVersion string, namespace string, selector labels.Selector, class string) *ResourceWatcher {
+	restClient := cli.JSONClientset.CoreV1().RESTClient()
+	source := &cache.ListWatch{
+		ListFunc: func(options api.ListOptions) (runtime.Object, error) {
+			if options.ResourceVersion == "" {
+				options.ResourceVersion = "0"
+			}
+			options.LabelSelector = selector
+			return listIngresses(ctx, restClient, groupVersion, namespace, options)
+		},
+		WatchFunc: func(options api.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			return watchWithContext(ctx, func() (watch.Interface, error) {
+				return watchIngresses(restClient, groupVersion, namespace, options)
+			})
+		},
+	}
+	w := newResourceWatcherFromSource(source, &Ingress{})
+	w.include = func(obj interface{}) bool {
+		ingress, ok := obj.(*Ingress)
+		return !ok || ingressHasClass(ingress, class)
+	}
+	return w
+}
+
+// Lets us know whether the provided ingress has the provided class, an empty class matches every ingress.
+func ingressHasClass(ingress *Ingress, class string) bool {
+	return class == "" || ingress.Spec.ClassName == class
+}
+
+// Provides the path of the ingresses collection for the provided API group version and namespace.
+func ingressesPath(groupVersion string, namespace string) string {
+	if namespace == "" {
+		return "/apis/" + groupVersion + "/ingresses"
+	}
+	return "/apis/" + groupVersion + "/namespaces/" + namespace + "/ingresses"
+}
+
+// Applies the provided list options to the provided request.
+func withListOptions(req *rest.Request, options api.ListOptions) *rest.Request {
+	if options.LabelSelector != nil && !options.LabelSelector.Empty() {
+		req = req.Param("labelSelector", options.LabelSelector.String())
+	}
+	if options.ResourceVersion != "" {
+		req = req.Param("resourceVersion", options.ResourceVersion)
+	}
+	if options.TimeoutSeconds != nil {
+		req = req.Param("timeoutSeconds", strconv.FormatInt(*options.TimeoutSeconds, 10))
+	}
+	return req
+}
+
+func listIngresses(ctx context.Context, restClient rest.Interface, groupVersion string, namespace string, options api.ListOptions) (*IngressList, error) {
+	var raw []byte
+	err := Retry(ctx, func() error {
+		var err error
+		raw, err = withListOptions(restClient.Get().AbsPath(ingressesPath(groupVersion, namespace)), options).DoRaw()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decodeIngresses(groupVersion, raw)
+}
+
+// Decodes a list of ingresses from the provided API group version into our own Ingress type.
+func decodeIngresses(groupVersion string, raw []byte) (*IngressList, error) {
+	rawList := struct {
+		Metadata unversioned.ListMeta `json:"metadata"`
+		Items    []json.RawMessage    `json:"items"`
+	}{}
+	if err := json.Unmarshal(raw, &rawList); err != nil {
+		return nil, err
+	}
+	list := &IngressList{Metadata: rawList.Metadata, Items: []Ingress{}}
+	for _, item := range rawList.Items {
+		ingress, err := translateIngress(groupVersion, item)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, *ingress)
+	}
+	return list, nil
+}
+
+func watchIngresses(restClient rest.Interface, groupVersion string, namespace string, options api.ListOptions) (watch.Interface, error) {
+	req := withListOptions(restClient.Get().AbsPath(ingressesPath(groupVersion, namespace)), options).Param("watch", "true")
+	stream, err := req.Stream()
+	if err != nil {
+		return nil, err
+	}
+	return newRawWatch(stream, func(raw json.RawMessage) (runtime.Object, error) {
+		return translateIngress(groupVersion, raw)
+	}), nil
+}
+
+// Provides a service port that may be serialised as either a number or a name.
+type intOrString string
+
+func (p *intOrString) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*p = intOrString(name)
+		return nil
+	}
+	var number int64
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*p = intOrString(strconv.FormatInt(number, 10))
+	return nil
+}
+
+// The backend of a networking.k8s.io/v1 ingress.
+type ingressBackendV1 struct {
+	Service *struct {
+		Name string `json:"name"`
+		Port struct {
+			Name   string `json:"name"`
+			Number int64  `json:"number"`
+		} `json:"port"`
+	} `json:"service"`
+}
+
+func (b *ingressBackendV1) translate() IngressBackend {
+	if b.Service == nil {
+		return IngressBackend{}
+	}
+	port := b.Service.Port.Name
+	if port == "" {
+		port = strconv.FormatInt(b.Service.Port.Number, 10)
+	}
+	return IngressBackend{ServiceName: b.Service.Name, ServicePort: port}
+}
+
+// The backend of a networking.k8s.io/v1beta1 or extensions/v1beta1 ingress.
+type ingressBackendV1beta1 struct {
+	ServiceName string      `json:"serviceName"`
+	ServicePort intOrString `json:"servicePort"`
+}
+
+func (b *ingressBackendV1beta1) translate() IngressBackend {
+	return IngressBackend{ServiceName: b.ServiceName, ServicePort: string(b.ServicePort)}
+}
+
+// Translates the provided raw ingress from the provided API group version into our own Ingress type.
+func translateIngress(groupVersion string, raw []byte) (*Ingress, error) {
+	type rule struct {
+		Host string `json:"host"`
+		HTTP *struct {
+			Paths []struct {
+				Path     string          `json:"path"`
+				PathType string          `json:"pathType"`
+				Backend  json.RawMessage `json:"backend"`
+			} `json:"paths"`
+		} `json:"http"`
+	}
+	rawIngress := struct {
+		Metadata api.ObjectMeta `json:"metadata"`
+		Spec     struct {
+			IngressClassName *string         `json:"ingressClassName"`
+			DefaultBackend   json.RawMessage `json:"defaultBackend"`
+			Backend          json.RawMessage `json:"backend"`
+			TLS              []IngressTLS    `json:"tls"`
+			Rules            []rule          `json:"rules"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(raw, &rawIngress); err != nil {
+		return nil, err
+	}
+	backend := func(raw json.RawMessage) (IngressBackend, error) {
+		if groupVersion == "networking.k8s.io/v1" {
+			b := ingressBackendV1{}
+			err := json.Unmarshal(raw, &b)
+			return b.translate(), err
+		}
+		b := ingressBackendV1beta1{}
+		err := json.Unmarshal(raw, &b)
+		return b.translate(), err
+	}
+	ingress := &Ingress{Metadata: rawIngress.Metadata, Spec: IngressSpec{TLS: rawIngress.Spec.TLS}}
+	ingress.Spec.ClassName = rawIngress.Metadata.Annotations[IngressClassAnnotation]
+	if rawIngress.Spec.IngressClassName != nil {
+		ingress.Spec.ClassName = *rawIngress.Spec.IngressClassName
+	}
+	// The default backend was renamed from backend in networking.k8s.io/v1.
+	defaultBackend := rawIngress.Spec.DefaultBackend
+	if len(defaultBackend) == 0 {
+		defaultBackend = rawIngress.Spec.Backend
+	}
+	if len(defaultBackend) > 0 && string(defaultBackend) != "null" {
+		b, err := backend(defaultBackend)
+		if err != nil {
+			return nil, err
+		}
+		ingress.Spec.DefaultBackend = &b
+	}
+	for _, r := range rawIngress.Spec.Rules {
+		translated := IngressRule{Host: r.Host}
+		if r.HTTP != nil {
+			for _, p := range r.HTTP.Paths {
+				b, err := backend(p.Backend)
+				if err != nil {
+					return nil, err
+				}
+				translated.Paths = append(translated.Paths, IngressPath{Path: p.Path, PathType: p.PathType, Backend: b})
+			}
+		}
+		ingress.Spec.Rules = append(ingress.Spec.Rules, translated)
+	}
+	return ingress, nil
+}
@@ -0,0 +1,171 @@
+package k8sclient
+
+import (
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/api/meta"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ParseNamespaces provides the namespaces in the provided comma separated list,
+// an empty list means every namespace.
+func ParseNamespaces(value string) []string {
+	namespaces := []string{}
+	seen := make(map[string]bool)
+	for _, namespace := range strings.Split(value, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" && !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// NamespacesListWatch provides a list watch for the objects in all of the provided namespaces
+// out of the list watches the provided function creates for a single namespace, an empty list of namespaces
+// watches every namespace. With several namespaces the lists of each namespace are merged into a single list
+// and their watches into a single watch so a single informer cache holds the objects of every namespace.
+func NamespacesListWatch(namespaces []string, source func(namespace string) *cache.ListWatch) *cache.ListWatch {
+	switch len(namespaces) {
+	case 0:
+		return source("")
+	case 1:
+		return source(namespaces[0])
+	}
+	lw := &namespacesListWatch{sources: make(map[string]*cache.ListWatch), versions: make(map[string]string)}
+	for _, namespace := range namespaces {
+		lw.namespaces = append(lw.namespaces, namespace)
+		lw.sources[namespace] = source(namespace)
+	}
+	return &cache.ListWatch{ListFunc: lw.list, WatchFunc: lw.watch}
+}
+
+// Lists and watches the objects of several namespaces through the list watch of each namespace.
+// Resource versions are tracked for each namespace as the watch of a namespace has to pick up
+// from where its own list or last event left off, not from where another namespace did.
+type namespacesListWatch struct {
+	namespaces []string
+	sources    map[string]*cache.ListWatch
+	mu         sync.Mutex
+	versions   map[string]string
+}
+
+func (lw *namespacesListWatch) list(options api.ListOptions) (runtime.Object, error) {
+	var merged runtime.Object
+	items := []runtime.Object{}
+	versions := make(map[string]string)
+	for _, namespace := range lw.namespaces {
+		list, err := lw.sources[namespace].List(options)
+		if err != nil {
+			return nil, err
+		}
+		objs, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, objs...)
+		if listMeta, err := meta.ListAccessor(list); err == nil {
+			versions[namespace] = listMeta.GetResourceVersion()
+		}
+		if merged == nil {
+			// The list of the first namespace carries the objects of them all.
+			merged = list
+		}
+	}
+	if err := meta.SetList(merged, items); err != nil {
+		return nil, err
+	}
+	lw.mu.Lock()
+	lw.versions = versions
+	lw.mu.Unlock()
+	return merged, nil
+}
+
+func (lw *namespacesListWatch) watch(options api.ListOptions) (watch.Interface, error) {
+	merged := &namespacesWatch{result: make(chan watch.Event), stopped: make(chan struct{})}
+	for _, namespace := range lw.namespaces {
+		namespaceOptions := options
+		lw.mu.Lock()
+		if version := lw.versions[namespace]; version != "" {
+			namespaceOptions.ResourceVersion = version
+		}
+		lw.mu.Unlock()
+		w, err := lw.sources[namespace].Watch(namespaceOptions)
+		if err != nil {
+			merged.Stop()
+			return nil, err
+		}
+		merged.watches = append(merged.watches, w)
+	}
+	for i, namespace := range lw.namespaces {
+		namespace := namespace
+		merged.wg.Add(1)
+		go merged.forward(merged.watches[i], func(obj runtime.Object) {
+			if accessor, err := meta.Accessor(obj); err == nil && accessor != nil {
+				lw.mu.Lock()
+				lw.versions[namespace] = accessor.GetResourceVersion()
+				lw.mu.Unlock()
+			}
+		})
+	}
+	go func() {
+		merged.wg.Wait()
+		close(merged.result)
+	}()
+	return merged, nil
+}
+
+// Merges the watches of several namespaces into a single watch, the watch ends as soon as
+// the watch of any namespace does so the informer lists and watches every namespace again.
+type namespacesWatch struct {
+	watches []watch.Interface
+	result  chan watch.Event
+	once    sync.Once
+	stopped chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Stop stops the watches of every namespace, it's safe to call more than once.
+func (w *namespacesWatch) Stop() {
+	w.once.Do(func() {
+		close(w.stopped)
+		for _, namespaceWatch := range w.watches {
+			namespaceWatch.Stop()
+		}
+	})
+}
+
+// ResultChan provides the events of every namespace.
+func (w *namespacesWatch) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+// Passes the events of the provided watch on until either the watch or the merged watch ends,
+// the provided function is called with the object of every event passed on that isn't an error.
+func (w *namespacesWatch) forward(namespaceWatch watch.Interface, seen func(obj runtime.Object)) {
+	defer w.wg.Done()
+	defer w.Stop()
+	for {
+		select {
+		case event, ok := <-namespaceWatch.ResultChan():
+			if !ok {
+				return
+			}
+			select {
+			case w.result <- event:
+			case <-w.stopped:
+				return
+			}
+			if event.Type != watch.Error {
+				seen(event.Object)
+			}
+		case <-w.stopped:
+			return
+		}
+	}
+}
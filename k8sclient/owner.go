@@ -0,0 +1,38 @@
+package k8sclient
+
+import (
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/types"
+)
+
+// ControllerReference provides the owner reference linking an object generated by the controller
+// to the parent object with the provided details, so Kubernetes garbage collection
+// removes the generated object when the parent disappears.
+func ControllerReference(apiVersion string, kind string, name string, uid types.UID) v1.OwnerReference {
+	controller := true
+	return v1.OwnerReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       name,
+		UID:        uid,
+		Controller: &controller,
+	}
+}
+
+// SetOwnerReference adds the provided owner reference to the provided object metadata,
+// replacing any existing reference to the same owner.
+// Lets us know whether the metadata has changed so callers can skip needless updates.
+func SetOwnerReference(meta *v1.ObjectMeta, ref v1.OwnerReference) bool {
+	for i, existing := range meta.OwnerReferences {
+		if existing.UID == ref.UID {
+			if existing.APIVersion == ref.APIVersion && existing.Kind == ref.Kind && existing.Name == ref.Name &&
+				existing.Controller != nil && ref.Controller != nil && *existing.Controller == *ref.Controller {
+				return false
+			}
+			meta.OwnerReferences[i] = ref
+			return true
+		}
+	}
+	meta.OwnerReferences = append(meta.OwnerReferences, ref)
+	return true
+}
@@ -0,0 +1,92 @@
+package k8sclient
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"k8s.io/client-go/pkg/api/errors"
+)
+
+const (
+	// The number of times an apiserver call is attempted before its error is given up on.
+	retryAttempts = 5
+	// The delay before the first retry, doubled for each retry after it.
+	retryInitialDelay = 200 * time.Millisecond
+	// The longest we'll wait between retries unless the apiserver asks us to wait longer.
+	retryMaxDelay = 10 * time.Second
+)
+
+// Retry runs the provided apiserver call, retrying it with exponential backoff when it fails
+// with a transient error such as the apiserver throttling us, a timeout or a dropped connection.
+// When the apiserver provides a Retry-After delay it's waited out instead of the backoff.
+// Any other error along with the error of the final attempt is returned as is.
+// Retries stop as soon as the provided context is done.
+func Retry(ctx context.Context, call func() error) error {
+	delay := retryInitialDelay
+	for attempt := 1; ; attempt++ {
+		err := doWithContext(ctx, call)
+		if err == nil || err == ctx.Err() || attempt == retryAttempts {
+			return err
+		}
+		wait, transient := retryDelay(err, delay)
+		if !transient {
+			return err
+		}
+		log.Printf("Retrying apiserver call in %v after transient error: %v", wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
+
+// Lets us know whether the provided error is transient and how long to wait
+// before retrying, the Retry-After delay of the apiserver takes precedence over the provided backoff delay.
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	if seconds, ok := errors.SuggestsClientDelay(err); ok && seconds > 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if status, ok := err.(errors.APIStatus); ok {
+		switch status.Status().Code {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return backoff, true
+		}
+		return backoff, errors.IsServerTimeout(err) || errors.IsTimeout(err)
+	}
+	return backoff, transientNetworkError(err)
+}
+
+// Lets us know whether the provided error is a timeout or a dropped connection
+// on the way to or from the apiserver.
+func transientNetworkError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if netErr, ok := err.(net.Error); ok && (netErr.Timeout() || netErr.Temporary()) {
+		return true
+	}
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if syscallErr, ok := err.(*os.SyscallError); ok {
+		err = syscallErr.Err
+	}
+	return err == syscall.ECONNRESET || err == syscall.ECONNREFUSED || err == syscall.EPIPE
+}
@@ -0,0 +1,47 @@
+package k8sclient
+
+import (
+	"context"
+
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+)
+
+// WatchSecrets deals with watching the secrets in the provided namespace
+// that match the provided label selector, resuming from the provided resource version.
+// The watch is stopped once the provided context is done.
+func (cli *Client) WatchSecrets(ctx context.Context, namespace string, selector labels.Selector, resourceVersion string) (watch.Interface, error) {
+	options := v1.ListOptions{
+		LabelSelector:   selector.String(),
+		ResourceVersion: resourceVersion,
+	}
+	return watchWithContext(ctx, func() (watch.Interface, error) {
+		return cli.Clientset.CoreV1().Secrets(namespace).Watch(options)
+	})
+}
+
+// ListSecrets retrieves the secrets in the provided namespace that match the provided label selector.
+func (cli *Client) ListSecrets(ctx context.Context, namespace string, selector labels.Selector) (*v1.SecretList, error) {
+	secrets := &v1.SecretList{}
+	err := listObjectsInChunks(ctx, cli.Clientset.CoreV1().RESTClient(), corePath("secrets", namespace), selector.String(), "",
+		func() runtime.Object { return &v1.SecretList{} },
+		func(list runtime.Object) error {
+			chunk := list.(*v1.SecretList)
+			secrets.ListMeta = chunk.ListMeta
+			secrets.Items = append(secrets.Items, chunk.Items...)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// NewSecretWatcher creates a watcher sharing changes to the secrets in the provided namespaces
+// that match the provided label selector with every controller that subscribes to it.
+// An empty list of namespaces watches every namespace.
+func (cli *Client) NewSecretWatcher(ctx context.Context, namespaces []string, selector labels.Selector) *ResourceWatcher {
+	return newNamespacesWatcher(ctx, cli.Clientset.CoreV1().RESTClient(), "secrets", namespaces, selector, &v1.Secret{})
+}
@@ -0,0 +1,62 @@
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/rest"
+)
+
+// UpdateStatus replaces the status of the provided object through the status subresource,
+// the update fails with a conflict when the object has changed since the resource version it carries.
+// Third party resources don't serve the status subresource so the whole object
+// is replaced instead when the apiserver doesn't know about it.
+func (c *DynamicClient) UpdateStatus(ctx context.Context, obj *Unstructured) (*Unstructured, error) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return c.withStatusFallback(ctx, func(subresources ...string) *rest.Request {
+		return c.restClient.Put().AbsPath(c.resource.objectPath(obj.Metadata.Namespace, obj.Metadata.Name, subresources...)).Body(body)
+	})
+}
+
+// PatchStatus sets the status of the object with the provided namespace and name to the provided status
+// with a JSON merge patch through the status subresource, falling back to patching the whole object
+// like UpdateStatus does.
+func (c *DynamicClient) PatchStatus(ctx context.Context, namespace string, name string, status interface{}) (*Unstructured, error) {
+	patch, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		return nil, err
+	}
+	return c.withStatusFallback(ctx, func(subresources ...string) *rest.Request {
+		return c.restClient.Patch(api.MergePatchType).AbsPath(c.resource.objectPath(namespace, name, subresources...)).Body(patch)
+	})
+}
+
+// Carries out the request built by the provided function against the status subresource,
+// the request is carried out against the object itself when the subresource isn't found.
+// When it's the object that isn't found the second request fails with not found too.
+func (c *DynamicClient) withStatusFallback(ctx context.Context, request func(subresources ...string) *rest.Request) (*Unstructured, error) {
+	obj, err := c.do(ctx, func() *rest.Request {
+		return request("status")
+	})
+	if err == nil || !errors.IsNotFound(err) {
+		return obj, err
+	}
+	return c.do(ctx, func() *rest.Request {
+		return request()
+	})
+}
+
+// Provides the path of the object with the provided namespace and name,
+// followed by the provided subresources.
+func (r GroupVersionResource) objectPath(namespace string, name string, subresources ...string) string {
+	path := r.path(namespace) + "/" + name
+	for _, subresource := range subresources {
+		path += "/" + subresource
+	}
+	return path
+}
@@ -0,0 +1,153 @@
+package k8sclient
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/pkg/fields"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ResourceWatcher keeps an informer cache of one type of object and delivers
+// every change to the controllers that have subscribed to it, so features that need
+// to react to the same objects share a single watch instead of each rolling their own.
+type ResourceWatcher struct {
+	store       cache.Store
+	controller  *cache.Controller
+	mu          sync.RWMutex
+	subscribers []func(evType watch.EventType, old interface{}, obj interface{})
+	running     bool
+	// Lets us know whether an update changes anything subscribers care about, nil when they care about every update.
+	changed func(old interface{}, new interface{}) bool
+	// Lets us know whether subscribers care about an object at all, nil when they care about every object.
+	include func(obj interface{}) bool
+}
+
+// Creates a new instance of a resource watcher for the provided resource, namespace and selector.
+func newResourceWatcher(ctx context.Context, c cache.Getter, resource string, namespace string,
+	selector labels.Selector, objType runtime.Object) *ResourceWatcher {
+	return newResourceWatcherFromSource(NewListWatchFromClient(ctx, c, resource, namespace, selector, fields.Everything()), objType)
+}
+
+// Creates a new instance of a resource watcher for the provided resource and selector across the provided namespaces,
+// an empty list of namespaces watches every namespace.
+func newNamespacesWatcher(ctx context.Context, c cache.Getter, resource string, namespaces []string,
+	selector labels.Selector, objType runtime.Object) *ResourceWatcher {
+	return newResourceWatcherFromSource(NamespacesListWatch(namespaces, func(namespace string) *cache.ListWatch {
+		return NewListWatchFromClient(ctx, c, resource, namespace, selector, fields.Everything())
+	}), objType)
+}
+
+// Creates a new instance of a resource watcher for the objects listed and watched by the provided source.
+// Objects moving in or out of what subscribers care about are delivered as added or deleted.
+func newResourceWatcherFromSource(source *cache.ListWatch, objType runtime.Object) *ResourceWatcher {
+	w := &ResourceWatcher{}
+	w.store, w.controller = cache.NewInformer(source, objType, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if w.includes(obj) {
+				w.notify(watch.Added, nil, obj)
+			}
+		},
+		UpdateFunc: func(old, new interface{}) {
+			oldIncluded, newIncluded := w.includes(old), w.includes(new)
+			switch {
+			case oldIncluded && newIncluded:
+				if w.changed == nil || w.changed(old, new) {
+					w.notify(watch.Modified, old, new)
+				}
+			case newIncluded:
+				w.notify(watch.Added, nil, new)
+			case oldIncluded:
+				w.notify(watch.Deleted, nil, old)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if w.includes(obj) {
+				w.notify(watch.Deleted, nil, obj)
+			}
+		},
+	})
+	return w
+}
+
+// Subscribe registers the provided function to be called with every change to the watched objects,
+// the function is called synchronously so it should hand the change off rather than process it.
+// Subscribers registered once the watcher is running are first called with every object already
+// in the cache as added, so subscribers that come along later don't miss any objects either.
+func (w *ResourceWatcher) Subscribe(fn func(evType watch.EventType, obj interface{})) {
+	w.SubscribeChanges(func(evType watch.EventType, old interface{}, obj interface{}) {
+		fn(evType, obj)
+	})
+}
+
+// SubscribeChanges registers the provided function like Subscribe, modified objects are delivered along with
+// the object they replace so subscribers can react to what has changed, old is nil for other events.
+func (w *ResourceWatcher) SubscribeChanges(fn func(evType watch.EventType, old interface{}, obj interface{})) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running {
+		for _, obj := range w.store.List() {
+			if w.includes(obj) {
+				fn(watch.Added, nil, obj)
+			}
+		}
+	}
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Run starts watching the objects until the provided done channel is closed
+// and blocks until the initial list of objects has been loaded into the cache.
+func (w *ResourceWatcher) Run(done <-chan struct{}) {
+	w.mu.Lock()
+	w.running = true
+	w.mu.Unlock()
+	go w.controller.Run(done)
+	for !w.controller.HasSynced() {
+		select {
+		case <-done:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// HasSynced lets us know whether the initial list of objects has been loaded into the cache.
+func (w *ResourceWatcher) HasSynced() bool {
+	return w.controller.HasSynced()
+}
+
+// Store provides the informer cache of the watched objects.
+func (w *ResourceWatcher) Store() cache.Store {
+	return w.store
+}
+
+// Get retrieves the watched object with the provided namespace and name from the cache.
+func (w *ResourceWatcher) Get(namespace string, name string) (interface{}, bool) {
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+	obj, exists, err := w.store.GetByKey(key)
+	if err != nil {
+		log.Printf("Error retrieving %v from the informer cache: %v", key, err)
+		return nil, false
+	}
+	return obj, exists
+}
+
+func (w *ResourceWatcher) includes(obj interface{}) bool {
+	return w.include == nil || w.include(obj)
+}
+
+func (w *ResourceWatcher) notify(evType watch.EventType, old interface{}, obj interface{}) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, fn := range w.subscribers {
+		fn(evType, old, obj)
+	}
+}
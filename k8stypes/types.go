@@ -14,3 +14,9 @@ type ServiceUpdateEvent struct {
 	Old v1.Service `json:"old"`
 	New v1.Service `json:"new"`
 }
+
+// SecretEvent provides the event recieved for secret watchers.
+type SecretEvent struct {
+	Type   string    `json:"type"`
+	Object v1.Secret `json:"object"`
+}
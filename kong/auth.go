@@ -0,0 +1,35 @@
+package kong
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/freshwebio/k8s-kong-api/redact"
+)
+
+// AdminTokenHeader provides the header Kong Enterprise admin apis with RBAC enabled read the token
+// of the RBAC user making the request from.
+const AdminTokenHeader = "Kong-Admin-Token"
+
+// SetHeader makes the client send the header with the provided name and value with every request,
+// e.g. the apikey of a kong admin api protected by key-auth. The value is masked in logs.
+func (c *Client) SetHeader(name string, value string) {
+	if c.headers == nil {
+		c.headers = make(http.Header)
+	}
+	c.headers.Set(name, value)
+	redact.AddValue(value)
+}
+
+// SetBasicAuth makes the client authenticate every request with the provided username and password,
+// for kong admin apis protected by basic-auth.
+func (c *Client) SetBasicAuth(username string, password string) {
+	redact.AddValue(password)
+	c.SetHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+}
+
+// SetAdminToken makes the client send the provided RBAC user token with every request,
+// for Kong Enterprise admin apis with RBAC enabled.
+func (c *Client) SetAdminToken(token string) {
+	c.SetHeader(AdminTokenHeader, token)
+}
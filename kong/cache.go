@@ -0,0 +1,110 @@
+package kong
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// The kinds of kong objects held in the read cache.
+const (
+	apiKind      = "api"
+	upstreamKind = "upstream"
+	pluginsKind  = "plugins"
+)
+
+// Provides a read-through cache of the kong objects looked up on the hot path, entries expire
+// after the ttl and every entry of a kind is dropped on any write to an object of that kind
+// so objects can be looked up by either their name or id without going stale.
+// Lookups of objects that don't exist are cached too as they are just as frequent.
+type readCache struct {
+	ttl         time.Duration
+	mu          sync.Mutex
+	entries     map[string]cacheEntry
+	generations map[string]int
+}
+
+type cacheEntry struct {
+	value   interface{}
+	err     error
+	expires time.Time
+}
+
+// EnableCache makes GetAPI, GetUpstream and ListApiPlugins serve repeated lookups from memory
+// for the provided TTL instead of going to the kong admin api every time, this keeps the existence
+// checks made while working through a burst of events off kong.
+// Any write made through the client drops the cached objects it could have changed.
+// A TTL of 0 disables the cache.
+func (c *Client) EnableCache(ttl time.Duration) {
+	if ttl <= 0 {
+		c.cache = nil
+		return
+	}
+	c.cache = &readCache{ttl: ttl, entries: make(map[string]cacheEntry), generations: make(map[string]int)}
+}
+
+// Provides the cached result of the lookup for the object of the provided kind and key,
+// the lookup is carried out with the provided function when there's no fresh result.
+// Only successful lookups and lookups of objects that don't exist are cached.
+func (c *Client) cached(kind string, key string, lookup func() (interface{}, error)) (interface{}, error) {
+	if c.cache == nil {
+		return lookup()
+	}
+	entry, generation, exists := c.cache.get(kind, key)
+	if exists {
+		return entry.value, entry.err
+	}
+	value, err := lookup()
+	if err == nil || err == ErrNotFound {
+		c.cache.put(kind, key, generation, cacheEntry{value: value, err: err, expires: time.Now().Add(c.cache.ttl)})
+	}
+	return value, err
+}
+
+// Drops every cached object of the provided kinds.
+func (c *Client) invalidate(kinds ...string) {
+	if c.cache == nil {
+		return
+	}
+	c.cache.drop(kinds)
+}
+
+// Provides the fresh entry for the object of the provided kind and key along with the current
+// generation of the kind, which has to be handed back when caching the result of a lookup.
+func (r *readCache) get(kind string, key string) (cacheEntry, int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, exists := r.entries[kind+"/"+key]
+	if exists && time.Now().After(entry.expires) {
+		delete(r.entries, kind+"/"+key)
+		exists = false
+	}
+	return entry, r.generations[kind], exists
+}
+
+// Caches the provided entry unless objects of the provided kind have been written to
+// since the provided generation, as the lookup could have raced with the write.
+func (r *readCache) put(kind string, key string, generation int, entry cacheEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generations[kind] != generation {
+		return
+	}
+	r.entries[kind+"/"+key] = entry
+}
+
+func (r *readCache) drop(kinds []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, kind := range kinds {
+		r.generations[kind]++
+	}
+	for key := range r.entries {
+		for _, kind := range kinds {
+			if strings.HasPrefix(key, kind+"/") {
+				delete(r.entries, key)
+				break
+			}
+		}
+	}
+}
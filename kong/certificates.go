@@ -0,0 +1,82 @@
+package kong
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	certificatesEndpoint = "/certificates/"
+	snisEndpoint         = "/snis/"
+)
+
+// CreateCertificate creates a new certificate in kong.
+func (c *Client) CreateCertificate(ctx context.Context, certificate *Certificate) (*Certificate, error) {
+	created := &Certificate{}
+	if err := c.send(ctx, "POST", certificatesEndpoint, "create certificate", certificate, created, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetCertificate retrieves the certificate with the provided id.
+func (c *Client) GetCertificate(ctx context.Context, id string) (*Certificate, error) {
+	certificate := &Certificate{}
+	if err := c.send(ctx, "GET", certificatesEndpoint+id, "get the "+id+" certificate", nil, certificate, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+// UpdateCertificate replaces the certificate and private key of the certificate with the ID of the provided certificate.
+func (c *Client) UpdateCertificate(ctx context.Context, certificate *Certificate) (*Certificate, error) {
+	payload := &Certificate{Cert: certificate.Cert, Key: certificate.Key}
+	updated := &Certificate{}
+	err := c.send(ctx, "PATCH", certificatesEndpoint+certificate.ID, "update the "+certificate.ID+" certificate", payload, updated, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteCertificate removes the certificate with the provided id, kong removes the SNIs referencing it along with it.
+func (c *Client) DeleteCertificate(ctx context.Context, id string) error {
+	return c.send(ctx, "DELETE", certificatesEndpoint+id, "delete the "+id+" certificate", nil, nil, http.StatusNoContent)
+}
+
+// ListSNIs retrieves every SNI in kong, following the pages
+// of the listing until all of them have been retrieved.
+func (c *Client) ListSNIs(ctx context.Context) ([]*SNI, error) {
+	snis := []*SNI{}
+	offset := ""
+	for {
+		page := &SNIList{}
+		if err := c.send(ctx, "GET", snisEndpoint+pageQuery(offset), "list snis", nil, page, http.StatusOK); err != nil {
+			return nil, err
+		}
+		snis = append(snis, page.Data...)
+		if page.Offset == "" || len(page.Data) == 0 {
+			return snis, nil
+		}
+		offset = page.Offset
+	}
+}
+
+// CreateSNI creates a new SNI serving the certificate with the provided id for the host name of the provided SNI,
+// the certificate is referenced the way the version of kong written to expects.
+func (c *Client) CreateSNI(ctx context.Context, name string, certificateID string) (*SNI, error) {
+	sni := &SNI{Name: name, SSLCertificateID: certificateID}
+	if c.certificateRefs {
+		sni = &SNI{Name: name, Certificate: &CertificateID{ID: certificateID}}
+	}
+	created := &SNI{}
+	if err := c.send(ctx, "POST", snisEndpoint, "create the "+name+" sni", sni, created, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// DeleteSNI removes the SNI with the provided name.
+func (c *Client) DeleteSNI(ctx context.Context, name string) error {
+	return c.send(ctx, "DELETE", snisEndpoint+name, "delete the "+name+" sni", nil, nil, http.StatusNoContent)
+}
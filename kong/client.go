@@ -2,12 +2,17 @@ package kong
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+
+	"github.com/freshwebio/k8s-kong-api/redact"
 )
 
 const (
@@ -15,33 +20,87 @@ const (
 	upstreamsEndpoint = "/upstreams/"
 	pluginsEndpoint   = "/plugins/"
 	targetsEndpoint   = "/targets"
+	statusEndpoint    = "/status"
 )
 
 var (
 	// ErrNotFound provides the error when a kong object can't be retrieved.
 	ErrNotFound = errors.New("Failed to find the specified kong object")
+	// ErrTargetDeletesUnsupported provides the error when a target entry is deleted from kong before 1.0,
+	// where deleting a target only adds another entry with a weight of 0 to its history.
+	ErrTargetDeletesUnsupported = errors.New("Target entries can't be deleted from kong before 1.0")
 )
 
 // Client provides a client for interacting
 // with the kong API gateway application.
 type Client struct {
-	host   string
-	port   string
-	client *http.Client
+	host      string
+	port      string
+	client    *http.Client
+	slowStart *slowStart
+	cache     *readCache
+	services  bool
+	// The weight targets are registered with once they are fully enabled.
+	targetWeight int
+	// The headers sent with every request, e.g. to authenticate to the kong admin api.
+	headers http.Header
+	// How the kong admin api is reached, see ConfigureHTTP, ConfigureTLS and UseSocket.
+	httpOptions HTTPOptions
+	tlsConfig   *tls.Config
+	socket      string
+	// Whether SNIs reference their certificate as an object like kong 1.0 and later expect.
+	certificateRefs bool
+	// Whether target entries can be deleted from the target history of upstreams like kong 1.0 and later allow.
+	targetDeletes bool
 }
 
 // NewClient creates a new instance
 // of the kong client.
+// The client starts out with the DefaultHTTPOptions.
 func NewClient(host string, port string, scheme string) *Client {
-	return &Client{host: scheme + host, port: port, client: http.DefaultClient}
+	c := &Client{host: scheme + host, port: port, targetWeight: fullTargetWeight, httpOptions: DefaultHTTPOptions}
+	c.resetTransport()
+	return c
+}
+
+// UnreachableError provides the error when a request can't be made to the kong admin api at all,
+// as opposed to kong responding with an error.
+type UnreachableError struct {
+	Err error
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("Failed to reach the kong admin api: %v", e.Err)
+}
+
+// Sends the provided request to the kong admin api, wrapping any failure
+// to reach it in an UnreachableError. Writes are counted in the kong operation metrics.
+// The headers set with SetHeader are added to every request.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		recordOperation(req, "unreachable")
+		return nil, &UnreachableError{Err: err}
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		recordOperation(req, "failure")
+	} else {
+		recordOperation(req, "success")
+	}
+	return resp, nil
 }
 
 // Helper method to setting headers for every request.
-func newRequest(method string, url string, body io.Reader) (*http.Request, error) {
+// The request is abandoned once the provided context is done.
+func newRequest(ctx context.Context, method string, url string, body io.Reader) (*http.Request, error) {
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return req, err
 	}
+	req = req.WithContext(ctx)
 	if method == "POST" || method == "PUT" || method == "PATCH" {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -49,22 +108,27 @@ func newRequest(method string, url string, body io.Reader) (*http.Request, error
 }
 
 // CreateAPI creates a new API in kong.
-func (c *Client) CreateAPI(api *API) (*API, error) {
+func (c *Client) CreateAPI(ctx context.Context, api *API) (*API, error) {
+	defer c.invalidate(apiKind)
+	if c.services {
+		return c.createServiceAPI(ctx, api)
+	}
 	b := new(bytes.Buffer)
 	err := json.NewEncoder(b).Encode(api)
 	if err != nil {
 		return nil, err
 	}
 	log.Printf("\nMaking request to the kong admin api (%v) to create API with payload:\n%v\n",
-		c.host+":"+c.port, string(b.Bytes()))
-	req, err := newRequest("POST", c.host+":"+c.port+apisEndpoint, b)
+		c.host+":"+c.port, redact.JSON(b.Bytes()))
+	req, err := newRequest(ctx, "POST", c.host+":"+c.port+apisEndpoint, b)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	var createdAPI *API
 	if resp.StatusCode != http.StatusCreated {
 		return nil, fmt.Errorf("Failed to create the specified API with status code %v", resp.StatusCode)
@@ -77,17 +141,32 @@ func (c *Client) CreateAPI(api *API) (*API, error) {
 }
 
 // GetAPI retrieves an API by it's name or id.
-func (c *Client) GetAPI(nameOrID string) (*API, error) {
+func (c *Client) GetAPI(ctx context.Context, nameOrID string) (*API, error) {
+	api, err := c.cached(apiKind, nameOrID, func() (interface{}, error) {
+		return c.getAPI(ctx, nameOrID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	copied := *api.(*API)
+	return &copied, nil
+}
+
+func (c *Client) getAPI(ctx context.Context, nameOrID string) (*API, error) {
+	if c.services {
+		return c.getServiceAPI(ctx, nameOrID)
+	}
 	log.Printf("\nMaking request to the kong admin api (%v) to get the %v API\n",
 		c.host+":"+c.port, nameOrID)
-	req, err := newRequest("GET", c.host+":"+c.port+apisEndpoint+nameOrID, nil)
+	req, err := newRequest(ctx, "GET", c.host+":"+c.port+apisEndpoint+nameOrID, nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, ErrNotFound
 	} else if resp.StatusCode != http.StatusOK {
@@ -101,10 +180,54 @@ func (c *Client) GetAPI(nameOrID string) (*API, error) {
 	return api, nil
 }
 
+// ListAPIs retrieves every API object in kong, following the pages
+// of the listing until all of them have been retrieved.
+func (c *Client) ListAPIs(ctx context.Context) ([]*API, error) {
+	if c.services {
+		return c.listServiceAPIs(ctx)
+	}
+	log.Printf("\nMaking request to the kong admin api (%v) to list all APIs\n", c.host+":"+c.port)
+	apis := []*API{}
+	offset := ""
+	for {
+		endpoint := c.host + ":" + c.port + apisEndpoint + "?size=100"
+		if offset != "" {
+			endpoint += "&offset=" + url.QueryEscape(offset)
+		}
+		req, err := newRequest(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Failed to list the APIs with status code %v", resp.StatusCode)
+		}
+		page := &APIList{}
+		err = json.NewDecoder(resp.Body).Decode(page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		apis = append(apis, page.Data...)
+		if page.Offset == "" || len(page.Data) == 0 {
+			return apis, nil
+		}
+		offset = page.Offset
+	}
+}
+
 // UpdateAPI deals with updating the provided API
 // assuming an API exists with the provided ID or name
 // if it doesn't exist.
-func (c *Client) UpdateAPI(api *API) (*API, error) {
+func (c *Client) UpdateAPI(ctx context.Context, api *API) (*API, error) {
+	defer c.invalidate(apiKind, pluginsKind)
+	if c.services {
+		return c.updateServiceAPI(ctx, api)
+	}
 	b := new(bytes.Buffer)
 	err := json.NewEncoder(b).Encode(api)
 	if err != nil {
@@ -117,15 +240,16 @@ func (c *Client) UpdateAPI(api *API) (*API, error) {
 		nameOrID = api.Name
 	}
 	log.Printf("\nMaking request to the kong admin api (%v) to update the %v API with payload:\n%v\n",
-		c.host+":"+c.port, nameOrID, string(b.Bytes()))
-	req, err := newRequest("PUT", c.host+":"+c.port+apisEndpoint+nameOrID, b)
+		c.host+":"+c.port, nameOrID, redact.JSON(b.Bytes()))
+	req, err := newRequest(ctx, "PUT", c.host+":"+c.port+apisEndpoint+nameOrID, b)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, ErrNotFound
 	} else if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
@@ -140,17 +264,22 @@ func (c *Client) UpdateAPI(api *API) (*API, error) {
 }
 
 // DeleteAPI deals with removing the specified API.
-func (c *Client) DeleteAPI(nameOrID string) error {
+func (c *Client) DeleteAPI(ctx context.Context, nameOrID string) error {
+	defer c.invalidate(apiKind, pluginsKind)
+	if c.services {
+		return c.deleteServiceAPI(ctx, nameOrID)
+	}
 	log.Printf("\nMaking request to the kong admin api (%v) to delete the %v API\n",
 		c.host+":"+c.port, nameOrID)
-	req, err := newRequest("DELETE", c.host+":"+c.port+apisEndpoint+nameOrID, nil)
+	req, err := newRequest(ctx, "DELETE", c.host+":"+c.port+apisEndpoint+nameOrID, nil)
 	if err != nil {
 		return err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
 		return ErrNotFound
 	} else if resp.StatusCode != http.StatusNoContent {
@@ -161,22 +290,24 @@ func (c *Client) DeleteAPI(nameOrID string) error {
 
 // CreateUpstream deals with creating a new upstream object
 // which can be referenced by an API as an upstream URL.
-func (c *Client) CreateUpstream(upstream *Upstream) (*Upstream, error) {
+func (c *Client) CreateUpstream(ctx context.Context, upstream *Upstream) (*Upstream, error) {
+	defer c.invalidate(upstreamKind)
 	b := new(bytes.Buffer)
 	err := json.NewEncoder(b).Encode(upstream)
 	if err != nil {
 		return nil, err
 	}
 	log.Printf("\nMaking request to the kong admin api (%v) to create upstream with payload:\n%v\n",
-		c.host+":"+c.port, string(b.Bytes()))
-	req, err := newRequest("POST", c.host+":"+c.port+upstreamsEndpoint, b)
+		c.host+":"+c.port, redact.JSON(b.Bytes()))
+	req, err := newRequest(ctx, "POST", c.host+":"+c.port+upstreamsEndpoint, b)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusCreated {
 		return nil, fmt.Errorf("Failed to create the specified upstream with status code %v", resp.StatusCode)
 	}
@@ -190,17 +321,29 @@ func (c *Client) CreateUpstream(upstream *Upstream) (*Upstream, error) {
 
 // GetUpstream deals with retrieving the upstream
 // with the specified name or ID.
-func (c *Client) GetUpstream(nameOrId string) (*Upstream, error) {
+func (c *Client) GetUpstream(ctx context.Context, nameOrId string) (*Upstream, error) {
+	upstream, err := c.cached(upstreamKind, nameOrId, func() (interface{}, error) {
+		return c.getUpstream(ctx, nameOrId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	copied := *upstream.(*Upstream)
+	return &copied, nil
+}
+
+func (c *Client) getUpstream(ctx context.Context, nameOrId string) (*Upstream, error) {
 	log.Printf("\nMaking request to the kong admin api (%v) to get the %v upstream\n",
 		c.host+":"+c.port, nameOrId)
-	req, err := newRequest("GET", c.host+":"+c.port+upstreamsEndpoint+nameOrId, nil)
+	req, err := newRequest(ctx, "GET", c.host+":"+c.port+upstreamsEndpoint+nameOrId, nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, ErrNotFound
 	} else if resp.StatusCode != http.StatusOK {
@@ -216,17 +359,19 @@ func (c *Client) GetUpstream(nameOrId string) (*Upstream, error) {
 
 // DeleteUpstream deals with removing the upstream
 // object with the specified name or ID.
-func (c *Client) DeleteUpstream(nameOrId string) error {
+func (c *Client) DeleteUpstream(ctx context.Context, nameOrId string) error {
+	defer c.invalidate(upstreamKind)
 	log.Printf("\nMaking request to the kong admin api (%v) to delete the %v upstream\n",
 		c.host+":"+c.port, nameOrId)
-	req, err := newRequest("DELETE", c.host+":"+c.port+upstreamsEndpoint+nameOrId, nil)
+	req, err := newRequest(ctx, "DELETE", c.host+":"+c.port+upstreamsEndpoint+nameOrId, nil)
 	if err != nil {
 		return err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
 		return ErrNotFound
 	} else if resp.StatusCode != http.StatusNoContent {
@@ -236,7 +381,8 @@ func (c *Client) DeleteUpstream(nameOrId string) error {
 }
 
 // UpdateUpstream deals with updating the specified upstream.
-func (c *Client) UpdateUpstream(upstream *Upstream) (*Upstream, error) {
+func (c *Client) UpdateUpstream(ctx context.Context, upstream *Upstream) (*Upstream, error) {
+	defer c.invalidate(upstreamKind)
 	var nameOrId string
 	if upstream.ID != "" {
 		nameOrId = upstream.ID
@@ -249,15 +395,16 @@ func (c *Client) UpdateUpstream(upstream *Upstream) (*Upstream, error) {
 		return nil, err
 	}
 	log.Printf("\nMaking request to the kong admin api (%v) to update the %v upstream with payload:\n%v\n",
-		c.host+":"+c.port, nameOrId, string(b.Bytes()))
-	req, err := newRequest("PUT", c.host+":"+c.port+apisEndpoint+nameOrId, b)
+		c.host+":"+c.port, nameOrId, redact.JSON(b.Bytes()))
+	req, err := newRequest(ctx, "PUT", c.host+":"+c.port+apisEndpoint+nameOrId, b)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, ErrNotFound
 	} else if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
@@ -273,22 +420,23 @@ func (c *Client) UpdateUpstream(upstream *Upstream) (*Upstream, error) {
 
 // CreateTarget deals with adding a new target
 // to an existing upstream.
-func (c *Client) CreateTarget(upstreamNameOrId string, target *Target) (*Target, error) {
+func (c *Client) CreateTarget(ctx context.Context, upstreamNameOrId string, target *Target) (*Target, error) {
 	b := new(bytes.Buffer)
 	err := json.NewEncoder(b).Encode(target)
 	if err != nil {
 		return nil, err
 	}
 	log.Printf("\nMaking request to the kong admin api (%v) to create target for the %v upstream with payload:\n%v\n",
-		c.host+":"+c.port, upstreamNameOrId, string(b.Bytes()))
-	req, err := newRequest("POST", c.host+":"+c.port+upstreamsEndpoint+upstreamNameOrId+targetsEndpoint, b)
+		c.host+":"+c.port, upstreamNameOrId, redact.JSON(b.Bytes()))
+	req, err := newRequest(ctx, "POST", c.host+":"+c.port+upstreamsEndpoint+upstreamNameOrId+targetsEndpoint, b)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusCreated {
 		return nil, fmt.Errorf("Failed to create the specified target for the specified upstream with status code %v", resp.StatusCode)
 	}
@@ -301,44 +449,88 @@ func (c *Client) CreateTarget(upstreamNameOrId string, target *Target) (*Target,
 }
 
 // ListTargets lists out all the targets for a specified
-// upstream.
-func (c *Client) ListTargets(upstreamNameOrId string) (*TargetList, error) {
+// upstream, following the pages of the target history
+// until every entry has been retrieved.
+func (c *Client) ListTargets(ctx context.Context, upstreamNameOrId string) (*TargetList, error) {
 	log.Printf("\nMaking request to the kong admin api (%v) to list targets for the %v upstream\n",
 		c.host+":"+c.port, upstreamNameOrId)
-	req, err := newRequest("GET", c.host+":"+c.port+upstreamsEndpoint+upstreamNameOrId+targetsEndpoint, nil)
-	if err != nil {
-		return nil, err
+	targetList := &TargetList{Data: []*Target{}}
+	offset := ""
+	for {
+		endpoint := c.host + ":" + c.port + upstreamsEndpoint + upstreamNameOrId + targetsEndpoint + "?size=100"
+		if offset != "" {
+			endpoint += "&offset=" + url.QueryEscape(offset)
+		}
+		req, err := newRequest(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil, ErrNotFound
+		} else if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Failed to retrieve the list of targets for the provided upstream with status code %v", resp.StatusCode)
+		}
+		page := &TargetList{}
+		err = json.NewDecoder(resp.Body).Decode(page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		targetList.Data = append(targetList.Data, page.Data...)
+		if page.Offset == "" || len(page.Data) == 0 {
+			targetList.Total = len(targetList.Data)
+			return targetList, nil
+		}
+		offset = page.Offset
 	}
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, err
+}
+
+// DisableTarget creates a new target with the specified host with a weight of 0.
+// Any slow start ramp in progress for the target is cancelled.
+func (c *Client) DisableTarget(ctx context.Context, upstreamNameOrId string, targetHost string) (*Target, error) {
+	if c.slowStart != nil {
+		c.slowStart.cancel(upstreamNameOrId, targetHost)
 	}
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, ErrNotFound
-	} else if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Failed to retrieve the list of targets for the provided upstream with status code %v", resp.StatusCode)
+	return c.newTargetEntry(ctx, upstreamNameOrId, targetHost, 0)
+}
+
+// EnableTarget creates a new upstream with the weight set to the target weight, 10 unless SetDefaults says otherwise,
+// so the load balancer takes the upstream target into account. (Upstreams use history for targets so the latest created
+// target gets used) When slow start is enabled the target is created with the initial slow start weight instead
+// and ramped up to the target weight in the background, with every step of the ramp waiting on the provided function.
+func (c *Client) EnableTarget(ctx context.Context, upstreamNameOrId string, targetHost string, wait RampWait) (*Target, error) {
+	s := c.slowStart
+	if s == nil {
+		return c.newTargetEntry(ctx, upstreamNameOrId, targetHost, c.targetWeight)
+	}
+	initialWeight := s.initialWeight
+	if initialWeight > c.targetWeight {
+		initialWeight = c.targetWeight
 	}
-	var targetList *TargetList
-	err = json.NewDecoder(resp.Body).Decode(&targetList)
+	cancel := s.begin(upstreamNameOrId, targetHost)
+	target, err := c.newTargetEntry(ctx, upstreamNameOrId, targetHost, initialWeight)
 	if err != nil {
+		s.finish(upstreamNameOrId, targetHost, cancel)
 		return nil, err
 	}
-	return targetList, nil
+	go c.rampTarget(s, upstreamNameOrId, targetHost, initialWeight, wait, cancel)
+	return target, nil
 }
 
-// DisableTarget creates a new target with the specified host with a weight of 0.
-func (c *Client) DisableTarget(upstreamNameOrId string, targetHost string) (*Target, error) {
-	return c.newTargetEntry(upstreamNameOrId, targetHost, 0)
-}
-
-// EnableTarget creates a new upstream with the weight set to 10 so the load balancer takes
-// the upstream target into account. (Upstreams use history for targets so the latest created target gets used)
-func (c *Client) EnableTarget(upstreamNameOrId string, targetHost string) (*Target, error) {
-	return c.newTargetEntry(upstreamNameOrId, targetHost, 10)
+// TargetWeight provides the weight targets end up with once they are fully enabled,
+// a target with a lower weight is either disabled or part way through its slow start.
+func (c *Client) TargetWeight() int {
+	return c.targetWeight
 }
 
 // Creates a new kong target object with the provided weight.
-func (c *Client) newTargetEntry(upstreamNameOrId string, targetHost string, weight int) (*Target, error) {
+func (c *Client) newTargetEntry(ctx context.Context, upstreamNameOrId string, targetHost string, weight int) (*Target, error) {
 	target := &Target{
 		Target: targetHost,
 		Weight: weight,
@@ -350,15 +542,16 @@ func (c *Client) newTargetEntry(upstreamNameOrId string, targetHost string, weig
 	}
 	log.Printf("\nMaking request to the kong admin api (%v) to create a new target entry (enable or disable) "+
 		"for the %v upstream with payload:\n%v\n",
-		c.host+":"+c.port, upstreamNameOrId, string(b.Bytes()))
-	req, err := newRequest("POST", c.host+":"+c.port+upstreamsEndpoint+upstreamNameOrId+targetsEndpoint, b)
+		c.host+":"+c.port, upstreamNameOrId, redact.JSON(b.Bytes()))
+	req, err := newRequest(ctx, "POST", c.host+":"+c.port+upstreamsEndpoint+upstreamNameOrId+targetsEndpoint, b)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, ErrNotFound
 	} else if resp.StatusCode != http.StatusCreated {
@@ -372,17 +565,66 @@ func (c *Client) newTargetEntry(upstreamNameOrId string, targetHost string, weig
 	return createdTarget, nil
 }
 
-func (c *Client) ListApiPlugins(apiName string) (*PluginList, error) {
+// DeletesTargets lets us know whether target entries can be deleted from the target history of upstreams,
+// which only kong 1.0 and later can do. Deleting a target with earlier versions adds an entry with a weight of 0 instead.
+func (c *Client) DeletesTargets() bool {
+	return c.targetDeletes
+}
+
+// DeleteTarget removes the target entry with the provided id from the target history of the specified upstream.
+// Only kong 1.0 and later can remove target entries, ErrTargetDeletesUnsupported is returned for earlier versions.
+func (c *Client) DeleteTarget(ctx context.Context, upstreamNameOrId string, id string) error {
+	if !c.targetDeletes {
+		return ErrTargetDeletesUnsupported
+	}
+	log.Printf("\nMaking request to the kong admin api (%v) to delete the %v target entry of the %v upstream\n",
+		c.host+":"+c.port, id, upstreamNameOrId)
+	req, err := newRequest(ctx, "DELETE", c.host+":"+c.port+upstreamsEndpoint+upstreamNameOrId+targetsEndpoint+"/"+id, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	} else if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("Failed to delete the target entry with the provided id with status code %v", resp.StatusCode)
+	}
+	return nil
+}
+
+// ListApiPlugins retrieves the plugins attached to the API with the provided name.
+func (c *Client) ListApiPlugins(ctx context.Context, apiName string) (*PluginList, error) {
+	plugins, err := c.cached(pluginsKind, apiName, func() (interface{}, error) {
+		return c.listApiPlugins(ctx, apiName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cachedList := plugins.(*PluginList)
+	copied := &PluginList{Total: cachedList.Total, Data: make([]*Plugin, 0, len(cachedList.Data))}
+	for _, plugin := range cachedList.Data {
+		p := *plugin
+		copied.Data = append(copied.Data, &p)
+	}
+	return copied, nil
+}
+
+func (c *Client) listApiPlugins(ctx context.Context, apiName string) (*PluginList, error) {
 	plugins := &PluginList{}
 	log.Printf("\nMaking request to the kong admin api (%v) to retrieve plugins for the %v api", c.host+":"+c.port, apiName)
-	req, err := newRequest("GET", c.host+":"+c.port+apisEndpoint+apiName+pluginsEndpoint, nil)
+	req, err := newRequest(ctx, "GET", c.host+":"+c.port+c.pluginParentsEndpoint()+apiName+pluginsEndpoint, nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("Failed to retrieve plugins for the %v api with status code %v", apiName, resp.StatusCode)
 	}
@@ -396,9 +638,9 @@ func (c *Client) ListApiPlugins(apiName string) (*PluginList, error) {
 
 // APIHasPlugin lets us know whether the provided API has an instance
 // of the provided plugin type.
-func (c *Client) APIHasPlugin(apiName string, pluginName string) (bool, error) {
+func (c *Client) APIHasPlugin(ctx context.Context, apiName string, pluginName string) (bool, error) {
 	hasPlugin := false
-	_, err := c.GetAPI(apiName)
+	_, err := c.GetAPI(ctx, apiName)
 	if err != nil {
 		// If the API doesn't exist we'll simply return false.
 		if err == ErrNotFound {
@@ -406,7 +648,7 @@ func (c *Client) APIHasPlugin(apiName string, pluginName string) (bool, error) {
 		}
 		return hasPlugin, err
 	}
-	plugins, err := c.ListApiPlugins(apiName)
+	plugins, err := c.ListApiPlugins(ctx, apiName)
 	if err != nil {
 		return hasPlugin, err
 	}
@@ -422,7 +664,8 @@ func (c *Client) APIHasPlugin(apiName string, pluginName string) (bool, error) {
 }
 
 // AddPlugin deals with adding the provided plugin definition to the specified API.
-func (c *Client) AddPlugin(apiName string, plugin *Plugin) error {
+func (c *Client) AddPlugin(ctx context.Context, apiName string, plugin *Plugin) error {
+	defer c.invalidate(pluginsKind)
 	b := new(bytes.Buffer)
 	err := json.NewEncoder(b).Encode(plugin)
 	if err != nil {
@@ -430,14 +673,15 @@ func (c *Client) AddPlugin(apiName string, plugin *Plugin) error {
 	}
 	log.Printf("\nMaking request to the kong admin api (%v) to create a new plugin for the %v kong API\n",
 		c.host+":"+c.port, apiName)
-	req, err := newRequest("POST", c.host+":"+c.port+apisEndpoint+apiName+pluginsEndpoint, b)
+	req, err := newRequest(ctx, "POST", c.host+":"+c.port+c.pluginParentsEndpoint()+apiName+pluginsEndpoint, b)
 	if err != nil {
 		return err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusCreated {
 		return fmt.Errorf("Failed to create the new plugin for the %v api with status code %v", apiName, resp.StatusCode)
 	}
@@ -450,16 +694,17 @@ func (c *Client) AddPlugin(apiName string, plugin *Plugin) error {
 }
 
 // GetPlugin retrieves the plugin with the provided ID.
-func (c *Client) GetPlugin(pluginID string) (*Plugin, error) {
+func (c *Client) GetPlugin(ctx context.Context, pluginID string) (*Plugin, error) {
 	log.Printf("\nMaking request to retrieve the plugin %v from the kong admin api (%v)", c.host+":"+c.port, pluginID)
-	req, err := newRequest("GET", c.host+":"+c.port+pluginsEndpoint+pluginID, nil)
+	req, err := newRequest(ctx, "GET", c.host+":"+c.port+pluginsEndpoint+pluginID, nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("Failed to retrieve the plugin %v from the kong admin api", pluginID)
 	}
@@ -476,8 +721,9 @@ func (c *Client) GetPlugin(pluginID string) (*Plugin, error) {
 // such as Created, ID and APIID.
 // We must resolve the UUID from the API + plugin name combination as the kong endpoint
 // for updating plugins do not support plugin names as the path parameter eventhough the docs say otherwise.
-func (c *Client) UpdatePlugin(apiName string, plugin *Plugin) error {
-	apiPlugins, err := c.ListApiPlugins(apiName)
+func (c *Client) UpdatePlugin(ctx context.Context, apiName string, plugin *Plugin) error {
+	defer c.invalidate(pluginsKind)
+	apiPlugins, err := c.ListApiPlugins(ctx, apiName)
 	if err != nil {
 		return err
 	}
@@ -500,14 +746,15 @@ func (c *Client) UpdatePlugin(apiName string, plugin *Plugin) error {
 	}
 	log.Printf("\nMaking request to the kong admin api (%v) to update the api %v plugin with config name %v",
 		c.host+":"+c.port, apiName, plugin.Name)
-	req, err := newRequest("PATCH", c.host+":"+c.port+apisEndpoint+apiName+pluginsEndpoint+pluginID, b)
+	req, err := newRequest(ctx, "PATCH", c.host+":"+c.port+c.pluginPath(apiName, pluginID), b)
 	if err != nil {
 		return err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("Failed to update the %v plugin for the %v api with status code %v", plugin.Name, apiName, resp.StatusCode)
 	}
@@ -524,8 +771,9 @@ func (c *Client) UpdatePlugin(apiName string, plugin *Plugin) error {
 // in a DELETE request but it is not the case. This retrieves the list of plugins and finds the one
 // with the provided plugin name and gets the ID that way to prevent us having to manage some sort
 // of data store in this app.
-func (c *Client) RemovePlugin(apiName string, pluginName string) error {
-	apiPlugins, err := c.ListApiPlugins(apiName)
+func (c *Client) RemovePlugin(ctx context.Context, apiName string, pluginName string) error {
+	defer c.invalidate(pluginsKind)
+	apiPlugins, err := c.ListApiPlugins(ctx, apiName)
 	if err != nil {
 		return err
 	}
@@ -543,17 +791,49 @@ func (c *Client) RemovePlugin(apiName string, pluginName string) error {
 	}
 	log.Printf("\nMaking request to the kong admin api (%v) to remove the plugin with config name %v for the %v api",
 		c.host+":"+c.port, pluginName, apiName)
-	req, err := newRequest("DELETE", c.host+":"+c.port+apisEndpoint+apiName+pluginsEndpoint+pluginID, nil)
+	req, err := newRequest(ctx, "DELETE", c.host+":"+c.port+c.pluginPath(apiName, pluginID), nil)
 	if err != nil {
 		return err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusNoContent {
 		return fmt.Errorf("Failed to remove the plugin %v from api %v with status code %v",
 			pluginName, apiName, resp.StatusCode)
 	}
 	return nil
 }
+
+// Status checks the kong admin api is reachable and kong is able to reach its database.
+// Unlike the other requests this isn't logged as it's polled regularly.
+func (c *Client) Status(ctx context.Context) error {
+	req, err := newRequest(ctx, "GET", c.host+":"+c.port+statusEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Failed to retrieve the kong node status with status code %v", resp.StatusCode)
+	}
+	var status struct {
+		Database struct {
+			Reachable *bool `json:"reachable"`
+		} `json:"database"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		return err
+	}
+	// Older versions of kong don't report whether the database is reachable.
+	if status.Database.Reachable != nil && !*status.Database.Reachable {
+		return errors.New("The kong node can't reach its database")
+	}
+	return nil
+}
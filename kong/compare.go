@@ -0,0 +1,125 @@
+package kong
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// The values kong gives the properties of an API object that are left out of the payload
+// written to it, API objects are replaced as a whole so leaving a property out resets it.
+const (
+	defaultRetries = 5
+	defaultTimeout = 60000
+)
+
+// APIMatches lets us know whether writing the provided desired API object would leave the provided
+// API object currently in kong as it is. Properties left out of the desired API object are compared
+// against the values kong gives them, apart from http_if_terminated whose default differs between versions.
+func APIMatches(current *API, desired *API) bool {
+	if current == nil || desired == nil {
+		return false
+	}
+	return current.Name == desired.Name &&
+		current.UpstreamURL == desired.UpstreamURL &&
+		stringsMatch(current.Hosts, desired.Hosts) &&
+		stringsMatch(current.URIs, desired.URIs) &&
+		stringsMatch(current.Methods, desired.Methods) &&
+		boolMatches(current.StripURI, desired.StripURI, true) &&
+		boolMatches(current.PreserveHost, desired.PreserveHost, false) &&
+		boolMatches(current.HTTPSOnly, desired.HTTPSOnly, false) &&
+		(desired.HTTPIfTerminated == nil || boolMatches(current.HTTPIfTerminated, desired.HTTPIfTerminated, false)) &&
+		int64PtrMatches(current.Retries, desired.Retries, defaultRetries) &&
+		intMatches(current.UpstreamConnectTimeout, desired.UpstreamConnectTimeout, defaultTimeout) &&
+		intMatches(current.UpstreamSendTimeout, desired.UpstreamSendTimeout, defaultTimeout) &&
+		intMatches(current.UpstreamReadTimeout, desired.UpstreamReadTimeout, defaultTimeout)
+}
+
+// PluginMatches lets us know whether writing the provided desired plugin would leave the provided
+// plugin currently in kong as it is. Plugins are patched so only the config fields set in the desired plugin
+// are compared, kong fills in defaults for the rest of the config.
+func PluginMatches(current *Plugin, desired *Plugin) bool {
+	if current == nil || desired == nil || current.Name != desired.Name {
+		return false
+	}
+	if desired.Enabled != nil && !boolMatches(current.Enabled, desired.Enabled, true) {
+		return false
+	}
+	return configMatches(normalise(current.Config), normalise(desired.Config))
+}
+
+// Lets us know whether every value set in the provided desired config is the same in the provided current config,
+// nested objects are compared the same way while everything else has to be equal.
+func configMatches(current interface{}, desired interface{}) bool {
+	desiredMap, isMap := desired.(map[string]interface{})
+	if !isMap {
+		return reflect.DeepEqual(current, desired)
+	}
+	currentMap, isMap := current.(map[string]interface{})
+	if !isMap {
+		return len(desiredMap) == 0 && current == nil
+	}
+	for key, value := range desiredMap {
+		if !configMatches(currentMap[key], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Round trips the provided config through JSON so numbers and nested values have the same types
+// whether they came from a Kubernetes resource or the kong admin api.
+func normalise(config map[string]interface{}) interface{} {
+	b, err := json.Marshal(config)
+	if err != nil {
+		return config
+	}
+	var normalised interface{}
+	if err = json.Unmarshal(b, &normalised); err != nil {
+		return config
+	}
+	return normalised
+}
+
+func stringsMatch(current []string, desired []string) bool {
+	if len(current) != len(desired) {
+		return false
+	}
+	for i := range current {
+		if current[i] != desired[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func boolMatches(current *bool, desired *bool, fallback bool) bool {
+	currentValue, desiredValue := fallback, fallback
+	if current != nil {
+		currentValue = *current
+	}
+	if desired != nil {
+		desiredValue = *desired
+	}
+	return currentValue == desiredValue
+}
+
+func int64PtrMatches(current *int64, desired *int64, fallback int64) bool {
+	currentValue, desiredValue := fallback, fallback
+	if current != nil {
+		currentValue = *current
+	}
+	if desired != nil {
+		desiredValue = *desired
+	}
+	return currentValue == desiredValue
+}
+
+func intMatches(current int64, desired int64, fallback int64) bool {
+	if current == 0 {
+		current = fallback
+	}
+	if desired == 0 {
+		desired = fallback
+	}
+	return current == desired
+}
@@ -0,0 +1,92 @@
+package kong
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	consumersEndpoint = "/consumers/"
+	keyAuthEndpoint   = "/key-auth/"
+)
+
+// CreateConsumer creates a new consumer in kong.
+func (c *Client) CreateConsumer(ctx context.Context, consumer *Consumer) (*Consumer, error) {
+	created := &Consumer{}
+	if err := c.send(ctx, "POST", consumersEndpoint, "create consumer", consumer, created, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetConsumer retrieves a consumer by it's username or id.
+func (c *Client) GetConsumer(ctx context.Context, usernameOrID string) (*Consumer, error) {
+	consumer := &Consumer{}
+	err := c.send(ctx, "GET", consumersEndpoint+usernameOrID, "get the "+usernameOrID+" consumer", nil, consumer, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return consumer, nil
+}
+
+// UpdateConsumer updates the consumer with the ID of the provided consumer,
+// or its username when the ID isn't set.
+func (c *Client) UpdateConsumer(ctx context.Context, consumer *Consumer) (*Consumer, error) {
+	usernameOrID := consumer.ID
+	if usernameOrID == "" {
+		usernameOrID = consumer.Username
+	}
+	// The ID only identifies the consumer to update so it's left out of the payload.
+	payload := *consumer
+	payload.ID = ""
+	payload.Created = 0
+	updated := &Consumer{}
+	err := c.send(ctx, "PATCH", consumersEndpoint+usernameOrID, "update the "+usernameOrID+" consumer", &payload, updated, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteConsumer removes the consumer with the provided username or id along with its credentials.
+func (c *Client) DeleteConsumer(ctx context.Context, usernameOrID string) error {
+	return c.send(ctx, "DELETE", consumersEndpoint+usernameOrID, "delete the "+usernameOrID+" consumer", nil, nil, http.StatusNoContent)
+}
+
+// CreateKeyAuthCredential creates a new key-auth credential for the consumer with the provided username or id.
+func (c *Client) CreateKeyAuthCredential(ctx context.Context, consumerUsernameOrID string, credential *KeyAuthCredential) (*KeyAuthCredential, error) {
+	created := &KeyAuthCredential{}
+	err := c.send(ctx, "POST", consumersEndpoint+consumerUsernameOrID+keyAuthEndpoint,
+		"create a key-auth credential for the "+consumerUsernameOrID+" consumer", credential, created, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// ListKeyAuthCredentials retrieves every key-auth credential of the consumer with the provided username or id,
+// following the pages of the listing until all of them have been retrieved.
+func (c *Client) ListKeyAuthCredentials(ctx context.Context, consumerUsernameOrID string) ([]*KeyAuthCredential, error) {
+	credentials := []*KeyAuthCredential{}
+	offset := ""
+	for {
+		page := &KeyAuthCredentialList{}
+		err := c.send(ctx, "GET", consumersEndpoint+consumerUsernameOrID+keyAuthEndpoint+pageQuery(offset),
+			"list the key-auth credentials of the "+consumerUsernameOrID+" consumer", nil, page, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, page.Data...)
+		if page.Offset == "" || len(page.Data) == 0 {
+			return credentials, nil
+		}
+		offset = page.Offset
+	}
+}
+
+// DeleteKeyAuthCredential removes the key-auth credential with the provided id
+// from the consumer with the provided username or id.
+func (c *Client) DeleteKeyAuthCredential(ctx context.Context, consumerUsernameOrID string, id string) error {
+	return c.send(ctx, "DELETE", consumersEndpoint+consumerUsernameOrID+keyAuthEndpoint+id,
+		"delete the "+id+" key-auth credential of the "+consumerUsernameOrID+" consumer", nil, nil, http.StatusNoContent)
+}
@@ -0,0 +1,140 @@
+package kong
+
+import (
+	"sort"
+
+	"github.com/ghodss/yaml"
+)
+
+// The version of the declarative configuration format rendered, understood by kong 1.1 and later.
+const declarativeFormatVersion = "1.1"
+
+// DeclarativeConfig provides the complete desired state of kong in the format of the kong.yml file
+// DB-less kong deployments load their configuration from. API objects are represented as a service
+// with a single route like they are with EnableServices, with their plugins nested in the service.
+// Consumers and global plugins are included alongside the services.
+type DeclarativeConfig struct {
+	services  map[string]*declarativeService
+	plugins   map[string][]*Plugin
+	upstreams map[string][]string
+	weights   map[string]int
+	consumers []*Consumer
+	globals   []*Plugin
+}
+
+type declarativeConfigFile struct {
+	FormatVersion string                 `json:"_format_version"`
+	Services      []*declarativeService  `json:"services"`
+	Upstreams     []*declarativeUpstream `json:"upstreams,omitempty"`
+	Consumers     []*Consumer            `json:"consumers,omitempty"`
+	Plugins       []*Plugin              `json:"plugins,omitempty"`
+}
+
+type declarativeService struct {
+	*Service
+	Routes  []*Route  `json:"routes"`
+	Plugins []*Plugin `json:"plugins,omitempty"`
+}
+
+type declarativeUpstream struct {
+	Name    string               `json:"name"`
+	Targets []*declarativeTarget `json:"targets,omitempty"`
+}
+
+type declarativeTarget struct {
+	Target string `json:"target"`
+	Weight int    `json:"weight"`
+}
+
+// NewDeclarativeConfig creates a new empty declarative configuration.
+func NewDeclarativeConfig() *DeclarativeConfig {
+	return &DeclarativeConfig{services: make(map[string]*declarativeService), plugins: make(map[string][]*Plugin),
+		upstreams: make(map[string][]string), weights: make(map[string]int)}
+}
+
+// AddAPI adds the provided API object to the configuration, replacing any API object with the same name.
+func (d *DeclarativeConfig) AddAPI(api *API) {
+	route := routeFor(api, "")
+	// Routes nested in a service reference it implicitly.
+	route.Service = nil
+	d.services[api.Name] = &declarativeService{Service: serviceFor(api), Routes: []*Route{route}}
+}
+
+// AddPlugin adds the provided plugin to the API object with the provided name, plugins for
+// API objects that aren't in the configuration are left out as there's nothing to attach them to.
+func (d *DeclarativeConfig) AddPlugin(apiName string, plugin *Plugin) {
+	d.plugins[apiName] = append(d.plugins[apiName], &Plugin{Name: plugin.Name, Config: plugin.Config, Enabled: plugin.Enabled})
+}
+
+// AddUpstream adds the upstream with the provided name to the configuration
+// with the provided host:port targets at the provided weight, full weight when it's less than 1.
+func (d *DeclarativeConfig) AddUpstream(name string, targets []string, weight int) {
+	if weight < 1 {
+		weight = fullTargetWeight
+	}
+	d.upstreams[name] = targets
+	d.weights[name] = weight
+}
+
+// AddGlobalPlugin adds the provided plugin to the configuration as a plugin applied to every request.
+func (d *DeclarativeConfig) AddGlobalPlugin(plugin *Plugin) {
+	d.globals = append(d.globals, &Plugin{Name: plugin.Name, Config: plugin.Config, Enabled: plugin.Enabled})
+}
+
+// AddConsumer adds the provided consumer to the configuration.
+func (d *DeclarativeConfig) AddConsumer(consumer *Consumer) {
+	d.consumers = append(d.consumers, &Consumer{Username: consumer.Username, CustomID: consumer.CustomID})
+}
+
+// YAML renders the configuration as the contents of a kong.yml file, objects are sorted
+// by name so the same desired state always renders the same way.
+func (d *DeclarativeConfig) YAML() ([]byte, error) {
+	file := &declarativeConfigFile{FormatVersion: declarativeFormatVersion, Services: []*declarativeService{}}
+	serviceNames := make([]string, 0, len(d.services))
+	for name := range d.services {
+		serviceNames = append(serviceNames, name)
+	}
+	sort.Strings(serviceNames)
+	for _, name := range serviceNames {
+		service := d.services[name]
+		plugins := append(pluginsByName{}, d.plugins[name]...)
+		sort.Sort(plugins)
+		file.Services = append(file.Services, &declarativeService{Service: service.Service, Routes: service.Routes, Plugins: plugins})
+	}
+	upstreamNames := make([]string, 0, len(d.upstreams))
+	for name := range d.upstreams {
+		upstreamNames = append(upstreamNames, name)
+	}
+	sort.Strings(upstreamNames)
+	for _, name := range upstreamNames {
+		upstream := &declarativeUpstream{Name: name}
+		targets := append([]string{}, d.upstreams[name]...)
+		sort.Strings(targets)
+		for _, target := range targets {
+			upstream.Targets = append(upstream.Targets, &declarativeTarget{Target: target, Weight: d.weights[name]})
+		}
+		file.Upstreams = append(file.Upstreams, upstream)
+	}
+	file.Consumers = append(consumersByName{}, d.consumers...)
+	sort.Sort(consumersByName(file.Consumers))
+	file.Plugins = append(pluginsByName{}, d.globals...)
+	sort.Sort(pluginsByName(file.Plugins))
+	return yaml.Marshal(file)
+}
+
+type pluginsByName []*Plugin
+
+func (p pluginsByName) Len() int           { return len(p) }
+func (p pluginsByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
+func (p pluginsByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type consumersByName []*Consumer
+
+func (c consumersByName) Len() int { return len(c) }
+func (c consumersByName) Less(i, j int) bool {
+	if c[i].Username != c[j].Username {
+		return c[i].Username < c[j].Username
+	}
+	return c[i].CustomID < c[j].CustomID
+}
+func (c consumersByName) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
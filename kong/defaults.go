@@ -0,0 +1,48 @@
+package kong
+
+// Defaults provides the values given to the properties of kong objects that the resources they're synced
+// from leave out. They're filled in before anything is written to kong so minimal resources behave the same way
+// whichever version of kong they're written to and whether they're synced incrementally or declaratively.
+type Defaults struct {
+	StripURI bool
+	Retries  int64
+	// The upstream connect, send and read timeouts in milliseconds.
+	Timeout int64
+	// The weight targets end up with once they are fully enabled.
+	TargetWeight int
+}
+
+// StandardDefaults provides the defaults kong gives API objects itself along with the weight
+// targets have always been registered with.
+var StandardDefaults = Defaults{StripURI: true, Retries: defaultRetries, Timeout: defaultTimeout, TargetWeight: fullTargetWeight}
+
+// Apply fills in the properties the provided API object leaves out with the defaults, providing the API object.
+// Retries are only defaulted when they're left out so retries of 0 turn retries off.
+func (d Defaults) Apply(api *API) *API {
+	if api.StripURI == nil {
+		stripURI := d.StripURI
+		api.StripURI = &stripURI
+	}
+	if api.Retries == nil {
+		retries := d.Retries
+		api.Retries = &retries
+	}
+	if api.UpstreamConnectTimeout == 0 {
+		api.UpstreamConnectTimeout = d.Timeout
+	}
+	if api.UpstreamSendTimeout == 0 {
+		api.UpstreamSendTimeout = d.Timeout
+	}
+	if api.UpstreamReadTimeout == 0 {
+		api.UpstreamReadTimeout = d.Timeout
+	}
+	return api
+}
+
+// SetDefaults makes the client register fully enabled targets with the target weight of the provided defaults,
+// a weight of less than 1 keeps the current weight.
+func (c *Client) SetDefaults(defaults Defaults) {
+	if defaults.TargetWeight > 0 {
+		c.targetWeight = defaults.TargetWeight
+	}
+}
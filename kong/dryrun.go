@@ -0,0 +1,63 @@
+package kong
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/freshwebio/k8s-kong-api/redact"
+)
+
+// Provides a transport that lets reads through to the kong admin api
+// but only logs writes, answering them as kong would for a successful write.
+type dryRunTransport struct {
+	transport http.RoundTripper
+}
+
+// RoundTrip deals with sending reads on to the underlying transport
+// and faking a successful response for writes.
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == "GET" || req.Method == "HEAD" {
+		return t.transport.RoundTrip(req)
+	}
+	body := []byte{}
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("Dry run, skipping the %v request to %v with payload: %v", req.Method, req.URL, redact.JSON(body))
+	statusCode := http.StatusOK
+	switch req.Method {
+	case "POST":
+		statusCode = http.StatusCreated
+	case "DELETE":
+		statusCode = http.StatusNoContent
+		body = []byte{}
+	}
+	// Echo the payload back so callers decoding the written object get what they sent.
+	return &http.Response{
+		Status:     http.StatusText(statusCode),
+		StatusCode: statusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// EnableDryRun stops the client from making any changes to kong,
+// writes are logged instead of being sent to the kong admin api while reads still go through.
+func (c *Client) EnableDryRun() {
+	transport := c.client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	c.client = &http.Client{Transport: &dryRunTransport{transport: transport}, Timeout: c.client.Timeout}
+}
@@ -0,0 +1,1006 @@
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+)
+
+// The weight targets are enabled with, like the kong client without slow start.
+const fullTargetWeight = 10
+
+var _ kong.Interface = (*Kong)(nil)
+
+// Kong provides an in-memory implementation of kong.Interface so the reconcile logic of the controllers
+// can be exercised without a kong admin api. It answers like kong does, e.g. with kong.ErrNotFound
+// for objects that don't exist, and keeps the history of targets the way kong does.
+// Failures can be injected for any method with FailOn.
+type Kong struct {
+	mu        sync.Mutex
+	apis      map[string]*kong.API
+	upstreams map[string]*kong.Upstream
+	targets   map[string][]*kong.Target
+	plugins   map[string][]*kong.Plugin
+	globals   map[string]*kong.Plugin
+	enabled   map[string]bool
+	consumers map[string]*kong.Consumer
+	keyAuths  map[string][]*kong.KeyAuthCredential
+	certs     map[string]*kong.Certificate
+	snis      map[string]*kong.SNI
+	failures  map[string]*failure
+	calls     map[string]int
+	lastID    int
+	clock     int
+	// Whether the fake imitates kong before 1.0 which can't delete target entries.
+	legacyTargets bool
+}
+
+// Provides an injected failure along with the number of calls
+// it has left, a count of less than 1 fails every call.
+type failure struct {
+	err       error
+	remaining int
+}
+
+// New creates a new instance of an empty in-memory kong.
+func New() *Kong {
+	return &Kong{
+		apis:      make(map[string]*kong.API),
+		upstreams: make(map[string]*kong.Upstream),
+		targets:   make(map[string][]*kong.Target),
+		plugins:   make(map[string][]*kong.Plugin),
+		globals:   make(map[string]*kong.Plugin),
+		enabled:   make(map[string]bool),
+		consumers: make(map[string]*kong.Consumer),
+		keyAuths:  make(map[string][]*kong.KeyAuthCredential),
+		certs:     make(map[string]*kong.Certificate),
+		snis:      make(map[string]*kong.SNI),
+		failures:  make(map[string]*failure),
+		calls:     make(map[string]int),
+	}
+}
+
+// FailOn makes the provided number of calls to the method with the provided name, e.g. "CreateAPI",
+// fail with the provided error without touching the in-memory state. A number of calls of less than 1
+// fails every call until Heal is called for the method.
+func (k *Kong) FailOn(method string, calls int, err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.failures[method] = &failure{err: err, remaining: calls}
+}
+
+// Heal removes any failure injected for the method with the provided name.
+func (k *Kong) Heal(method string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.failures, method)
+}
+
+// Calls provides the number of times the method with the provided name has been called,
+// failed calls included.
+func (k *Kong) Calls(method string) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.calls[method]
+}
+
+// CreateAPI creates a new API, failing with a conflict when an API with the same name exists.
+func (k *Kong) CreateAPI(ctx context.Context, api *kong.API) (*kong.API, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "CreateAPI"); err != nil {
+		return nil, err
+	}
+	if _, exists := k.apis[api.Name]; exists {
+		return nil, fmt.Errorf("Failed to create the specified API with status code %v", http.StatusConflict)
+	}
+	created := &kong.API{}
+	if err := copyInto(api, created); err != nil {
+		return nil, err
+	}
+	created.ID = k.nextID()
+	k.apis[created.Name] = created
+	return copyAPI(created)
+}
+
+// GetAPI retrieves an API by it's name or id.
+func (k *Kong) GetAPI(ctx context.Context, nameOrID string) (*kong.API, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "GetAPI"); err != nil {
+		return nil, err
+	}
+	api := k.findAPI(nameOrID)
+	if api == nil {
+		return nil, kong.ErrNotFound
+	}
+	return copyAPI(api)
+}
+
+// ListAPIs retrieves every API sorted by name.
+func (k *Kong) ListAPIs(ctx context.Context) ([]*kong.API, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "ListAPIs"); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(k.apis))
+	for name := range k.apis {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	apis := make([]*kong.API, 0, len(names))
+	for _, name := range names {
+		api, err := copyAPI(k.apis[name])
+		if err != nil {
+			return nil, err
+		}
+		apis = append(apis, api)
+	}
+	return apis, nil
+}
+
+// UpdateAPI replaces the API with the ID or name of the provided API.
+func (k *Kong) UpdateAPI(ctx context.Context, api *kong.API) (*kong.API, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "UpdateAPI"); err != nil {
+		return nil, err
+	}
+	nameOrID := api.Name
+	if api.ID != "" {
+		nameOrID = api.ID
+	}
+	existing := k.findAPI(nameOrID)
+	if existing == nil {
+		return nil, kong.ErrNotFound
+	}
+	updated := &kong.API{}
+	if err := copyInto(api, updated); err != nil {
+		return nil, err
+	}
+	updated.ID = existing.ID
+	delete(k.apis, existing.Name)
+	k.apis[updated.Name] = updated
+	if updated.Name != existing.Name {
+		k.plugins[updated.Name] = k.plugins[existing.Name]
+		delete(k.plugins, existing.Name)
+	}
+	return copyAPI(updated)
+}
+
+// DeleteAPI removes the API with the provided name or id along with its plugins.
+func (k *Kong) DeleteAPI(ctx context.Context, nameOrID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "DeleteAPI"); err != nil {
+		return err
+	}
+	api := k.findAPI(nameOrID)
+	if api == nil {
+		return kong.ErrNotFound
+	}
+	delete(k.apis, api.Name)
+	delete(k.plugins, api.Name)
+	return nil
+}
+
+// CreateUpstream creates a new upstream, failing with a conflict when an upstream with the same name exists.
+func (k *Kong) CreateUpstream(ctx context.Context, upstream *kong.Upstream) (*kong.Upstream, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "CreateUpstream"); err != nil {
+		return nil, err
+	}
+	if _, exists := k.upstreams[upstream.Name]; exists {
+		return nil, fmt.Errorf("Failed to create the specified upstream with status code %v", http.StatusConflict)
+	}
+	created := &kong.Upstream{ID: k.nextID(), Name: upstream.Name}
+	k.upstreams[created.Name] = created
+	return &kong.Upstream{ID: created.ID, Name: created.Name}, nil
+}
+
+// GetUpstream retrieves the upstream with the provided name or id.
+func (k *Kong) GetUpstream(ctx context.Context, nameOrId string) (*kong.Upstream, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "GetUpstream"); err != nil {
+		return nil, err
+	}
+	upstream := k.findUpstream(nameOrId)
+	if upstream == nil {
+		return nil, kong.ErrNotFound
+	}
+	return &kong.Upstream{ID: upstream.ID, Name: upstream.Name}, nil
+}
+
+// DeleteUpstream removes the upstream with the provided name or id along with its targets.
+func (k *Kong) DeleteUpstream(ctx context.Context, nameOrId string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "DeleteUpstream"); err != nil {
+		return err
+	}
+	upstream := k.findUpstream(nameOrId)
+	if upstream == nil {
+		return kong.ErrNotFound
+	}
+	delete(k.upstreams, upstream.Name)
+	delete(k.targets, upstream.Name)
+	return nil
+}
+
+// UpdateUpstream replaces the upstream with the ID or name of the provided upstream.
+func (k *Kong) UpdateUpstream(ctx context.Context, upstream *kong.Upstream) (*kong.Upstream, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "UpdateUpstream"); err != nil {
+		return nil, err
+	}
+	nameOrId := upstream.Name
+	if upstream.ID != "" {
+		nameOrId = upstream.ID
+	}
+	existing := k.findUpstream(nameOrId)
+	if existing == nil {
+		return nil, kong.ErrNotFound
+	}
+	updated := &kong.Upstream{ID: existing.ID, Name: upstream.Name}
+	delete(k.upstreams, existing.Name)
+	k.upstreams[updated.Name] = updated
+	if updated.Name != existing.Name {
+		k.targets[updated.Name] = k.targets[existing.Name]
+		delete(k.targets, existing.Name)
+	}
+	return &kong.Upstream{ID: updated.ID, Name: updated.Name}, nil
+}
+
+// CreateTarget adds a new entry to the target history of the upstream with the provided name or id.
+func (k *Kong) CreateTarget(ctx context.Context, upstreamNameOrId string, target *kong.Target) (*kong.Target, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "CreateTarget"); err != nil {
+		return nil, err
+	}
+	return k.addTarget(upstreamNameOrId, target.Target, target.Weight)
+}
+
+// ListTargets lists every entry in the target history of the upstream with the provided name or id.
+func (k *Kong) ListTargets(ctx context.Context, upstreamNameOrId string) (*kong.TargetList, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "ListTargets"); err != nil {
+		return nil, err
+	}
+	upstream := k.findUpstream(upstreamNameOrId)
+	if upstream == nil {
+		return nil, kong.ErrNotFound
+	}
+	list := &kong.TargetList{Data: []*kong.Target{}}
+	for _, target := range k.targets[upstream.Name] {
+		copied := *target
+		list.Data = append(list.Data, &copied)
+	}
+	list.Total = len(list.Data)
+	return list, nil
+}
+
+// DisableTargetDeletes makes the fake imitate kong before 1.0, which can't delete target entries.
+func (k *Kong) DisableTargetDeletes() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.legacyTargets = true
+}
+
+// DeletesTargets lets us know whether target entries can be deleted, which they can
+// unless DisableTargetDeletes has been called.
+func (k *Kong) DeletesTargets() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return !k.legacyTargets
+}
+
+// DeleteTarget removes the entry with the provided id from the target history of the upstream
+// with the provided name or id, like kong 1.0 and later. Once DisableTargetDeletes has been called
+// it fails with kong.ErrTargetDeletesUnsupported like the kong client does for earlier versions.
+func (k *Kong) DeleteTarget(ctx context.Context, upstreamNameOrId string, id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "DeleteTarget"); err != nil {
+		return err
+	}
+	if k.legacyTargets {
+		return kong.ErrTargetDeletesUnsupported
+	}
+	upstream := k.findUpstream(upstreamNameOrId)
+	if upstream == nil {
+		return kong.ErrNotFound
+	}
+	targets := k.targets[upstream.Name]
+	for i, target := range targets {
+		if target.ID == id {
+			k.targets[upstream.Name] = append(targets[:i:i], targets[i+1:]...)
+			return nil
+		}
+	}
+	return kong.ErrNotFound
+}
+
+// DisableTarget adds an entry with a weight of 0 for the provided target.
+func (k *Kong) DisableTarget(ctx context.Context, upstreamNameOrId string, targetHost string) (*kong.Target, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "DisableTarget"); err != nil {
+		return nil, err
+	}
+	return k.addTarget(upstreamNameOrId, targetHost, 0)
+}
+
+// EnableTarget adds an entry with the full weight for the provided target.
+func (k *Kong) EnableTarget(ctx context.Context, upstreamNameOrId string, targetHost string, wait kong.RampWait) (*kong.Target, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "EnableTarget"); err != nil {
+		return nil, err
+	}
+	return k.addTarget(upstreamNameOrId, targetHost, fullTargetWeight)
+}
+
+// ResumeTarget adds an entry with the full weight for the provided target once the provided function
+// lets it through, like the kong client does without slow start.
+func (k *Kong) ResumeTarget(ctx context.Context, upstreamNameOrId string, targetHost string, weight int, wait kong.RampWait) error {
+	if err := wait(ctx); err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "ResumeTarget"); err != nil {
+		return err
+	}
+	_, err := k.addTarget(upstreamNameOrId, targetHost, fullTargetWeight)
+	return err
+}
+
+// TargetWeight provides the weight targets are enabled with.
+func (k *Kong) TargetWeight() int {
+	return fullTargetWeight
+}
+
+// ListApiPlugins lists the plugins attached to the API with the provided name.
+func (k *Kong) ListApiPlugins(ctx context.Context, apiName string) (*kong.PluginList, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "ListApiPlugins"); err != nil {
+		return nil, err
+	}
+	return k.listPlugins(apiName)
+}
+
+// APIHasPlugin lets us know whether the provided API has an instance of the provided plugin type,
+// an API that doesn't exist has no plugins.
+func (k *Kong) APIHasPlugin(ctx context.Context, apiName string, pluginName string) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "APIHasPlugin"); err != nil {
+		return false, err
+	}
+	if _, exists := k.apis[apiName]; !exists {
+		return false, nil
+	}
+	return k.findPlugin(apiName, pluginName) != nil, nil
+}
+
+// AddPlugin attaches the provided plugin to the API with the provided name,
+// the created instance fields are set on the provided plugin.
+func (k *Kong) AddPlugin(ctx context.Context, apiName string, plugin *kong.Plugin) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "AddPlugin"); err != nil {
+		return err
+	}
+	api, exists := k.apis[apiName]
+	if !exists {
+		return fmt.Errorf("Failed to create the new plugin for the %v api with status code %v", apiName, http.StatusNotFound)
+	}
+	if k.findPlugin(apiName, plugin.Name) != nil {
+		return fmt.Errorf("Failed to create the new plugin for the %v api with status code %v", apiName, http.StatusConflict)
+	}
+	created := &kong.Plugin{}
+	if err := copyInto(plugin, created); err != nil {
+		return err
+	}
+	created.ID = k.nextID()
+	created.APIID = api.ID
+	created.Created = k.tick()
+	k.plugins[apiName] = append(k.plugins[apiName], created)
+	return copyInto(created, plugin)
+}
+
+// GetPlugin retrieves the plugin with the provided ID.
+func (k *Kong) GetPlugin(ctx context.Context, pluginID string) (*kong.Plugin, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "GetPlugin"); err != nil {
+		return nil, err
+	}
+	for _, plugins := range k.plugins {
+		for _, plugin := range plugins {
+			if plugin.ID == pluginID {
+				copied := &kong.Plugin{}
+				if err := copyInto(plugin, copied); err != nil {
+					return nil, err
+				}
+				return copied, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Failed to retrieve the plugin %v from the kong admin api", pluginID)
+}
+
+// UpdatePlugin updates the configuration of the plugin with the name of the provided plugin
+// attached to the API with the provided name, the updated instance fields are set on the provided plugin.
+func (k *Kong) UpdatePlugin(ctx context.Context, apiName string, plugin *kong.Plugin) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "UpdatePlugin"); err != nil {
+		return err
+	}
+	if _, err := k.listPlugins(apiName); err != nil {
+		return err
+	}
+	existing := k.findPlugin(apiName, plugin.Name)
+	if existing == nil {
+		return fmt.Errorf("No plugin exists for the provided api with the configuration name: %v", plugin.Name)
+	}
+	if plugin.Config != nil {
+		config := map[string]interface{}{}
+		if err := copyInto(plugin.Config, &config); err != nil {
+			return err
+		}
+		existing.Config = config
+	}
+	if plugin.Enabled != nil {
+		enabled := *plugin.Enabled
+		existing.Enabled = &enabled
+	}
+	return copyInto(existing, plugin)
+}
+
+// RemovePlugin detaches the plugin with the provided name from the API with the provided name.
+func (k *Kong) RemovePlugin(ctx context.Context, apiName string, pluginName string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "RemovePlugin"); err != nil {
+		return err
+	}
+	if _, err := k.listPlugins(apiName); err != nil {
+		return err
+	}
+	plugins := k.plugins[apiName]
+	for i, plugin := range plugins {
+		if plugin.Name == pluginName {
+			k.plugins[apiName] = append(plugins[:i:i], plugins[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("No plugin exists for the provided service with the configuration name: %v", pluginName)
+}
+
+// ListGlobalPlugins lists the global plugins sorted by name.
+func (k *Kong) ListGlobalPlugins(ctx context.Context) ([]*kong.Plugin, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "ListGlobalPlugins"); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(k.globals))
+	for name := range k.globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	plugins := make([]*kong.Plugin, 0, len(names))
+	for _, name := range names {
+		copied := &kong.Plugin{}
+		if err := copyInto(k.globals[name], copied); err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, copied)
+	}
+	return plugins, nil
+}
+
+// AddGlobalPlugin applies a new global plugin, failing with a conflict when a global plugin with the same name exists.
+func (k *Kong) AddGlobalPlugin(ctx context.Context, plugin *kong.Plugin) (*kong.Plugin, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "AddGlobalPlugin"); err != nil {
+		return nil, err
+	}
+	if _, exists := k.globals[plugin.Name]; exists {
+		return nil, fmt.Errorf("Failed to create the global %v plugin with status code %v", plugin.Name, http.StatusConflict)
+	}
+	created := &kong.Plugin{}
+	if err := copyInto(plugin, created); err != nil {
+		return nil, err
+	}
+	created.ID, created.Created = k.nextID(), k.tick()
+	k.globals[created.Name] = created
+	copied := &kong.Plugin{}
+	if err := copyInto(created, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// UpdateGlobalPlugin updates the global plugin with the ID of the provided plugin.
+func (k *Kong) UpdateGlobalPlugin(ctx context.Context, plugin *kong.Plugin) (*kong.Plugin, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "UpdateGlobalPlugin"); err != nil {
+		return nil, err
+	}
+	for name, existing := range k.globals {
+		if existing.ID != plugin.ID {
+			continue
+		}
+		updated := &kong.Plugin{}
+		if err := copyInto(plugin, updated); err != nil {
+			return nil, err
+		}
+		updated.Created = existing.Created
+		delete(k.globals, name)
+		k.globals[updated.Name] = updated
+		copied := &kong.Plugin{}
+		if err := copyInto(updated, copied); err != nil {
+			return nil, err
+		}
+		return copied, nil
+	}
+	return nil, kong.ErrNotFound
+}
+
+// RemoveGlobalPlugin removes the global plugin with the provided id.
+func (k *Kong) RemoveGlobalPlugin(ctx context.Context, id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "RemoveGlobalPlugin"); err != nil {
+		return err
+	}
+	for name, existing := range k.globals {
+		if existing.ID == id {
+			delete(k.globals, name)
+			return nil
+		}
+	}
+	return kong.ErrNotFound
+}
+
+// EnablePlugins adds the plugins with the provided names to the plugins enabled in the fake kong.
+func (k *Kong) EnablePlugins(names ...string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, name := range names {
+		k.enabled[name] = true
+	}
+}
+
+// EnabledPlugins lists the names of the enabled plugins sorted by name.
+func (k *Kong) EnabledPlugins(ctx context.Context) ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "EnabledPlugins"); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(k.enabled))
+	for name := range k.enabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CreateConsumer creates a new consumer, failing with a conflict when a consumer
+// with the same username or custom id exists.
+func (k *Kong) CreateConsumer(ctx context.Context, consumer *kong.Consumer) (*kong.Consumer, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "CreateConsumer"); err != nil {
+		return nil, err
+	}
+	if k.consumerConflicts(consumer, "") {
+		return nil, fmt.Errorf("Failed to create consumer with status code %v", http.StatusConflict)
+	}
+	created := &kong.Consumer{ID: k.nextID(), Username: consumer.Username, CustomID: consumer.CustomID, Created: k.tick()}
+	k.consumers[created.ID] = created
+	copied := *created
+	return &copied, nil
+}
+
+// GetConsumer retrieves the consumer with the provided username or id.
+func (k *Kong) GetConsumer(ctx context.Context, usernameOrID string) (*kong.Consumer, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "GetConsumer"); err != nil {
+		return nil, err
+	}
+	consumer := k.findConsumer(usernameOrID)
+	if consumer == nil {
+		return nil, kong.ErrNotFound
+	}
+	copied := *consumer
+	return &copied, nil
+}
+
+// UpdateConsumer updates the consumer with the ID or username of the provided consumer.
+func (k *Kong) UpdateConsumer(ctx context.Context, consumer *kong.Consumer) (*kong.Consumer, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "UpdateConsumer"); err != nil {
+		return nil, err
+	}
+	usernameOrID := consumer.ID
+	if usernameOrID == "" {
+		usernameOrID = consumer.Username
+	}
+	existing := k.findConsumer(usernameOrID)
+	if existing == nil {
+		return nil, kong.ErrNotFound
+	}
+	if k.consumerConflicts(consumer, existing.ID) {
+		return nil, fmt.Errorf("Failed to update the %v consumer with status code %v", usernameOrID, http.StatusConflict)
+	}
+	existing.Username, existing.CustomID = consumer.Username, consumer.CustomID
+	copied := *existing
+	return &copied, nil
+}
+
+// DeleteConsumer removes the consumer with the provided username or id.
+func (k *Kong) DeleteConsumer(ctx context.Context, usernameOrID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "DeleteConsumer"); err != nil {
+		return err
+	}
+	consumer := k.findConsumer(usernameOrID)
+	if consumer == nil {
+		return kong.ErrNotFound
+	}
+	delete(k.consumers, consumer.ID)
+	delete(k.keyAuths, consumer.ID)
+	return nil
+}
+
+// CreateKeyAuthCredential creates a new key-auth credential for the consumer with the provided username or id,
+// failing with a conflict when any consumer already has a credential with the same key.
+func (k *Kong) CreateKeyAuthCredential(ctx context.Context, consumerUsernameOrID string, credential *kong.KeyAuthCredential) (*kong.KeyAuthCredential, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "CreateKeyAuthCredential"); err != nil {
+		return nil, err
+	}
+	consumer := k.findConsumer(consumerUsernameOrID)
+	if consumer == nil {
+		return nil, kong.ErrNotFound
+	}
+	for _, credentials := range k.keyAuths {
+		for _, existing := range credentials {
+			if existing.Key == credential.Key {
+				return nil, fmt.Errorf("Failed to create a key-auth credential for the %v consumer with status code %v",
+					consumerUsernameOrID, http.StatusConflict)
+			}
+		}
+	}
+	created := &kong.KeyAuthCredential{ID: k.nextID(), Key: credential.Key, ConsumerID: consumer.ID, Created: k.tick()}
+	k.keyAuths[consumer.ID] = append(k.keyAuths[consumer.ID], created)
+	copied := *created
+	return &copied, nil
+}
+
+// ListKeyAuthCredentials lists the key-auth credentials of the consumer with the provided username or id.
+func (k *Kong) ListKeyAuthCredentials(ctx context.Context, consumerUsernameOrID string) ([]*kong.KeyAuthCredential, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "ListKeyAuthCredentials"); err != nil {
+		return nil, err
+	}
+	consumer := k.findConsumer(consumerUsernameOrID)
+	if consumer == nil {
+		return nil, kong.ErrNotFound
+	}
+	credentials := []*kong.KeyAuthCredential{}
+	for _, credential := range k.keyAuths[consumer.ID] {
+		copied := *credential
+		credentials = append(credentials, &copied)
+	}
+	return credentials, nil
+}
+
+// DeleteKeyAuthCredential removes the key-auth credential with the provided id
+// from the consumer with the provided username or id.
+func (k *Kong) DeleteKeyAuthCredential(ctx context.Context, consumerUsernameOrID string, id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "DeleteKeyAuthCredential"); err != nil {
+		return err
+	}
+	consumer := k.findConsumer(consumerUsernameOrID)
+	if consumer == nil {
+		return kong.ErrNotFound
+	}
+	credentials := k.keyAuths[consumer.ID]
+	for i, credential := range credentials {
+		if credential.ID == id {
+			k.keyAuths[consumer.ID] = append(credentials[:i], credentials[i+1:]...)
+			return nil
+		}
+	}
+	return kong.ErrNotFound
+}
+
+// CreateCertificate creates a new certificate.
+func (k *Kong) CreateCertificate(ctx context.Context, certificate *kong.Certificate) (*kong.Certificate, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "CreateCertificate"); err != nil {
+		return nil, err
+	}
+	created := &kong.Certificate{ID: k.nextID(), Cert: certificate.Cert, Key: certificate.Key, Created: k.tick()}
+	k.certs[created.ID] = created
+	copied := *created
+	return &copied, nil
+}
+
+// GetCertificate retrieves the certificate with the provided id.
+func (k *Kong) GetCertificate(ctx context.Context, id string) (*kong.Certificate, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "GetCertificate"); err != nil {
+		return nil, err
+	}
+	certificate, exists := k.certs[id]
+	if !exists {
+		return nil, kong.ErrNotFound
+	}
+	copied := *certificate
+	return &copied, nil
+}
+
+// UpdateCertificate replaces the certificate and private key of the certificate with the ID of the provided certificate.
+func (k *Kong) UpdateCertificate(ctx context.Context, certificate *kong.Certificate) (*kong.Certificate, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "UpdateCertificate"); err != nil {
+		return nil, err
+	}
+	existing, exists := k.certs[certificate.ID]
+	if !exists {
+		return nil, kong.ErrNotFound
+	}
+	existing.Cert, existing.Key = certificate.Cert, certificate.Key
+	copied := *existing
+	return &copied, nil
+}
+
+// DeleteCertificate removes the certificate with the provided id along with the SNIs referencing it.
+func (k *Kong) DeleteCertificate(ctx context.Context, id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "DeleteCertificate"); err != nil {
+		return err
+	}
+	if _, exists := k.certs[id]; !exists {
+		return kong.ErrNotFound
+	}
+	delete(k.certs, id)
+	for name, sni := range k.snis {
+		if sni.CertificateRef() == id {
+			delete(k.snis, name)
+		}
+	}
+	return nil
+}
+
+// ListSNIs lists every SNI sorted by name.
+func (k *Kong) ListSNIs(ctx context.Context) ([]*kong.SNI, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "ListSNIs"); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(k.snis))
+	for name := range k.snis {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	snis := make([]*kong.SNI, 0, len(names))
+	for _, name := range names {
+		copied := *k.snis[name]
+		snis = append(snis, &copied)
+	}
+	return snis, nil
+}
+
+// CreateSNI creates a new SNI for the certificate with the provided id, failing with a conflict
+// when an SNI with the same name exists.
+func (k *Kong) CreateSNI(ctx context.Context, name string, certificateID string) (*kong.SNI, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "CreateSNI"); err != nil {
+		return nil, err
+	}
+	if _, exists := k.snis[name]; exists {
+		return nil, fmt.Errorf("Failed to create the %v sni with status code %v", name, http.StatusConflict)
+	}
+	if _, exists := k.certs[certificateID]; !exists {
+		return nil, fmt.Errorf("Failed to create the %v sni with status code %v", name, http.StatusBadRequest)
+	}
+	created := &kong.SNI{Name: name, SSLCertificateID: certificateID, Created: k.tick()}
+	k.snis[name] = created
+	copied := *created
+	return &copied, nil
+}
+
+// DeleteSNI removes the SNI with the provided name.
+func (k *Kong) DeleteSNI(ctx context.Context, name string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.call(ctx, "DeleteSNI"); err != nil {
+		return err
+	}
+	if _, exists := k.snis[name]; !exists {
+		return kong.ErrNotFound
+	}
+	delete(k.snis, name)
+	return nil
+}
+
+// Status lets us know kong is healthy unless a failure has been injected for it.
+func (k *Kong) Status(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.call(ctx, "Status")
+}
+
+// Records a call to the method with the provided name, providing the error
+// injected for it if there is one. Calls made with a context that is done fail with the error of the context
+// like requests to the kong admin api would.
+func (k *Kong) call(ctx context.Context, method string) error {
+	k.calls[method]++
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f, exists := k.failures[method]
+	if !exists {
+		return nil
+	}
+	if f.remaining > 0 {
+		f.remaining--
+		if f.remaining == 0 {
+			delete(k.failures, method)
+		}
+	}
+	return f.err
+}
+
+func (k *Kong) nextID() string {
+	k.lastID++
+	return "fake-" + strconv.Itoa(k.lastID)
+}
+
+// Provides an ever increasing creation time so the latest entries can be told apart.
+func (k *Kong) tick() float64 {
+	k.clock++
+	return float64(k.clock)
+}
+
+func (k *Kong) findAPI(nameOrID string) *kong.API {
+	if api, exists := k.apis[nameOrID]; exists {
+		return api
+	}
+	for _, api := range k.apis {
+		if api.ID == nameOrID {
+			return api
+		}
+	}
+	return nil
+}
+
+func (k *Kong) findUpstream(nameOrId string) *kong.Upstream {
+	if upstream, exists := k.upstreams[nameOrId]; exists {
+		return upstream
+	}
+	for _, upstream := range k.upstreams {
+		if upstream.ID == nameOrId {
+			return upstream
+		}
+	}
+	return nil
+}
+
+func (k *Kong) findConsumer(usernameOrID string) *kong.Consumer {
+	if consumer, exists := k.consumers[usernameOrID]; exists {
+		return consumer
+	}
+	for _, consumer := range k.consumers {
+		if consumer.Username != "" && consumer.Username == usernameOrID {
+			return consumer
+		}
+	}
+	return nil
+}
+
+// Lets us know whether a consumer other than the one with the provided id
+// already has the username or custom id of the provided consumer.
+func (k *Kong) consumerConflicts(consumer *kong.Consumer, id string) bool {
+	for _, existing := range k.consumers {
+		if existing.ID == id {
+			continue
+		}
+		if (consumer.Username != "" && existing.Username == consumer.Username) ||
+			(consumer.CustomID != "" && existing.CustomID == consumer.CustomID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *Kong) findPlugin(apiName string, pluginName string) *kong.Plugin {
+	for _, plugin := range k.plugins[apiName] {
+		if plugin.Name == pluginName {
+			return plugin
+		}
+	}
+	return nil
+}
+
+func (k *Kong) listPlugins(apiName string) (*kong.PluginList, error) {
+	if _, exists := k.apis[apiName]; !exists {
+		return nil, fmt.Errorf("Failed to retrieve plugins for the %v api with status code %v", apiName, http.StatusNotFound)
+	}
+	list := &kong.PluginList{Data: []*kong.Plugin{}}
+	for _, plugin := range k.plugins[apiName] {
+		copied := &kong.Plugin{}
+		if err := copyInto(plugin, copied); err != nil {
+			return nil, err
+		}
+		list.Data = append(list.Data, copied)
+	}
+	list.Total = len(list.Data)
+	return list, nil
+}
+
+func (k *Kong) addTarget(upstreamNameOrId string, targetHost string, weight int) (*kong.Target, error) {
+	upstream := k.findUpstream(upstreamNameOrId)
+	if upstream == nil {
+		return nil, kong.ErrNotFound
+	}
+	target := &kong.Target{ID: k.nextID(), Target: targetHost, Weight: weight, UpstreamID: upstream.ID, Created: k.tick()}
+	k.targets[upstream.Name] = append(k.targets[upstream.Name], target)
+	copied := *target
+	return &copied, nil
+}
+
+func copyAPI(api *kong.API) (*kong.API, error) {
+	copied := &kong.API{}
+	if err := copyInto(api, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// Copies the provided value into the provided destination through JSON
+// so the copy shares nothing with the original, the way values sent to kong don't.
+// Values that can't be encoded fail the call they were provided to like kong would reject them.
+func copyInto(src interface{}, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
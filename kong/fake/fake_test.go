@@ -0,0 +1,106 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+)
+
+func TestFailOnFailsTheProvidedNumberOfCalls(t *testing.T) {
+	k := New()
+	injected := errors.New("kong unavailable")
+	k.FailOn("CreateAPI", 2, injected)
+	for i := 0; i < 2; i++ {
+		if _, err := k.CreateAPI(context.Background(), &kong.API{Name: "orders"}); err != injected {
+			t.Fatalf("call %v: expected the injected error but got %v", i+1, err)
+		}
+	}
+	if _, err := k.GetAPI(context.Background(), "orders"); err != kong.ErrNotFound {
+		t.Fatalf("expected failed creates to leave the API out but got %v", err)
+	}
+	if _, err := k.CreateAPI(context.Background(), &kong.API{Name: "orders"}); err != nil {
+		t.Fatalf("expected the third call to go through but got %v", err)
+	}
+	if calls := k.Calls("CreateAPI"); calls != 3 {
+		t.Errorf("expected 3 calls to be recorded but got %v", calls)
+	}
+}
+
+func TestFailOnFailsEveryCallUntilHealed(t *testing.T) {
+	k := New()
+	injected := errors.New("kong unavailable")
+	k.FailOn("Status", 0, injected)
+	for i := 0; i < 5; i++ {
+		if err := k.Status(context.Background()); err != injected {
+			t.Fatalf("call %v: expected the injected error but got %v", i+1, err)
+		}
+	}
+	k.Heal("Status")
+	if err := k.Status(context.Background()); err != nil {
+		t.Errorf("expected the status to be healthy once healed but got %v", err)
+	}
+}
+
+func TestCallsWithADoneContextFail(t *testing.T) {
+	k := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := k.CreateUpstream(ctx, &kong.Upstream{Name: "orders"}); err != context.Canceled {
+		t.Fatalf("expected the error of the context but got %v", err)
+	}
+	if _, err := k.GetUpstream(context.Background(), "orders"); err != kong.ErrNotFound {
+		t.Errorf("expected the upstream not to be created but got %v", err)
+	}
+}
+
+func TestValuesThatCantBeEncodedFailTheCall(t *testing.T) {
+	k := New()
+	if _, err := k.CreateAPI(context.Background(), &kong.API{Name: "orders"}); err != nil {
+		t.Fatalf("creating the orders API: %v", err)
+	}
+	plugin := &kong.Plugin{Name: "rate-limiting", Config: map[string]interface{}{"minute": make(chan int)}}
+	if err := k.AddPlugin(context.Background(), "orders", plugin); err == nil {
+		t.Fatal("expected a plugin config that can't be encoded to fail")
+	}
+	if has, err := k.APIHasPlugin(context.Background(), "orders", "rate-limiting"); err != nil || has {
+		t.Errorf("expected the plugin not to be added but got %v, %v", has, err)
+	}
+}
+
+func TestTargetDeletes(t *testing.T) {
+	k := New()
+	ctx := context.Background()
+	if _, err := k.CreateUpstream(ctx, &kong.Upstream{Name: "orders"}); err != nil {
+		t.Fatalf("creating the orders upstream: %v", err)
+	}
+	first, err := k.CreateTarget(ctx, "orders", &kong.Target{Target: "10.0.0.1:80", Weight: 10})
+	if err != nil {
+		t.Fatalf("creating a target: %v", err)
+	}
+	if _, err = k.DisableTarget(ctx, "orders", "10.0.0.1:80"); err != nil {
+		t.Fatalf("disabling the target: %v", err)
+	}
+	if !k.DeletesTargets() {
+		t.Fatal("expected target entries to be deletable by default")
+	}
+	if err = k.DeleteTarget(ctx, "orders", first.ID); err != nil {
+		t.Fatalf("deleting the first target entry: %v", err)
+	}
+	list, err := k.ListTargets(ctx, "orders")
+	if err != nil {
+		t.Fatalf("listing the targets: %v", err)
+	}
+	if list.Total != 1 || list.Data[0].Weight != 0 {
+		t.Fatalf("expected only the entry disabling the target to be left but got %+v", list.Data)
+	}
+
+	k.DisableTargetDeletes()
+	if k.DeletesTargets() {
+		t.Error("expected target entries not to be deletable like kong before 1.0")
+	}
+	if err = k.DeleteTarget(ctx, "orders", list.Data[0].ID); err != kong.ErrTargetDeletesUnsupported {
+		t.Errorf("expected kong.ErrTargetDeletesUnsupported but got %v", err)
+	}
+}
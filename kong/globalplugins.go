@@ -0,0 +1,66 @@
+package kong
+
+import (
+	"context"
+	"net/http"
+)
+
+// ListGlobalPlugins retrieves every plugin applied globally in kong, following the pages
+// of the listing until all of them have been retrieved.
+func (c *Client) ListGlobalPlugins(ctx context.Context) ([]*Plugin, error) {
+	plugins := []*Plugin{}
+	offset := ""
+	for {
+		page := &PluginList{}
+		if err := c.send(ctx, "GET", pluginsEndpoint+pageQuery(offset), "list plugins", nil, page, http.StatusOK); err != nil {
+			return nil, err
+		}
+		for _, plugin := range page.Data {
+			if plugin.Global() {
+				plugins = append(plugins, plugin)
+			}
+		}
+		if page.Offset == "" || len(page.Data) == 0 {
+			return plugins, nil
+		}
+		offset = page.Offset
+	}
+}
+
+// AddGlobalPlugin applies the provided plugin to every request through kong,
+// kong only allows a single global plugin with each name.
+func (c *Client) AddGlobalPlugin(ctx context.Context, plugin *Plugin) (*Plugin, error) {
+	created := &Plugin{}
+	if err := c.send(ctx, "POST", pluginsEndpoint, "create the global "+plugin.Name+" plugin", plugin, created, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateGlobalPlugin updates the global plugin with the ID of the provided plugin.
+func (c *Client) UpdateGlobalPlugin(ctx context.Context, plugin *Plugin) (*Plugin, error) {
+	payload := &Plugin{Name: plugin.Name, Config: plugin.Config, Enabled: plugin.Enabled}
+	updated := &Plugin{}
+	err := c.send(ctx, "PATCH", pluginsEndpoint+plugin.ID, "update the global "+plugin.Name+" plugin", payload, updated, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// RemoveGlobalPlugin removes the global plugin with the provided id.
+func (c *Client) RemoveGlobalPlugin(ctx context.Context, id string) error {
+	return c.send(ctx, "DELETE", pluginsEndpoint+id, "delete the global plugin "+id, nil, nil, http.StatusNoContent)
+}
+
+// EnabledPlugins provides the names of the plugins enabled in the kong node,
+// only these can be applied to APIs or globally.
+func (c *Client) EnabledPlugins(ctx context.Context) ([]string, error) {
+	var enabled struct {
+		EnabledPlugins []string `json:"enabled_plugins"`
+	}
+	if err := c.send(ctx, "GET", pluginsEndpoint+"enabled", "list the enabled plugins", nil, &enabled, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return enabled.EnabledPlugins, nil
+}
@@ -0,0 +1,55 @@
+package kong
+
+import "context"
+
+var _ Interface = (*Client)(nil)
+
+// Interface provides the operations the controllers carry out against kong,
+// it's implemented by Client and by the in-memory fake in the fake package
+// so the controllers can be exercised without a kong admin api.
+// Every operation is abandoned once the provided context is done.
+type Interface interface {
+	CreateAPI(ctx context.Context, api *API) (*API, error)
+	GetAPI(ctx context.Context, nameOrID string) (*API, error)
+	ListAPIs(ctx context.Context) ([]*API, error)
+	UpdateAPI(ctx context.Context, api *API) (*API, error)
+	DeleteAPI(ctx context.Context, nameOrID string) error
+	CreateUpstream(ctx context.Context, upstream *Upstream) (*Upstream, error)
+	GetUpstream(ctx context.Context, nameOrId string) (*Upstream, error)
+	DeleteUpstream(ctx context.Context, nameOrId string) error
+	UpdateUpstream(ctx context.Context, upstream *Upstream) (*Upstream, error)
+	CreateTarget(ctx context.Context, upstreamNameOrId string, target *Target) (*Target, error)
+	ListTargets(ctx context.Context, upstreamNameOrId string) (*TargetList, error)
+	DisableTarget(ctx context.Context, upstreamNameOrId string, targetHost string) (*Target, error)
+	EnableTarget(ctx context.Context, upstreamNameOrId string, targetHost string, wait RampWait) (*Target, error)
+	ResumeTarget(ctx context.Context, upstreamNameOrId string, targetHost string, weight int, wait RampWait) error
+	TargetWeight() int
+	DeletesTargets() bool
+	DeleteTarget(ctx context.Context, upstreamNameOrId string, id string) error
+	ListApiPlugins(ctx context.Context, apiName string) (*PluginList, error)
+	APIHasPlugin(ctx context.Context, apiName string, pluginName string) (bool, error)
+	AddPlugin(ctx context.Context, apiName string, plugin *Plugin) error
+	GetPlugin(ctx context.Context, pluginID string) (*Plugin, error)
+	UpdatePlugin(ctx context.Context, apiName string, plugin *Plugin) error
+	RemovePlugin(ctx context.Context, apiName string, pluginName string) error
+	ListGlobalPlugins(ctx context.Context) ([]*Plugin, error)
+	AddGlobalPlugin(ctx context.Context, plugin *Plugin) (*Plugin, error)
+	UpdateGlobalPlugin(ctx context.Context, plugin *Plugin) (*Plugin, error)
+	RemoveGlobalPlugin(ctx context.Context, id string) error
+	EnabledPlugins(ctx context.Context) ([]string, error)
+	CreateConsumer(ctx context.Context, consumer *Consumer) (*Consumer, error)
+	GetConsumer(ctx context.Context, usernameOrID string) (*Consumer, error)
+	UpdateConsumer(ctx context.Context, consumer *Consumer) (*Consumer, error)
+	DeleteConsumer(ctx context.Context, usernameOrID string) error
+	CreateKeyAuthCredential(ctx context.Context, consumerUsernameOrID string, credential *KeyAuthCredential) (*KeyAuthCredential, error)
+	ListKeyAuthCredentials(ctx context.Context, consumerUsernameOrID string) ([]*KeyAuthCredential, error)
+	DeleteKeyAuthCredential(ctx context.Context, consumerUsernameOrID string, id string) error
+	CreateCertificate(ctx context.Context, certificate *Certificate) (*Certificate, error)
+	GetCertificate(ctx context.Context, id string) (*Certificate, error)
+	UpdateCertificate(ctx context.Context, certificate *Certificate) (*Certificate, error)
+	DeleteCertificate(ctx context.Context, id string) error
+	ListSNIs(ctx context.Context) ([]*SNI, error)
+	CreateSNI(ctx context.Context, name string, certificateID string) (*SNI, error)
+	DeleteSNI(ctx context.Context, name string) error
+	Status(ctx context.Context) error
+}
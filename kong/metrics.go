@@ -0,0 +1,43 @@
+package kong
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/freshwebio/k8s-kong-api/metrics"
+)
+
+// The kinds of kong object the admin api endpoints we write to deal with.
+var operationKinds = map[string]bool{
+	"apis": true, "services": true, "routes": true, "plugins": true, "upstreams": true, "targets": true,
+	"consumers": true, "key-auth": true, "certificates": true, "snis": true,
+}
+
+// Counts the provided write to the kong admin api with the provided outcome,
+// reads aren't counted as they don't change anything in kong.
+func recordOperation(req *http.Request, result string) {
+	operation := ""
+	switch req.Method {
+	case "POST":
+		operation = "create"
+	case "PUT", "PATCH":
+		operation = "update"
+	case "DELETE":
+		operation = "delete"
+	default:
+		return
+	}
+	metrics.KongOperationsTotal.WithLabelValues(operation, operationKind(req.URL.Path), result).Inc()
+}
+
+// Provides the kind of kong object the provided admin api path deals with, the last collection
+// in the path, e.g. plugins for /apis/my-api/plugins/.
+func operationKind(path string) string {
+	kind := "other"
+	for _, segment := range strings.Split(path, "/") {
+		if operationKinds[segment] {
+			kind = segment
+		}
+	}
+	return kind
+}
@@ -0,0 +1,336 @@
+package kong
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/freshwebio/k8s-kong-api/redact"
+)
+
+const (
+	servicesEndpoint = "/services/"
+	routesEndpoint   = "/routes/"
+)
+
+// EnableServices makes the client represent API objects as a kong service with a single route
+// for kong 0.13 and later, which deprecate and eventually remove the /apis endpoint.
+// The API methods keep working the same way so the controllers don't need to know which model kong uses,
+// plugins are attached to the service. The http_if_terminated setting has no equivalent and is dropped.
+func (c *Client) EnableServices() {
+	c.services = true
+}
+
+// CreateService creates a new service in kong.
+func (c *Client) CreateService(ctx context.Context, service *Service) (*Service, error) {
+	created := &Service{}
+	if err := c.send(ctx, "POST", servicesEndpoint, "create service", service, created, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetService retrieves a service by it's name or id.
+func (c *Client) GetService(ctx context.Context, nameOrID string) (*Service, error) {
+	service := &Service{}
+	if err := c.send(ctx, "GET", servicesEndpoint+nameOrID, "get the "+nameOrID+" service", nil, service, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// ListServices retrieves every service in kong, following the pages
+// of the listing until all of them have been retrieved.
+func (c *Client) ListServices(ctx context.Context) ([]*Service, error) {
+	services := []*Service{}
+	offset := ""
+	for {
+		page := &ServiceList{}
+		if err := c.send(ctx, "GET", servicesEndpoint+pageQuery(offset), "list services", nil, page, http.StatusOK); err != nil {
+			return nil, err
+		}
+		services = append(services, page.Data...)
+		if page.Offset == "" || len(page.Data) == 0 {
+			return services, nil
+		}
+		offset = page.Offset
+	}
+}
+
+// UpdateService updates the service with the ID or name of the provided service.
+func (c *Client) UpdateService(ctx context.Context, service *Service) (*Service, error) {
+	nameOrID := service.ID
+	if nameOrID == "" {
+		nameOrID = service.Name
+	}
+	// The ID only identifies the service to update so it's left out of the payload.
+	payload := *service
+	payload.ID = ""
+	updated := &Service{}
+	if err := c.send(ctx, "PATCH", servicesEndpoint+nameOrID, "update the "+nameOrID+" service", &payload, updated, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteService removes the service with the provided name or id,
+// kong refuses to delete services that still have routes.
+func (c *Client) DeleteService(ctx context.Context, nameOrID string) error {
+	return c.send(ctx, "DELETE", servicesEndpoint+nameOrID, "delete the "+nameOrID+" service", nil, nil, http.StatusNoContent)
+}
+
+// ListServiceRoutes retrieves the routes sending traffic to the service with the provided name or id.
+func (c *Client) ListServiceRoutes(ctx context.Context, serviceNameOrID string) ([]*Route, error) {
+	routes := &RouteList{}
+	err := c.send(ctx, "GET", servicesEndpoint+serviceNameOrID+routesEndpoint, "list the routes of the "+serviceNameOrID+" service",
+		nil, routes, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return routes.Data, nil
+}
+
+// ListRoutes retrieves every route in kong, following the pages
+// of the listing until all of them have been retrieved.
+func (c *Client) ListRoutes(ctx context.Context) ([]*Route, error) {
+	routes := []*Route{}
+	offset := ""
+	for {
+		page := &RouteList{}
+		if err := c.send(ctx, "GET", routesEndpoint+pageQuery(offset), "list routes", nil, page, http.StatusOK); err != nil {
+			return nil, err
+		}
+		routes = append(routes, page.Data...)
+		if page.Offset == "" || len(page.Data) == 0 {
+			return routes, nil
+		}
+		offset = page.Offset
+	}
+}
+
+// CreateRoute creates a new route in kong for the service it references.
+func (c *Client) CreateRoute(ctx context.Context, route *Route) (*Route, error) {
+	created := &Route{}
+	if err := c.send(ctx, "POST", routesEndpoint, "create route", route, created, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateRoute updates the route with the ID of the provided route.
+func (c *Client) UpdateRoute(ctx context.Context, route *Route) (*Route, error) {
+	payload := *route
+	payload.ID = ""
+	updated := &Route{}
+	if err := c.send(ctx, "PATCH", routesEndpoint+route.ID, "update the "+route.ID+" route", &payload, updated, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteRoute removes the route with the provided id.
+func (c *Client) DeleteRoute(ctx context.Context, id string) error {
+	return c.send(ctx, "DELETE", routesEndpoint+id, "delete the "+id+" route", nil, nil, http.StatusNoContent)
+}
+
+// Sends a request with the provided JSON payload to the provided path of the kong admin api, decoding the
+// response into out when it has the expected status code. A missing object is reported as ErrNotFound.
+func (c *Client) send(ctx context.Context, method string, path string, description string, payload interface{}, out interface{}, expected int) error {
+	b := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(b).Encode(payload); err != nil {
+			return err
+		}
+		log.Printf("\nMaking request to the kong admin api (%v) to %v with payload:\n%v\n",
+			c.host+":"+c.port, description, redact.JSON(b.Bytes()))
+	} else {
+		log.Printf("\nMaking request to the kong admin api (%v) to %v\n", c.host+":"+c.port, description)
+	}
+	req, err := newRequest(ctx, method, c.host+":"+c.port+path, b)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	} else if resp.StatusCode != expected {
+		return fmt.Errorf("Failed to %v with status code %v", description, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func pageQuery(offset string) string {
+	if offset == "" {
+		return "?size=100"
+	}
+	return "?size=100&offset=" + url.QueryEscape(offset)
+}
+
+// Provides the service the provided API object's upstream half is represented by.
+func serviceFor(api *API) *Service {
+	return &Service{Name: api.Name, URL: api.UpstreamURL, Retries: api.Retries, ConnectTimeout: api.UpstreamConnectTimeout,
+		WriteTimeout: api.UpstreamSendTimeout, ReadTimeout: api.UpstreamReadTimeout}
+}
+
+// Provides the route the provided API object's matching half is represented by,
+// sending traffic to the service with the provided id.
+func routeFor(api *API, serviceID string) *Route {
+	route := &Route{Methods: api.Methods, Hosts: api.Hosts, Paths: api.URIs, StripPath: api.StripURI,
+		PreserveHost: api.PreserveHost, Service: &ServiceID{ID: serviceID}}
+	if api.HTTPSOnly != nil && *api.HTTPSOnly {
+		route.Protocols = []string{"https"}
+	} else {
+		route.Protocols = []string{"http", "https"}
+	}
+	return route
+}
+
+// Provides the API object the provided service and its route represent, the route is nil
+// when the service doesn't have one yet.
+func apiFor(service *Service, route *Route) *API {
+	api := &API{ID: service.ID, Name: service.Name, UpstreamURL: upstreamURLOf(service), Retries: service.Retries,
+		UpstreamConnectTimeout: service.ConnectTimeout, UpstreamSendTimeout: service.WriteTimeout,
+		UpstreamReadTimeout: service.ReadTimeout}
+	if route == nil {
+		return api
+	}
+	httpsOnly := len(route.Protocols) == 1 && route.Protocols[0] == "https"
+	api.Hosts, api.URIs, api.Methods = route.Hosts, route.Paths, route.Methods
+	api.StripURI, api.PreserveHost, api.HTTPSOnly = route.StripPath, route.PreserveHost, &httpsOnly
+	return api
+}
+
+// Provides the URL of the upstream of the provided service, the port is left out for host names
+// on the default port of the protocol as that's how URLs pointing at kong upstreams are written.
+func upstreamURLOf(service *Service) string {
+	if service.URL != "" {
+		return service.URL
+	}
+	host := service.Host
+	defaultPort := (service.Protocol == "http" && service.Port == 80) || (service.Protocol == "https" && service.Port == 443)
+	if net.ParseIP(service.Host) != nil || !defaultPort {
+		host += ":" + strconv.Itoa(service.Port)
+	}
+	return service.Protocol + "://" + host + service.Path
+}
+
+// Retrieves the API object the service with the provided name or id represents.
+func (c *Client) getServiceAPI(ctx context.Context, nameOrID string) (*API, error) {
+	service, err := c.GetService(ctx, nameOrID)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := c.ListServiceRoutes(ctx, service.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return apiFor(service, nil), nil
+	}
+	return apiFor(service, routes[0]), nil
+}
+
+// Retrieves the API objects every service in kong represents.
+func (c *Client) listServiceAPIs(ctx context.Context) ([]*API, error) {
+	services, err := c.ListServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := c.ListRoutes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	routesByService := make(map[string]*Route)
+	for _, route := range routes {
+		if route.Service != nil && routesByService[route.Service.ID] == nil {
+			routesByService[route.Service.ID] = route
+		}
+	}
+	apis := make([]*API, 0, len(services))
+	for _, service := range services {
+		apis = append(apis, apiFor(service, routesByService[service.ID]))
+	}
+	return apis, nil
+}
+
+// Creates the service and route the provided API object is represented by.
+func (c *Client) createServiceAPI(ctx context.Context, api *API) (*API, error) {
+	service, err := c.CreateService(ctx, serviceFor(api))
+	if err != nil {
+		return nil, err
+	}
+	route, err := c.CreateRoute(ctx, routeFor(api, service.ID))
+	if err != nil {
+		return nil, err
+	}
+	return apiFor(service, route), nil
+}
+
+// Updates the service and route the provided API object is represented by,
+// the route is created when the service doesn't have one yet.
+func (c *Client) updateServiceAPI(ctx context.Context, api *API) (*API, error) {
+	desired := serviceFor(api)
+	desired.ID = api.ID
+	service, err := c.UpdateService(ctx, desired)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := c.ListServiceRoutes(ctx, service.ID)
+	if err != nil {
+		return nil, err
+	}
+	route := routeFor(api, service.ID)
+	if len(routes) == 0 {
+		route, err = c.CreateRoute(ctx, route)
+	} else {
+		route.ID = routes[0].ID
+		route, err = c.UpdateRoute(ctx, route)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return apiFor(service, route), nil
+}
+
+// Deletes the service the API object with the provided name or id is represented by along with its routes.
+func (c *Client) deleteServiceAPI(ctx context.Context, nameOrID string) error {
+	routes, err := c.ListServiceRoutes(ctx, nameOrID)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		if err = c.DeleteRoute(ctx, route.ID); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+	return c.DeleteService(ctx, nameOrID)
+}
+
+// Provides the endpoint plugins are attached to the API objects with, either the APIs or the services.
+func (c *Client) pluginParentsEndpoint() string {
+	if c.services {
+		return servicesEndpoint
+	}
+	return apisEndpoint
+}
+
+// Provides the path of the plugin with the provided ID attached to the API object with the provided name.
+func (c *Client) pluginPath(apiName string, pluginID string) string {
+	if c.services {
+		return pluginsEndpoint + pluginID
+	}
+	return apisEndpoint + apiName + pluginsEndpoint + pluginID
+}
@@ -0,0 +1,166 @@
+package kong
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// The weight targets end up with once they are fully enabled, unless SetDefaults says otherwise.
+const fullTargetWeight = 10
+
+// The most steps a slow start ramp takes to get a target up to full weight, every step
+// adds an entry to the history of the upstream so the ramp is kept coarse whatever the target weight.
+const maxRampSteps = 5
+
+// RampWait blocks until the next step of a slow start ramp can be written to the kong admin api,
+// e.g. until the write rate limit of the namespace the target belongs to lets it through.
+// The ramp is abandoned when an error is returned.
+type RampWait func(ctx context.Context) error
+
+// Keeps track of the targets currently having their weight ramped up
+// so a ramp can be cancelled when the target gets disabled or enabled again.
+// Ramps are stopped once the context they run under is done.
+type slowStart struct {
+	ctx           context.Context
+	period        time.Duration
+	initialWeight int
+	mu            sync.Mutex
+	ramps         map[string]chan struct{}
+}
+
+// EnableSlowStart makes EnableTarget register new targets with the provided initial weight
+// and ramp them up to full weight over the provided period instead of jumping straight to full weight,
+// this avoids sending a full share of traffic to cold pods. Initial weights above the target weight are capped to it.
+// Ramps run in the background until the provided context is done, so it should live as long as the controllers do.
+// A period of 0 disables slow start.
+func (c *Client) EnableSlowStart(ctx context.Context, period time.Duration, initialWeight int) {
+	if period <= 0 {
+		c.slowStart = nil
+		return
+	}
+	if initialWeight < 1 {
+		initialWeight = 1
+	}
+	c.slowStart = &slowStart{ctx: ctx, period: period, initialWeight: initialWeight, ramps: make(map[string]chan struct{})}
+}
+
+// Registers a ramp for the provided target, cancelling any ramp already in progress for it.
+func (s *slowStart) begin(upstreamNameOrId string, targetHost string) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := upstreamNameOrId + "/" + targetHost
+	if cancel, exists := s.ramps[key]; exists {
+		close(cancel)
+	}
+	cancel := make(chan struct{})
+	s.ramps[key] = cancel
+	return cancel
+}
+
+// Registers a ramp for the provided target like begin, unless there is already one
+// in progress for it in which case that ramp is left to carry on and nil is provided.
+func (s *slowStart) resume(upstreamNameOrId string, targetHost string) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := upstreamNameOrId + "/" + targetHost
+	if _, exists := s.ramps[key]; exists {
+		return nil
+	}
+	cancel := make(chan struct{})
+	s.ramps[key] = cancel
+	return cancel
+}
+
+// Cancels the ramp in progress for the provided target if there is one.
+func (s *slowStart) cancel(upstreamNameOrId string, targetHost string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := upstreamNameOrId + "/" + targetHost
+	if cancel, exists := s.ramps[key]; exists {
+		close(cancel)
+		delete(s.ramps, key)
+	}
+}
+
+// Removes the ramp for the provided target once it has finished,
+// as long as it hasn't since been replaced by a new ramp.
+func (s *slowStart) finish(upstreamNameOrId string, targetHost string, cancel <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := upstreamNameOrId + "/" + targetHost
+	if current, exists := s.ramps[key]; exists && current == cancel {
+		delete(s.ramps, key)
+	}
+}
+
+// ResumeTarget carries on ramping up the weight of the provided target from the provided weight it was left at,
+// e.g. by a restart or a change of leader part way through its slow start, over the share of the slow start period
+// that was left. A ramp already in progress for the target is left to finish. Without slow start the target
+// is given the target weight straight away. Every write made for the target waits on the provided function first.
+func (c *Client) ResumeTarget(ctx context.Context, upstreamNameOrId string, targetHost string, weight int, wait RampWait) error {
+	s := c.slowStart
+	if s == nil {
+		if err := wait(ctx); err != nil {
+			return err
+		}
+		_, err := c.newTargetEntry(ctx, upstreamNameOrId, targetHost, c.targetWeight)
+		return err
+	}
+	cancel := s.resume(upstreamNameOrId, targetHost)
+	if cancel == nil {
+		return nil
+	}
+	go c.rampTarget(s, upstreamNameOrId, targetHost, weight, wait, cancel)
+	return nil
+}
+
+// Steps the weight of the provided target up from the provided weight to full weight evenly over the share
+// of the slow start period the remaining weight makes up. Each step adds a new entry to the target history
+// as that is how kong picks up the latest weight for a target, so the ramp takes at most maxRampSteps steps
+// and each of them waits on the provided function before it is written.
+// The ramp outlives the request that enabled the target so it runs under the context of the slow start instead,
+// it stops when that context is done, when the ramp is cancelled or when a step can't be written.
+func (c *Client) rampTarget(s *slowStart, upstreamNameOrId string, targetHost string, from int, wait RampWait,
+	cancel <-chan struct{}) {
+	defer s.finish(upstreamNameOrId, targetHost, cancel)
+	remaining := c.targetWeight - from
+	if remaining <= 0 {
+		return
+	}
+	steps := remaining
+	if steps > maxRampSteps {
+		steps = maxRampSteps
+	}
+	period := s.period
+	if span := c.targetWeight - s.initialWeight; span > remaining {
+		period = period * time.Duration(remaining) / time.Duration(span)
+	}
+	ticker := time.NewTicker(period / time.Duration(steps))
+	defer ticker.Stop()
+	for step := 1; step <= steps; step++ {
+		select {
+		case <-cancel:
+			return
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		weight := from + remaining*step/steps
+		if err := wait(s.ctx); err != nil {
+			return
+		}
+		select {
+		case <-cancel:
+			// The target was disabled or enabled again while the step was waiting.
+			return
+		default:
+		}
+		if _, err := c.newTargetEntry(s.ctx, upstreamNameOrId, targetHost, weight); err != nil {
+			log.Printf("Failed to ramp the weight of the %v target for the %v upstream to %v: %v",
+				targetHost, upstreamNameOrId, weight, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package kong
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/freshwebio/k8s-kong-api/redact"
+)
+
+// TLSOptions provides how the client verifies the kong admin api and authenticates to it when it's served over HTTPS.
+type TLSOptions struct {
+	// The path of a PEM encoded bundle of the CAs the certificate of the kong admin api is verified against,
+	// empty to use the CAs of the system.
+	CAFile string
+	// The name the certificate of the kong admin api is verified for, empty for the kong host.
+	ServerName string
+	// Whether the certificate of the kong admin api isn't verified at all.
+	InsecureSkipVerify bool
+	// The paths of the PEM encoded client certificate and key presented to kong admin apis requiring mutual TLS.
+	CertFile string
+	KeyFile  string
+	// The PEM encoded client certificate and key, e.g. read from a Secret, used when the files aren't provided.
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// ConfigureTLS makes the client verify the certificate of the kong admin api following the provided options,
+// presenting the client certificate of the options when one is provided. The certificate is only loaded here
+// so the controller has to be restarted to pick up a renewed certificate.
+// It should be called before EnableDryRun as it replaces the transport of the client.
+func (c *Client) ConfigureTLS(opts TLSOptions) error {
+	config := &tls.Config{ServerName: opts.ServerName, InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CAFile != "" {
+		bundle, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(bundle) {
+			return fmt.Errorf("The %v CA bundle doesn't contain any PEM encoded certificates", opts.CAFile)
+		}
+		config.RootCAs = roots
+	}
+	certPEM, keyPEM := opts.CertPEM, opts.KeyPEM
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		var err error
+		if certPEM, err = ioutil.ReadFile(opts.CertFile); err != nil {
+			return err
+		}
+		if keyPEM, err = ioutil.ReadFile(opts.KeyFile); err != nil {
+			return err
+		}
+	}
+	if len(certPEM) > 0 || len(keyPEM) > 0 {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return fmt.Errorf("Failed to load the client certificate for the kong admin api: %v", err)
+		}
+		redact.AddValue(string(keyPEM))
+		config.Certificates = []tls.Certificate{cert}
+	}
+	c.tlsConfig = config
+	c.resetTransport()
+	return nil
+}
+
+// UseSocket makes the client reach the kong admin api through the unix socket at the provided path
+// instead of konghost and kongport, e.g. when running as a sidecar next to kong.
+// It should be called before EnableDryRun as it replaces the transport of the client.
+func (c *Client) UseSocket(path string) {
+	c.socket = path
+	c.resetTransport()
+}
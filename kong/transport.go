@@ -0,0 +1,74 @@
+package kong
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPOptions provides how the client's requests to the kong admin api are timed out
+// and how its connections are made and pooled.
+type HTTPOptions struct {
+	// The longest a single request can take, reading the response included, 0 for no limit.
+	Timeout time.Duration
+	// The longest establishing a connection to the kong admin api can take, 0 for no limit.
+	DialTimeout time.Duration
+	// The period of the TCP keep-alive probes sent on open connections, 0 to not send any.
+	KeepAlive time.Duration
+	// Whether HTTP keep-alives are disabled so every request opens a new connection rather than reusing an idle one.
+	DisableKeepAlives bool
+	// The number of idle connections kept open to the kong admin api for reuse, 0 for no limit.
+	MaxIdleConns int
+}
+
+// DefaultHTTPOptions provides the HTTP options the client starts out with, they're the ones of
+// http.DefaultTransport apart from the request timeout it doesn't have and keeping every idle connection
+// for the kong admin api instead of only two, as it's the only host the client talks to.
+var DefaultHTTPOptions = HTTPOptions{Timeout: 30 * time.Second, DialTimeout: 30 * time.Second,
+	KeepAlive: 30 * time.Second, MaxIdleConns: 100}
+
+// ConfigureHTTP makes the client time out requests and make and pool its connections following the provided options.
+// It should be called before EnableDryRun as it replaces the transport of the client.
+func (c *Client) ConfigureHTTP(opts HTTPOptions) {
+	c.httpOptions = opts
+	c.resetTransport()
+}
+
+// Replaces the HTTP client with one following the HTTP options, TLS config and unix socket of the client.
+func (c *Client) resetTransport() {
+	c.client = &http.Client{Transport: c.newTransport(), Timeout: c.httpOptions.Timeout}
+}
+
+// Provides a transport set up following the HTTP options and TLS config of the client,
+// dialing the unix socket of the client instead of the kong host when it has one.
+func (c *Client) newTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   c.httpOptions.DialTimeout,
+		KeepAlive: c.httpOptions.KeepAlive,
+	}
+	dial := dialer.DialContext
+	if c.socket != "" {
+		dial = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", c.socket)
+		}
+	}
+	// The transport falls back to keeping two idle connections per host when it isn't given a limit,
+	// so no limit has to be spelt out as the largest one possible.
+	maxIdleConnsPerHost := c.httpOptions.MaxIdleConns
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = math.MaxInt32
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dial,
+		MaxIdleConns:          c.httpOptions.MaxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		DisableKeepAlives:     c.httpOptions.DisableKeepAlives,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       c.tlsConfig,
+	}
+}
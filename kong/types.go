@@ -11,7 +11,7 @@ type API struct {
 	StripURI               *bool    `json:"strip_uri,omitempty"`
 	Methods                []string `json:"methods,omitempty"`
 	PreserveHost           *bool    `json:"preserve_host,omitempty"`
-	Retries                int64    `json:"retries,omitempty"`
+	Retries                *int64   `json:"retries,omitempty"`
 	UpstreamConnectTimeout int64    `json:"upstream_connect_timeout,omitempty"`
 	UpstreamSendTimeout    int64    `json:"upstream_send_timeout,omitempty"`
 	UpstreamReadTimeout    int64    `json:"upstream_read_timeout,omitempty"`
@@ -19,6 +19,14 @@ type API struct {
 	HTTPIfTerminated       *bool    `json:"http_if_terminated,omitempty"`
 }
 
+// APIList provides the data structure for a page of API objects,
+// Offset is set when there are more pages to retrieve.
+type APIList struct {
+	Total  int    `json:"total"`
+	Data   []*API `json:"data"`
+	Offset string `json:"offset,omitempty"`
+}
+
 // Upstream provides a subset of the kong Upstream object.
 // We only care about the name, maybe in the future it will be worth supporting
 // the other properties.
@@ -34,30 +42,163 @@ type Target struct {
 	Target     string `json:"target"`
 	Weight     int    `json:"weight"`
 	UpstreamID string `json:"upstream_id,omitempty"`
-	Created    int    `json:"created_at,omitempty"`
+	// Kong 0.10 reports the creation time in milliseconds while later versions
+	// report it in seconds with a fraction, so it's only good for ordering targets.
+	Created float64 `json:"created_at,omitempty"`
 }
 
 // TargetList provides the data structure
 // for a list of upstream targets.
 type TargetList struct {
-	Total int       `json:"total"`
-	Data  []*Target `json:"data"`
+	Total  int       `json:"total"`
+	Data   []*Target `json:"data"`
+	Offset string    `json:"offset,omitempty"`
 }
 
 // Plugin provides the data structure for
 // a Plugin object to be attached to APIs.
 type Plugin struct {
-	ID      string                 `json:"id,omitempty"`
-	APIID   string                 `json:"api_id,omitempty"`
-	Name    string                 `json:"name"`
-	Config  map[string]interface{} `json:"config"`
-	Enabled *bool                  `json:"enabled,omitempty"`
-	Created int                    `json:"created_at,omitempty"`
+	ID         string                 `json:"id,omitempty"`
+	APIID      string                 `json:"api_id,omitempty"`
+	ConsumerID string                 `json:"consumer_id,omitempty"`
+	Service    *ServiceID             `json:"service,omitempty"`
+	Route      *ObjectID              `json:"route,omitempty"`
+	Consumer   *ObjectID              `json:"consumer,omitempty"`
+	Name       string                 `json:"name"`
+	Config     map[string]interface{} `json:"config"`
+	Enabled    *bool                  `json:"enabled,omitempty"`
+	Created    float64                `json:"created_at,omitempty"`
+}
+
+// Global lets us know whether the plugin applies to every request through kong,
+// rather than being attached to an API, service, route or consumer.
+func (p *Plugin) Global() bool {
+	return p.APIID == "" && p.ConsumerID == "" && p.Service == nil && p.Route == nil && p.Consumer == nil
+}
+
+// ObjectID provides a reference to another kong object by its id,
+// the way kong 0.13 and later reference the objects plugins are attached to.
+type ObjectID struct {
+	ID string `json:"id"`
 }
 
 // PluginList represents the data structure returned from kong
 // when making a request to retrieve a list of plugins.
+// Offset is set when there are more pages to retrieve.
 type PluginList struct {
-	Total int       `json:"total"`
-	Data  []*Plugin `json:"data"`
+	Total  int       `json:"total"`
+	Data   []*Plugin `json:"data"`
+	Offset string    `json:"offset,omitempty"`
+}
+
+// Service provides a subset of the kong Service object introduced with kong 0.13,
+// it holds the upstream half of what used to be an API object.
+// The URL is only ever sent to kong, which breaks it down into the protocol, host, port and path.
+type Service struct {
+	ID             string `json:"id,omitempty"`
+	Name           string `json:"name"`
+	URL            string `json:"url,omitempty"`
+	Protocol       string `json:"protocol,omitempty"`
+	Host           string `json:"host,omitempty"`
+	Port           int    `json:"port,omitempty"`
+	Path           string `json:"path,omitempty"`
+	Retries        *int64 `json:"retries,omitempty"`
+	ConnectTimeout int64  `json:"connect_timeout,omitempty"`
+	WriteTimeout   int64  `json:"write_timeout,omitempty"`
+	ReadTimeout    int64  `json:"read_timeout,omitempty"`
+}
+
+// ServiceList provides the data structure for a page of Service objects,
+// Offset is set when there are more pages to retrieve.
+type ServiceList struct {
+	Data   []*Service `json:"data"`
+	Offset string     `json:"offset,omitempty"`
+}
+
+// Route provides a subset of the kong Route object introduced with kong 0.13,
+// it holds the matching half of what used to be an API object.
+type Route struct {
+	ID           string     `json:"id,omitempty"`
+	Protocols    []string   `json:"protocols,omitempty"`
+	Methods      []string   `json:"methods,omitempty"`
+	Hosts        []string   `json:"hosts,omitempty"`
+	Paths        []string   `json:"paths,omitempty"`
+	StripPath    *bool      `json:"strip_path,omitempty"`
+	PreserveHost *bool      `json:"preserve_host,omitempty"`
+	Service      *ServiceID `json:"service,omitempty"`
+}
+
+// ServiceID provides the reference from a route to the service it sends traffic to.
+type ServiceID struct {
+	ID string `json:"id"`
+}
+
+// RouteList provides the data structure for a page of Route objects,
+// Offset is set when there are more pages to retrieve.
+type RouteList struct {
+	Data   []*Route `json:"data"`
+	Offset string   `json:"offset,omitempty"`
+}
+
+// Consumer provides the kong Consumer object, which identifies a client of the APIs
+// by its username, its custom id or both.
+type Consumer struct {
+	ID       string  `json:"id,omitempty"`
+	Username string  `json:"username,omitempty"`
+	CustomID string  `json:"custom_id,omitempty"`
+	Created  float64 `json:"created_at,omitempty"`
+}
+
+// KeyAuthCredential provides the kong key-auth credential object a consumer
+// is identified by when calling APIs with the key-auth plugin attached.
+type KeyAuthCredential struct {
+	ID         string  `json:"id,omitempty"`
+	Key        string  `json:"key"`
+	ConsumerID string  `json:"consumer_id,omitempty"`
+	Created    float64 `json:"created_at,omitempty"`
+}
+
+// KeyAuthCredentialList provides the data structure for a page of key-auth credentials,
+// Offset is set when there are more pages to retrieve.
+type KeyAuthCredentialList struct {
+	Data   []*KeyAuthCredential `json:"data"`
+	Offset string               `json:"offset,omitempty"`
+}
+
+// Certificate provides the kong Certificate object holding a PEM encoded certificate
+// and private key used to terminate HTTPS for the SNIs that reference it.
+type Certificate struct {
+	ID      string  `json:"id,omitempty"`
+	Cert    string  `json:"cert"`
+	Key     string  `json:"key"`
+	Created float64 `json:"created_at,omitempty"`
+}
+
+// CertificateID provides the reference from an SNI to its certificate in kong 1.0 and later.
+type CertificateID struct {
+	ID string `json:"id"`
+}
+
+// SNI provides the kong SNI object matching a host name to the certificate served for it.
+// Kong versions before 1.0 reference the certificate by SSLCertificateID, later ones by Certificate.
+type SNI struct {
+	Name             string         `json:"name"`
+	SSLCertificateID string         `json:"ssl_certificate_id,omitempty"`
+	Certificate      *CertificateID `json:"certificate,omitempty"`
+	Created          float64        `json:"created_at,omitempty"`
+}
+
+// CertificateRef provides the id of the certificate the SNI references.
+func (s *SNI) CertificateRef() string {
+	if s.Certificate != nil {
+		return s.Certificate.ID
+	}
+	return s.SSLCertificateID
+}
+
+// SNIList provides the data structure for a page of SNI objects,
+// Offset is set when there are more pages to retrieve.
+type SNIList struct {
+	Data   []*SNI `json:"data"`
+	Offset string `json:"offset,omitempty"`
 }
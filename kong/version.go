@@ -0,0 +1,97 @@
+package kong
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The first kong version with services and routes.
+const (
+	servicesMajorVersion = 0
+	servicesMinorVersion = 13
+)
+
+// Version retrieves the version of kong behind the admin api from the root endpoint, e.g. 0.13.1.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	req, err := newRequest(ctx, "GET", c.host+":"+c.port+"/", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Failed to retrieve the kong node information with status code %v", resp.StatusCode)
+	}
+	var info struct {
+		Version string `json:"version"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", err
+	}
+	if info.Version == "" {
+		return "", errors.New("The kong node information doesn't include a version")
+	}
+	return info.Version, nil
+}
+
+// AdaptTo sets the client up to write to the provided version of kong, e.g. 0.10.3 or 1.0.
+// Kong 0.13 and later are written to as services and routes, see EnableServices, while earlier versions
+// are written to as API objects. Target entries can only be deleted from kong 1.0 and later. Enterprise versions like 0.34-1 are compared on their major and minor versions alone.
+func (c *Client) AdaptTo(version string) error {
+	major, minor, err := parseVersion(version)
+	if err != nil {
+		return err
+	}
+	c.targetDeletes = major >= 1
+	c.certificateRefs = major >= 1
+	if major > servicesMajorVersion || (major == servicesMajorVersion && minor >= servicesMinorVersion) {
+		log.Printf("Writing to kong %v as services and routes", version)
+		c.EnableServices()
+		return nil
+	}
+	log.Printf("Writing to kong %v as API objects", version)
+	c.services = false
+	return nil
+}
+
+// DetectVersion retrieves the version of kong behind the admin api and sets the client up to write to it,
+// so a single build of the controller works across every version of kong it supports.
+// Lets us know the version that was detected.
+func (c *Client) DetectVersion(ctx context.Context) (string, error) {
+	version, err := c.Version(ctx)
+	if err != nil {
+		return "", err
+	}
+	return version, c.AdaptTo(version)
+}
+
+// Provides the major and minor version of the provided kong version.
+func parseVersion(version string) (int, int, error) {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("Failed to parse the kong version %v", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Failed to parse the kong version %v", version)
+	}
+	// Anything after the minor version, like the -1 of enterprise releases, is ignored.
+	minorDigits := parts[1]
+	if end := strings.IndexFunc(minorDigits, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+		minorDigits = minorDigits[:end]
+	}
+	minor, err := strconv.Atoi(minorDigits)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Failed to parse the kong version %v", version)
+	}
+	return major, minor, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Retrieves the Secret referenced as <namespace>/<name>, a reference without a namespace
+// refers to a Secret in the default namespace.
+func secretByRef(cli *k8sclient.Client, ref string) (*v1.Secret, error) {
+	namespace, name := "default", ref
+	if parts := strings.SplitN(ref, "/", 2); len(parts) == 2 {
+		namespace, name = parts[0], parts[1]
+	}
+	if namespace == "" || name == "" {
+		return nil, fmt.Errorf("Expected a Secret reference of the form <namespace>/<name> but got %v", ref)
+	}
+	return cli.Clientset.CoreV1().Secrets(namespace).Get(name)
+}
+
+// Provides the PEM encoded client certificate and key held by the kubernetes.io/tls Secret with the provided reference.
+func kongClientCertificate(cli *k8sclient.Client, ref string) ([]byte, []byte, error) {
+	secret, err := secretByRef(cli, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, key := secret.Data[v1.TLSCertKey], secret.Data[v1.TLSPrivateKeyKey]
+	if len(cert) == 0 || len(key) == 0 {
+		return nil, nil, fmt.Errorf("The %v Secret doesn't hold a %v and %v", ref, v1.TLSCertKey, v1.TLSPrivateKeyKey)
+	}
+	return cert, key, nil
+}
+
+// Makes the provided kong client authenticate with the credentials in the Secret with the provided reference.
+// Secrets holding a username and password, like kubernetes.io/basic-auth Secrets, are sent as basic auth,
+// otherwise the value under the provided key is sent in the header with the provided name.
+func configureKongAuth(cli *k8sclient.Client, kongClient *kong.Client, ref string, header string, key string) error {
+	secret, err := secretByRef(cli, ref)
+	if err != nil {
+		return err
+	}
+	username, password := secret.Data["username"], secret.Data["password"]
+	if len(username) > 0 && len(password) > 0 {
+		kongClient.SetBasicAuth(string(username), string(password))
+		return nil
+	}
+	value := secret.Data[key]
+	if len(value) == 0 {
+		return fmt.Errorf("The %v Secret holds neither a username and password nor a %v", ref, key)
+	}
+	kongClient.SetHeader(header, strings.TrimSpace(string(value)))
+	return nil
+}
+
+// Provides the Kong Enterprise RBAC token to send to the kong admin api, read from the file at the provided path
+// when one is provided, e.g. a key of a mounted Secret, otherwise the provided token is used as it is.
+func kongAdminToken(token string, file string) (string, error) {
+	if file == "" {
+		return strings.TrimSpace(token), nil
+	}
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if token = strings.TrimSpace(string(contents)); token == "" {
+		return "", fmt.Errorf("The %v file doesn't hold a token", file)
+	}
+	return token, nil
+}
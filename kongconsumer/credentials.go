@@ -0,0 +1,142 @@
+package kongconsumer
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/redact"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/selection"
+	"k8s.io/client-go/pkg/watch"
+)
+
+// Brings the key-auth credentials of the kong consumer owned by the KongConsumer resource with the provided
+// namespace and name in line with the keys of the Secrets labelled for it. When the key of a Secret changes the
+// new credential is created before the old one is deleted so clients can move over without being locked out.
+// Nothing is done until the consumer has been created, the credentials are synced along with it.
+func (s *Service) syncCredentials(ctx context.Context, namespace string, name string) error {
+	consumerID := s.ownedConsumerID(namespace, name)
+	if consumerID == "" {
+		return nil
+	}
+	desired := make(map[string]string)
+	for _, secret := range s.consumerSecrets(namespace, name) {
+		key := string(secret.Data[KeyAuthSecretKey])
+		if key == "" {
+			log.Printf("The %v/%v Secret doesn't have a %v to provision as a key-auth credential",
+				namespace, secret.GetName(), KeyAuthSecretKey)
+			continue
+		}
+		redact.AddValue(key)
+		desired[key] = secretOwner(namespace, secret.GetName())
+	}
+	current, err := s.kongClient.ListKeyAuthCredentials(ctx, consumerID)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]*kong.KeyAuthCredential)
+	for _, credential := range current {
+		existing[credential.Key] = credential
+	}
+	for key, owner := range desired {
+		if credential, exists := existing[key]; exists {
+			if err = s.registry.Claim(ownership.KindKeyAuth, credential.ID, owner); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Printf("Creating a key-auth credential for the kong consumer %v from %v", consumerID, owner)
+		if err := s.limiter.WaitWrite(ctx, namespace); err != nil {
+			return err
+		}
+		created, err := s.kongClient.CreateKeyAuthCredential(ctx, consumerID, &kong.KeyAuthCredential{Key: key})
+		if err != nil {
+			return err
+		}
+		if err = s.registry.Claim(ownership.KindKeyAuth, created.ID, owner); err != nil {
+			return err
+		}
+	}
+	// Only credentials provisioned from Secrets are removed, ones added to the consumer by other means are left alone.
+	owned := s.registry.Owned(ownership.KindKeyAuth)
+	for _, credential := range current {
+		owner, isOwned := owned[credential.ID]
+		if !isOwned || desired[credential.Key] == owner {
+			continue
+		}
+		log.Printf("Deleting the key-auth credential %v of the kong consumer %v as it's no longer in %v",
+			credential.ID, consumerID, owner)
+		if err := s.limiter.WaitWrite(ctx, namespace); err != nil {
+			return err
+		}
+		if err = s.kongClient.DeleteKeyAuthCredential(ctx, consumerID, credential.ID); err != nil && err != kong.ErrNotFound {
+			return err
+		}
+		if err = s.registry.Release(ownership.KindKeyAuth, credential.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Provides the cached Secrets labelled for the KongConsumer resource with the provided namespace and name.
+func (s *Service) consumerSecrets(namespace string, name string) []*v1.Secret {
+	secrets := []*v1.Secret{}
+	if s.secretStore == nil {
+		return secrets
+	}
+	for _, obj := range s.secretStore.List() {
+		secret, ok := obj.(*v1.Secret)
+		if !ok || secret.GetNamespace() != namespace || secret.Labels[CredentialLabel] != name {
+			continue
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets
+}
+
+// Provides the owner recorded in the ownership registry for the credentials provisioned from a Secret.
+func secretOwner(namespace string, name string) string {
+	return fmt.Sprintf("secret/%v/%v", namespace, name)
+}
+
+// Queues the KongConsumer resources whose credentials need syncing to be reconciled
+// whenever a Secret with the credential label is added, changed or removed. When the label of a Secret
+// is changed both the consumer it used to be labelled for and the one it's now labelled for are synced.
+func (s *Service) monitorSecretEvents() {
+	selector := labels.NewSelector()
+	req, err := labels.NewRequirement(CredentialLabel, selection.Exists, []string{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	selector = selector.Add(*req)
+	eventCallback := func(obj interface{}) {
+		secret, ok := obj.(*v1.Secret)
+		if !ok {
+			log.Printf("could not convert %v (%T) into Secret", obj, obj)
+			return
+		}
+		metrics.ObserveDelivery("kongconsumer", "secrets", func() {
+			if s.dbless || s.declarative {
+				return
+			}
+			s.queueConsumer(secret.GetNamespace(), secret.Labels[CredentialLabel])
+		})
+	}
+	watcher := s.informers.Secrets(selector)
+	s.secretStore = watcher.Store()
+	s.synced = append(s.synced, watcher.HasSynced)
+	watcher.SubscribeChanges(func(evType watch.EventType, old interface{}, new interface{}) {
+		oldSecret, ook := old.(*v1.Secret)
+		newSecret, nok := new.(*v1.Secret)
+		if ook && nok && oldSecret.Labels[CredentialLabel] != newSecret.Labels[CredentialLabel] {
+			eventCallback(old)
+		}
+		eventCallback(new)
+	})
+}
@@ -0,0 +1,39 @@
+package kongconsumer
+
+import (
+	"errors"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+)
+
+// HasSynced lets us know whether the KongConsumer resource cache has been loaded.
+func (s *Service) HasSynced() bool {
+	if len(s.synced) == 0 {
+		return false
+	}
+	for _, synced := range s.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Declare adds the consumers the cached KongConsumer resources reconciled by this instance call for
+// to the provided declarative configuration, resources without a username or custom id are left out.
+func (s *Service) Declare(cfg *kong.DeclarativeConfig) error {
+	if !s.HasSynced() {
+		return errors.New("The kong consumer cache hasn't synced yet")
+	}
+	consumers, err := s.consumers.List()
+	if err != nil {
+		return err
+	}
+	for _, consumer := range consumers {
+		if !s.reconciles(consumer.Metadata.Namespace) || (consumer.Spec.Username == "" && consumer.Spec.CustomID == "") {
+			continue
+		}
+		cfg.AddConsumer(&kong.Consumer{Username: consumer.Spec.Username, CustomID: consumer.Spec.CustomID})
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package kongconsumer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewInformer creates a shared informer caching the KongConsumer resources in the provided namespaces
+// that match the provided label selector and belong to the provided controller class,
+// the cache is indexed by namespace.
+// Lists are abandoned and watches stopped once the provided context is done.
+func NewInformer(ctx context.Context, client *Client, namespaces []string, selector labels.Selector,
+	class string) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		k8sclient.NamespacesListWatch(namespaces, func(namespace string) *cache.ListWatch {
+			return client.ListWatch(ctx, namespace, selector, class)
+		}), &KongConsumer{}, 0,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// Lister provides typed reads of the KongConsumer resources in an informer cache.
+type Lister struct {
+	indexer cache.Indexer
+}
+
+// NewLister creates a lister reading from the provided informer cache.
+func NewLister(indexer cache.Indexer) *Lister {
+	return &Lister{indexer: indexer}
+}
+
+// List provides every KongConsumer resource in the cache.
+func (l *Lister) List() ([]*KongConsumer, error) {
+	objs := l.indexer.List()
+	items := make([]*KongConsumer, 0, len(objs))
+	for _, obj := range objs {
+		consumer, ok := obj.(*KongConsumer)
+		if !ok {
+			return nil, fmt.Errorf("could not convert %v (%T) into KongConsumer", obj, obj)
+		}
+		items = append(items, consumer)
+	}
+	return items, nil
+}
+
+// Get provides the KongConsumer resource in the cache with the provided namespace and name,
+// lets us know whether it exists.
+func (l *Lister) Get(namespace string, name string) (*KongConsumer, bool, error) {
+	obj, exists, err := l.indexer.GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	consumer, ok := obj.(*KongConsumer)
+	if !ok {
+		return nil, false, fmt.Errorf("could not convert %v (%T) into KongConsumer", obj, obj)
+	}
+	return consumer, true, nil
+}
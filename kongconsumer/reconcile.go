@@ -0,0 +1,77 @@
+package kongconsumer
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+)
+
+// Queues the KongConsumer resource with the provided namespace and name to be reconciled, resources in
+// namespaces outside of our shard or that haven't been onboarded are left alone.
+func (s *Service) queueConsumer(namespace string, name string) {
+	if !s.reconciles(namespace) {
+		return
+	}
+	if s.verbose {
+		log.Printf("Queueing a reconcile for the %v kong consumer in the %v namespace", name, namespace)
+	}
+	s.queue.Add(namespace, consumerOwner(namespace, name), syncerror.ResourceKey("kongconsumers", namespace, name))
+}
+
+// Reconciles the KongConsumer resource with the provided key from its latest state,
+// logging the outcome and recording it in the sync error rates and the error table.
+func (s *Service) reconcile(key string) error {
+	ctx, cancel := workqueue.Context(s.ctx, s.reconcileTimeout)
+	defer cancel()
+	err := s.syncResource(ctx, key)
+	if err != nil {
+		log.Printf("Error while processing reconcile of %v: %v", key, err)
+	}
+	metrics.RecordSync("kongconsumer", syncerror.Classify(err))
+	s.errors.Record("kongconsumer", key, err)
+	return err
+}
+
+// Brings the kong consumer for the KongConsumer resource with the provided key in line with its latest state,
+// deleting it when the resource has been deleted. With the declarative strategy only forced reconciles write to kong.
+// A reconcile that has been forced by a resync stays forced until it succeeds.
+func (s *Service) syncResource(ctx context.Context, key string) (err error) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 {
+		return nil
+	}
+	namespace, name := parts[1], parts[2]
+	forced := s.memory.TakeForced(key)
+	defer func() {
+		if err != nil && forced {
+			s.memory.Force(key)
+		}
+	}()
+	c, exists, err := s.consumers.Get(namespace, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		deleted, wasDeleted := s.memory.LastDeleted(key)
+		if !wasDeleted {
+			return nil
+		}
+		if err = s.deleteConsumer(ctx, *deleted.(*KongConsumer)); err != nil {
+			return err
+		}
+		s.memory.Forget(key)
+		return nil
+	}
+	if s.dbless || (s.declarative && !forced) {
+		return nil
+	}
+	if err = s.syncConsumer(ctx, *c); err != nil {
+		return err
+	}
+	s.memory.Synced(key, c)
+	return nil
+}
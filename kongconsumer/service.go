@@ -0,0 +1,317 @@
+package kongconsumer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/config"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/shard"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Service deals with monitoring and responding
+// to events on kong consumer resources in k8s
+// and updating the Kong consumers accordingly.
+type Service struct {
+	k8sClient        *k8sclient.Client
+	client           *Client
+	namespaces       []string
+	class            string
+	kongClient       kong.Interface
+	limiter          *throttle.Limiter
+	queue            *workqueue.Queue
+	memory           *workqueue.Memory
+	shard            shard.Shard
+	verbose          bool
+	registry         *ownership.Registry
+	adoptUnowned     bool
+	resyncChan       chan struct{}
+	errors           *syncerror.Table
+	resyncPeriod     time.Duration
+	onboarding       *onboarding.Watcher
+	informers        *k8sclient.InformerFactory
+	consumers        *Lister
+	secretStore      cache.Store
+	declarative      bool
+	dbless           bool
+	ctx              context.Context
+	reconcileTimeout time.Duration
+	synced           []func() bool
+}
+
+// NewService creates a new instance of the KongConsumer service.
+// Pre-existing kong consumers that aren't in the ownership registry are only managed when the
+// KongConsumer resource has the adopt annotation unless adoptUnowned is set.
+func NewService(k8sClient *k8sclient.Client, kong kong.Interface, cfg *config.Config) *Service {
+	s := &Service{k8sClient: k8sClient, client: NewClient(k8sClient), kongClient: kong, namespaces: cfg.Namespaces, limiter: cfg.Limiter,
+		class: cfg.ControllerClass, shard: cfg.Shard, verbose: cfg.Verbose, registry: cfg.Registry, adoptUnowned: cfg.AdoptUnowned,
+		resyncChan: make(chan struct{}, 1), errors: cfg.Errors, resyncPeriod: cfg.ResyncPeriod, onboarding: cfg.Onboarding, informers: cfg.Informers,
+		memory: workqueue.NewMemory(), declarative: cfg.SyncStrategy == config.DeclarativeSync, dbless: cfg.SyncStrategy == config.DBLessSync,
+		ctx: cfg.Context, reconcileTimeout: cfg.ReconcileTimeout}
+	s.queue = workqueue.New("kongconsumer", cfg.Limiter, cfg.Retry, s.reconcile)
+	return s
+}
+
+// Start deals with beginning the monitoring process which deals with monitoring
+// events from k8s kong consumer resources to propogate changes to kong.
+// Events queue the resource they are for to be reconciled from its latest state, reconciles go through
+// the shared limiter so each namespace is bound to its own concurrency and kong write limits.
+// This method should be called asynchronously in it's own goroutine.
+func (s *Service) Start(doneChan <-chan struct{}, wg *sync.WaitGroup) {
+	log.Println("Starting the kong consumer watcher service")
+	s.monitorConsumerEvents(s.namespaces, labels.NewSelector(), doneChan)
+	s.monitorSecretEvents()
+	var resyncTicks <-chan time.Time
+	if s.resyncPeriod > 0 && !s.dbless {
+		ticker := time.NewTicker(s.resyncPeriod)
+		defer ticker.Stop()
+		resyncTicks = ticker.C
+	}
+	for {
+		select {
+		case <-s.resyncChan:
+			if s.dbless {
+				continue
+			}
+			s.resyncAll(0, doneChan)
+		case <-resyncTicks:
+			if s.declarative {
+				// The complete desired state is pushed to kong in one go.
+				s.resyncAll(0, doneChan)
+				continue
+			}
+			// Periodic resyncs are spread over the resync period so every object isn't reconciled on the same tick.
+			s.resyncAll(s.resyncPeriod, doneChan)
+		case <-doneChan:
+			s.queue.ShutDown()
+			wg.Done()
+			log.Println("Stopped kong consumer event watcher.")
+			return
+		}
+	}
+}
+
+// Resync triggers a full reconciliation of every KongConsumer resource so the consumers
+// in kong converge on the state in k8s straight away, e.g. after manual changes to kong.
+// Resyncs requested while one is already pending are folded into the pending one.
+func (s *Service) Resync() {
+	select {
+	case s.resyncChan <- struct{}{}:
+	default:
+	}
+}
+
+// Queues a reconcile for every KongConsumer resource currently in the informer cache,
+// spreading them randomly over the provided window. Resyncs always write to kong,
+// with the declarative strategy they are the only reconciles that do.
+func (s *Service) resyncAll(spread time.Duration, done <-chan struct{}) {
+	log.Println("Resyncing all kong consumer resources")
+	consumers, err := s.consumers.List()
+	if err != nil {
+		log.Printf("Error listing the cached kong consumer resources for the resync: %v", err)
+	}
+	for _, consumer := range consumers {
+		namespace, name := consumer.Metadata.Namespace, consumer.Metadata.Name
+		s.memory.Force(syncerror.ResourceKey("kongconsumers", namespace, name))
+		throttle.Spread(spread, done, func() {
+			s.queueConsumer(namespace, name)
+		})
+	}
+}
+
+// Lets us know whether resources in the provided namespace are reconciled by this instance of the controller.
+func (s *Service) reconciles(namespace string) bool {
+	return s.shard.Owns(namespace) && s.onboarding.Enabled(namespace)
+}
+
+// Brings the kong consumer owned by the provided KongConsumer resource and its key-auth credentials
+// in line with the resource and the Secrets labelled for it.
+func (s *Service) syncConsumer(ctx context.Context, c KongConsumer) error {
+	if err := s.ensureConsumer(ctx, c); err != nil {
+		return err
+	}
+	return s.syncCredentials(ctx, c.Metadata.Namespace, c.Metadata.Name)
+}
+
+// Brings the kong consumer owned by the provided KongConsumer resource in line with the resource,
+// creating it when the resource doesn't own one yet. The consumer is tracked by its id in the
+// ownership registry so changing the username of the resource renames the consumer.
+func (s *Service) ensureConsumer(ctx context.Context, c KongConsumer) error {
+	if c.Spec.Username == "" && c.Spec.CustomID == "" {
+		return syncerror.Validationf("The kong consumer resource %v must set a username or custom id", c.Metadata.Name)
+	}
+	desired := &kong.Consumer{Username: c.Spec.Username, CustomID: c.Spec.CustomID}
+	id := s.ownedConsumerID(c.Metadata.Namespace, c.Metadata.Name)
+	if id == "" {
+		adopted, err := s.adoptConsumer(ctx, &c)
+		if err != nil {
+			return err
+		}
+		id = adopted
+	}
+	if id == "" {
+		return s.createConsumer(ctx, &c, desired)
+	}
+	current, err := s.kongClient.GetConsumer(ctx, id)
+	if err != nil {
+		if err != kong.ErrNotFound {
+			return err
+		}
+		// The consumer was removed from kong behind our back so it's created again.
+		if err = s.registry.Release(ownership.KindConsumer, id); err != nil {
+			return err
+		}
+		return s.createConsumer(ctx, &c, desired)
+	}
+	if current.Username == desired.Username && current.CustomID == desired.CustomID {
+		return nil
+	}
+	desired.ID = id
+	log.Printf("Updating the kong consumer %v for %v", id, ownerOf(&c))
+	if err := s.limiter.WaitWrite(ctx, c.Metadata.Namespace); err != nil {
+		return err
+	}
+	_, err = s.kongClient.UpdateConsumer(ctx, desired)
+	return err
+}
+
+// Creates the provided consumer in kong and records the provided KongConsumer resource as its owner.
+func (s *Service) createConsumer(ctx context.Context, c *KongConsumer, consumer *kong.Consumer) error {
+	log.Printf("Creating a kong consumer for %v", ownerOf(c))
+	if err := s.limiter.WaitWrite(ctx, c.Metadata.Namespace); err != nil {
+		return err
+	}
+	created, err := s.kongClient.CreateConsumer(ctx, consumer)
+	if err != nil {
+		return err
+	}
+	return s.registry.Claim(ownership.KindConsumer, created.ID, ownerOf(c))
+}
+
+// Takes over a pre-existing kong consumer with the username of the provided KongConsumer resource
+// when the resource is allowed to, lets us know the id of the consumer that was adopted
+// or an empty id when there's no consumer to adopt.
+func (s *Service) adoptConsumer(ctx context.Context, c *KongConsumer) (string, error) {
+	if c.Spec.Username == "" {
+		return "", nil
+	}
+	existing, err := s.kongClient.GetConsumer(ctx, c.Spec.Username)
+	if err != nil {
+		if err == kong.ErrNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	current, owned := s.registry.Owner(ownership.KindConsumer, existing.ID)
+	if c.Metadata.Annotations[AdoptAnnotation] != "true" && (owned || !s.adoptUnowned) {
+		if owned {
+			return "", syncerror.Validationf("The %v kong consumer is already managed by %v, "+
+				"set the %v annotation to \"true\" to take it over", c.Spec.Username, current, AdoptAnnotation)
+		}
+		return "", syncerror.Validationf("The %v kong consumer already exists and isn't managed by this resource, "+
+			"set the %v annotation to \"true\" to adopt it", c.Spec.Username, AdoptAnnotation)
+	}
+	if err = s.registry.Claim(ownership.KindConsumer, existing.ID, ownerOf(c)); err != nil {
+		return "", err
+	}
+	log.Printf("The %v kong consumer has been adopted by %v", c.Spec.Username, ownerOf(c))
+	return existing.ID, nil
+}
+
+// Deletes the kong consumer owned by the provided KongConsumer resource, consumers
+// the resource doesn't own are left alone. Kong deletes the credentials of the consumer along with it.
+func (s *Service) deleteConsumer(ctx context.Context, c KongConsumer) error {
+	id := s.ownedConsumerID(c.Metadata.Namespace, c.Metadata.Name)
+	if id == "" {
+		return nil
+	}
+	credentials, err := s.kongClient.ListKeyAuthCredentials(ctx, id)
+	if err != nil && err != kong.ErrNotFound {
+		return err
+	}
+	log.Printf("Deleting the kong consumer %v as %v has been deleted", id, ownerOf(&c))
+	if err := s.limiter.WaitWrite(ctx, c.Metadata.Namespace); err != nil {
+		return err
+	}
+	if err = s.kongClient.DeleteConsumer(ctx, id); err != nil && err != kong.ErrNotFound {
+		return err
+	}
+	for _, credential := range credentials {
+		if err = s.registry.Release(ownership.KindKeyAuth, credential.ID); err != nil {
+			return err
+		}
+	}
+	return s.registry.Release(ownership.KindConsumer, id)
+}
+
+// Provides the id of the kong consumer owned by the KongConsumer resource with the provided
+// namespace and name, empty when it doesn't own one.
+func (s *Service) ownedConsumerID(namespace string, name string) string {
+	owner := consumerOwner(namespace, name)
+	for id, current := range s.registry.Owned(ownership.KindConsumer) {
+		if current == owner {
+			return id
+		}
+	}
+	return ""
+}
+
+// Provides the owner recorded in the ownership registry for a KongConsumer resource.
+func ownerOf(c *KongConsumer) string {
+	return consumerOwner(c.Metadata.Namespace, c.Metadata.Name)
+}
+
+func consumerOwner(namespace string, name string) string {
+	return fmt.Sprintf("kongconsumer/%v/%v", namespace, name)
+}
+
+// Handles watching events occuring for our custom kong consumer resource.
+// All KongConsumer resources in the given namespaces and selector combination are watched in this case
+// and queued to be reconciled.
+func (s *Service) monitorConsumerEvents(namespaces []string, selector labels.Selector, done <-chan struct{}) {
+	eventCallback := func(evType watch.EventType, obj interface{}) {
+		consumer, ok := obj.(*KongConsumer)
+		if !ok {
+			log.Printf("could not convert %v (%T) into KongConsumer", obj, obj)
+			return
+		}
+		metrics.ObserveDelivery("kongconsumer", "kongconsumers", func() {
+			if s.dbless || (s.declarative && evType != watch.Deleted) {
+				return
+			}
+			if evType == watch.Deleted {
+				s.memory.Deleted(syncerror.ResourceKey("kongconsumers", consumer.Metadata.Namespace, consumer.Metadata.Name), consumer)
+			}
+			s.queueConsumer(consumer.Metadata.Namespace, consumer.Metadata.Name)
+		})
+	}
+	informer := NewInformer(k8sclient.DoneContext(done), s.client, namespaces, selector, s.class)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			eventCallback(watch.Added, obj)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			eventCallback(watch.Modified, new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			eventCallback(watch.Deleted, obj)
+		},
+	})
+	s.consumers = NewLister(informer.GetIndexer())
+	s.synced = append(s.synced, informer.HasSynced)
+
+	go informer.Run(done)
+}
@@ -0,0 +1,70 @@
+package kongconsumer
+
+import (
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/api/meta"
+	"k8s.io/client-go/pkg/api/unversioned"
+)
+
+// Resource identifies KongConsumer resources for the dynamic client.
+var Resource = k8sclient.GroupVersionResource{Group: "k8s.freshweb.io", Version: "v1", Resource: "kongconsumers"}
+
+// AdoptAnnotation provides the annotation that allows a KongConsumer resource to take over
+// a pre-existing kong consumer that isn't owned by the controller, the same one GatewayApi resources use.
+const AdoptAnnotation = "k8s.freshweb.io/adopt"
+
+const (
+	// CredentialLabel provides the label of the Secrets holding the key-auth credentials of a consumer,
+	// set to the name of the KongConsumer resource in the same namespace.
+	CredentialLabel = "k8s.freshweb.io/kong-consumer"
+	// KeyAuthSecretKey provides the key of the Secret data holding the key of a key-auth credential.
+	KeyAuthSecretKey = "key"
+)
+
+// KongConsumer provides the type for a
+// kong consumer resource in Kubernetes.
+type KongConsumer struct {
+	unversioned.TypeMeta `json:",inline"`
+	Metadata             api.ObjectMeta `json:"metadata"`
+	Spec                 Spec           `json:"spec"`
+}
+
+// GetObjectKind provides the method to expose the kind
+// of our KongConsumer object.
+func (c *KongConsumer) GetObjectKind() unversioned.ObjectKind {
+	return &c.TypeMeta
+}
+
+// GetObjectMeta Retrieves the metadata for the KongConsumer.
+func (c *KongConsumer) GetObjectMeta() meta.Object {
+	return &c.Metadata
+}
+
+// KongConsumerList provides the type encapsulating a list of KongConsumer resources.
+type KongConsumerList struct {
+	unversioned.TypeMeta `json:",inline"`
+	Metadata             unversioned.ListMeta `json:"metadata"`
+	Items                []KongConsumer       `json:"items"`
+}
+
+// GetObjectKind provides the method to expose the kind
+// of our KongConsumer List object.
+func (l *KongConsumerList) GetObjectKind() unversioned.ObjectKind {
+	return &l.TypeMeta
+}
+
+// GetListMeta Retrieves the metadata for the KongConsumer List.
+func (l *KongConsumerList) GetListMeta() unversioned.List {
+	return &l.Metadata
+}
+
+// Spec provides the type for the specification
+// of the kong consumer resource specification.
+type Spec struct {
+	// The unique username of the consumer in kong.
+	Username string `json:"username"`
+	// The unique id of the consumer in an existing user database,
+	// at least one of the username and custom id must be set.
+	CustomID string `json:"customId"`
+}
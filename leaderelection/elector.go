@@ -0,0 +1,155 @@
+package leaderelection
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// The annotation on the lock ConfigMap holding the leader election record.
+const leaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+
+// Provides the leader election record stored on the lock ConfigMap.
+type record struct {
+	HolderIdentity       string    `json:"holderIdentity"`
+	LeaseDurationSeconds int       `json:"leaseDurationSeconds"`
+	AcquireTime          time.Time `json:"acquireTime"`
+	RenewTime            time.Time `json:"renewTime"`
+}
+
+// Elector deals with electing a single leader between the replicas of the controller
+// using an annotation on a ConfigMap as the lock.
+// The lease expiry is measured against the time we last observed a change to the record
+// rather than the times in the record so clock skew between replicas doesn't matter.
+type Elector struct {
+	k8sClient      *k8sclient.Client
+	namespace      string
+	name           string
+	identity       string
+	leaseDuration  time.Duration
+	renewDeadline  time.Duration
+	retryPeriod    time.Duration
+	observedRecord record
+	observedTime   time.Time
+}
+
+// NewElector creates a new instance of an elector for the lock ConfigMap with the provided
+// namespace and name, identity should be unique to each replica, e.g. the pod name.
+func NewElector(k8sClient *k8sclient.Client, namespace string, name string, identity string,
+	leaseDuration time.Duration) *Elector {
+	return &Elector{
+		k8sClient:     k8sClient,
+		namespace:     namespace,
+		name:          name,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+		renewDeadline: leaseDuration * 2 / 3,
+		retryPeriod:   leaseDuration / 5,
+	}
+}
+
+// Run blocks until leadership is acquired at which point onStartedLeading is called in its own goroutine,
+// the lease is then renewed until either the done channel is closed or the lease can't be renewed
+// within the renew deadline in which case onStoppedLeading gets called.
+func (e *Elector) Run(done <-chan struct{}, onStartedLeading func(), onStoppedLeading func()) {
+	log.Printf("Attempting to acquire the %v/%v leader lock as %v", e.namespace, e.name, e.identity)
+	ticker := time.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+	for !e.tryAcquireOrRenew() {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+	log.Printf("Acquired the %v/%v leader lock as %v", e.namespace, e.name, e.identity)
+	go onStartedLeading()
+	lastRenewal := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if e.tryAcquireOrRenew() {
+				lastRenewal = time.Now()
+			} else if time.Since(lastRenewal) > e.renewDeadline {
+				log.Printf("Failed to renew the %v/%v leader lock within %v", e.namespace, e.name, e.renewDeadline)
+				onStoppedLeading()
+				return
+			}
+		}
+	}
+}
+
+// Attempts to acquire the lock or renew it when we already hold it,
+// lets us know whether we hold the lock afterwards.
+func (e *Elector) tryAcquireOrRenew() bool {
+	now := time.Now()
+	desired := record{
+		HolderIdentity:       e.identity,
+		LeaseDurationSeconds: int(e.leaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+	configMaps := e.k8sClient.Clientset.CoreV1().ConfigMaps(e.namespace)
+	configMap, err := configMaps.Get(e.name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			log.Printf("Error retrieving the %v/%v leader lock: %v", e.namespace, e.name, err)
+			return false
+		}
+		raw, err := json.Marshal(desired)
+		if err != nil {
+			return false
+		}
+		configMap = &v1.ConfigMap{ObjectMeta: v1.ObjectMeta{
+			Name:        e.name,
+			Namespace:   e.namespace,
+			Annotations: map[string]string{leaderAnnotation: string(raw)},
+		}}
+		_, err = configMaps.Create(configMap)
+		if err != nil {
+			return false
+		}
+		e.observedRecord = desired
+		e.observedTime = now
+		return true
+	}
+	current := record{}
+	if raw, exists := configMap.Annotations[leaderAnnotation]; exists {
+		if err := json.Unmarshal([]byte(raw), &current); err != nil {
+			log.Printf("Ignoring the invalid leader election record on %v/%v: %v", e.namespace, e.name, err)
+		}
+	}
+	if current.HolderIdentity != e.observedRecord.HolderIdentity || !current.RenewTime.Equal(e.observedRecord.RenewTime) {
+		e.observedRecord = current
+		e.observedTime = now
+	}
+	if current.HolderIdentity != "" && current.HolderIdentity != e.identity &&
+		e.observedTime.Add(e.leaseDuration).After(now) {
+		return false
+	}
+	if current.HolderIdentity == e.identity {
+		desired.AcquireTime = current.AcquireTime
+	}
+	raw, err := json.Marshal(desired)
+	if err != nil {
+		return false
+	}
+	if configMap.Annotations == nil {
+		configMap.Annotations = make(map[string]string)
+	}
+	configMap.Annotations[leaderAnnotation] = string(raw)
+	// The update fails with a conflict when another replica got there first.
+	_, err = configMaps.Update(configMap)
+	if err != nil {
+		return false
+	}
+	e.observedRecord = desired
+	e.observedTime = now
+	return true
+}
@@ -1,122 +1,573 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
-
-	"k8s.io/client-go/pkg/api"
-	"k8s.io/client-go/pkg/api/unversioned"
-	"k8s.io/client-go/pkg/runtime"
-	"k8s.io/client-go/pkg/runtime/serializer"
-	"k8s.io/client-go/pkg/watch/versioned"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+	"time"
 
 	"github.com/namsral/flag"
 
 	"github.com/freshwebio/k8s-kong-api/apiplugin"
+	"github.com/freshwebio/k8s-kong-api/certificate"
+	"github.com/freshwebio/k8s-kong-api/clustergatewayapi"
+	"github.com/freshwebio/k8s-kong-api/config"
+	"github.com/freshwebio/k8s-kong-api/controller"
+	"github.com/freshwebio/k8s-kong-api/dbless"
+	"github.com/freshwebio/k8s-kong-api/dependency"
+	"github.com/freshwebio/k8s-kong-api/drift"
 	"github.com/freshwebio/k8s-kong-api/gatewayapi"
+	"github.com/freshwebio/k8s-kong-api/gc"
+	"github.com/freshwebio/k8s-kong-api/globalplugin"
+	"github.com/freshwebio/k8s-kong-api/health"
+	"github.com/freshwebio/k8s-kong-api/install"
 	"github.com/freshwebio/k8s-kong-api/k8sclient"
 	"github.com/freshwebio/k8s-kong-api/kong"
+	"github.com/freshwebio/k8s-kong-api/kongconsumer"
+	"github.com/freshwebio/k8s-kong-api/leaderelection"
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/multicluster"
+	"github.com/freshwebio/k8s-kong-api/naming"
+	"github.com/freshwebio/k8s-kong-api/onboarding"
+	"github.com/freshwebio/k8s-kong-api/ownership"
+	"github.com/freshwebio/k8s-kong-api/recorder"
+	"github.com/freshwebio/k8s-kong-api/redact"
+	"github.com/freshwebio/k8s-kong-api/shard"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+	"github.com/freshwebio/k8s-kong-api/webhook"
+	"github.com/freshwebio/k8s-kong-api/workqueue"
+	"k8s.io/client-go/pkg/labels"
 )
 
+// The version of the controller, set at build time with -ldflags "-X main.version=1.2.0".
+var version = "dev"
+
 var (
 	kubeconfig           = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	kubeNamespace        = flag.String("namespace", "default", "The namespace to use to watch k8s events in.")
+	kubeContext          = flag.String("kubecontext", "", "The context of the kubeconfig file to use, empty for the current context")
+	kubeQPS              = flag.Float64("kubeqps", 5, "The maximum number of requests per second made to the Kubernetes apiserver")
+	kubeBurst            = flag.Int("kubeburst", 10, "The number of Kubernetes apiserver requests that can be made in a burst above kubeqps")
+	kubeNamespace        = flag.String("namespace", "default", "The namespace to use to watch k8s events in, a comma separated list watches several namespaces.")
+	allNamespaces        = flag.Bool("all-namespaces", false, "Watch k8s events in every namespace, the namespace is then included in the names of kong APIs")
 	kongScheme           = flag.String("kongscheme", "http://", "The scheme of the kong admin api, http or https")
 	kongHost             = flag.String("konghost", "kong", "The host of the kong admin api")
 	kongPort             = flag.String("kongport", "8001", "The port the kong admin api lives on")
+	kongSocket           = flag.String("kongsocket", "", "The path of the unix socket the kong admin api listens on, used instead of konghost and kongport when set")
+	kongTimeout          = flag.Duration("kongtimeout", kong.DefaultHTTPOptions.Timeout, "The longest a single request to the kong admin api can take, 0 for no limit")
+	kongDialTimeout      = flag.Duration("kongdialtimeout", kong.DefaultHTTPOptions.DialTimeout, "The longest connecting to the kong admin api can take, 0 for no limit")
+	kongKeepAlive        = flag.Duration("kongkeepalive", kong.DefaultHTTPOptions.KeepAlive, "The period of the TCP keep-alive probes sent on connections to the kong admin api, 0 to not send any")
+	kongNoKeepAlives     = flag.Bool("kongdisablekeepalives", false, "Disable HTTP keep-alives so a new connection to the kong admin api is opened for every request")
+	kongMaxIdleConns     = flag.Int("kongmaxidleconns", kong.DefaultHTTPOptions.MaxIdleConns, "The number of idle connections to the kong admin api kept open for reuse, 0 for no limit")
+	kongCAFile           = flag.String("kongcafile", "", "The path of a PEM encoded CA bundle the certificate of the kong admin api is verified against, empty for the system CAs")
+	kongServerName       = flag.String("kongservername", "", "The name the certificate of the kong admin api is verified for, empty for konghost")
+	kongInsecure         = flag.Bool("konginsecure", false, "Skip verifying the certificate of the kong admin api served over https")
+	kongCertFile         = flag.String("kongcertfile", "", "The path of the PEM encoded client certificate presented to a kong admin api requiring mutual TLS")
+	kongKeyFile          = flag.String("kongkeyfile", "", "The path of the PEM encoded private key of the kong client certificate")
+	kongClientSecret     = flag.String("kongclientsecret", "", "The <namespace>/<name> of the kubernetes.io/tls Secret holding the kong client certificate, used when kongcertfile isn't set")
+	kongAuthSecret       = flag.String("kongauthsecret", "", "The <namespace>/<name> of the Secret holding the credentials sent to the kong admin api, empty to send none")
+	kongAuthHeader       = flag.String("kongauthheader", "apikey", "The header the credential in kongauthsecret is sent in, e.g. apikey or Authorization")
+	kongAuthSecretKey    = flag.String("kongauthsecretkey", "apikey", "The key of the credential in kongauthsecret")
+	kongAdminTokenValue  = flag.String("kongadmintoken", "", "The Kong Enterprise RBAC token sent in the Kong-Admin-Token header, empty to send none")
+	kongAdminTokenFile   = flag.String("kongadmintokenfile", "", "The path of a file holding the Kong Enterprise RBAC token, e.g. a key of a mounted Secret, used instead of kongadmintoken")
 	apiLabel             = flag.String("apilabel", "kong.gateway.api", "The name of the label used to identify a kong API that references a GatewayApi resource")
 	serviceSelectorLabel = flag.String("sslabel", "service", "The name the label to be used for selecting services in custom k8s resources")
+	certificateLabel     = flag.String("certlabel", "k8s.freshweb.io/kong-certificate", "The name of the label identifying the TLS Secrets synced to kong certificates and SNIs, empty to disable")
+	nsConcurrency        = flag.Int("nsconcurrency", 1, "The maximum number of reconciles that can be in flight at once for a single namespace")
+	nsWriteRate          = flag.Float64("nswriterate", 0, "The maximum number of writes per second made to the kong admin api for a single namespace, 0 for no limit")
+	nsWriteBurst         = flag.Int("nswriteburst", 1, "The number of kong admin api writes a single namespace can make in a burst above the write rate")
+	retryBaseDelay       = flag.Duration("retrybasedelay", workqueue.DefaultBackoff.BaseDelay, "The delay before a failed sync is first retried, it doubles with every consecutive failure")
+	retryMaxDelay        = flag.Duration("retrymaxdelay", workqueue.DefaultBackoff.MaxDelay, "The longest a failed sync waits to be retried")
+	reconcileTimeout     = flag.Duration("reconciletimeout", 2*time.Minute, "The longest a single sync can wait on the kong admin api before it's abandoned and retried, 0 for no limit")
+	retryMaxAttempts     = flag.Int("retrymaxattempts", 0, "The number of consecutive failed syncs of a resource after which it's no longer retried until its next event or resync, 0 for no limit")
+	kongServices         = flag.Bool("kongservices", false, "Represent kong APIs as a kong service with a route regardless of the kong version")
+	kongVersion          = flag.String("kongversion", "", "The version of kong the controller writes to, empty to detect it from the kong admin api on startup")
+	kongCacheTTL         = flag.Duration("kongcachettl", 0, "How long kong APIs, upstreams and plugin lists looked up are cached for, 0 to disable")
+	slowStartPeriod      = flag.Duration("slowstartperiod", 0, "The period over which the weight of newly enabled upstream targets is ramped up to full weight, 0 to disable")
+	slowStartWeight      = flag.Int("slowstartweight", 1, "The weight newly enabled upstream targets start with when slow start is enabled")
+	defaultStripURI      = flag.Bool("defaultstripuri", kong.StandardDefaults.StripURI, "Whether kong APIs strip the matched uri when the resource doesn't set strip_uri")
+	defaultRetries       = flag.Int("defaultretries", int(kong.StandardDefaults.Retries), "The number of retries kong APIs get when the resource doesn't set retries")
+	defaultTimeout       = flag.Duration("defaulttimeout", time.Duration(kong.StandardDefaults.Timeout)*time.Millisecond, "The upstream connect, send and read timeouts kong APIs get when the resource doesn't set them")
+	defaultTargetWeight  = flag.Int("defaulttargetweight", kong.StandardDefaults.TargetWeight, "The weight upstream targets are registered with once they are fully enabled")
+	deletionGracePeriod  = flag.Duration("deletiongraceperiod", 0, "How long a GatewayApi resource must be gone for before its kong API is deleted, 0 to delete straight away")
+	ownershipConfigMap   = flag.String("ownershipconfigmap", "k8s-kong-api-ownership", "The name of the ConfigMap in the watched namespace that records the kong objects owned by the controller")
+	adoptUnowned         = flag.Bool("adoptunowned", false, "Adopt pre-existing kong APIs that aren't owned by the controller without requiring the adopt annotation")
+	statusAddr           = flag.String("statusaddr", ":8080", "The address the status server exposing metrics listens on, empty to disable")
+	shardIndex           = flag.Int("shard-index", 0, "The index of the shard of namespaces this instance reconciles")
+	shardTotal           = flag.Int("shard-total", 1, "The total number of shards namespaces are spread across")
+	leaderElect          = flag.Bool("leaderelect", false, "Only reconcile once elected leader between the replicas of the same shard")
+	leaseDuration        = flag.Duration("leaseduration", 15*time.Second, "How long the leader lock is held for before it must be renewed")
+	lockNamespace        = flag.String("locknamespace", "default", "The namespace the ConfigMap used as the leader lock lives in")
+	verbose              = flag.Bool("verbose", false, "Log every reconcile that is dispatched")
+	dryRun               = flag.Bool("dryrun", false, "Log the writes that would be made to the kong admin api instead of making them")
+	kongStatusInterval   = flag.Duration("kongstatusinterval", 10*time.Second, "How often the kong admin api status is polled for the readiness probe")
+	kongFailureThreshold = flag.Int("kongfailurethreshold", 3, "The number of consecutive failed kong status polls before the controller reports itself as not ready")
+	errorRateWindow      = flag.Duration("errorratewindow", 5*time.Minute, "The rolling window sync error rates are calculated over")
+	errorRateThreshold   = flag.Float64("errorratethreshold", 0.5, "The sync error rate above which the error rate exceeded metric is set")
+	recordEvents         = flag.Bool("recordevents", true, "Record the outcome of GatewayApi, ApiPlugin and service syncs as Kubernetes Events on the resources synced")
+	resyncPeriod         = flag.Duration("resyncperiod", 0, "How often every resource is resynced with kong, resyncs are spread over the period, 0 to disable")
+	syncStrategy         = flag.String("sync-strategy", config.IncrementalSync, "How kong is brought in line with k8s, incremental applies every change as it happens while declarative pushes the complete desired state every resync period and dbless writes it to a ConfigMap as a kong.yml file")
+	dblessConfigMap      = flag.String("dblessconfigmap", "k8s-kong-api-dbless", "The name of the ConfigMap the kong.yml file is written to with the dbless sync strategy")
+	dblessNamespace      = flag.String("dblessnamespace", "default", "The namespace of the ConfigMap the kong.yml file is written to with the dbless sync strategy")
+	dblessInterval       = flag.Duration("dblessinterval", 10*time.Second, "How often the kong.yml file is rendered with the dbless sync strategy, it's only written when it has changed")
+	driftInterval        = flag.Duration("driftinterval", 0, "How often the kong objects k8s calls for are compared with the ones in kong for the drift metrics, 0 to disable")
+	gcInterval           = flag.Duration("gcinterval", 0, "How often owned kong objects without a GatewayApi resource are garbage collected, 0 to disable")
+	gcReportOnly         = flag.Bool("gcreportonly", false, "Only log and count the kong objects the garbage collector would delete")
+	remoteKubeconfigs    = flag.String("remotekubeconfigs", "", "Comma separated name=path pairs of the kubeconfig files of remote clusters whose services are registered as kong targets")
+	endpointTargets      = flag.Bool("endpointtargets", false, "Register the ready pods behind services as kong upstream targets instead of pointing kong APIs at the cluster IP")
+	endpointSlices       = flag.Bool("endpointslices", false, "Read the pods targeted with endpointtargets from EndpointSlices instead of Endpoints, for clusters serving discovery.k8s.io/v1")
+	compactionInterval   = flag.Duration("targetcompactioninterval", 0, "How often the target histories of kong upstreams are checked for compaction, 0 to disable")
+	compactionThreshold  = flag.Int("targetcompactionthreshold", 100, "The number of stale target entries an upstream needs before it's compacted")
+	redactKeys           = flag.String("redactkeys", strings.Join(redact.DefaultKeys, ","), "Comma separated key fragments whose values are masked in logs, errors and statuses")
+	controllerClass      = flag.String("controller-class", "", "Only reconcile resources whose controller class or ingress class annotation is set to this class, empty to reconcile resources without a class")
+	onboardingAnnotation = flag.String("onboardingannotation", "", "Only reconcile namespaces with this annotation set to \"true\", empty to reconcile every namespace")
+	namespaceOptOut      = flag.String("namespaceoptout", "kong.freshweb.io/ignore", "The annotation or label that excludes a namespace from reconciliation when set to \"true\" while several namespaces are watched, empty to disable")
+	clusterGatewayApis   = flag.Bool("clustergatewayapis", false, "Reconcile cluster-scoped ClusterGatewayApi resources publishing kong APIs that balance across services in any namespace")
+	createCRDs           = flag.Bool("create-crds", true, "Create the custom resource definitions that don't exist yet on startup")
+	webhookAddr          = flag.String("webhookaddr", "", "The address the admission webhook server validating GatewayApi and ApiPlugin resources listens on, empty to disable")
+	webhookNamespace     = flag.String("webhooknamespace", "default", "The namespace of the webhook service and the Secret its certificates are stored in")
+	webhookService       = flag.String("webhookservice", "k8s-kong-api-webhook", "The name of the service the apiserver reaches the webhook server through")
+	webhookSecret        = flag.String("webhooksecret", "k8s-kong-api-webhook-certs", "The name of the Secret the webhook certificates are stored in")
+	webhookConfig        = flag.String("webhookconfig", "k8s-kong-api", "The name of the webhook configurations the CA bundle of the webhook certificates is patched into")
+	webhookCertValidity  = flag.Duration("webhookcertvalidity", 365*24*time.Hour, "How long the webhook certificates are valid for, they are rotated once two thirds of it has passed")
+	image                = flag.String("image", "freshwebio/k8s-kong-api:latest", "The image the install subcommand deploys the controller with")
+	replicas             = flag.Int("replicas", 1, "The number of replicas of the controller the install subcommand deploys")
+	installNamespace     = flag.String("installnamespace", "default", "The namespace the install subcommand deploys the controller to")
+	backupDir            = flag.String("backupdir", ".", "The directory the migrate and install subcommands back up ThirdPartyResource objects to")
+	profile              = flag.String("profile", "", "A configuration profile providing defaults for the flags that aren't set, dev or prod")
 )
 
 func main() {
+	// The install and migrate subcommands take the same flags as the controller itself.
+	installing := len(os.Args) > 1 && os.Args[1] == "install"
+	migrating := len(os.Args) > 1 && os.Args[1] == "migrate"
+	if installing || migrating {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
 	flag.Parse()
+	// The installed controller is configured with the flags as they were provided,
+	// the profile is passed on and applied by the installed controller.
+	var env map[string]string
+	if installing {
+		env = installEnv()
+	}
+	if err := applyProfile(*profile); err != nil {
+		log.Fatalf("error applying the configuration profile: %v", err)
+	}
+	// Sensitive values are masked wherever they would be written out, the log included.
+	redact.SetKeys(strings.Split(*redactKeys, ","))
+	log.SetOutput(redact.Writer(os.Stderr))
+	if *syncStrategy != config.IncrementalSync && *syncStrategy != config.DeclarativeSync && *syncStrategy != config.DBLessSync {
+		log.Fatalf("error validating the sync strategy: expected %v, %v or %v but got %v",
+			config.IncrementalSync, config.DeclarativeSync, config.DBLessSync, *syncStrategy)
+	}
+	if *syncStrategy == config.DeclarativeSync && *resyncPeriod <= 0 {
+		// The desired state has to be pushed periodically for anything but deletions to reach kong.
+		*resyncPeriod = time.Minute
+	}
+	controllerShard := shard.Shard{Index: *shardIndex, Total: *shardTotal}
+	if err := controllerShard.Validate(); err != nil {
+		log.Fatalf("error validating the shard configuration: %v", err)
+	}
+	if *syncStrategy == config.DBLessSync && controllerShard.Total > 1 {
+		// Every shard would overwrite the kong.yml file with its own part of the desired state.
+		log.Fatalf("error validating the shard configuration: the %v sync strategy can't be sharded", config.DBLessSync)
+	}
+	namespaces := k8sclient.ParseNamespaces(*kubeNamespace)
+	if *allNamespaces {
+		namespaces = nil
+	}
+	// Services with the same name in different namespaces can only share a kong when their namespace
+	// is part of the name of their kong API.
+	names := naming.Scheme{Namespaced: len(namespaces) == 0}
+	if names.Namespaced {
+		log.Println("Watching every namespace, kong APIs are named <service>.<namespace>")
+	}
+	for _, namespace := range namespaces {
+		if !controllerShard.Owns(namespace) {
+			log.Printf("The %v namespace doesn't belong to shard %v of %v so nothing will be reconciled in it",
+				namespace, controllerShard.Index, controllerShard.Total)
+		}
+	}
 	var err error
 	var cli *k8sclient.Client
+	clientOpts := k8sclient.Options{
+		Context:   *kubeContext,
+		UserAgent: k8sclient.UserAgent(version),
+		QPS:       float32(*kubeQPS),
+		Burst:     *kubeBurst,
+	}
 	if *kubeconfig == "" {
 		// Let's create an in cluster client.
-		cli, err = k8sclient.NewInClusterClient()
+		cli, err = k8sclient.NewInClusterClient(clientOpts)
 		if err != nil {
 			panic(err.Error())
 		}
 	} else {
 		// If kube config flag is specified lets load our client
 		// from config.
-		cli, err = k8sclient.NewClient(*kubeconfig)
+		cli, err = k8sclient.NewClient(*kubeconfig, clientOpts)
 		if err != nil {
 			panic(err.Error())
 		}
 	}
+	if installing {
+		if err = runInstall(cli, env); err != nil {
+			log.Fatalf("error installing the controller: %v", err)
+		}
+		log.Printf("Installed the controller in the %v namespace", *installNamespace)
+		return
+	}
+	if migrating {
+		if err = install.Migrate(cli, *backupDir); err != nil {
+			log.Fatalf("error migrating the ThirdPartyResources: %v", err)
+		}
+		log.Println("Migrated the ThirdPartyResources to CustomResourceDefinitions")
+		return
+	}
+	if *createCRDs {
+		if err = install.EnsureDefinitions(cli, conversionWebhook()); err != nil {
+			log.Fatalf("error creating the custom resource definitions: %v", err)
+		}
+	}
+	// Resources can leave out the properties of kong objects that have sane defaults.
+	defaults := kong.Defaults{
+		StripURI:     *defaultStripURI,
+		Retries:      int64(*defaultRetries),
+		Timeout:      int64(*defaultTimeout / time.Millisecond),
+		TargetWeight: *defaultTargetWeight,
+	}
+	if defaults.Retries < 0 || defaults.Timeout < 1 || defaults.TargetWeight < 1 {
+		log.Fatalf("error validating the defaults: the retries can't be negative and the timeout and target weight must be positive")
+	}
 	// Now let's initialise our kong client.
 	kongClient := kong.NewClient(*kongHost, *kongPort, *kongScheme)
-
-	// Now setup our api plugin scheme.
-	groupVersion := unversioned.GroupVersion{
-		Group:   "k8s.freshweb.io",
-		Version: "v1",
-	}
-	schemeBuilder := runtime.NewSchemeBuilder(
-		func(scheme *runtime.Scheme) error {
-			scheme.AddKnownTypes(
-				groupVersion,
-				&apiplugin.ApiPlugin{},
-				&apiplugin.ApiPluginList{},
-				&gatewayapi.GatewayApi{},
-				&gatewayapi.GatewayApiList{},
-				&api.ListOptions{},
-				&api.DeleteOptions{},
-			)
-			versioned.AddToGroupVersion(scheme, groupVersion)
-			return nil
-		})
-	if err = schemeBuilder.AddToScheme(api.Scheme); err != nil {
-		log.Fatalf("error setting up apiplugin and gatewayapi scheme: %v", err)
+	kongClient.SetDefaults(defaults)
+	if *kongTimeout < 0 || *kongDialTimeout < 0 || *kongKeepAlive < 0 || *kongMaxIdleConns < 0 {
+		log.Fatalf("error validating the kong http options: kongtimeout, kongdialtimeout, kongkeepalive and kongmaxidleconns can't be negative")
 	}
-	var k8sRestConfig *rest.Config
-	if *kubeconfig == "" {
-		k8sRestConfig, err = rest.InClusterConfig()
-	} else {
-		k8sRestConfig, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	kongClient.ConfigureHTTP(kong.HTTPOptions{Timeout: *kongTimeout, DialTimeout: *kongDialTimeout,
+		KeepAlive: *kongKeepAlive, DisableKeepAlives: *kongNoKeepAlives, MaxIdleConns: *kongMaxIdleConns})
+	kongTLS := kong.TLSOptions{CAFile: *kongCAFile, ServerName: *kongServerName, InsecureSkipVerify: *kongInsecure,
+		CertFile: *kongCertFile, KeyFile: *kongKeyFile}
+	if *kongCertFile == "" && *kongKeyFile == "" && *kongClientSecret != "" {
+		if kongTLS.CertPEM, kongTLS.KeyPEM, err = kongClientCertificate(cli, *kongClientSecret); err != nil {
+			log.Fatalf("error reading the kong client certificate: %v", err)
+		}
+	}
+	if err = kongClient.ConfigureTLS(kongTLS); err != nil {
+		log.Fatalf("error configuring TLS for the kong admin api: %v", err)
+	}
+	if *kongInsecure {
+		log.Println("Not verifying the certificate of the kong admin api")
+	}
+	if *kongSocket != "" {
+		log.Printf("Reaching the kong admin api through the %v unix socket", *kongSocket)
+		kongClient.UseSocket(*kongSocket)
+	}
+	if *kongAuthSecret != "" {
+		if err = configureKongAuth(cli, kongClient, *kongAuthSecret, *kongAuthHeader, *kongAuthSecretKey); err != nil {
+			log.Fatalf("error reading the kong admin api credentials: %v", err)
+		}
 	}
+	adminToken, err := kongAdminToken(*kongAdminTokenValue, *kongAdminTokenFile)
 	if err != nil {
-		log.Fatalf("Error trying to configure k8s REST client: %v", err)
+		log.Fatalf("error reading the kong admin token: %v", err)
+	}
+	if adminToken != "" {
+		kongClient.SetAdminToken(adminToken)
+	}
+	// Slow start ramps run in the background so they're stopped along with the controllers on shutdown.
+	rampCtx, stopRamps := context.WithCancel(context.Background())
+	kongClient.EnableSlowStart(rampCtx, *slowStartPeriod, *slowStartWeight)
+	kongClient.EnableCache(*kongCacheTTL)
+	if *kongServices || *syncStrategy == config.DBLessSync {
+		// DB-less kong only exists from 1.1 onwards so there's no version to detect.
+		kongClient.EnableServices()
+	} else if *kongVersion != "" {
+		if err = kongClient.AdaptTo(*kongVersion); err != nil {
+			log.Fatalf("error parsing the kong version: %v", err)
+		}
+	} else {
+		// Restarting until kong is reachable is left to Kubernetes, as writing with the wrong model would fail anyway.
+		ctx, cancel := workqueue.Context(context.Background(), *reconcileTimeout)
+		detected, err := kongClient.DetectVersion(ctx)
+		cancel()
+		if err != nil {
+			log.Fatalf("error detecting the kong version, set kongversion to skip detection: %v", err)
+		}
+		log.Printf("Detected kong %v", detected)
+	}
+	if *dryRun {
+		log.Println("Running in dry run mode, no changes will be made to kong")
+		kongClient.EnableDryRun()
+	}
+
+	// Controllers of different classes keep their own ownership records and leader lock
+	// so they never act on the kong objects of each other's resources.
+	ownershipName, lockPrefix := *ownershipConfigMap, "k8s-kong-api"
+	if *controllerClass != "" {
+		ownershipName += "-" + *controllerClass
+		lockPrefix += "-" + *controllerClass
+	}
+
+	// Load the kong objects we own so pre-existing objects aren't overwritten.
+	// With several namespaces watched the ownership records live in the first of them,
+	// with every namespace watched they live alongside the leader lock.
+	ownershipNamespace := *lockNamespace
+	if len(namespaces) > 0 {
+		ownershipNamespace = namespaces[0]
+	}
+	registry := ownership.NewRegistry(cli, ownershipNamespace, ownershipName)
+	if err = registry.Load(); err != nil {
+		log.Fatalf("error loading the kong object ownership registry: %v", err)
 	}
-	tprConfig := *k8sRestConfig
-	tprConfig.GroupVersion = &groupVersion
-	tprConfig.APIPath = "/apis"
-	tprConfig.ContentType = runtime.ContentTypeJSON
-	tprConfig.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: api.Codecs}
 
-	k8sRestClient, err := rest.RESTClientFor(&tprConfig)
+	// The limiter is shared between the managers so the per-namespace limits
+	// hold across everything we reconcile for a namespace.
+	limiter := throttle.NewLimiter(*nsConcurrency, *nsWriteRate, *nsWriteBurst)
+	metrics.ConfigureErrorRates(*errorRateWindow, *errorRateThreshold, syncerror.Classes)
+	metrics.RegisterCollectFunc(func() {
+		metrics.QueueDepth.Reset()
+		metrics.QueueOldestItemAge.Reset()
+		for namespace, stats := range limiter.Stats() {
+			metrics.QueueDepth.WithLabelValues(namespace).Set(float64(stats.Depth))
+			metrics.QueueOldestItemAge.WithLabelValues(namespace).Set(stats.OldestAge.Seconds())
+		}
+	})
+	syncErrors := syncerror.NewTable()
+	var eventRecorder *recorder.Recorder
+	if *recordEvents {
+		eventRecorder = recorder.NewRecorder(cli)
+	}
+	// Opting out only makes sense when more than the one namespace the controller has been pointed at is watched.
+	optOut := *namespaceOptOut
+	if len(namespaces) == 1 {
+		optOut = ""
+	}
+	namespaceOnboarding := onboarding.NewWatcher(cli, *onboardingAnnotation, optOut)
+	dependencies := dependency.NewGraph()
+	metrics.RegisterCollectFunc(func() {
+		metrics.PluginsAwaitingAPI.WithLabelValues().Set(float64(dependencies.Waiting()))
+	})
+	var discovery *multicluster.Discovery
+	remoteClusters, err := multicluster.ParseKubeconfigs(*remoteKubeconfigs)
 	if err != nil {
-		log.Fatalf("error creating our general k8s client for the apiplugin service: %v", err)
+		log.Fatalf("error parsing the remote cluster kubeconfigs: %v", err)
+	}
+	if len(remoteClusters) > 0 {
+		remoteClients := make(map[string]*k8sclient.Client)
+		for name, path := range remoteClusters {
+			// The kube context only applies to the local kubeconfig.
+			remoteOpts := clientOpts
+			remoteOpts.Context = ""
+			if remoteClients[name], err = k8sclient.NewClient(path, remoteOpts); err != nil {
+				log.Fatalf("error creating the client for the %v remote cluster: %v", name, err)
+			}
+		}
+		if discovery, err = multicluster.NewDiscovery(remoteClients, *apiLabel); err != nil {
+			log.Fatalf("error setting up remote cluster discovery: %v", err)
+		}
+	}
+	doneChan := make(chan struct{})
+	// Controllers watching the same services or secrets share a single watch of them.
+	informers := cli.NewInformerFactory(namespaces, doneChan)
+	var endpoints k8sclient.ServiceTargets
+	if *endpointTargets && *endpointSlices {
+		endpoints = cli.NewEndpointSliceWatcher(k8sclient.DoneContext(doneChan), namespaces)
+	} else if *endpointTargets {
+		// Endpoints don't necessarily carry the labels of their service so every one in the namespace is watched.
+		endpoints = cli.NewEndpointsWatcher(k8sclient.DoneContext(doneChan), namespaces, labels.Everything())
+	}
+	cfg := &config.Config{
+		Namespaces:           namespaces,
+		APILabel:             *apiLabel,
+		ServiceSelectorLabel: *serviceSelectorLabel,
+		CertificateLabel:     *certificateLabel,
+		ControllerClass:      *controllerClass,
+		Limiter:              limiter,
+		Retry:                workqueue.Backoff{BaseDelay: *retryBaseDelay, MaxDelay: *retryMaxDelay, MaxAttempts: *retryMaxAttempts},
+		Context:              k8sclient.DoneContext(doneChan),
+		ReconcileTimeout:     *reconcileTimeout,
+		Shard:                controllerShard,
+		Names:                names,
+		DeletionGracePeriod:  *deletionGracePeriod,
+		Registry:             registry,
+		AdoptUnowned:         *adoptUnowned,
+		ResyncPeriod:         *resyncPeriod,
+		Errors:               syncErrors,
+		Recorder:             eventRecorder,
+		Dependencies:         dependencies,
+		Onboarding:           namespaceOnboarding,
+		Discovery:            discovery,
+		Informers:            informers,
+		Endpoints:            endpoints,
+		Defaults:             defaults,
+		Verbose:              *verbose,
+		SyncStrategy:         *syncStrategy,
 	}
 
 	// Instantiate the GatewayApi manager.
-	gatewayApiService := gatewayapi.NewService(k8sRestClient, cli, kongClient, *kubeNamespace, *apiLabel, *serviceSelectorLabel)
+	gatewayApiService := gatewayapi.NewService(cli, kongClient, cfg)
 
 	// Now instantiate our ApiPlugin manager.
-	apipluginService := apiplugin.NewService(k8sRestClient, cli, kongClient, *kubeNamespace, *apiLabel, *serviceSelectorLabel)
+	apipluginService := apiplugin.NewService(cli, kongClient, cfg)
+
+	// And our KongConsumer manager.
+	consumerService := kongconsumer.NewService(cli, kongClient, cfg)
+
+	// And our GlobalPlugin manager.
+	globalPluginService := globalplugin.NewService(cli, kongClient, cfg)
+
+	controllers := controller.Set{gatewayApiService, apipluginService, consumerService, globalPluginService}
+	declarers := []dbless.Source{gatewayApiService, apipluginService, consumerService, globalPluginService}
+	// Changes to the targets of a service are passed on to every controller balancing across it.
+	syncTargets := gatewayApiService.SyncTargets
+	if *clusterGatewayApis {
+		// And our ClusterGatewayApi manager, which watches every service in the watched namespaces.
+		clusterGatewayApiService := clustergatewayapi.NewService(cli, kongClient, cfg)
+		controllers = append(controllers, clusterGatewayApiService)
+		declarers = append(declarers, clusterGatewayApiService)
+		syncTargets = func(namespace string, name string) {
+			gatewayApiService.SyncTargets(namespace, name)
+			clusterGatewayApiService.SyncTargets(namespace, name)
+		}
+	}
+	if *certificateLabel != "" {
+		controllers = append(controllers, certificate.NewService(cli, kongClient, cfg))
+	}
+	if *syncStrategy == config.DBLessSync {
+		// The controllers only keep their caches up to date, the writer renders kong's configuration from them.
+		controllers = append(controllers, dbless.NewWriter(cli, *dblessNamespace, *dblessConfigMap, *dblessInterval,
+			declarers...))
+	}
+
+	// A full resync can be triggered with SIGUSR1 or through the status server
+	// so manual changes to kong can be converged straight away.
+	resync := func() {
+		log.Println("Full resync requested")
+		controllers.Resync()
+	}
+	// Resources that already exist in a namespace being onboarded are picked up with a resync,
+	// the limits of namespaces that are offboarded or deleted are dropped.
+	namespaceOnboarding.Run(doneChan, func(namespace string) {
+		resync()
+	}, limiter.Forget)
+	if discovery != nil {
+		// Changes to services in remote clusters update the targets of the matching local services.
+		discovery.Run(doneChan, syncTargets)
+	}
+	if endpoints != nil {
+		// Pods becoming ready or going away update the targets of their service.
+		endpoints.OnServiceChange(syncTargets)
+		log.Println("Loading the endpoints of the watched services")
+		endpoints.Run(doneChan)
+	}
+	if *statusAddr != "" {
+		// Kubernetes keeps the instance out of ready while it can't apply changes to kong.
+		kongProbe := health.NewKongProbe(kongClient, *kongStatusInterval, *kongFailureThreshold)
+		go kongProbe.Run(doneChan)
+		statusMux := http.NewServeMux()
+		statusMux.Handle("/metrics", metrics.Handler())
+		statusMux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+		statusMux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+			if ready, err := kongProbe.Ready(); !ready {
+				http.Error(w, fmt.Sprintf("kong admin api unreachable: %v", err), http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		})
+		statusMux.Handle("/debug/errors", syncErrors.Handler())
+		statusMux.HandleFunc("/debug/resync", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				w.Header().Set("Allow", "POST")
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			resync()
+			w.WriteHeader(http.StatusAccepted)
+		})
+		go func() {
+			log.Printf("Starting the status server on %v", *statusAddr)
+			if err := http.ListenAndServe(*statusAddr, statusMux); err != nil {
+				log.Fatalf("error running the status server: %v", err)
+			}
+		}()
+	}
+
+	if *webhookAddr != "" {
+		// Every replica serves admission reviews, whether or not it's the leader.
+		certs := webhook.NewCertManager(cli, *webhookNamespace, *webhookSecret, *webhookService, *webhookConfig,
+			*webhookCertValidity)
+		if err = certs.Ensure(); err != nil {
+			log.Fatalf("error loading the webhook certificates: %v", err)
+		}
+		go certs.Run(doneChan)
+		webhookServer := webhook.NewServer(cli, kongClient, *apiLabel, *serviceSelectorLabel)
+		go func() {
+			log.Printf("Starting the webhook server on %v", *webhookAddr)
+			if err := webhookServer.ListenAndServeTLS(*webhookAddr, certs); err != nil {
+				log.Fatalf("error running the webhook server: %v", err)
+			}
+		}()
+	}
 
 	// Asynchronously start watching and refreshing apiplugins and kong API objects
 	wg := sync.WaitGroup{}
-	doneChan := make(chan struct{})
-	wg.Add(1)
-	go gatewayApiService.Start(doneChan, &wg)
+	startControllers := func() {
+		controllers.Start(doneChan, &wg)
 
-	wg.Add(1)
-	go apipluginService.Start(doneChan, &wg)
+		if *driftInterval > 0 {
+			go drift.Run(doneChan, *driftInterval, gatewayApiService, apipluginService)
+		}
+
+		if *compactionInterval > 0 && *syncStrategy != config.DBLessSync {
+			go gatewayApiService.CompactTargets(doneChan, *compactionInterval, *compactionThreshold)
+		}
+
+		if *gcInterval > 0 && *syncStrategy != config.DBLessSync {
+			collector := gc.NewCollector(cli, kongClient, cfg, *gcInterval, *gcReportOnly)
+			go collector.Run(doneChan)
+		}
+	}
+	if *leaderElect {
+		// The replicas of each shard elect their own leader so every shard is reconciled by exactly one instance.
+		identity, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("error determining the leader election identity: %v", err)
+		}
+		elector := leaderelection.NewElector(cli, *lockNamespace, controllerShard.LockName(lockPrefix), identity, *leaseDuration)
+		go elector.Run(doneChan, startControllers, func() {
+			log.Fatalf("Lost the leader lock for shard %v, exiting...", controllerShard.Index)
+		})
+	} else {
+		startControllers()
+	}
 
 	// Listen for shutdown signals
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	resyncChan := make(chan os.Signal, 1)
+	signal.Notify(resyncChan, syscall.SIGUSR1)
+	go func() {
+		for range resyncChan {
+			resync()
+		}
+	}()
 	<-signalChan
 	log.Println("Shutdown signal received, exiting...")
 	close(doneChan)
+	stopRamps()
 	wg.Wait()
+	// Let any reconciles that are still in flight finish before we exit.
+	limiter.Wait()
 	return
 }
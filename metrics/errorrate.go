@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	// SyncErrorRate provides the fraction of syncs that failed with each class of error
+	// over the rolling error rate window for each controller.
+	SyncErrorRate = NewGaugeVec(namespace+"sync_error_rate",
+		"Fraction of syncs that failed with each class of error over the rolling window.",
+		"controller", "class")
+	// SyncErrorRateThreshold provides the configured error rate above which syncs are considered to be failing.
+	SyncErrorRateThreshold = NewGaugeVec(namespace+"sync_error_rate_threshold",
+		"Error rate above which syncs are considered to be failing.")
+	// SyncErrorRateExceeded is set to 1 while the error rate for a controller and class of error
+	// is above the threshold, standard alerts can page on it staying at 1 for a sustained period.
+	SyncErrorRateExceeded = NewGaugeVec(namespace+"sync_error_rate_exceeded",
+		"Whether the error rate for a controller and class of error is above the threshold.",
+		"controller", "class")
+	// SyncsTotal provides the number of syncs carried out by each controller.
+	SyncsTotal = NewCounterVec(namespace+"syncs_total",
+		"Number of syncs carried out by each controller.",
+		"controller")
+	// SyncErrorsTotal provides the number of syncs that failed for each controller and class of error.
+	SyncErrorsTotal = NewCounterVec(namespace+"sync_errors_total",
+		"Number of syncs that failed for each controller and class of error.",
+		"controller", "class")
+)
+
+// Keeps the outcome of the syncs for each controller within the rolling window.
+type errorRates struct {
+	mu        sync.Mutex
+	window    time.Duration
+	threshold float64
+	classes   []string
+	results   map[string][]syncResult
+}
+
+// Provides the outcome of a single sync, an empty class means the sync succeeded.
+type syncResult struct {
+	at    time.Time
+	class string
+}
+
+var rates = &errorRates{window: 5 * time.Minute, threshold: 0.5, results: make(map[string][]syncResult)}
+
+func init() {
+	RegisterCollectFunc(rates.collect)
+}
+
+// ConfigureErrorRates sets the rolling window sync error rates are calculated over,
+// the error rate above which syncs are considered to be failing and the classes of error
+// the rates are always reported for, even when no errors of the class have been seen.
+func ConfigureErrorRates(window time.Duration, threshold float64, classes []string) {
+	rates.mu.Lock()
+	defer rates.mu.Unlock()
+	rates.window = window
+	rates.threshold = threshold
+	rates.classes = classes
+}
+
+// RecordSync records the outcome of a sync carried out by the provided controller,
+// class should be the class of the error the sync failed with or empty when it succeeded.
+func RecordSync(controller string, class string) {
+	SyncsTotal.WithLabelValues(controller).Inc()
+	if class != "" {
+		SyncErrorsTotal.WithLabelValues(controller, class).Inc()
+	}
+	rates.mu.Lock()
+	defer rates.mu.Unlock()
+	now := time.Now()
+	rates.results[controller] = append(rates.prune(rates.results[controller], now), syncResult{at: now, class: class})
+}
+
+// Drops the results that have fallen out of the window.
+func (r *errorRates) prune(results []syncResult, now time.Time) []syncResult {
+	i := 0
+	for i < len(results) && now.Sub(results[i].at) > r.window {
+		i++
+	}
+	return results[i:]
+}
+
+// Refreshes the error rate gauges from the results within the window.
+func (r *errorRates) collect() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	SyncErrorRate.Reset()
+	SyncErrorRateExceeded.Reset()
+	SyncErrorRateThreshold.WithLabelValues().Set(r.threshold)
+	for controller, results := range r.results {
+		results = r.prune(results, now)
+		r.results[controller] = results
+		errors := make(map[string]int)
+		for _, class := range r.classes {
+			errors[class] = 0
+		}
+		for _, result := range results {
+			if result.class != "" {
+				errors[result.class]++
+			}
+		}
+		for class, count := range errors {
+			rate := 0.0
+			if len(results) > 0 {
+				rate = float64(count) / float64(len(results))
+			}
+			SyncErrorRate.WithLabelValues(controller, class).Set(rate)
+			exceeded := 0.0
+			if rate > r.threshold {
+				exceeded = 1
+			}
+			SyncErrorRateExceeded.WithLabelValues(controller, class).Set(exceeded)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import "time"
+
+const namespace = "k8s_kong_api_"
+
+var (
+	// WatchEventDelivery provides the time it takes for an event received by an informer
+	// to be picked up by its controller. A growing delivery time means the controller is falling
+	// behind the events coming from the cluster.
+	WatchEventDelivery = NewHistogramVec(namespace+"watch_event_delivery_seconds",
+		"Time taken for an event received from a watch to be picked up by its controller.",
+		nil, "controller", "resource")
+	// WatchEventsPending provides the number of watch events waiting to be picked up by their controller.
+	WatchEventsPending = NewGaugeVec(namespace+"watch_events_pending",
+		"Number of watch events waiting to be picked up by their controller.",
+		"controller", "resource")
+	// EventsProcessedTotal provides the number of watch events picked up by each controller for each resource.
+	EventsProcessedTotal = NewCounterVec(namespace+"events_processed_total",
+		"Number of watch events picked up by each controller.",
+		"controller", "resource")
+	// KongOperationsTotal provides the number of writes made to the kong admin api for each operation,
+	// kind of kong object and outcome, which is success, failure or unreachable.
+	KongOperationsTotal = NewCounterVec(namespace+"kong_operations_total",
+		"Number of create, update and delete operations made to the kong admin api.",
+		"operation", "kind", "result")
+	// KongWritesSkippedTotal provides the number of updates to kong objects of each kind that were skipped
+	// as the object in kong already matched the desired state.
+	KongWritesSkippedTotal = NewCounterVec(namespace+"kong_writes_skipped_total",
+		"Number of updates to kong objects skipped as the object in kong already matched.",
+		"kind")
+	// QueueDepth provides the number of reconciles that have been queued up
+	// but have not yet finished for each namespace.
+	QueueDepth = NewGaugeVec(namespace+"queue_depth",
+		"Number of reconciles queued up or in flight for a namespace.",
+		"namespace")
+	// QueueOldestItemAge provides the age of the oldest reconcile queued up
+	// or in flight for each namespace.
+	QueueOldestItemAge = NewGaugeVec(namespace+"queue_oldest_item_age_seconds",
+		"Age of the oldest reconcile queued up or in flight for a namespace.",
+		"namespace")
+	// EventsMerged provides the number of events for an object that was already queued up
+	// to be reconciled, a climbing rate means events are backing up.
+	EventsMerged = NewCounterVec(namespace+"events_merged_total",
+		"Number of events merged into a reconcile of the same object still waiting in the queue.",
+		"controller", "resource")
+	// SyncRetriesTotal provides the number of failed reconciles scheduled to be retried by each controller.
+	SyncRetriesTotal = NewCounterVec(namespace+"sync_retries_total",
+		"Number of failed reconciles scheduled to be retried.",
+		"controller")
+	// SyncRetriesExhaustedTotal provides the number of resources each controller gave up retrying
+	// after they failed to reconcile the maximum number of times in a row.
+	SyncRetriesExhaustedTotal = NewCounterVec(namespace+"sync_retries_exhausted_total",
+		"Number of resources given up on after failing to reconcile the maximum number of times in a row.",
+		"controller")
+	// PluginsAwaitingAPI provides the number of ApiPlugin resources waiting on the kong API object
+	// they attach to before they can be synced.
+	PluginsAwaitingAPI = NewGaugeVec(namespace+"plugins_awaiting_api",
+		"Number of ApiPlugin resources waiting on the kong API object they attach to.")
+	// GCOrphans provides the number of owned kong objects of each kind found without
+	// the Kubernetes resource they are generated from in the last garbage collection pass.
+	GCOrphans = NewGaugeVec(namespace+"gc_orphans",
+		"Number of owned kong objects without a Kubernetes resource in the last garbage collection pass.",
+		"kind")
+	// GCReapedTotal provides the number of orphaned kong objects of each kind deleted by the garbage collector.
+	GCReapedTotal = NewCounterVec(namespace+"gc_reaped_total",
+		"Number of orphaned kong objects deleted by the garbage collector.",
+		"kind")
+	// DriftDesiredObjects provides the number of kong objects of each kind the k8s resources call for
+	// as of the last drift check.
+	DriftDesiredObjects = NewGaugeVec(namespace+"drift_desired_objects",
+		"Number of kong objects of each kind the k8s resources call for as of the last drift check.",
+		"kind")
+	// DriftActualObjects provides the number of kong objects of each kind managed by the controller
+	// that were observed in kong in the last drift check.
+	DriftActualObjects = NewGaugeVec(namespace+"drift_actual_objects",
+		"Number of managed kong objects of each kind observed in kong in the last drift check.",
+		"kind")
+	// DriftDesiredHash provides a fingerprint of the desired kong objects of each kind,
+	// kong matches k8s when it's equal to the actual fingerprint.
+	DriftDesiredHash = NewGaugeVec(namespace+"drift_desired_hash",
+		"Fingerprint of the kong objects of each kind the k8s resources call for.",
+		"kind")
+	// DriftActualHash provides a fingerprint of the managed kong objects of each kind observed in kong.
+	DriftActualHash = NewGaugeVec(namespace+"drift_actual_hash",
+		"Fingerprint of the managed kong objects of each kind observed in kong.",
+		"kind")
+	// DriftOutOfSync provides whether the kong objects a k8s resource calls for
+	// are missing from or differ from the ones in kong, 1 when they do.
+	DriftOutOfSync = NewGaugeVec(namespace+"out_of_sync",
+		"Whether the kong objects a k8s resource calls for are missing from or differ from the ones in kong.",
+		"kind", "resource")
+	// UpstreamStaleTargets provides the number of target entries kong keeps for the upstreams managed
+	// by the controller that no longer make up the active set of targets, as of the last compaction pass.
+	UpstreamStaleTargets = NewGaugeVec(namespace+"upstream_stale_targets",
+		"Number of stale target entries in the upstreams managed by the controller as of the last compaction pass.")
+	// TargetCompactionsTotal provides the number of upstreams whose target history has been compacted.
+	TargetCompactionsTotal = NewCounterVec(namespace+"target_compactions_total",
+		"Number of upstreams whose target history has been compacted.")
+	// TargetEntriesCompactedTotal provides the number of stale target entries dropped by compactions.
+	TargetEntriesCompactedTotal = NewCounterVec(namespace+"target_entries_compacted_total",
+		"Number of stale target entries dropped by upstream target compactions.")
+)
+
+// ObserveDelivery deals with recording how long the provided deliver function
+// takes to hand an event from an informer over to its controller.
+func ObserveDelivery(controller string, resource string, deliver func()) {
+	start := time.Now()
+	pending := WatchEventsPending.WithLabelValues(controller, resource)
+	pending.Inc()
+	deliver()
+	pending.Dec()
+	EventsProcessedTotal.WithLabelValues(controller, resource).Inc()
+	WatchEventDelivery.WithLabelValues(controller, resource).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,288 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Provides the metric families registered with the package
+// along with functions to run before every scrape.
+type registry struct {
+	mu           sync.Mutex
+	families     []family
+	collectFuncs []func()
+}
+
+var defaultRegistry = &registry{}
+
+// Implemented by every type of metric vector so the
+// registry can render it in the prometheus text format.
+type family interface {
+	write(w io.Writer)
+}
+
+// RegisterCollectFunc adds a function that gets called before every scrape
+// so gauges derived from the state of other components can be refreshed.
+func RegisterCollectFunc(fn func()) {
+	defaultRegistry.mu.Lock()
+	defer defaultRegistry.mu.Unlock()
+	defaultRegistry.collectFuncs = append(defaultRegistry.collectFuncs, fn)
+}
+
+func register(f family) {
+	defaultRegistry.mu.Lock()
+	defer defaultRegistry.mu.Unlock()
+	defaultRegistry.families = append(defaultRegistry.families, f)
+}
+
+// Handler provides the http handler that exposes all the registered
+// metrics in the prometheus text exposition format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defaultRegistry.mu.Lock()
+		collectFuncs := append([]func(){}, defaultRegistry.collectFuncs...)
+		families := append([]family{}, defaultRegistry.families...)
+		defaultRegistry.mu.Unlock()
+		for _, collect := range collectFuncs {
+			collect()
+		}
+		b := new(bytes.Buffer)
+		for _, f := range families {
+			f.write(b)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(b.Bytes())
+	})
+}
+
+// The common parts of every metric vector.
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+	mu     sync.Mutex
+}
+
+// Builds the key a child is stored under along with its rendered label pairs.
+func (v *vec) labelPairs(values []string, extra ...string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %v expects %v label values but got %v", v.name, len(v.labels), len(values)))
+	}
+	pairs := []string{}
+	for i, label := range v.labels {
+		pairs = append(pairs, label+"=\""+escape(values[i])+"\"")
+	}
+	pairs = append(pairs, extra...)
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (v *vec) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", v.name, v.help, v.name, v.typ)
+}
+
+func escape(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	return strings.Replace(s, "\n", "\\n", -1)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Value provides a single counter or gauge value.
+type Value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+// Inc increments the value by 1.
+func (v *Value) Inc() {
+	v.Add(1)
+}
+
+// Dec decrements the value by 1.
+func (v *Value) Dec() {
+	v.Add(-1)
+}
+
+// Add adds the provided delta to the value.
+func (v *Value) Add(delta float64) {
+	v.mu.Lock()
+	v.v += delta
+	v.mu.Unlock()
+}
+
+// Set sets the value, this should only be used for gauges.
+func (v *Value) Set(value float64) {
+	v.mu.Lock()
+	v.v = value
+	v.mu.Unlock()
+}
+
+// Get retrieves the current value.
+func (v *Value) Get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+// ValueVec provides a counter or gauge partitioned by a set of labels.
+type ValueVec struct {
+	vec
+	children map[string]*Value
+}
+
+// NewCounterVec creates and registers a new counter partitioned by the provided labels.
+func NewCounterVec(name string, help string, labels ...string) *ValueVec {
+	return newValueVec(name, help, "counter", labels)
+}
+
+// NewGaugeVec creates and registers a new gauge partitioned by the provided labels.
+func NewGaugeVec(name string, help string, labels ...string) *ValueVec {
+	return newValueVec(name, help, "gauge", labels)
+}
+
+func newValueVec(name string, help string, typ string, labels []string) *ValueVec {
+	v := &ValueVec{vec: vec{name: name, help: help, typ: typ, labels: labels}, children: make(map[string]*Value)}
+	register(v)
+	return v
+}
+
+// WithLabelValues retrieves the value for the provided label values,
+// creating it when it doesn't exist yet.
+func (v *ValueVec) WithLabelValues(values ...string) *Value {
+	key := v.labelPairs(values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	child, exists := v.children[key]
+	if !exists {
+		child = &Value{}
+		v.children[key] = child
+	}
+	return child
+}
+
+// Reset removes every value so gauges for objects that no longer
+// exist stop being exposed.
+func (v *ValueVec) Reset() {
+	v.mu.Lock()
+	v.children = make(map[string]*Value)
+	v.mu.Unlock()
+}
+
+func (v *ValueVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.writeHeader(w)
+	keys := []string{}
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%v%v %v\n", v.name, key, formatFloat(v.children[key].Get()))
+	}
+}
+
+// DefBuckets provides the default histogram buckets which are
+// tailored to measure latencies in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram provides a single histogram of observations.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if value <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// HistogramVec provides a histogram partitioned by a set of labels.
+type HistogramVec struct {
+	vec
+	buckets  []float64
+	children map[string][]string
+	values   map[string]*Histogram
+}
+
+// NewHistogramVec creates and registers a new histogram partitioned by the provided labels,
+// when no buckets are provided the default buckets are used.
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	h := &HistogramVec{
+		vec:      vec{name: name, help: help, typ: "histogram", labels: labels},
+		buckets:  buckets,
+		children: make(map[string][]string),
+		values:   make(map[string]*Histogram),
+	}
+	register(h)
+	return h
+}
+
+// WithLabelValues retrieves the histogram for the provided label values,
+// creating it when it doesn't exist yet.
+func (h *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	key := h.labelPairs(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	child, exists := h.values[key]
+	if !exists {
+		child = &Histogram{buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = child
+		h.children[key] = values
+	}
+	return child
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	keys := []string{}
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		child := h.values[key]
+		values := h.children[key]
+		child.mu.Lock()
+		for i, upper := range child.buckets {
+			fmt.Fprintf(w, "%v_bucket%v %v\n", h.name, h.labelPairs(values, "le=\""+formatFloat(upper)+"\""), child.counts[i])
+		}
+		fmt.Fprintf(w, "%v_bucket%v %v\n", h.name, h.labelPairs(values, "le=\"+Inf\""), child.count)
+		fmt.Fprintf(w, "%v_sum%v %v\n", h.name, key, formatFloat(child.sum))
+		fmt.Fprintf(w, "%v_count%v %v\n", h.name, key, child.count)
+		child.mu.Unlock()
+	}
+}
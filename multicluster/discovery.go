@@ -0,0 +1,151 @@
+package multicluster
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/selection"
+	"k8s.io/client-go/pkg/watch"
+)
+
+// Discovery deals with keeping track of the services in remote clusters, so a service in a remote
+// cluster with the same namespace and name as a local service can be registered as a target
+// of the kong upstream of the local service. This lets a single kong front door balance
+// traffic across every cluster running the service.
+// Remote services are only reachable from kong through their load balancer or external IPs,
+// remote services without either are ignored.
+type Discovery struct {
+	clusters map[string]*k8sclient.Client
+	selector labels.Selector
+	watchers map[string]*k8sclient.ResourceWatcher
+}
+
+// ParseKubeconfigs parses a comma separated list of name=path pairs
+// into the kubeconfig file of each remote cluster keyed by cluster name.
+func ParseKubeconfigs(value string) (map[string]string, error) {
+	kubeconfigs := make(map[string]string)
+	if value == "" {
+		return kubeconfigs, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Expected a name=path pair for each remote cluster but got %v", pair)
+		}
+		if _, exists := kubeconfigs[parts[0]]; exists {
+			return nil, fmt.Errorf("The %v remote cluster has been provided more than once", parts[0])
+		}
+		kubeconfigs[parts[0]] = parts[1]
+	}
+	return kubeconfigs, nil
+}
+
+// NewDiscovery creates a new instance of discovery for the provided remote clusters keyed by name,
+// only services with the provided API label are discovered like they are in the local cluster.
+func NewDiscovery(clusters map[string]*k8sclient.Client, apiLabel string) (*Discovery, error) {
+	req, err := labels.NewRequirement(apiLabel, selection.Exists, []string{})
+	if err != nil {
+		return nil, err
+	}
+	return &Discovery{clusters: clusters, selector: labels.NewSelector().Add(*req),
+		watchers: make(map[string]*k8sclient.ResourceWatcher)}, nil
+}
+
+// UpstreamName provides the name of the kong upstream balancing traffic
+// across the clusters running the service with the provided namespace and name.
+func UpstreamName(namespace string, name string) string {
+	return name + "." + namespace + ".multicluster"
+}
+
+// Run watches the services in every remote cluster until the provided done channel is closed,
+// calling onChange with the namespace and name of every remote service that changes so the targets
+// of the matching local service can be synced.
+// Run blocks until the services of every remote cluster have been loaded.
+func (d *Discovery) Run(done <-chan struct{}, onChange func(namespace string, name string)) {
+	ctx := k8sclient.DoneContext(done)
+	for name, client := range d.clusters {
+		cluster := name
+		watcher := client.NewServiceWatcher(ctx, "", d.selector)
+		watcher.Subscribe(func(evType watch.EventType, obj interface{}) {
+			service, ok := obj.(*v1.Service)
+			if !ok {
+				log.Printf("could not convert %v (%T) into Service", obj, obj)
+				return
+			}
+			if evType == watch.Added && !loadedAll(d.watchers) {
+				// The targets of every service are synced along with it once we're running.
+				return
+			}
+			log.Printf("The %v/%v service changed in the %v cluster", service.GetNamespace(), service.GetName(), cluster)
+			onChange(service.GetNamespace(), service.GetName())
+		})
+		d.watchers[cluster] = watcher
+	}
+	for cluster, watcher := range d.watchers {
+		log.Printf("Loading the services of the %v cluster", cluster)
+		watcher.Run(done)
+	}
+}
+
+// Targets provides the sorted host:port targets of the services in the remote clusters
+// with the provided namespace and name on the port with the provided name.
+func (d *Discovery) Targets(namespace string, name string, portName string) []string {
+	targets := []string{}
+	for _, watcher := range d.watchers {
+		obj, exists := watcher.Get(namespace, name)
+		if !exists {
+			continue
+		}
+		if service, ok := obj.(*v1.Service); ok {
+			targets = append(targets, remoteTargets(service, portName)...)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Lets us know whether the initial list of services has been loaded for every remote cluster.
+func loadedAll(watchers map[string]*k8sclient.ResourceWatcher) bool {
+	for _, watcher := range watchers {
+		if !watcher.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Provides the addresses the provided remote service can be reached on from kong on the port
+// with the provided name, the first port of the service is used when it doesn't have a port with the name.
+func remoteTargets(service *v1.Service, portName string) []string {
+	if len(service.Spec.Ports) == 0 {
+		return nil
+	}
+	port := ":" + strconv.Itoa(int(service.Spec.Ports[0].Port))
+	for _, servicePort := range service.Spec.Ports {
+		if servicePort.Name == portName {
+			port = ":" + strconv.Itoa(int(servicePort.Port))
+			break
+		}
+	}
+	targets := []string{}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			targets = append(targets, ingress.IP+port)
+		} else if ingress.Hostname != "" {
+			targets = append(targets, ingress.Hostname+port)
+		}
+	}
+	if len(targets) > 0 {
+		return targets
+	}
+	for _, ip := range service.Spec.ExternalIPs {
+		targets = append(targets, ip+port)
+	}
+	return targets
+}
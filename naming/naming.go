@@ -0,0 +1,28 @@
+package naming
+
+import "strings"
+
+// Scheme provides how the names of kong objects are derived from the Kubernetes objects they represent.
+// Watching every namespace brings services with the same name in different namespaces together in a single kong,
+// so the names of the kong API objects for services carry their namespace as well.
+type Scheme struct {
+	Namespaced bool
+}
+
+// API provides the name of the kong API object derived from the object with the provided namespace and name,
+// `<name>.<namespace>` when names are namespaced, otherwise just the name.
+func (s Scheme) API(namespace string, name string) string {
+	if !s.Namespaced {
+		return name
+	}
+	return name + "." + namespace
+}
+
+// Local provides the name the kong API object with the provided name in the provided namespace
+// was derived from, the reverse of API.
+func (s Scheme) Local(namespace string, apiName string) string {
+	if !s.Namespaced {
+		return apiName
+	}
+	return strings.TrimSuffix(apiName, "."+namespace)
+}
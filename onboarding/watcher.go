@@ -0,0 +1,151 @@
+package onboarding
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/fields"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Watcher deals with keeping track of the namespaces that have been onboarded
+// by setting the onboarding annotation to "true", so platform teams can onboard tenants
+// at runtime without changing the flags of the controller and restarting it.
+// Namespaces can also opt out by setting the opt out annotation or label to "true", which takes precedence
+// over onboarding so a team can take its namespace out of a controller watching the whole cluster.
+// Resources in namespaces that haven't been onboarded or have opted out are ignored by the controllers
+// and the kong objects already created for them are left as they are.
+type Watcher struct {
+	k8sClient  *k8sclient.Client
+	annotation string
+	optOut     string
+	mu         sync.RWMutex
+	enabled    map[string]bool
+	ignored    map[string]bool
+	synced     bool
+}
+
+// NewWatcher creates a new instance of the onboarding watcher for the provided onboarding annotation
+// and opt out annotation or label, with an empty onboarding annotation every namespace is treated as onboarded
+// and with an empty opt out key no namespace can opt out.
+func NewWatcher(k8sClient *k8sclient.Client, annotation string, optOut string) *Watcher {
+	return &Watcher{k8sClient: k8sClient, annotation: annotation, optOut: optOut, enabled: make(map[string]bool),
+		ignored: make(map[string]bool)}
+}
+
+// Enabled lets us know whether the provided namespace has been onboarded and hasn't opted out.
+func (w *Watcher) Enabled(namespace string) bool {
+	if w.annotation == "" && w.optOut == "" {
+		return true
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.enabledLocked(namespace)
+}
+
+// Lets us know whether the provided namespace is enabled, the lock must be held.
+func (w *Watcher) enabledLocked(namespace string) bool {
+	return !w.ignored[namespace] && (w.annotation == "" || w.enabled[namespace])
+}
+
+// Lets us know whether the provided namespace has opted out by setting the opt out annotation or label.
+func (w *Watcher) optedOut(namespace *v1.Namespace) bool {
+	return w.optOut != "" && (namespace.Annotations[w.optOut] == "true" || namespace.Labels[w.optOut] == "true")
+}
+
+// Run watches the namespaces in the cluster until the provided done channel is closed,
+// calling onEnabled whenever a namespace is onboarded or opts back in so its existing resources can be synced
+// and onDisabled whenever a namespace is offboarded, opts out or is deleted so what's kept for it can be dropped.
+// Namespaces are watched for deletions even when neither onboarding nor opting out is configured.
+// Run blocks until the initial list of namespaces has been loaded and then carries on watching
+// in the background so the controllers can be started straight after.
+func (w *Watcher) Run(done <-chan struct{}, onEnabled func(namespace string), onDisabled func(namespace string)) {
+	tracked := w.annotation != "" || w.optOut != ""
+	update := func(obj interface{}) {
+		if !tracked {
+			return
+		}
+		namespace, ok := obj.(*v1.Namespace)
+		if !ok {
+			log.Printf("could not convert %v (%T) into Namespace", obj, obj)
+			return
+		}
+		w.set(namespace.GetName(), namespace.Annotations[w.annotation] == "true", w.optedOut(namespace), onEnabled, onDisabled)
+	}
+	source := k8sclient.NewListWatchFromClient(k8sclient.DoneContext(done),
+		w.k8sClient.Clientset.CoreV1().RESTClient(), "namespaces", "", labels.Everything(), fields.Everything())
+	_, ctrl := cache.NewInformer(source, &v1.Namespace{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: update,
+		UpdateFunc: func(old, new interface{}) {
+			update(new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			namespace, ok := obj.(*v1.Namespace)
+			if !ok {
+				return
+			}
+			if tracked {
+				w.set(namespace.GetName(), false, false, onEnabled, nil)
+			}
+			// Deleted namespaces are always reported, whether or not they were enabled.
+			onDisabled(namespace.GetName())
+		},
+	})
+	go ctrl.Run(done)
+	for !ctrl.HasSynced() {
+		select {
+		case <-done:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	w.mu.Lock()
+	w.synced = true
+	w.mu.Unlock()
+}
+
+// Records whether the provided namespace is onboarded and whether it has opted out, logging and reporting
+// the change when the namespace has just been enabled or disabled by either, onDisabled can be nil
+// when disabling the namespace shouldn't be reported.
+// Namespaces loaded by the initial list aren't reported as their resources are synced
+// when the controllers start anyway.
+func (w *Watcher) set(namespace string, onboarded bool, ignored bool, onEnabled func(namespace string),
+	onDisabled func(namespace string)) {
+	w.mu.Lock()
+	wasEnabled, wasIgnored := w.enabledLocked(namespace), w.ignored[namespace]
+	setFlag(w.enabled, namespace, onboarded)
+	setFlag(w.ignored, namespace, ignored)
+	enabled := w.enabledLocked(namespace)
+	synced := w.synced
+	w.mu.Unlock()
+	if enabled == wasEnabled || !synced {
+		return
+	}
+	switch {
+	case enabled && wasIgnored:
+		log.Printf("The %v namespace no longer opts out of reconciliation", namespace)
+	case enabled:
+		log.Printf("The %v namespace has been onboarded", namespace)
+	case ignored:
+		log.Printf("The %v namespace has opted out, its resources will no longer be reconciled", namespace)
+	default:
+		log.Printf("The %v namespace has been offboarded, its resources will no longer be reconciled", namespace)
+	}
+	if enabled {
+		onEnabled(namespace)
+	} else if onDisabled != nil {
+		onDisabled(namespace)
+	}
+}
+
+func setFlag(flags map[string]bool, namespace string, set bool) {
+	if set {
+		flags[namespace] = true
+	} else {
+		delete(flags, namespace)
+	}
+}
@@ -0,0 +1,93 @@
+package fake
+
+import (
+	"sync"
+
+	"k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/unversioned"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+var configMapsResource = unversioned.GroupResource{Resource: "configmaps"}
+
+// ConfigMaps provides an in-memory implementation of ownership.ConfigMaps so the ownership registry
+// can be exercised without an apiserver. It answers like the apiserver does, e.g. with a not found error
+// for ConfigMaps that don't exist. Writes can be made to fail with FailWith.
+type ConfigMaps struct {
+	mu         sync.Mutex
+	configMaps map[string]*v1.ConfigMap
+	failWith   error
+}
+
+// NewConfigMaps creates a new instance of an empty set of in-memory ConfigMaps.
+func NewConfigMaps() *ConfigMaps {
+	return &ConfigMaps{configMaps: make(map[string]*v1.ConfigMap)}
+}
+
+// FailWith makes every create and update fail with the provided error without touching
+// the in-memory ConfigMaps, nil lets them through again.
+func (c *ConfigMaps) FailWith(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failWith = err
+}
+
+// Data provides a copy of the data of the ConfigMap with the provided name, nil when it doesn't exist.
+func (c *ConfigMaps) Data(name string) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	configMap, exists := c.configMaps[name]
+	if !exists {
+		return nil
+	}
+	return copyConfigMap(configMap).Data
+}
+
+// Get retrieves the ConfigMap with the provided name.
+func (c *ConfigMaps) Get(name string) (*v1.ConfigMap, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	configMap, exists := c.configMaps[name]
+	if !exists {
+		return nil, errors.NewNotFound(configMapsResource, name)
+	}
+	return copyConfigMap(configMap), nil
+}
+
+// Create creates the provided ConfigMap, failing when a ConfigMap with the same name exists.
+func (c *ConfigMaps) Create(configMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failWith != nil {
+		return nil, c.failWith
+	}
+	if _, exists := c.configMaps[configMap.Name]; exists {
+		return nil, errors.NewAlreadyExists(configMapsResource, configMap.Name)
+	}
+	c.configMaps[configMap.Name] = copyConfigMap(configMap)
+	return copyConfigMap(configMap), nil
+}
+
+// Update replaces the ConfigMap with the name of the provided ConfigMap.
+func (c *ConfigMaps) Update(configMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failWith != nil {
+		return nil, c.failWith
+	}
+	if _, exists := c.configMaps[configMap.Name]; !exists {
+		return nil, errors.NewNotFound(configMapsResource, configMap.Name)
+	}
+	c.configMaps[configMap.Name] = copyConfigMap(configMap)
+	return copyConfigMap(configMap), nil
+}
+
+// Copies the provided ConfigMap so the copy shares no data with the original,
+// the way ConfigMaps sent to the apiserver don't.
+func copyConfigMap(configMap *v1.ConfigMap) *v1.ConfigMap {
+	copied := &v1.ConfigMap{ObjectMeta: configMap.ObjectMeta, Data: make(map[string]string)}
+	for k, v := range configMap.Data {
+		copied.Data[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,195 @@
+package ownership
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// KindAPI provides the kind used to register kong API objects.
+	KindAPI = "apis"
+	// KindConsumer provides the kind used to register kong consumers, which are registered by their id.
+	KindConsumer = "consumers"
+	// KindKeyAuth provides the kind used to register kong key-auth credentials, which are registered by their id.
+	KindKeyAuth = "keyauth"
+	// KindCertificate provides the kind used to register kong certificates, which are registered by their id.
+	KindCertificate = "certificates"
+	// KindGlobalPlugin provides the kind used to register global kong plugins, which are registered by their name.
+	KindGlobalPlugin = "globalplugins"
+	// KindUpstream provides the kind used to register the kong upstreams created for kong API objects,
+	// which are registered by their name.
+	KindUpstream = "upstreams"
+	// The number of times we'll retry persisting the registry when
+	// someone else has updated the ConfigMap in the meantime.
+	maxConflictRetries = 5
+)
+
+// Registry keeps track of the kong objects owned by the controller along with
+// the Kubernetes resource that owns each of them.
+// Kong objects don't support tags in the versions we target so ownership is persisted
+// in a ConfigMap instead, this lets the controller tell apart the objects it created from
+// pre-existing objects someone else is managing.
+type Registry struct {
+	configMaps ConfigMaps
+	namespace  string
+	name       string
+	mu         sync.Mutex
+	owners     map[string]string
+}
+
+// ConfigMaps provides the operations on the ConfigMaps of a namespace the registry is persisted through,
+// it's implemented by the ConfigMap clients of the clientset and by the in-memory fake in the fake package.
+type ConfigMaps interface {
+	Get(name string) (*v1.ConfigMap, error)
+	Create(configMap *v1.ConfigMap) (*v1.ConfigMap, error)
+	Update(configMap *v1.ConfigMap) (*v1.ConfigMap, error)
+}
+
+// NewRegistry creates a new instance of the ownership registry persisted
+// in the ConfigMap with the provided namespace and name.
+func NewRegistry(k8sClient *k8sclient.Client, namespace string, name string) *Registry {
+	return NewRegistryFor(k8sClient.Clientset.CoreV1().ConfigMaps(namespace), namespace, name)
+}
+
+// NewRegistryFor creates a new instance of the ownership registry persisted through the provided
+// ConfigMaps of the provided namespace in the ConfigMap with the provided name.
+func NewRegistryFor(configMaps ConfigMaps, namespace string, name string) *Registry {
+	return &Registry{
+		configMaps: configMaps,
+		namespace:  namespace,
+		name:       name,
+		owners:     make(map[string]string),
+	}
+}
+
+// Load deals with loading the current owners from the ConfigMap,
+// a missing ConfigMap simply means the controller doesn't own anything yet.
+func (r *Registry) Load() error {
+	configMap, err := r.configMaps.Get(r.name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.owners = make(map[string]string)
+	for key, owner := range configMap.Data {
+		r.owners[key] = owner
+	}
+	log.Printf("Loaded %v owned kong objects from the %v/%v ConfigMap", len(r.owners), r.namespace, r.name)
+	return nil
+}
+
+// Owner retrieves the resource that owns the kong object of the provided kind and name,
+// lets us know whether the object is owned at all.
+func (r *Registry) Owner(kind string, name string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	owner, owned := r.owners[key(kind, name)]
+	return owner, owned
+}
+
+// Owned retrieves the names of every kong object of the provided kind
+// owned by the controller along with the resource that owns each of them.
+func (r *Registry) Owned(kind string) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prefix := kind + "."
+	owned := make(map[string]string)
+	for k, owner := range r.owners {
+		if strings.HasPrefix(k, prefix) {
+			owned[strings.TrimPrefix(k, prefix)] = owner
+		}
+	}
+	return owned
+}
+
+// Claim records the provided resource as the owner of the kong object
+// of the provided kind and name. The claim only takes effect once it has been persisted.
+func (r *Registry) Claim(kind string, name string, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := key(kind, name)
+	if current, owned := r.owners[k]; owned && current == owner {
+		return nil
+	}
+	return r.apply(func(data map[string]string) {
+		data[k] = owner
+	})
+}
+
+// Release removes the kong object of the provided kind and name
+// from the objects owned by the controller. The object stays owned until the release has been persisted.
+func (r *Registry) Release(kind string, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := key(kind, name)
+	if _, owned := r.owners[k]; !owned {
+		return nil
+	}
+	return r.apply(func(data map[string]string) {
+		delete(data, k)
+	})
+}
+
+// Applies the provided change to a copy of the owners and persists it, the owners are only
+// replaced by the copy once the change has been persisted so a failure leaves them as they were
+// and in line with the ConfigMap. The lock must be held.
+func (r *Registry) apply(change func(data map[string]string)) error {
+	owners := make(map[string]string, len(r.owners)+1)
+	for k, owner := range r.owners {
+		owners[k] = owner
+	}
+	change(owners)
+	if err := r.persist(change); err != nil {
+		return err
+	}
+	r.owners = owners
+	return nil
+}
+
+// Applies the provided change to the ConfigMap, creating it when it doesn't exist yet.
+// The change is applied to the latest copy of the ConfigMap so changes made by other
+// instances of the controller aren't lost.
+func (r *Registry) persist(change func(data map[string]string)) error {
+	for i := 0; i < maxConflictRetries; i++ {
+		configMap, err := r.configMaps.Get(r.name)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+			configMap = &v1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: r.name, Namespace: r.namespace}}
+			configMap.Data = make(map[string]string)
+			change(configMap.Data)
+			_, err = r.configMaps.Create(configMap)
+			if err != nil && errors.IsAlreadyExists(err) {
+				continue
+			}
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		change(configMap.Data)
+		_, err = r.configMaps.Update(configMap)
+		if err != nil && errors.IsConflict(err) {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("Failed to persist the ownership registry to the %v/%v ConfigMap after %v attempts",
+		r.namespace, r.name, maxConflictRetries)
+}
+
+// Provides the ConfigMap key for a kong object.
+func key(kind string, name string) string {
+	return kind + "." + name
+}
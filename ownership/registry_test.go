@@ -0,0 +1,86 @@
+package ownership
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/freshwebio/k8s-kong-api/ownership/fake"
+	apierrors "k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/unversioned"
+)
+
+var configMapsResource = unversioned.GroupResource{Resource: "configmaps"}
+
+func TestClaimAndReleasePersistOwnership(t *testing.T) {
+	configMaps := fake.NewConfigMaps()
+	r := NewRegistryFor(configMaps, "kong", "owners")
+	if err := r.Claim(KindAPI, "orders", "default/orders"); err != nil {
+		t.Fatalf("claiming the orders API: %v", err)
+	}
+	if err := r.Claim(KindUpstream, "orders.default.multicluster", "default/orders"); err != nil {
+		t.Fatalf("claiming the orders upstream: %v", err)
+	}
+	expected := map[string]string{"apis.orders": "default/orders", "upstreams.orders.default.multicluster": "default/orders"}
+	if !reflect.DeepEqual(configMaps.Data("owners"), expected) {
+		t.Errorf("expected the ConfigMap to hold %v but got %v", expected, configMaps.Data("owners"))
+	}
+
+	if err := r.Release(KindAPI, "orders"); err != nil {
+		t.Fatalf("releasing the orders API: %v", err)
+	}
+	if _, owned := r.Owner(KindAPI, "orders"); owned {
+		t.Error("expected the orders API to no longer be owned once released")
+	}
+	// A fresh registry loads what was persisted.
+	loaded := NewRegistryFor(configMaps, "kong", "owners")
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("loading the registry: %v", err)
+	}
+	expectedUpstreams := map[string]string{"orders.default.multicluster": "default/orders"}
+	if owned := loaded.Owned(KindUpstream); !reflect.DeepEqual(owned, expectedUpstreams) {
+		t.Errorf("expected the loaded upstreams to be %v but got %v", expectedUpstreams, owned)
+	}
+	if owned := loaded.Owned(KindAPI); len(owned) != 0 {
+		t.Errorf("expected no loaded APIs but got %v", owned)
+	}
+}
+
+func TestFailedClaimLeavesTheObjectUnowned(t *testing.T) {
+	configMaps := fake.NewConfigMaps()
+	configMaps.FailWith(errors.New("apiserver unavailable"))
+	r := NewRegistryFor(configMaps, "kong", "owners")
+	if err := r.Claim(KindAPI, "orders", "default/orders"); err == nil {
+		t.Fatal("expected the claim to fail when it can't be persisted")
+	}
+	if _, owned := r.Owner(KindAPI, "orders"); owned {
+		t.Error("expected the orders API not to be owned after a failed claim")
+	}
+
+	// The claim is persisted once the apiserver is back.
+	configMaps.FailWith(nil)
+	if err := r.Claim(KindAPI, "orders", "default/orders"); err != nil {
+		t.Fatalf("claiming the orders API: %v", err)
+	}
+	if owner, _ := r.Owner(KindAPI, "orders"); owner != "default/orders" {
+		t.Errorf("expected the orders API to be owned by default/orders but got %q", owner)
+	}
+}
+
+func TestFailedReleaseKeepsTheObjectOwned(t *testing.T) {
+	configMaps := fake.NewConfigMaps()
+	r := NewRegistryFor(configMaps, "kong", "owners")
+	if err := r.Claim(KindAPI, "orders", "default/orders"); err != nil {
+		t.Fatalf("claiming the orders API: %v", err)
+	}
+	configMaps.FailWith(apierrors.NewConflict(configMapsResource, "owners", errors.New("modified")))
+	if err := r.Release(KindAPI, "orders"); err == nil {
+		t.Fatal("expected the release to fail when it can't be persisted")
+	}
+	if owner, owned := r.Owner(KindAPI, "orders"); !owned || owner != "default/orders" {
+		t.Errorf("expected the orders API to stay owned by default/orders but got %q, %v", owner, owned)
+	}
+	if data := configMaps.Data("owners"); data["apis.orders"] != "default/orders" {
+		t.Errorf("expected the ConfigMap to still hold the orders API but got %v", data)
+	}
+}
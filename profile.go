@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/namsral/flag"
+)
+
+// Provides the flag defaults bundled by each configuration profile,
+// dev is geared towards trying the controller out safely while prod
+// switches on everything needed to run it reliably in a production cluster.
+var profiles = map[string]map[string]string{
+	"dev": {
+		"verbose": "true",
+		"dryrun":  "true",
+	},
+	"prod": {
+		"nsconcurrency": "4",
+		"nswriterate":   "10",
+		"nswriteburst":  "20",
+		"leaderelect":   "true",
+		"statusaddr":    ":8080",
+	},
+}
+
+// Applies the defaults of the provided profile to every flag
+// that hasn't been set explicitly so explicit flags always win over the profile.
+func applyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	defaults, exists := profiles[name]
+	if !exists {
+		return fmt.Errorf("Unknown configuration profile %v, expected one of dev or prod", name)
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for flagName, value := range defaults {
+		if set[flagName] {
+			continue
+		}
+		if err := flag.Set(flagName, value); err != nil {
+			return err
+		}
+	}
+	log.Printf("Applied the %v configuration profile", name)
+	return nil
+}
@@ -0,0 +1,115 @@
+package recorder
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/redact"
+	"k8s.io/client-go/pkg/api/unversioned"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// Component provides the source component of the events recorded by the controller.
+	Component = "k8s-kong-api"
+	// ReasonSynced provides the reason of the events recorded when a resource has been synced to kong.
+	ReasonSynced = "Synced"
+	// ReasonSyncFailed provides the reason of the events recorded when a resource failed to sync to kong.
+	ReasonSyncFailed = "SyncFailed"
+)
+
+// Recorder deals with recording the outcome of syncs as Kubernetes Events on the resources synced,
+// so `kubectl describe` shows why a resource isn't reflected in kong.
+// Repeats of the last event recorded for a resource bump the count of that event rather than creating
+// another one, and successful syncs are only recorded when the previous sync of the resource had a different outcome
+// so periodic resyncs don't flood the cluster with events.
+type Recorder struct {
+	k8sClient *k8sclient.Client
+	mu        sync.Mutex
+	last      map[string]*v1.Event
+}
+
+// NewRecorder creates a new instance of an event recorder.
+func NewRecorder(k8sClient *k8sclient.Client) *Recorder {
+	return &Recorder{k8sClient: k8sClient, last: make(map[string]*v1.Event)}
+}
+
+// Outcome records the outcome of a sync of the object with the provided reference,
+// a Warning event with the error when it failed and a Normal event when it succeeded.
+func (r *Recorder) Outcome(ref v1.ObjectReference, err error) {
+	if r == nil {
+		return
+	}
+	if err != nil {
+		r.Event(ref, v1.EventTypeWarning, ReasonSyncFailed, redact.String(err.Error()))
+		return
+	}
+	r.mu.Lock()
+	last, exists := r.last[refKey(ref)]
+	r.mu.Unlock()
+	if exists && last.InvolvedObject.UID == ref.UID && last.Reason == ReasonSynced {
+		return
+	}
+	r.Event(ref, v1.EventTypeNormal, ReasonSynced, "Synced to kong successfully")
+}
+
+// Event records an event of the provided type, reason and message on the object with the provided reference.
+// Failing to record the event is logged rather than failing the sync it's for. A nil recorder records nothing.
+func (r *Recorder) Event(ref v1.ObjectReference, eventType string, reason string, message string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := refKey(ref)
+	now := unversioned.Now()
+	events := r.k8sClient.Clientset.CoreV1().Events(ref.Namespace)
+	if last, exists := r.last[key]; exists && last.InvolvedObject.UID == ref.UID && last.Type == eventType &&
+		last.Reason == reason && last.Message == message {
+		repeat := *last
+		repeat.Count++
+		repeat.LastTimestamp = now
+		if updated, err := events.Update(&repeat); err == nil {
+			r.last[key] = updated
+			return
+		}
+		// The event has most likely expired, it's recorded afresh.
+	}
+	event := &v1.Event{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", ref.Name, now.UnixNano()),
+			Namespace: ref.Namespace,
+		},
+		InvolvedObject: ref,
+		Reason:         reason,
+		Message:        message,
+		Source:         v1.EventSource{Component: Component},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventType,
+	}
+	created, err := events.Create(event)
+	if err != nil {
+		log.Printf("Error recording the %v event for the %v %v/%v: %v", reason, ref.Kind, ref.Namespace, ref.Name, err)
+		return
+	}
+	r.last[key] = created
+}
+
+// Forget drops what's known about the events recorded for the object with the provided reference,
+// this should be called once the object has been deleted. Only the kind, namespace and name of the reference are used.
+func (r *Recorder) Forget(ref v1.ObjectReference) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.last, refKey(ref))
+}
+
+func refKey(ref v1.ObjectReference) string {
+	return ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+}
@@ -0,0 +1,141 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Mask provides the text sensitive values are replaced with.
+const Mask = "[REDACTED]"
+
+// DefaultKeys provides the key fragments treated as sensitive when none are configured,
+// they cover the credentials taken by the bundled kong plugins.
+var DefaultKeys = []string{"password", "secret", "token", "credential", "private_key", "api_key", "aws_key"}
+
+var (
+	mu     sync.RWMutex
+	keys   = DefaultKeys
+	values = make(map[string]bool)
+)
+
+// SetKeys replaces the key fragments treated as sensitive, a key is sensitive when its name
+// contains any of the fragments regardless of case.
+func SetKeys(fragments []string) {
+	lowered := make([]string, 0, len(fragments))
+	for _, fragment := range fragments {
+		if fragment = strings.ToLower(strings.TrimSpace(fragment)); fragment != "" {
+			lowered = append(lowered, fragment)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	keys = lowered
+}
+
+// AddValue registers a sensitive value, e.g. one sourced from a Secret, so it's masked
+// wherever it turns up regardless of the key it's held under.
+// Values like PEM blocks change when they are JSON encoded so their encoded form is masked too.
+func AddValue(value string) {
+	if value == "" {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	values[value] = true
+	if encoded, err := json.Marshal(value); err == nil {
+		values[string(encoded[1:len(encoded)-1])] = true
+	}
+}
+
+// SensitiveKey lets us know whether values held under the provided key are masked.
+func SensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, fragment := range keys {
+		if strings.Contains(key, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// String masks the registered sensitive values in the provided text.
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for value := range values {
+		s = strings.Replace(s, value, Mask, -1)
+	}
+	return s
+}
+
+// Map provides a copy of the provided map with the values of sensitive keys masked,
+// nested maps and lists are copied and masked too while the provided map is left untouched.
+func Map(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	masked := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		if SensitiveKey(key) {
+			masked[key] = Mask
+			continue
+		}
+		masked[key] = maskValue(value)
+	}
+	return masked
+}
+
+// JSON masks the values of sensitive keys in the provided JSON document along with
+// the registered sensitive values, anything that isn't JSON is masked as plain text.
+func JSON(data []byte) string {
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return String(string(data))
+	}
+	masked, err := json.Marshal(maskValue(document))
+	if err != nil {
+		return String(string(data))
+	}
+	return String(string(masked))
+}
+
+// Writer wraps the provided writer so the registered sensitive values
+// are masked in everything written to it, e.g. the output of the standard logger.
+func Writer(w io.Writer) io.Writer {
+	return &writer{w: w}
+}
+
+type writer struct {
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func maskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return Map(v)
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, item := range v {
+			masked[i] = maskValue(item)
+		}
+		return masked
+	case string:
+		return String(v)
+	default:
+		return v
+	}
+}
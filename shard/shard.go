@@ -0,0 +1,51 @@
+package shard
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+)
+
+// Shard provides the shard of namespaces an instance of the controller
+// is responsible for, namespaces are assigned to shards by hashing their names
+// so the work of very large clusters can be spread across several replicas.
+type Shard struct {
+	Index int
+	Total int
+}
+
+// Validate ensures the shard index falls within the total number of shards.
+func (s Shard) Validate() error {
+	if s.Total < 1 {
+		return fmt.Errorf("The total number of shards must be at least 1 but was %v", s.Total)
+	}
+	if s.Index < 0 || s.Index >= s.Total {
+		return fmt.Errorf("The shard index must be between 0 and %v but was %v", s.Total-1, s.Index)
+	}
+	return nil
+}
+
+// Owns lets us know whether the provided namespace belongs to the shard.
+func (s Shard) Owns(namespace string) bool {
+	if s.Total <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	return int(h.Sum32()%uint32(s.Total)) == s.Index
+}
+
+// OwnsClusterScoped lets us know whether cluster-scoped resources belong to the shard,
+// they don't live in a namespace so they are all reconciled by the first shard.
+func (s Shard) OwnsClusterScoped() bool {
+	return s.Index == 0
+}
+
+// LockName provides the name of the leader election lock for the shard
+// so the replicas of each shard elect a leader between themselves.
+func (s Shard) LockName(prefix string) string {
+	if s.Total <= 1 {
+		return prefix
+	}
+	return prefix + "-shard-" + strconv.Itoa(s.Index)
+}
@@ -0,0 +1,66 @@
+package syncerror
+
+import (
+	"fmt"
+
+	"github.com/freshwebio/k8s-kong-api/kong"
+	k8serrors "k8s.io/client-go/pkg/api/errors"
+)
+
+const (
+	// ClassKongUnreachable provides the class of errors where the kong admin api couldn't be reached.
+	ClassKongUnreachable = "kong_unreachable"
+	// ClassValidation provides the class of errors caused by invalid or incomplete resources.
+	ClassValidation = "validation"
+	// ClassK8sAPI provides the class of errors returned by the k8s api server.
+	ClassK8sAPI = "k8s_api"
+	// ClassOther provides the class of every other error, e.g. kong rejecting a request.
+	ClassOther = "other"
+)
+
+// Classes provides every error class a sync error can be classified as.
+var Classes = []string{ClassKongUnreachable, ClassValidation, ClassK8sAPI, ClassOther}
+
+// ValidationError provides the error when a resource can't be synced
+// because it's invalid or references something that doesn't exist,
+// retrying won't help until the resource is fixed.
+type ValidationError struct {
+	msg string
+}
+
+func (e *ValidationError) Error() string {
+	return e.msg
+}
+
+// NewValidation creates a new validation error with the provided message.
+func NewValidation(msg string) error {
+	return &ValidationError{msg: msg}
+}
+
+// Validationf creates a new validation error formatted according to the provided format.
+func Validationf(format string, a ...interface{}) error {
+	return &ValidationError{msg: fmt.Sprintf(format, a...)}
+}
+
+// Classify provides the class of the provided sync error,
+// an empty class is provided for a nil error.
+func Classify(err error) string {
+	if err == nil {
+		return ""
+	}
+	switch err.(type) {
+	case *kong.UnreachableError:
+		return ClassKongUnreachable
+	case *ValidationError:
+		return ClassValidation
+	}
+	if _, ok := err.(k8serrors.APIStatus); ok {
+		return ClassK8sAPI
+	}
+	return ClassOther
+}
+
+// ResourceKey provides the key a resource of the provided kind is recorded under in the error table.
+func ResourceKey(kind string, namespace string, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
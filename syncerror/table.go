@@ -0,0 +1,90 @@
+package syncerror
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/redact"
+)
+
+// Entry provides the last error seen while syncing a single resource.
+type Entry struct {
+	Resource     string    `json:"resource"`
+	Controller   string    `json:"controller"`
+	Class        string    `json:"class"`
+	Error        string    `json:"error"`
+	FirstFailure time.Time `json:"firstFailure"`
+	LastFailure  time.Time `json:"lastFailure"`
+	Retries      int       `json:"retries"`
+}
+
+// Table keeps the last error for every resource that is currently failing to sync,
+// a resource is removed from the table as soon as it syncs successfully.
+type Table struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+}
+
+// NewTable creates a new instance of an empty error table.
+func NewTable() *Table {
+	return &Table{entries: make(map[string]*Entry)}
+}
+
+// Record records the outcome of a sync of the provided resource by the provided controller,
+// consecutive failures are counted as retries of the first failure.
+func (t *Table) Record(controller string, resource string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := controller + "/" + resource
+	if err == nil {
+		delete(t.entries, key)
+		return
+	}
+	now := time.Now()
+	entry, exists := t.entries[key]
+	if !exists {
+		entry = &Entry{Resource: resource, Controller: controller, FirstFailure: now}
+		t.entries[key] = entry
+	} else {
+		entry.Retries++
+	}
+	entry.Class = Classify(err)
+	entry.Error = redact.String(err.Error())
+	entry.LastFailure = now
+}
+
+// Entries retrieves a snapshot of the resources currently failing to sync
+// ordered by resource and controller.
+func (t *Table) Entries() []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := []Entry{}
+	for _, entry := range t.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Sort(byResource(entries))
+	return entries
+}
+
+// Handler provides the http handler that serves the resources
+// currently failing to sync as JSON.
+func (t *Table) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Entries())
+	})
+}
+
+type byResource []Entry
+
+func (b byResource) Len() int      { return len(b) }
+func (b byResource) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byResource) Less(i, j int) bool {
+	if b[i].Resource != b[j].Resource {
+		return b[i].Resource < b[j].Resource
+	}
+	return b[i].Controller < b[j].Controller
+}
@@ -0,0 +1,236 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter provides per-namespace limits on the number of reconciles
+// that can be in flight at once and the rate at which writes can be made
+// to the kong admin api, this prevents a single namespace generating a storm
+// of events from starving the gateway updates of every other namespace.
+type Limiter struct {
+	maxConcurrent int
+	writeRate     float64
+	writeBurst    int
+	mu            sync.Mutex
+	namespaces    map[string]*namespaceLimits
+	inFlight      sync.WaitGroup
+}
+
+// Holds the reconcile slots, the keys currently being reconciled
+// along with the work queued up behind them and the write token bucket for a single namespace.
+// Forgotten limits are dropped once the last of their work has completed.
+type namespaceLimits struct {
+	namespace   string
+	slots       chan struct{}
+	keys        map[string][]*task
+	outstanding map[*task]struct{}
+	bucket      *tokenBucket
+	forgotten   bool
+}
+
+// Provides a single piece of dispatched work along with
+// the time it was dispatched.
+type task struct {
+	fn         func()
+	dispatched time.Time
+}
+
+// Stats provides a snapshot of the work queued up or in flight for a namespace.
+type Stats struct {
+	Depth     int
+	OldestAge time.Duration
+}
+
+// NewLimiter creates a new instance of a limiter, a maxConcurrent value of less than 1
+// is treated as 1 and a writeRate of 0 or less disables rate limiting of kong writes.
+func NewLimiter(maxConcurrent int, writeRate float64, writeBurst int) *Limiter {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	if writeBurst < 1 {
+		writeBurst = 1
+	}
+	return &Limiter{
+		maxConcurrent: maxConcurrent,
+		writeRate:     writeRate,
+		writeBurst:    writeBurst,
+		namespaces:    make(map[string]*namespaceLimits),
+	}
+}
+
+// Dispatch deals with running the provided function asynchronously once a reconcile slot
+// is available for the provided namespace.
+// Work dispatched with the same key is run one at a time in the order it was dispatched
+// so events for the same object can never be applied to kong out of order.
+// Dispatch never blocks so the watchers feeding events to the controllers keep moving.
+func (l *Limiter) Dispatch(namespace string, key string, fn func()) {
+	t := &task{fn: fn, dispatched: time.Now()}
+	l.inFlight.Add(1)
+	l.mu.Lock()
+	// The limits are looked up under the same lock the task is queued under so they can't be forgotten in between.
+	ns := l.limitsFor(namespace)
+	ns.outstanding[t] = struct{}{}
+	if pending, running := ns.keys[key]; running {
+		ns.keys[key] = append(pending, t)
+		l.mu.Unlock()
+		return
+	}
+	ns.keys[key] = []*task{}
+	l.mu.Unlock()
+	go l.run(ns, key, t)
+}
+
+// Runs the provided task followed by any work queued up for the same key
+// while it was running.
+func (l *Limiter) run(ns *namespaceLimits, key string, t *task) {
+	for t != nil {
+		ns.slots <- struct{}{}
+		t.fn()
+		<-ns.slots
+		l.inFlight.Done()
+		l.mu.Lock()
+		delete(ns.outstanding, t)
+		pending := ns.keys[key]
+		if len(pending) == 0 {
+			delete(ns.keys, key)
+			t = nil
+			l.dropIfForgotten(ns)
+		} else {
+			t = pending[0]
+			ns.keys[key] = pending[1:]
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Stats retrieves a snapshot of the work queued up or in flight
+// for every namespace the limiter has seen.
+func (l *Limiter) Stats() map[string]Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	stats := make(map[string]Stats)
+	for namespace, ns := range l.namespaces {
+		nsStats := Stats{Depth: len(ns.outstanding)}
+		for t := range ns.outstanding {
+			if age := now.Sub(t.dispatched); age > nsStats.OldestAge {
+				nsStats.OldestAge = age
+			}
+		}
+		stats[namespace] = nsStats
+	}
+	return stats
+}
+
+// WaitWrite blocks until the provided namespace is allowed to make
+// another write to the kong admin api, giving up with the error of the provided
+// context once it's done so a reconcile held back by the rate limit still honours its timeout.
+// Only Dispatch creates the limits of a namespace, there's nothing to wait on for a namespace
+// whose limits have been dropped so the write goes ahead without bringing them back.
+func (l *Limiter) WaitWrite(ctx context.Context, namespace string) error {
+	if l.writeRate <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	ns, exists := l.namespaces[namespace]
+	l.mu.Unlock()
+	if !exists {
+		return nil
+	}
+	return ns.bucket.wait(ctx)
+}
+
+// Forget drops the limits for the provided namespace, e.g. once the namespace has been deleted
+// or offboarded, so the limiter doesn't hold on to every namespace it has ever seen.
+// Limits with work queued up or in flight are dropped once all of it has completed,
+// a namespace seen again after its limits have been dropped starts out with fresh limits.
+func (l *Limiter) Forget(namespace string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ns, exists := l.namespaces[namespace]
+	if !exists {
+		return
+	}
+	ns.forgotten = true
+	l.dropIfForgotten(ns)
+}
+
+// Drops the provided limits when they have been forgotten and have no work left, the lock must be held.
+func (l *Limiter) dropIfForgotten(ns *namespaceLimits) {
+	if ns.forgotten && len(ns.keys) == 0 && l.namespaces[ns.namespace] == ns {
+		delete(l.namespaces, ns.namespace)
+	}
+}
+
+// Wait blocks until all the work that has been dispatched has completed.
+func (l *Limiter) Wait() {
+	l.inFlight.Wait()
+}
+
+// Retrieves the limits for the provided namespace, creating them
+// the first time the namespace is seen, the lock must be held.
+func (l *Limiter) limitsFor(namespace string) *namespaceLimits {
+	ns, exists := l.namespaces[namespace]
+	if !exists {
+		ns = &namespaceLimits{
+			namespace:   namespace,
+			slots:       make(chan struct{}, l.maxConcurrent),
+			keys:        make(map[string][]*task),
+			outstanding: make(map[*task]struct{}),
+			bucket:      newTokenBucket(l.writeRate, l.writeBurst),
+		}
+		l.namespaces[namespace] = ns
+	}
+	return ns
+}
+
+// Provides a simple token bucket that refills at the provided rate per second
+// up to the provided burst.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Blocks until a token can be taken from the bucket or the provided context is done,
+// in which case the token is handed back as the write it was for won't be made.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	// Take the token up front, when we go into debt the caller
+	// sleeps for as long as it takes the bucket to pay it back.
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
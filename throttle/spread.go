@@ -0,0 +1,36 @@
+package throttle
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	jitterMu sync.Mutex
+	jitter   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Spread runs the provided function after a random delay within the provided window
+// so work scheduled for many objects at once is spread out over the window instead of
+// hitting the apiserver and the kong admin api in a single burst.
+// The function runs straight away for a window of 0 or less and is dropped when the
+// provided done channel is closed before the delay has passed.
+func Spread(window time.Duration, done <-chan struct{}, fn func()) {
+	if window <= 0 {
+		fn()
+		return
+	}
+	jitterMu.Lock()
+	delay := time.Duration(jitter.Int63n(int64(window)))
+	jitterMu.Unlock()
+	go func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			fn()
+		}
+	}()
+}
@@ -0,0 +1,386 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/redact"
+	"k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// The keys the certificates are stored under in the Secret.
+	caCertKey  = "ca.crt"
+	tlsCertKey = "tls.crt"
+	tlsKeyKey  = "tls.key"
+	// The admission registration API the webhook configurations live in.
+	admissionRegistrationPath = "/apis/admissionregistration.k8s.io/v1"
+	// The path of the CustomResourceDefinition of the GatewayApi resources the webhook server converts.
+	gatewayApiDefinitionPath = "/apis/apiextensions.k8s.io/v1beta1/customresourcedefinitions/gatewayapis.k8s.freshweb.io"
+	// How often the certificates are checked for expiry.
+	certCheckInterval = time.Hour
+)
+
+// CertManager deals with generating a self-signed CA and serving certificate for the webhook server,
+// persisting them in a Secret, patching the CA bundle of the webhook configurations and the conversion
+// webhook of the GatewayApi definition and rotating
+// the certificates before they expire so the webhooks don't depend on cert-manager.
+type CertManager struct {
+	k8sClient         *k8sclient.Client
+	namespace         string
+	secretName        string
+	serviceName       string
+	webhookConfigName string
+	validity          time.Duration
+	mu                sync.RWMutex
+	cert              *tls.Certificate
+	caCert            []byte
+	notAfter          time.Time
+}
+
+// NewCertManager creates a new instance of the certificate manager for the webhook server behind the service
+// with the provided name in the provided namespace. Certificates are persisted in the Secret with the provided name
+// in the same namespace and the CA bundle is patched into the validating and mutating webhook configurations with
+// the provided name. Certificates are valid for the provided validity and get rotated once two thirds of it has passed.
+func NewCertManager(k8sClient *k8sclient.Client, namespace string, secretName string, serviceName string,
+	webhookConfigName string, validity time.Duration) *CertManager {
+	return &CertManager{
+		k8sClient:         k8sClient,
+		namespace:         namespace,
+		secretName:        secretName,
+		serviceName:       serviceName,
+		webhookConfigName: webhookConfigName,
+		validity:          validity,
+	}
+}
+
+// Ensure makes sure a valid certificate is loaded, reusing the certificates in the Secret
+// when they aren't due for rotation and generating new ones otherwise.
+// The CA bundle of the webhook configurations is patched every time so it never drifts from the Secret.
+func (m *CertManager) Ensure() error {
+	secrets := m.k8sClient.Clientset.CoreV1().Secrets(m.namespace)
+	secret, err := secrets.Get(m.secretName)
+	exists := true
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		exists = false
+	}
+	owner, hasOwner := m.ownerReference()
+	if exists {
+		if cert, notAfter, err := parseSecret(secret); err == nil && !m.dueForRotation(notAfter) {
+			if hasOwner && k8sclient.SetOwnerReference(&secret.ObjectMeta, owner) {
+				if _, err = secrets.Update(secret); err != nil {
+					log.Printf("Failed to link the %v/%v Secret to its webhook service: %v", m.namespace, m.secretName, err)
+				}
+			}
+			m.setCertificate(cert, secret.Data[caCertKey], notAfter)
+			return m.patchCABundle(secret.Data[caCertKey])
+		}
+	}
+	log.Printf("Generating new webhook certificates for the %v/%v service", m.namespace, m.serviceName)
+	data, err := m.generate()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		secret = &v1.Secret{
+			ObjectMeta: v1.ObjectMeta{Name: m.secretName, Namespace: m.namespace},
+			Type:       v1.SecretTypeTLS,
+		}
+	}
+	secret.Data = data
+	if hasOwner {
+		k8sclient.SetOwnerReference(&secret.ObjectMeta, owner)
+	}
+	if exists {
+		_, err = secrets.Update(secret)
+	} else {
+		_, err = secrets.Create(secret)
+	}
+	if err != nil && (errors.IsAlreadyExists(err) || errors.IsConflict(err)) {
+		// Another replica got there first so pick up the certificates it saved.
+		secret, err = secrets.Get(m.secretName)
+		if err == nil {
+			data = secret.Data
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to save the webhook certificates to the %v/%v Secret: %v", m.namespace, m.secretName, err)
+	}
+	cert, notAfter, err := parseSecret(secret)
+	if err != nil {
+		return err
+	}
+	m.setCertificate(cert, data[caCertKey], notAfter)
+	return m.patchCABundle(data[caCertKey])
+}
+
+// Provides the owner reference linking the certificate Secret to the webhook service
+// so the Secret is garbage collected along with the service.
+// Lets us know whether the service could be found.
+func (m *CertManager) ownerReference() (v1.OwnerReference, bool) {
+	service, err := m.k8sClient.Clientset.CoreV1().Services(m.namespace).Get(m.serviceName)
+	if err != nil {
+		log.Printf("Not linking the webhook certificates to the %v/%v service: %v", m.namespace, m.serviceName, err)
+		return v1.OwnerReference{}, false
+	}
+	return k8sclient.ControllerReference("v1", "Service", service.GetName(), service.GetUID()), true
+}
+
+// Run periodically checks whether the certificates are due for rotation
+// and rotates them until the provided done channel is closed. Certificates that aren't due
+// have their CA bundle patched again, as rerunning the install replaces the GatewayApi definition without it.
+// This method should be called asynchronously in it's own goroutine.
+func (m *CertManager) Run(done <-chan struct{}) {
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			m.mu.RLock()
+			notAfter := m.notAfter
+			m.mu.RUnlock()
+			if !m.dueForRotation(notAfter) {
+				if err := m.patchCABundle(m.CABundle()); err != nil {
+					log.Printf("Error while patching the CA bundle of the webhook certificates: %v", err)
+				}
+				continue
+			}
+			if err := m.Ensure(); err != nil {
+				log.Printf("Error while rotating the webhook certificates: %v", err)
+			}
+		}
+	}
+}
+
+// GetCertificate provides the current serving certificate, this should be used as the
+// GetCertificate function of the webhook server's TLS config so rotated certificates
+// are picked up without restarting the server.
+func (m *CertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, fmt.Errorf("No webhook certificate has been loaded yet")
+	}
+	return m.cert, nil
+}
+
+// CABundle provides the PEM encoded CA certificate that signed the current serving certificate.
+func (m *CertManager) CABundle() []byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.caCert
+}
+
+func (m *CertManager) setCertificate(cert *tls.Certificate, caCert []byte, notAfter time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cert = cert
+	m.caCert = caCert
+	m.notAfter = notAfter
+}
+
+// Lets us know whether a certificate expiring at the provided time
+// has less than a third of its validity left.
+func (m *CertManager) dueForRotation(notAfter time.Time) bool {
+	return time.Now().Add(m.validity / 3).After(notAfter)
+}
+
+// Generates a new CA along with a serving certificate for the webhook service signed by it,
+// providing the PEM encoded certificates and key keyed as they are stored in the Secret.
+func (m *CertManager) generate() (map[string][]byte, error) {
+	now := time.Now()
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               pkix.Name{CommonName: m.serviceName + "-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(m.validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	host := m.serviceName + "." + m.namespace + ".svc"
+	template := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames: []string{
+			m.serviceName,
+			m.serviceName + "." + m.namespace,
+			host,
+			host + ".cluster.local",
+		},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(m.validity),
+		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		caCertKey:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		tlsCertKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		tlsKeyKey:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	}, nil
+}
+
+// Patches the provided CA bundle into every webhook of the validating and mutating
+// webhook configurations, configurations that don't exist are skipped.
+// The GatewayApi definition gets it too when it converts objects with the webhook server.
+func (m *CertManager) patchCABundle(caBundle []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(caBundle)
+	restClient := m.k8sClient.JSONClientset.CoreV1().RESTClient()
+	for _, resource := range []string{"validatingwebhookconfigurations", "mutatingwebhookconfigurations"} {
+		path := admissionRegistrationPath + "/" + resource + "/" + m.webhookConfigName
+		raw, err := restClient.Get().AbsPath(path).DoRaw()
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("Failed to retrieve the %v %v: %v", m.webhookConfigName, resource, err)
+		}
+		var config map[string]interface{}
+		if err = json.Unmarshal(raw, &config); err != nil {
+			return err
+		}
+		webhooks, _ := config["webhooks"].([]interface{})
+		changed := false
+		for _, w := range webhooks {
+			webhook, ok := w.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			clientConfig, ok := webhook["clientConfig"].(map[string]interface{})
+			if !ok {
+				clientConfig = make(map[string]interface{})
+				webhook["clientConfig"] = clientConfig
+			}
+			if current, _ := clientConfig["caBundle"].(string); current != encoded {
+				clientConfig["caBundle"] = encoded
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		body, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		// The update carries the resourceVersion we read so it fails rather than overwriting concurrent changes.
+		_, err = restClient.Put().AbsPath(path).Body(body).DoRaw()
+		if err != nil {
+			return fmt.Errorf("Failed to patch the CA bundle of the %v %v: %v", m.webhookConfigName, resource, err)
+		}
+		log.Printf("Patched the CA bundle of the %v %v", m.webhookConfigName, resource)
+	}
+	return m.patchConversionCABundle(encoded)
+}
+
+// Patches the provided base64 encoded CA bundle into the conversion webhook of the GatewayApi definition,
+// definitions that don't exist or aren't served under more than one version are skipped.
+func (m *CertManager) patchConversionCABundle(encoded string) error {
+	restClient := m.k8sClient.JSONClientset.CoreV1().RESTClient()
+	raw, err := restClient.Get().AbsPath(gatewayApiDefinitionPath).DoRaw()
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("Failed to retrieve the GatewayApi CustomResourceDefinition: %v", err)
+	}
+	var definition map[string]interface{}
+	if err = json.Unmarshal(raw, &definition); err != nil {
+		return err
+	}
+	spec, _ := definition["spec"].(map[string]interface{})
+	conversion, _ := spec["conversion"].(map[string]interface{})
+	if strategy, _ := conversion["strategy"].(string); strategy != "Webhook" {
+		return nil
+	}
+	clientConfig, ok := conversion["webhookClientConfig"].(map[string]interface{})
+	if !ok {
+		clientConfig = make(map[string]interface{})
+		conversion["webhookClientConfig"] = clientConfig
+	}
+	if current, _ := clientConfig["caBundle"].(string); current == encoded {
+		return nil
+	}
+	clientConfig["caBundle"] = encoded
+	body, err := json.Marshal(definition)
+	if err != nil {
+		return err
+	}
+	// The update carries the resourceVersion we read so it fails rather than overwriting concurrent changes.
+	if _, err = restClient.Put().AbsPath(gatewayApiDefinitionPath).Body(body).DoRaw(); err != nil {
+		return fmt.Errorf("Failed to patch the CA bundle of the GatewayApi CustomResourceDefinition: %v", err)
+	}
+	log.Printf("Patched the CA bundle of the GatewayApi CustomResourceDefinition")
+	return nil
+}
+
+// Parses the serving certificate and key in the provided Secret, lets us know when the
+// serving certificate expires and fails when it wasn't signed by the CA in the Secret.
+func parseSecret(secret *v1.Secret) (*tls.Certificate, time.Time, error) {
+	cert, err := tls.X509KeyPair(secret.Data[tlsCertKey], secret.Data[tlsKeyKey])
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(secret.Data[caCertKey]) {
+		return nil, time.Time{}, fmt.Errorf("The %v Secret doesn't contain a valid CA certificate", secret.GetName())
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	cert.Leaf = leaf
+	redact.AddValue(string(secret.Data[tlsKeyKey]))
+	return &cert, leaf.NotAfter, nil
+}
+
+// Provides a random serial number for a new certificate.
+func newSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
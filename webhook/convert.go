@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/freshwebio/k8s-kong-api/gatewayapi"
+)
+
+// Provides the parts of an apiextensions.k8s.io/v1beta1 ConversionReview the webhook deals with.
+type conversionReview struct {
+	APIVersion string              `json:"apiVersion"`
+	Kind       string              `json:"kind"`
+	Request    *conversionRequest  `json:"request,omitempty"`
+	Response   *conversionResponse `json:"response,omitempty"`
+}
+
+type conversionRequest struct {
+	UID               string            `json:"uid"`
+	DesiredAPIVersion string            `json:"desiredAPIVersion"`
+	Objects           []json.RawMessage `json:"objects"`
+}
+
+type conversionResponse struct {
+	UID              string            `json:"uid"`
+	ConvertedObjects []json.RawMessage `json:"convertedObjects"`
+	Result           conversionResult  `json:"result"`
+}
+
+type conversionResult struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Converts the GatewayApi resources in the ConversionReview posted to the server to the version the apiserver asks for,
+// the review fails as a whole when any of them can't be converted.
+func serveConversion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	review := &conversionReview{}
+	if err := json.NewDecoder(r.Body).Decode(review); err != nil || review.Request == nil {
+		http.Error(w, "Expected a ConversionReview with a request", http.StatusBadRequest)
+		return
+	}
+	response := &conversionResponse{UID: review.Request.UID, Result: conversionResult{Status: "Success"}}
+	for _, object := range review.Request.Objects {
+		converted, err := gatewayapi.Convert(object, review.Request.DesiredAPIVersion)
+		if err != nil {
+			log.Printf("Failed to convert the GatewayApi %v to %v: %v", objectName(object),
+				review.Request.DesiredAPIVersion, err)
+			response.ConvertedObjects = nil
+			response.Result = conversionResult{Status: "Failure", Message: err.Error()}
+			break
+		}
+		response.ConvertedObjects = append(response.ConvertedObjects, converted)
+	}
+	body, err := json.Marshal(&conversionReview{APIVersion: review.APIVersion, Kind: review.Kind, Response: response})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// Converts the objects of the provided admission request for a GatewayApi resource written through v2
+// to the v1 objects they're stored as, requests for v1 resources are left as they are.
+func convertToV1(req *admissionRequest) error {
+	if req.Kind.Version != gatewayapi.VersionV2 {
+		return nil
+	}
+	v1 := gatewayapi.Resource.Group + "/" + gatewayapi.Resource.Version
+	object, err := gatewayapi.Convert(req.Object, v1)
+	if err != nil {
+		return fmt.Errorf("The v2 spec can't be converted to v1: %v", err)
+	}
+	req.Object = object
+	if len(req.OldObject) == 0 || string(req.OldObject) == "null" {
+		return nil
+	}
+	if req.OldObject, err = gatewayapi.Convert(req.OldObject, v1); err != nil {
+		return fmt.Errorf("The previous v2 spec can't be converted to v1: %v", err)
+	}
+	return nil
+}
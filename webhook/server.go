@@ -0,0 +1,296 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/apiplugin"
+	"github.com/freshwebio/k8s-kong-api/gatewayapi"
+	"github.com/freshwebio/k8s-kong-api/k8sclient"
+	"github.com/freshwebio/k8s-kong-api/kong"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/selection"
+)
+
+const (
+	// The path the apiserver posts admission reviews to.
+	validatePath = "/validate"
+	// The path the apiserver posts conversion reviews to.
+	convertPath = "/convert"
+	// How long the plugins enabled in kong are cached for between admission reviews.
+	enabledPluginsTTL = time.Minute
+)
+
+// Provides the parts of an admission.k8s.io/v1 AdmissionReview the webhook deals with.
+type admissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *admissionRequest  `json:"request,omitempty"`
+	Response   *admissionResponse `json:"response,omitempty"`
+}
+
+type admissionRequest struct {
+	UID  string `json:"uid"`
+	Kind struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"kind"`
+	Namespace string          `json:"namespace"`
+	Operation string          `json:"operation"`
+	Object    json.RawMessage `json:"object,omitempty"`
+	OldObject json.RawMessage `json:"oldObject,omitempty"`
+}
+
+type admissionResponse struct {
+	UID     string           `json:"uid"`
+	Allowed bool             `json:"allowed"`
+	Result  *admissionResult `json:"status,omitempty"`
+}
+
+type admissionResult struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// Server deals with validating GatewayApi and ApiPlugin resources as they're admitted so mistakes
+// are reported to whoever applies the resource rather than only surfacing as failed syncs.
+// Resources are rejected when their selector doesn't select a service, the service they select
+// doesn't exist, their URIs aren't well-formed paths or the plugin they attach isn't enabled in kong.
+// It also converts GatewayApi resources between the versions they're served under for the apiserver.
+type Server struct {
+	k8sClient            *k8sclient.Client
+	kongClient           kong.Interface
+	apiLabel             string
+	serviceSelectorLabel string
+	mu                   sync.Mutex
+	enabledPlugins       map[string]bool
+	enabledPluginsAt     time.Time
+}
+
+// NewServer creates a new instance of the webhook server validating resources that select services
+// with the provided service selector label, the selected services need the provided api label.
+func NewServer(k8sClient *k8sclient.Client, kongClient kong.Interface, apiLabel string, serviceSelectorLabel string) *Server {
+	return &Server{
+		k8sClient:            k8sClient,
+		kongClient:           kongClient,
+		apiLabel:             apiLabel,
+		serviceSelectorLabel: serviceSelectorLabel,
+	}
+}
+
+// ListenAndServeTLS serves admission and conversion reviews on the provided address with the serving certificate
+// of the provided certificate manager, it only returns once serving fails.
+func (s *Server) ListenAndServeTLS(addr string, certs *CertManager) error {
+	mux := http.NewServeMux()
+	mux.Handle(validatePath, s)
+	mux.HandleFunc(convertPath, serveConversion)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	// The certificate is looked up for every connection so rotated certificates are served straight away.
+	tlsListener := tls.NewListener(listener, &tls.Config{GetCertificate: certs.GetCertificate})
+	return (&http.Server{Handler: mux}).Serve(tlsListener)
+}
+
+// ServeHTTP reviews the admission of the resource in the AdmissionReview posted to the server.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	review := &admissionReview{}
+	if err := json.NewDecoder(r.Body).Decode(review); err != nil || review.Request == nil {
+		http.Error(w, "Expected an AdmissionReview with a request", http.StatusBadRequest)
+		return
+	}
+	response := &admissionResponse{UID: review.Request.UID, Allowed: true}
+	if err := s.review(r.Context(), review.Request); err != nil {
+		log.Printf("Rejected the %v of the %v %v in the %v namespace: %v", strings.ToLower(review.Request.Operation),
+			review.Request.Kind.Kind, objectName(review.Request.Object), review.Request.Namespace, err)
+		response.Allowed = false
+		response.Result = &admissionResult{Message: err.Error(), Code: http.StatusForbidden}
+	}
+	body, err := json.Marshal(&admissionReview{APIVersion: review.APIVersion, Kind: review.Kind, Response: response})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// Validates the resource in the provided admission request, only creates and updates that change
+// the spec are validated so the controller can still update the status and finalizers of resources
+// whose service has gone away and resources can always be deleted.
+func (s *Server) review(ctx context.Context, req *admissionRequest) error {
+	if req.Operation != "CREATE" && req.Operation != "UPDATE" {
+		return nil
+	}
+	switch req.Kind.Kind {
+	case "GatewayApi":
+		// Resources written through v2 are validated as the v1 resources they're stored as.
+		if err := convertToV1(req); err != nil {
+			return err
+		}
+		a, old := &gatewayapi.GatewayApi{}, &gatewayapi.GatewayApi{}
+		if err := decode(req, a, old); err != nil {
+			return err
+		}
+		if a.Metadata.DeletionTimestamp != nil || (req.Operation == "UPDATE" && reflect.DeepEqual(a.Spec, old.Spec)) {
+			return nil
+		}
+		return s.validateGatewayApi(req.Namespace, a)
+	case "ApiPlugin":
+		p, old := &apiplugin.ApiPlugin{}, &apiplugin.ApiPlugin{}
+		if err := decode(req, p, old); err != nil {
+			return err
+		}
+		if p.Metadata.DeletionTimestamp != nil || (req.Operation == "UPDATE" && reflect.DeepEqual(p.Spec, old.Spec)) {
+			return nil
+		}
+		return s.validateApiPlugin(ctx, req.Namespace, p)
+	}
+	return nil
+}
+
+func (s *Server) validateGatewayApi(namespace string, a *gatewayapi.GatewayApi) error {
+	if err := s.validateSelector(namespace, a.Spec.Selector); err != nil {
+		return err
+	}
+	if err := validateURIs(a.Spec.Uris); err != nil {
+		return err
+	}
+	for _, port := range a.Spec.Ports {
+		if err := validateURIs(port.Uris); err != nil {
+			return fmt.Errorf("The %v port: %v", port.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) validateApiPlugin(ctx context.Context, namespace string, p *apiplugin.ApiPlugin) error {
+	if err := s.validateSelector(namespace, p.Spec.Selector); err != nil {
+		return err
+	}
+	return s.validatePluginName(ctx, p.Spec.Name)
+}
+
+// Makes sure the provided selector selects a service through the service selector label
+// and that a service with the api label exists in the provided namespace for it to select.
+func (s *Server) validateSelector(namespace string, selector map[string]string) error {
+	value, exists := selector[s.serviceSelectorLabel]
+	if !exists || value == "" {
+		return fmt.Errorf("The selector must set the service selector label (%v)", s.serviceSelectorLabel)
+	}
+	sel := labels.NewSelector()
+	req, err := labels.NewRequirement(s.serviceSelectorLabel, selection.Equals, []string{value})
+	if err != nil {
+		return fmt.Errorf("The selector has an invalid %v label: %v", s.serviceSelectorLabel, err)
+	}
+	apiReq, err := labels.NewRequirement(s.apiLabel, selection.Exists, []string{})
+	if err != nil {
+		return err
+	}
+	sel = sel.Add(*req).Add(*apiReq)
+	services, err := s.k8sClient.Clientset.CoreV1().Services(namespace).List(v1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		return fmt.Errorf("Failed to look up the selected service: %v", err)
+	}
+	if len(services.Items) == 0 {
+		return fmt.Errorf("No service in the %v namespace has the %v label set to %v along with the %v label",
+			namespace, s.serviceSelectorLabel, value, s.apiLabel)
+	}
+	return nil
+}
+
+// Makes sure the plugin with the provided name is enabled in kong. When kong can't be reached
+// the plugin is let through, the controller reports plugins kong doesn't know about when it syncs them.
+// Kong is only waited on for as long as the apiserver waits on the review.
+func (s *Server) validatePluginName(ctx context.Context, name string) error {
+	if name == "" {
+		return fmt.Errorf("The plugin name must be set")
+	}
+	enabled, err := s.enabled(ctx)
+	if err != nil {
+		log.Printf("Not checking the %v plugin is enabled in kong: %v", name, err)
+		return nil
+	}
+	if !enabled[name] {
+		return fmt.Errorf("The %v plugin isn't enabled in kong", name)
+	}
+	return nil
+}
+
+// Provides the plugins enabled in kong, they're cached for a while as they only change when kong is reconfigured.
+func (s *Server) enabled(ctx context.Context) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.enabledPlugins != nil && time.Since(s.enabledPluginsAt) < enabledPluginsTTL {
+		return s.enabledPlugins, nil
+	}
+	names, err := s.kongClient.EnabledPlugins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.enabledPlugins = make(map[string]bool)
+	for _, name := range names {
+		s.enabledPlugins[name] = true
+	}
+	s.enabledPluginsAt = time.Now()
+	return s.enabledPlugins, nil
+}
+
+// Makes sure each of the provided URIs is an absolute path kong can match requests against.
+func validateURIs(uris []string) error {
+	for _, uri := range uris {
+		if !strings.HasPrefix(uri, "/") {
+			return fmt.Errorf("The uri %q must start with a /", uri)
+		}
+		if strings.ContainsAny(uri, " \t\r\n") {
+			return fmt.Errorf("The uri %q must not contain whitespace", uri)
+		}
+		if _, err := url.Parse(uri); err != nil {
+			return fmt.Errorf("The uri %q isn't well-formed: %v", uri, err)
+		}
+	}
+	return nil
+}
+
+// Decodes the object of the provided admission request into obj and the object it replaces into old.
+func decode(req *admissionRequest, obj interface{}, old interface{}) error {
+	if err := json.Unmarshal(req.Object, obj); err != nil {
+		return fmt.Errorf("Failed to decode the %v: %v", req.Kind.Kind, err)
+	}
+	if len(req.OldObject) == 0 || string(req.OldObject) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(req.OldObject, old); err != nil {
+		return fmt.Errorf("Failed to decode the previous %v: %v", req.Kind.Kind, err)
+	}
+	return nil
+}
+
+// Provides the name of the provided raw object for logging.
+func objectName(raw json.RawMessage) string {
+	var obj struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	json.Unmarshal(raw, &obj)
+	return obj.Metadata.Name
+}
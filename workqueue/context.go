@@ -0,0 +1,20 @@
+package workqueue
+
+import (
+	"context"
+	"time"
+)
+
+// Context provides the context a single reconcile is carried out under, it's derived from the provided context
+// so reconciles are abandoned on shutdown and is cancelled once the provided timeout has passed so a reconcile
+// can't block on kong indefinitely. A timeout of 0 leaves the reconcile unbounded.
+// The provided cancel function must be called once the reconcile has finished.
+func Context(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
@@ -0,0 +1,82 @@
+package workqueue
+
+import "sync"
+
+// Memory keeps track of what the reconciles for each key need to know beyond the latest state
+// of the resource in the informer caches: the state the resource was last synced with so a reconcile
+// can work out what has changed, the last state of a resource that has been deleted so a reconcile
+// can clean up after it and whether the next reconcile has been forced by a resync.
+type Memory struct {
+	mu      sync.Mutex
+	synced  map[string]interface{}
+	deleted map[string]interface{}
+	forced  map[string]bool
+}
+
+// NewMemory creates a new instance of an empty memory.
+func NewMemory() *Memory {
+	return &Memory{synced: make(map[string]interface{}), deleted: make(map[string]interface{}),
+		forced: make(map[string]bool)}
+}
+
+// Synced records the provided state as the one the resource with the provided key was last synced with,
+// a resource that has been synced is no longer waiting to be cleaned up after.
+func (m *Memory) Synced(key string, obj interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.synced[key] = obj
+	delete(m.deleted, key)
+}
+
+// LastSynced retrieves the state the resource with the provided key was last synced with,
+// lets us know whether it has been synced since the controller started.
+func (m *Memory) LastSynced(key string) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, exists := m.synced[key]
+	return obj, exists
+}
+
+// Deleted records the provided state as the last state of the resource with the provided key
+// which has been deleted.
+func (m *Memory) Deleted(key string, obj interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleted[key] = obj
+}
+
+// LastDeleted retrieves the last state of the resource with the provided key that has been deleted,
+// lets us know whether it's still waiting to be cleaned up after.
+func (m *Memory) LastDeleted(key string) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, exists := m.deleted[key]
+	return obj, exists
+}
+
+// Forget drops everything remembered about the resource with the provided key,
+// this should be called once a deleted resource has been cleaned up after.
+func (m *Memory) Forget(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.synced, key)
+	delete(m.deleted, key)
+	delete(m.forced, key)
+}
+
+// Force marks the next reconcile of the resource with the provided key as forced.
+func (m *Memory) Force(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.forced[key] = true
+}
+
+// TakeForced lets us know whether the reconcile of the resource with the provided key has been forced,
+// clearing the mark so only a single reconcile is forced.
+func (m *Memory) TakeForced(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	forced := m.forced[key]
+	delete(m.forced, key)
+	return forced
+}
@@ -0,0 +1,187 @@
+package workqueue
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freshwebio/k8s-kong-api/metrics"
+	"github.com/freshwebio/k8s-kong-api/syncerror"
+	"github.com/freshwebio/k8s-kong-api/throttle"
+)
+
+// Backoff provides how failed reconciles are retried, the delay before a retry starts at the base delay
+// and doubles with every consecutive failure of the same key until it reaches the max delay.
+type Backoff struct {
+	// The delay before the first retry of a failed reconcile.
+	BaseDelay time.Duration
+	// The longest a failed reconcile waits to be retried.
+	MaxDelay time.Duration
+	// The number of consecutive failed reconciles after which a key is no longer retried, 0 for no limit.
+	// A key that has been given up on is reconciled again with the next event or resync for it.
+	MaxAttempts int
+}
+
+// DefaultBackoff provides the backoff used when none is configured.
+var DefaultBackoff = Backoff{BaseDelay: time.Second, MaxDelay: 5 * time.Minute}
+
+// Delay provides the delay before the retry following the provided number of consecutive failures.
+func (b Backoff) Delay(failures int) time.Duration {
+	delay := b.BaseDelay
+	for i := 1; i < failures && delay < b.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > b.MaxDelay {
+		return b.MaxDelay
+	}
+	return delay
+}
+
+// Lets us know whether a key that has failed the provided number of consecutive times has been given up on.
+func (b Backoff) exhausted(failures int) bool {
+	return b.MaxAttempts > 0 && failures >= b.MaxAttempts
+}
+
+// Queue provides a work queue of the keys of the resources a controller reconciles.
+// The reconcile for a key always works from the latest state of the resource rather than
+// the event that queued it, so a key queued any number of times before it's reconciled is only
+// reconciled once and missed or reordered watch events can't leave kong behind.
+// Reconciles are handed over to the limiter under the limiter key provided along with the resource key
+// so they are bound by the same per-namespace limits as the rest of the controller's work.
+// Failed reconciles are queued again following the backoff of the queue, apart from validation errors
+// which won't go away until the resource is changed.
+type Queue struct {
+	controller string
+	limiter    *throttle.Limiter
+	backoff    Backoff
+	reconcile  func(key string) error
+	mu         sync.Mutex
+	items      map[string]*item
+	shutDown   bool
+}
+
+// Provides the state of a single key in the queue.
+type item struct {
+	namespace  string
+	limiterKey string
+	// The key is waiting on the limiter to be reconciled.
+	queued bool
+	// The key is being reconciled.
+	active bool
+	// The key was added again while it was being reconciled.
+	dirty    bool
+	failures int
+	retry    *time.Timer
+}
+
+// New creates a new instance of a queue for the controller with the provided name
+// reconciling keys with the provided function through the provided limiter,
+// failed reconciles are retried following the provided backoff.
+func New(controller string, limiter *throttle.Limiter, backoff Backoff, reconcile func(key string) error) *Queue {
+	if backoff.BaseDelay <= 0 {
+		backoff.BaseDelay = DefaultBackoff.BaseDelay
+	}
+	if backoff.MaxDelay < backoff.BaseDelay {
+		backoff.MaxDelay = backoff.BaseDelay
+	}
+	return &Queue{controller: controller, limiter: limiter, backoff: backoff, reconcile: reconcile,
+		items: make(map[string]*item)}
+}
+
+// Add queues the resource with the provided key in the provided namespace to be reconciled under
+// the provided limiter key. Keys that are already waiting to be reconciled aren't queued again,
+// keys that are being reconciled are reconciled again once the current reconcile has finished.
+// Adding a key that's waiting to be retried reconciles it straight away.
+func (q *Queue) Add(namespace string, limiterKey string, key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shutDown {
+		return
+	}
+	it, exists := q.items[key]
+	if !exists {
+		it = &item{}
+		q.items[key] = it
+	}
+	if it.retry != nil {
+		it.retry.Stop()
+		it.retry = nil
+	}
+	if it.queued {
+		metrics.EventsMerged.WithLabelValues(q.controller, strings.SplitN(key, "/", 2)[0]).Inc()
+		return
+	}
+	it.namespace, it.limiterKey = namespace, limiterKey
+	if it.active {
+		it.dirty = true
+		return
+	}
+	q.dispatch(key, it)
+}
+
+// ShutDown stops the queue taking any more keys and cancels the pending retries,
+// reconciles that are already queued are still carried out.
+func (q *Queue) ShutDown() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.shutDown = true
+	for _, it := range q.items {
+		if it.retry != nil {
+			it.retry.Stop()
+			it.retry = nil
+		}
+	}
+}
+
+// Hands the reconcile of the provided key over to the limiter, the lock must be held.
+func (q *Queue) dispatch(key string, it *item) {
+	it.queued = true
+	q.limiter.Dispatch(it.namespace, it.limiterKey, func() {
+		q.process(key, it)
+	})
+}
+
+// Reconciles the provided key, scheduling a retry when the reconcile fails
+// and queueing the key again when it was added while it was being reconciled.
+// Keys that have used up their attempts are dropped until they are added again.
+func (q *Queue) process(key string, it *item) {
+	q.mu.Lock()
+	it.queued, it.active = false, true
+	q.mu.Unlock()
+	err := q.reconcile(key)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	it.active = false
+	if err == nil || syncerror.Classify(err) == syncerror.ClassValidation {
+		it.failures = 0
+	} else {
+		it.failures++
+	}
+	if it.failures > 0 && q.backoff.exhausted(it.failures) {
+		log.Printf("Giving up on %v after %v failed attempts, it will be reconciled again with its next event or resync",
+			key, it.failures)
+		metrics.SyncRetriesExhaustedTotal.WithLabelValues(q.controller).Inc()
+		it.failures = 0
+	}
+	switch {
+	case it.dirty && !q.shutDown:
+		// The resource has changed since the reconcile started so it's reconciled again straight away.
+		it.dirty = false
+		q.dispatch(key, it)
+	case it.failures > 0 && !q.shutDown:
+		metrics.SyncRetriesTotal.WithLabelValues(q.controller).Inc()
+		it.retry = time.AfterFunc(q.backoff.Delay(it.failures), func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			if q.shutDown || it.retry == nil || it.queued || it.active {
+				return
+			}
+			it.retry = nil
+			q.dispatch(key, it)
+		})
+	default:
+		it.dirty = false
+		delete(q.items, key)
+	}
+}